@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	apiparser "api-recommender/api-parser"
+)
+
+// catalog returns the APIs the tenant in ctx may see. Everything that lists
+// or picks APIs goes through it, so a restricted tenant is never recommended
+// an API outside its scope.
+func (s *ChatService) catalog(ctx context.Context) []apiparser.APIDoc {
+	apis := s.APIs()
+	tenant := tenantFrom(ctx)
+	if !s.cfg.Access.Restricted() || tenant == "" {
+		return apis
+	}
+
+	var out []apiparser.APIDoc
+	for _, a := range apis {
+		if s.cfg.Access.Allows(tenant, a.Name, a.Path) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// APIs returns the whole catalog. The slice is shared with concurrent
+// callers and must not be modified.
+func (s *ChatService) APIs() []apiparser.APIDoc {
+	if apis := s.apis.Load(); apis != nil {
+		return *apis
+	}
+	return nil
+}
+
+// SetAPIs replaces the catalog. Callers that already loaded the catalog
+// keep the one they have; later ones see apis. apis is copied, so the
+// caller may go on using it.
+func (s *ChatService) SetAPIs(apis []apiparser.APIDoc) {
+	apis = slices.Clone(apis)
+	s.apis.Store(&apis)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+var contentMethods = []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+
+// handleContent serves the admin CRUD endpoints for one kind of tunable
+// content. The collection path lists items; /{key} reads, writes or deletes
+// one. Writes and deletes must name the version they were based on.
+func (s *server) handleContent(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, rest, _ := strings.Cut(r.URL.Path, "/admin/"+kind)
+		key := strings.Trim(rest, "/")
+		store := s.service.content
+		if err := store.Refresh(r.Context()); err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		if key == "" {
+			if r.Method != http.MethodGet {
+				writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed", nil)
+				return
+			}
+			items, err := store.List(kind)
+			if err != nil {
+				writeServiceError(w, r, err)
+				return
+			}
+			writeJSON(w, map[string]any{"items": items})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			item, err := store.Get(kind, key)
+			if err != nil {
+				writeServiceError(w, r, err)
+				return
+			}
+			writeJSON(w, item)
+		case http.MethodPut:
+			var req struct {
+				Value   json.RawMessage `json:"value"`
+				Version int             `json:"version"`
+			}
+			if !decodeBody(w, r, &req) {
+				return
+			}
+			v := &requestValidator{}
+			if len(req.Value) == 0 {
+				v.add("value", "is required")
+			}
+			if req.Version < 0 {
+				v.add("version", "must be a non-negative integer")
+			}
+			if v.failed(w, r) {
+				return
+			}
+
+			item, err := store.Put(r.Context(), kind, key, req.Value, req.Version)
+			if err != nil {
+				writeServiceError(w, r, err)
+				return
+			}
+			writeJSON(w, item)
+		case http.MethodDelete:
+			v := &requestValidator{}
+			version := v.version("version", r.URL.Query().Get("version"))
+			if v.failed(w, r) {
+				return
+			}
+			if err := store.Delete(r.Context(), kind, key, version); err != nil {
+				writeServiceError(w, r, err)
+				return
+			}
+			writeJSON(w, map[string]any{"kind": kind, "key": key, "status": "deleted"})
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package anonymize
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for sensitive values.
+const (
+	MaskedWallet = "<wallet>"
+	MaskedVPA    = "<vpa>"
+	MaskedID     = "<id>"
+	MaskedNumber = "<number>"
+)
+
+var (
+	reUUID   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	reHexKey = regexp.MustCompile(`\b0x[0-9a-fA-F]{16,}\b`)
+	reVPA    = regexp.MustCompile(`\b[a-zA-Z0-9._-]{2,}@[a-zA-Z][a-zA-Z0-9.-]{1,}\b`)
+	// Long opaque tokens (base58/base64 style addresses, hashes, signatures)
+	// that contain both letters and digits.
+	reOpaque = regexp.MustCompile(`\b[A-Za-z0-9]{20,}\b`)
+	// Account numbers, phone numbers and similar long digit runs.
+	reDigits = regexp.MustCompile(`\b\d{9,}\b`)
+)
+
+// Text masks wallet addresses, VPAs, identifiers and long account-like numbers
+// in free text. It is deterministic so the same input always masks the same way.
+func Text(s string) string {
+	s = reUUID.ReplaceAllString(s, MaskedID)
+	s = reHexKey.ReplaceAllString(s, MaskedWallet)
+	s = reVPA.ReplaceAllString(s, MaskedVPA)
+	s = reOpaque.ReplaceAllStringFunc(s, func(m string) string {
+		if !hasLetterAndDigit(m) {
+			return m
+		}
+		return MaskedWallet
+	})
+	s = reDigits.ReplaceAllString(s, MaskedNumber)
+	return s
+}
+
+// Strings masks every element of values, returning a new slice.
+func Strings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = Text(v)
+	}
+	return out
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.IndexFunc(s, func(r rune) bool { return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') }) >= 0
+}
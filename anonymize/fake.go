@@ -0,0 +1,186 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Faker replaces wallet addresses, VPAs and identifiers with fakes of the
+// same shape: digits stay digits, hex stays hex and a VPA keeps its handle.
+// The same value always gets the same fake from one Faker, so ids that tie
+// parts of a payload together still match after faking; fakes from
+// Fakers with different keys are unrelated.
+type Faker struct {
+	key []byte
+}
+
+// NewFaker returns a Faker whose fakes are derived from secret and scope,
+// e.g. a chat session id.
+func NewFaker(secret []byte, scope string) *Faker {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(scope))
+	return &Faker{key: mac.Sum(nil)}
+}
+
+// sensitiveKeys are payload fields whose values are faked whatever they
+// look like. camelCase keys ending in Id, Address or Signature are
+// sensitive too.
+var sensitiveKeys = map[string]bool{
+	"id": true, "vpa": true, "address": true, "publickey": true, "signature": true,
+	"parentid": true, "netid": true, "securetoken": true, "idempotencykey": true,
+	"serialnumber": true, "password": true, "certificate": true,
+}
+
+func sensitiveKey(key string) bool {
+	if sensitiveKeys[strings.ToLower(key)] {
+		return true
+	}
+	for _, suffix := range []string{"Id", "ID", "Address", "Signature"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reXMLAttr matches an attribute of an XML element.
+var reXMLAttr = regexp.MustCompile(`([A-Za-z_][\w.:-]*)(\s*=\s*)"([^"]*)"`)
+
+// Text fakes the values Text would mask.
+func (f *Faker) Text(s string) string {
+	s = reUUID.ReplaceAllStringFunc(s, f.value)
+	s = reHexKey.ReplaceAllStringFunc(s, f.value)
+	s = reVPA.ReplaceAllStringFunc(s, f.vpa)
+	s = reOpaque.ReplaceAllStringFunc(s, func(m string) string {
+		if !hasLetterAndDigit(m) {
+			return m
+		}
+		return f.value(m)
+	})
+	return reDigits.ReplaceAllStringFunc(s, f.value)
+}
+
+// Payload fakes a JSON or XML payload, or text with one pasted in. Values
+// of sensitive fields are faked even when they are short; everything else
+// is faked as by Text. JSON is re-indented.
+func (f *Faker) Payload(raw string) string {
+	body := strings.TrimSpace(raw)
+	if strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+		var doc any
+		if err := json.Unmarshal([]byte(body), &doc); err == nil {
+			out, err := json.MarshalIndent(f.walk("", doc), "", "  ")
+			if err == nil {
+				return string(out)
+			}
+		}
+	}
+	if strings.HasPrefix(body, "<") {
+		raw = reXMLAttr.ReplaceAllStringFunc(raw, func(m string) string {
+			parts := reXMLAttr.FindStringSubmatch(m)
+			if !sensitiveKey(parts[1]) || strings.HasPrefix(parts[1], "xmlns") || parts[3] == "" {
+				return m
+			}
+			return parts[1] + parts[2] + `"` + f.field(parts[3]) + `"`
+		})
+	}
+	return f.Text(raw)
+}
+
+func (f *Faker) walk(key string, v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = f.walk(k, child)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = f.walk(key, child)
+		}
+		return t
+	case string:
+		if t != "" && sensitiveKey(key) {
+			return f.field(t)
+		}
+		return f.Text(t)
+	default:
+		return v
+	}
+}
+
+// field fakes the value of a sensitive field.
+func (f *Faker) field(v string) string {
+	if reVPA.MatchString(v) {
+		return reVPA.ReplaceAllStringFunc(v, f.vpa)
+	}
+	return f.value(v)
+}
+
+// vpa fakes the user part of a VPA and keeps its handle, which names the
+// payment provider rather than the person.
+func (f *Faker) vpa(v string) string {
+	user, handle, _ := strings.Cut(v, "@")
+	return f.value(user) + "@" + handle
+}
+
+// value replaces each letter and digit of v with one derived from v,
+// keeping case, hex-ness and punctuation.
+func (f *Faker) value(v string) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write([]byte(v))
+	stream := mac.Sum(nil)
+	next := func(i int) int {
+		// Stretch the stream for values longer than one digest
+		for i >= len(stream) {
+			mac.Write(stream)
+			stream = append(stream, mac.Sum(nil)...)
+		}
+		return int(stream[i])
+	}
+
+	prefix, rest := "", v
+	if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+		prefix, rest = v[:2], v[2:]
+	}
+	hex := isHex(rest)
+
+	out := []byte(rest)
+	for i := range out {
+		c := out[i]
+		switch {
+		case c >= '0' && c <= '9':
+			out[i] = '0' + byte(next(i)%10)
+		case hex && c >= 'a' && c <= 'f':
+			out[i] = 'a' + byte(next(i)%6)
+		case hex && c >= 'A' && c <= 'F':
+			out[i] = 'A' + byte(next(i)%6)
+		case c >= 'a' && c <= 'z':
+			out[i] = 'a' + byte(next(i)%26)
+		case c >= 'A' && c <= 'Z':
+			out[i] = 'A' + byte(next(i)%26)
+		}
+	}
+	// A leading zero would make a fake account or phone number implausible
+	if len(out) > 1 && out[0] == '0' && v[len(prefix)] != '0' {
+		out[0] = '1' + byte(next(0)%9)
+	}
+	return prefix + string(out)
+}
+
+// isHex reports whether s, ignoring dashes, is made of hex digits only.
+func isHex(s string) bool {
+	found := false
+	for _, r := range s {
+		switch {
+		case r == '-':
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'f', r >= 'A' && r <= 'F':
+			found = true
+		default:
+			return false
+		}
+	}
+	return found
+}
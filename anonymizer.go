@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+
+	"api-recommender/anonymize"
+	"api-recommender/config"
+)
+
+type anonymizeKey struct{}
+
+// withAnonymize asks for the chat turn run with ctx to replace VPAs, wallet
+// addresses and ids in the user's message and attachment with fakes before
+// they are stored, sent to the model or echoed back.
+func withAnonymize(ctx context.Context) context.Context {
+	return context.WithValue(ctx, anonymizeKey{}, true)
+}
+
+func anonymizeRequested(ctx context.Context) bool {
+	on, _ := ctx.Value(anonymizeKey{}).(bool)
+	return on
+}
+
+// anonymizationKey returns the key fakes are derived from: the hash of
+// ANONYMIZE_KEY when set, else a random key. A random key gives other
+// replicas, and this one after a restart, different fakes for the same
+// session, so clusters must set ANONYMIZE_KEY.
+func anonymizationKey(cluster config.Cluster) ([]byte, error) {
+	if secret := os.Getenv("ANONYMIZE_KEY"); secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		return sum[:], nil
+	}
+	if cluster.Enabled {
+		return nil, errors.New("cluster.enabled needs ANONYMIZE_KEY so every replica fakes a session's values alike")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate anonymization key: %w", err)
+	}
+	return key, nil
+}
+
+// anonymizeTurn fakes the sensitive values of a turn's input. Fakes are
+// consistent within a session, so an id repeated in a later message gets
+// the same fake; see anonymizationKey for when they survive restarts.
+func (s *ChatService) anonymizeTurn(ctx context.Context, sessionID, userInput string) (context.Context, string) {
+	faker := anonymize.NewFaker(s.fakeKey, sessionID)
+	if a := attachmentFrom(ctx); a != nil {
+		ctx = withAttachment(ctx, &Attachment{Name: a.Name, Content: faker.Payload(a.Content)})
+	}
+	return ctx, faker.Payload(userInput)
+}
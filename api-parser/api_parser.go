@@ -2,8 +2,16 @@ package apiparser
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -11,6 +19,86 @@ type APIField struct {
 	Name        string `json:"name"`
 	Type        string `json:"type"`
 	Description string `json:"description"`
+	// Required fields must be set in every request.
+	Required bool `json:"required,omitempty"`
+	// Enum lists the only values the field may take, when it is limited.
+	Enum []string `json:"enum,omitempty"`
+	// Example is a value the docs give for the field, one that works
+	// against the sandbox.
+	Example string `json:"example,omitempty"`
+	// Default is the value a required field takes when the request gives
+	// none.
+	Default string `json:"default,omitempty"`
+	// In is where the field is sent: InPath, InQuery or InHeader for
+	// parameters, and InBody, or empty, for a field of the payload.
+	In string `json:"in,omitempty"`
+}
+
+// Where a field is sent.
+const (
+	InBody   = "body"
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+)
+
+// Location returns where f is sent, InBody unless it is a parameter.
+func (f APIField) Location() string {
+	if f.In == "" {
+		return InBody
+	}
+	return f.In
+}
+
+// IsParameter reports whether f is sent in the URL or a header rather
+// than the payload.
+func (f APIField) IsParameter() bool {
+	return f.Location() != InBody
+}
+
+// fieldLocation reads where a field is sent, as docs write it, e.g. "Path"
+// or "formData". It returns "" and false for ones the catalog doesn't
+// know.
+func fieldLocation(in string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(in)) {
+	case "", InBody, "formdata", "form":
+		return "", true
+	case InPath:
+		return InPath, true
+	case InQuery:
+		return InQuery, true
+	case InHeader:
+		return InHeader, true
+	}
+	return "", false
+}
+
+// BodyFields returns the fields of the payload, leaving parameters out.
+func BodyFields(fields []APIField) []APIField {
+	var body []APIField
+	for _, f := range fields {
+		if !f.IsParameter() {
+			body = append(body, f)
+		}
+	}
+	return body
+}
+
+// APIResponse is one documented response of an API.
+type APIResponse struct {
+	// Status is the HTTP status code, e.g. "200", or "default" for any
+	// other.
+	Status      string     `json:"status"`
+	Description string     `json:"description,omitempty"`
+	Fields      []APIField `json:"fields,omitempty"`
+}
+
+// APIError is an error code an API documents.
+type APIError struct {
+	Code    string `json:"code"`
+	Meaning string `json:"meaning"`
+	// Retryable errors may go away when the same request is sent again.
+	Retryable bool `json:"retryable"`
 }
 
 type APIDoc struct {
@@ -19,42 +107,419 @@ type APIDoc struct {
 	Method      string     `json:"method"`
 	Description string     `json:"description"`
 	Fields      []APIField `json:"fields"`
+	// Version tells apart versions of an API sharing its name, e.g. "v2".
+	Version string `json:"version,omitempty"`
+	// Deprecated APIs are only recommended when asked for by name or path.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// ReplacedBy names the successor of a deprecated API, by name or path.
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// Tags are the groups the API belongs to, e.g. "Tokenization" or
+	// "Settlement".
+	Tags []string `json:"tags,omitempty"`
+	// Responses are what the API answers with, by status.
+	Responses []APIResponse `json:"responses,omitempty"`
+	// Errors are the error codes the API may answer with.
+	Errors []APIError `json:"errors,omitempty"`
+}
+
+// Error returns the error of the API with code, ignoring case.
+func (a APIDoc) Error(code string) (APIError, bool) {
+	for _, e := range a.Errors {
+		if strings.EqualFold(e.Code, code) {
+			return e, true
+		}
+	}
+	return APIError{}, false
 }
 
+// HasTag reports whether the API is in the group tag, ignoring case.
+func (a APIDoc) HasTag(tag string) bool {
+	for _, t := range a.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags lists the groups of apis in the order they first appear.
+func Tags(apis []APIDoc) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, a := range apis {
+		for _, t := range a.Tags {
+			if key := strings.ToLower(t); !seen[key] {
+				seen[key] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// tagList cleans up the tags of an API: trimmed, without blanks and without
+// repeats.
+func tagList(tags ...string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if key := strings.ToLower(t); t != "" && !seen[key] {
+			seen[key] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// VersionedName is the API's name followed by its version, if it has one,
+// e.g. "Manage v2".
+func (a APIDoc) VersionedName() string {
+	if a.Version == "" {
+		return a.Name
+	}
+	return a.Name + " " + a.Version
+}
+
+// Refers reports whether ref is the API's name, versioned name or path.
+func (a APIDoc) Refers(ref string) bool {
+	ref = strings.Join(strings.Fields(ref), " ")
+	return ref != "" && (strings.EqualFold(ref, a.Name) || strings.EqualFold(ref, a.VersionedName()) || strings.EqualFold(ref, a.Path))
+}
+
+// Find returns the API in apis that ref names. When ref is the name of
+// several versions, a current one is preferred to a deprecated one.
+func Find(apis []APIDoc, ref string) (APIDoc, bool) {
+	var found APIDoc
+	ok := false
+	for _, a := range apis {
+		if !a.Refers(ref) {
+			continue
+		}
+		if !a.Deprecated {
+			return a, true
+		}
+		if !ok {
+			found, ok = a, true
+		}
+	}
+	return found, ok
+}
+
+// ParseAPIDocs parses the API docs at path: an OpenAPI 3.0 or Swagger 2.0
+// document in YAML or JSON, a Postman v2.1 collection, docs in the YAML
+// format for a .yaml or .yml file, gRPC services in a .proto file or a
+// FileDescriptorSet (.pb, .binpb, .protoset or .desc), or else markdown
+// docs. A directory is walked for files of these extensions and .md
+// files, whose APIs are merged.
 func ParseAPIDocs(path string) ([]APIDoc, error) {
-	file, err := os.Open(path)
+	return parseDocsPath(path, false)
+}
+
+// ParseAPIDocsStrict parses the API docs at path like ParseAPIDocs, but
+// reports what ParseAPIDocs would skip in markdown docs: malformed headers,
+// APIs without a path or method, field lines without a name or type, and
+// any other line it doesn't understand. Every problem in every file is
+// listed in a *DiagnosticsError.
+func ParseAPIDocsStrict(path string) ([]APIDoc, error) {
+	return parseDocsPath(path, true)
+}
+
+func parseDocsPath(path string, strict bool) ([]APIDoc, error) {
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	if info.IsDir() {
+		return parseDocsDir(path, strict)
+	}
+	apis, err := parseDocsFile(path, strict)
+	if err != nil && strict {
+		return nil, &DiagnosticsError{Diagnostics: diagnose(path, err)}
+	}
+	return apis, err
+}
+
+// errNotSpec is returned for JSON files that are neither an OpenAPI or
+// Swagger spec nor a Postman collection.
+var errNotSpec = fmt.Errorf("%w: JSON docs must be an OpenAPI or Swagger spec or a Postman collection", ErrInvalidDocs)
+
+// isDocsFile reports whether a file named name is parsed as docs in a
+// docs directory.
+func isDocsFile(name string) bool {
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".md", ext == ".yaml", ext == ".yml", ext == ".json", ext == ".proto", descriptorSetExts[ext]:
+		return true
+	}
+	return false
+}
+
+// parseDocsDir parses the docs files below dir, in lexical order, skipping
+// hidden files and directories and logging every file it skips. An API
+// defined twice, by name or by method and path, is an error naming both
+// files. Strict parsing goes on past files with problems to report them all.
+func parseDocsDir(dir string, strict bool) ([]APIDoc, error) {
+	var apis []APIDoc
+	var dupes []string
+	var diags []Diagnostic
+	defined := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		file, err := filepath.Rel(dir, path)
+		if err != nil {
+			file = path
+		}
+		hidden := path != dir && strings.HasPrefix(d.Name(), ".")
+		switch {
+		case d.IsDir() && hidden:
+			log.Printf("API docs: skipping hidden directory %s", file)
+			return filepath.SkipDir
+		case d.IsDir():
+			return nil
+		case hidden:
+			log.Printf("API docs: skipping hidden file %s", file)
+			return nil
+		case !isDocsFile(path):
+			log.Printf("API docs: skipping %s: not a docs file", file)
+			return nil
+		}
+		parsed, err := parseDocsFile(path, strict)
+		if errors.Is(err, errNotSpec) {
+			log.Printf("API docs: skipping %s: not an OpenAPI or Swagger spec or a Postman collection", file)
+			return nil
+		}
+		if err != nil && strict {
+			diags = append(diags, diagnose(file, err)...)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, a := range parsed {
+			name, route := strings.ToLower(a.VersionedName()), a.Method+" "+a.Path
+			dupe := ""
+			if first, ok := defined[name]; ok {
+				dupe = fmt.Sprintf("%q is defined in %s and %s", a.VersionedName(), first, file)
+			} else if first, ok := defined[route]; ok {
+				dupe = fmt.Sprintf("%s is defined in %s and %s", route, first, file)
+			}
+			if dupe != "" {
+				dupes = append(dupes, dupe)
+				diags = append(diags, Diagnostic{File: file, Reason: dupe})
+				continue
+			}
+			defined[name], defined[route] = file, file
+			apis = append(apis, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if strict && len(diags) > 0 {
+		return nil, &DiagnosticsError{Diagnostics: diags}
+	}
+	if len(dupes) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDocs, strings.Join(dupes, "; "))
+	}
+	if len(apis) == 0 {
+		return nil, fmt.Errorf("%w: no APIs in the .md, .yaml, .yml, .json or protobuf files of %s", ErrInvalidDocs, dir)
+	}
+	return apis, nil
+}
+
+// parseDocsFile parses one docs file, picking the parser by content and
+// extension.
+func parseDocsFile(path string, strict bool) ([]APIDoc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDocs(path, data, strict)
+}
+
+// parseDocs parses docs read from the file or URL named name. Only the
+// markdown parser skips lines; strict parsing makes those errors.
+func parseDocs(name string, data []byte, strict bool) ([]APIDoc, error) {
+	switch specKind(data) {
+	case "openapi":
+		return ParseOpenAPI(bytes.NewReader(data))
+	case "swagger":
+		return ParseSwagger(bytes.NewReader(data))
+	case "postman":
+		return ParsePostman(bytes.NewReader(data))
+	}
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".yaml", ext == ".yml":
+		return ParseYAMLDocs(bytes.NewReader(data))
+	case ext == ".proto":
+		return ParseProto(bytes.NewReader(data))
+	case descriptorSetExts[ext]:
+		return ParseDescriptorSet(bytes.NewReader(data))
+	case ext == ".json":
+		return nil, errNotSpec
+	}
+	apis, diags, err := parseMarkdown(bytes.NewReader(data))
+	if err == nil && strict && len(diags) > 0 {
+		return nil, &DiagnosticsError{Diagnostics: diags}
+	}
+	return apis, err
+}
+
+// specKind tells a YAML or JSON spec by its top-level version key, or a
+// Postman collection by its schema URL: "openapi", "swagger", "postman", or
+// "" for anything else.
+func specKind(data []byte) string {
+	var head struct {
+		OpenAPI string `json:"openapi" yaml:"openapi"`
+		Swagger string `json:"swagger" yaml:"swagger"`
+		Info    struct {
+			Schema string `json:"schema" yaml:"schema"`
+		} `json:"info" yaml:"info"`
+	}
+	if decodeSpec(data, &head) != nil {
+		return ""
+	}
+	switch {
+	case head.OpenAPI != "":
+		return "openapi"
+	case head.Swagger != "":
+		return "swagger"
+	case strings.HasPrefix(head.Info.Schema, postmanSchema):
+		return "postman"
+	}
+	return ""
+}
 
+// ParseAPIDocsFrom parses markdown API docs from r. Lines it can't read
+// are skipped.
+func ParseAPIDocsFrom(r io.Reader) ([]APIDoc, error) {
+	apis, _, err := parseMarkdown(r)
+	return apis, err
+}
+
+var (
+	reHeader     = regexp.MustCompile(`^###\s*(.+)`)
+	rePath       = regexp.MustCompile(`\*\*Path:\*\*\s*(.+)`)
+	reMethod     = regexp.MustCompile(`\*\*Method:\*\*\s*(.+)`)
+	reDesc       = regexp.MustCompile(`\*\*Description:\*\*\s*(.+)`)
+	reVersion    = regexp.MustCompile(`(?i)\*\*Version:\*\*\s*(.+)`)
+	reDeprecated = regexp.MustCompile(`(?i)\*\*Deprecated:\*\*\s*(.+)`)
+	reReplacedBy = regexp.MustCompile(`(?i)\*\*Replaced by:\*\*\s*(.+)`)
+	reTags       = regexp.MustCompile(`(?i)\*\*(?:Tags|Groups?|Categor(?:y|ies)):\*\*\s*(.+)`)
+	reField      = regexp.MustCompile(`-\s*name:\s*([^\s]+)\s*type:\s*([^\s]+)\s*description:\s*(.+)`)
+	// reRequired is the required marker of a field line, which may stand
+	// anywhere after its name.
+	reRequired = regexp.MustCompile(`(?i)\s*\brequired:\s*(\S*)`)
+	// reAllowed is the allowed values marker of a field line, e.g.
+	// allowed: ACTIVE,LOCKED or allowed: [ACTIVE, LOCKED].
+	reAllowed = regexp.MustCompile(`(?i)\s*\ballowed:\s*(\[[^\]]*\]|\S*)`)
+	// reExample is the example value of a field line, quoted when it has
+	// spaces, e.g. example: GB2030 or example: "Gold Bond 2030".
+	reExample = regexp.MustCompile(`(?i)\s*\bexample:\s*("[^"]*"|'[^']*'|\S*)`)
+	// reDefault is the default value of a field line, written like an
+	// example.
+	reDefault = regexp.MustCompile(`(?i)\s*\bdefault:\s*("[^"]*"|'[^']*'|\S*)`)
+	// reIn is where a field line's field is sent, e.g. in: query; fields
+	// without one are in the body. Like the other keys of the line it
+	// follows two spaces, so "stored in: ..." in a description isn't it.
+	reIn = regexp.MustCompile(`(?i)\s{2,}in:\s*(\S*)`)
+	// reResponse starts a response section, e.g. **Response 200:** Accepted.
+	// Without a status it is the 200 response.
+	reResponse = regexp.MustCompile(`(?i)^\*\*Response(?:\s+(\S+?))?:\*\*\s*(.*)`)
+	reStatus   = regexp.MustCompile(`(?i)^(?:[1-5]\d\d|[1-5]XX|default)$`)
+	// reErrorKey finds the keys of an error line, e.g.
+	// - code: E403  meaning: Not allowed to issue  retryable: no
+	reErrorKey = regexp.MustCompile(`(?i)\b(code|meaning|retryable):\s*`)
+	// reTitle is a document or section title above the API headers.
+	reTitle   = regexp.MustCompile(`^#{1,2}\s+\S`)
+	reBoldKey = regexp.MustCompile(`^\*\*([^*]+?):?\*\*`)
+)
+
+// parseMarkdown parses markdown API docs, also returning what strict
+// parsing reports: the lines it skipped and APIs without a path or method.
+func parseMarkdown(r io.Reader) ([]APIDoc, []Diagnostic, error) {
 	var apis []APIDoc
+	var diags []Diagnostic
 	var current APIDoc
-	var inFields bool
+	var inFields, inErrors, inDesc bool
+	// table is the field table being read, from its header row on.
+	var table *fieldTable
+	// response is the index of the response whose fields are being read,
+	// or -1.
+	response := -1
+	var header, lineNo int
+	names := map[string]int{}
 
-	scanner := bufio.NewScanner(file)
-	reHeader := regexp.MustCompile(`^###\s*(.+)`)
-	rePath := regexp.MustCompile(`\*\*Path:\*\*\s*(.+)`)
-	reMethod := regexp.MustCompile(`\*\*Method:\*\*\s*(.+)`)
-	reDesc := regexp.MustCompile(`\*\*Description:\*\*\s*(.+)`)
-	reField := regexp.MustCompile(`-\s*name:\s*([^\s]+)\s*type:\s*([^\s]+)\s*description:\s*(.+)`)
+	skip := func(format string, args ...any) {
+		diags = append(diags, Diagnostic{Line: lineNo, Reason: fmt.Sprintf(format, args...)})
+	}
+	finish := func() {
+		if current.Name == "" {
+			return
+		}
+		// Versions of an API share its name
+		key := strings.ToLower(current.VersionedName())
+		if first, ok := names[key]; ok {
+			diags = append(diags, Diagnostic{Line: header, Reason: fmt.Sprintf("api %q is already defined on line %d", current.VersionedName(), first)})
+		} else {
+			names[key] = header
+		}
+		if current.Path == "" {
+			diags = append(diags, Diagnostic{Line: header, Reason: fmt.Sprintf("api %q has no **Path:**", current.Name)})
+		} else if !strings.HasPrefix(current.Path, "/") {
+			diags = append(diags, Diagnostic{Line: header, Reason: fmt.Sprintf("api %q needs a path starting with /", current.Name)})
+		}
+		if current.Method == "" {
+			diags = append(diags, Diagnostic{Line: header, Reason: fmt.Sprintf("api %q has no **Method:**", current.Name)})
+		} else if !validMethod(strings.ToUpper(current.Method)) {
+			diags = append(diags, Diagnostic{Line: header, Reason: fmt.Sprintf("api %q has method %q; use one of %s", current.Name, current.Method, strings.Join(httpMethods, ", "))})
+		}
+		apis = append(apis, current)
+	}
 
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
+		lineNo++
 		line := strings.TrimSpace(scanner.Text())
+		// Only the line right after the description may continue it
+		continuesDesc := inDesc
+		inDesc = false
 
-		// Skip empty lines or separators
-		if line == "" || strings.HasPrefix(line, "---") {
+		// Skip empty lines or separators; a blank line ends a table
+		if line == "" {
+			table = nil
+			continue
+		}
+		if strings.HasPrefix(line, "---") {
 			continue
 		}
 
 		// New API section
 		if matches := reHeader.FindStringSubmatch(line); matches != nil {
 			// Save previous API if it exists
-			if current.Name != "" {
-				apis = append(apis, current)
-			}
+			finish()
 			current = APIDoc{Name: matches[1]}
-			inFields = false
+			inFields, inErrors, response, table = false, false, -1, nil
+			switch {
+			case strings.HasPrefix(line, "####"):
+				skip("malformed header %q: API headers are ### followed by the name", line)
+			case !strings.HasPrefix(line, "### "):
+				skip("malformed header %q: put a space after ###", line)
+			}
+			header = lineNo
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if !reTitle.MatchString(line) {
+				skip("malformed header %q: API headers are ### followed by the name", line)
+			}
+			continue
+		}
+		if current.Name == "" {
+			skip("line outside an API section; start one with ### and the API name")
 			continue
 		}
 
@@ -70,40 +535,254 @@ func ParseAPIDocs(path string) ([]APIDoc, error) {
 
 		if matches := reDesc.FindStringSubmatch(line); matches != nil {
 			current.Description = strings.TrimSpace(matches[1])
+			inDesc = true
+			continue
+		}
+
+		if matches := reVersion.FindStringSubmatch(line); matches != nil {
+			current.Version = strings.TrimSpace(matches[1])
+			if strings.ContainsAny(current.Version, " \t") {
+				skip("**Version:** is %q; use one word, such as v2", current.Version)
+			}
+			continue
+		}
+
+		if matches := reDeprecated.FindStringSubmatch(line); matches != nil {
+			switch strings.ToLower(strings.TrimSpace(matches[1])) {
+			case "yes", "true":
+				current.Deprecated = true
+			case "no", "false":
+			default:
+				skip("**Deprecated:** is %q; use yes or no", strings.TrimSpace(matches[1]))
+			}
+			continue
+		}
+
+		if matches := reReplacedBy.FindStringSubmatch(line); matches != nil {
+			current.Deprecated = true
+			current.ReplacedBy = strings.TrimSpace(matches[1])
+			continue
+		}
+
+		if matches := reTags.FindStringSubmatch(line); matches != nil {
+			current.Tags = tagList(append(current.Tags, strings.Split(matches[1], ",")...)...)
 			continue
 		}
 
 		if strings.HasPrefix(line, "**Fields:**") {
-			inFields = true
+			inFields, inErrors, response, table = true, false, -1, nil
 			continue
 		}
 
-		if inFields && strings.HasPrefix(line, "-") {
+		if strings.HasPrefix(line, "**Errors:**") {
+			inFields, inErrors, response, table = false, true, -1, nil
+			continue
+		}
+
+		if inErrors && strings.HasPrefix(line, "-") {
+			e, problem := parseErrorLine(line)
+			switch _, dup := current.Error(e.Code); {
+			case problem != "":
+				skip("%s", problem)
+			case dup:
+				skip("error %s of api %q is listed twice", e.Code, current.Name)
+			default:
+				current.Errors = append(current.Errors, e)
+			}
+			continue
+		}
+
+		if matches := reResponse.FindStringSubmatch(line); matches != nil {
+			status := matches[1]
+			switch {
+			case status == "":
+				status = "200"
+			case !reStatus.MatchString(status):
+				skip("response status %q; use a status code such as 200, or default", status)
+			}
+			current.Responses = append(current.Responses, APIResponse{Status: strings.ToLower(status), Description: strings.TrimSpace(matches[2])})
+			inFields, inErrors, response, table = false, false, len(current.Responses)-1, nil
+			continue
+		}
+
+		if (inFields || response >= 0) && strings.HasPrefix(line, "|") {
+			fields := &current.Fields
+			if response >= 0 {
+				fields = &current.Responses[response].Fields
+			}
+			var problems []string
+			switch {
+			case table == nil:
+				table, problems = newFieldTable(line)
+			case reTableRule.MatchString(line):
+			default:
+				var field *APIField
+				if field, problems = table.row(line); field != nil {
+					*fields = append(*fields, *field)
+				}
+			}
+			for _, p := range problems {
+				skip("%s", p)
+			}
+			continue
+		}
+
+		if (inFields || response >= 0) && strings.HasPrefix(line, "-") {
+			// Field lines after a **Response:** line describe the response
+			fields := &current.Fields
+			if response >= 0 {
+				fields = &current.Responses[response].Fields
+			}
+			var required bool
+			if m := reRequired.FindStringSubmatchIndex(line); m != nil {
+				switch value := strings.ToLower(line[m[2]:m[3]]); value {
+				case "true", "yes":
+					required = true
+				case "false", "no":
+				default:
+					skip("required is %q; use true or false", line[m[2]:m[3]])
+				}
+				line = line[:m[0]] + "  " + line[m[1]:]
+			}
+			var in string
+			if m := reIn.FindStringSubmatchIndex(line); m != nil {
+				var ok bool
+				if in, ok = fieldLocation(line[m[2]:m[3]]); !ok {
+					skip("in is %q; use body, path, query or header", line[m[2]:m[3]])
+				}
+				line = line[:m[0]] + "  " + line[m[1]:]
+			}
+			var allowed []string
+			if m := reAllowed.FindStringSubmatchIndex(line); m != nil {
+				if allowed = enumList(line[m[2]:m[3]]); len(allowed) == 0 {
+					skip("allowed has no values; list them as allowed: A,B or allowed: [A, B]")
+				}
+				line = line[:m[0]] + "  " + line[m[1]:]
+			}
+			var example, def string
+			for _, marker := range []struct {
+				name  string
+				re    *regexp.Regexp
+				value *string
+			}{{"example", reExample, &example}, {"default", reDefault, &def}} {
+				m := marker.re.FindStringSubmatchIndex(line)
+				if m == nil {
+					continue
+				}
+				raw := line[m[2]:m[3]]
+				if *marker.value = strings.Trim(raw, `"'`); *marker.value == "" && !strings.HasPrefix(raw, `"`) && !strings.HasPrefix(raw, "'") {
+					skip("%s has no value; quote it when it has spaces, e.g. %s: \"Gold Bond\"", marker.name, marker.name)
+				} else if len(allowed) > 0 && !slices.Contains(allowed, *marker.value) {
+					skip("%s %q is not among the allowed values %s", marker.name, *marker.value, strings.Join(allowed, ", "))
+				}
+				line = line[:m[0]] + "  " + line[m[1]:]
+			}
+
 			// Try to parse full inline field definition (one-liner)
 			if matches := reField.FindStringSubmatch(line); matches != nil {
 				field := APIField{
 					Name:        matches[1],
 					Type:        matches[2],
-					Description: matches[3],
+					Description: strings.TrimSpace(matches[3]),
+					Required:    required,
+					Enum:        allowed,
+					Example:     example,
+					Default:     def,
+					In:          in,
 				}
-				current.Fields = append(current.Fields, field)
+				*fields = append(*fields, field)
 				continue
 			}
 
 			// Handle multiline field entries:
 			field := parseField(line)
 			if field != nil {
-				current.Fields = append(current.Fields, *field)
+				field.Required, field.Enum, field.Example, field.Default, field.In = required, allowed, example, def, in
 			}
+			switch {
+			case field == nil:
+				skip("field line has no name: use - name: <name>  type: <type>  description: <text>")
+			case field.Type == "":
+				skip("field %q has no type", field.Name)
+				*fields = append(*fields, *field)
+			default:
+				*fields = append(*fields, *field)
+			}
+			continue
 		}
+
+		if m := reBoldKey.FindStringSubmatch(line); m != nil {
+			skip("unknown key %q; use Path, Method, Description, Version, Tags, Fields, Response, Errors, Deprecated or Replaced by", m[1])
+			continue
+		}
+		if continuesDesc {
+			skip("the description of api %q goes on past its line; only the **Description:** line is read", current.Name)
+			inDesc = true
+			continue
+		}
+		skip("line not understood in api %q", current.Name)
 	}
 
 	// Add last API
-	if current.Name != "" {
-		apis = append(apis, current)
+	finish()
+
+	// An API's missing path or method is found at its end
+	slices.SortStableFunc(diags, func(a, b Diagnostic) int { return a.Line - b.Line })
+	return apis, diags, scanner.Err()
+}
+
+// parseErrorLine reads a line of an **Errors:** block, returning why it
+// can't be used when it can't.
+func parseErrorLine(line string) (APIError, string) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+	keys := reErrorKey.FindAllStringSubmatchIndex(line, -1)
+	var e APIError
+	for i, k := range keys {
+		end := len(line)
+		if i+1 < len(keys) {
+			end = keys[i+1][0]
+		}
+		value := strings.TrimSpace(line[k[1]:end])
+		switch strings.ToLower(line[k[2]:k[3]]) {
+		case "code":
+			e.Code = value
+		case "meaning":
+			e.Meaning = value
+		case "retryable":
+			switch strings.ToLower(value) {
+			case "yes", "true":
+				e.Retryable = true
+			case "no", "false":
+			default:
+				return e, fmt.Sprintf("retryable is %q; use yes or no", value)
+			}
+		}
+	}
+	switch {
+	case e.Code == "":
+		return e, "error line has no code: use - code: <code>  meaning: <text>  retryable: yes|no"
+	case strings.ContainsAny(e.Code, " \t"):
+		return e, fmt.Sprintf("error code %q has spaces", e.Code)
+	case e.Meaning == "":
+		return e, fmt.Sprintf("error %s has no meaning", e.Code)
 	}
+	return e, ""
+}
 
-	return apis, scanner.Err()
+// enumList reads the values of an allowed: marker, separated by commas or
+// bars and optionally in brackets or quotes.
+func enumList(raw string) []string {
+	raw = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), "["), "]")
+	var values []string
+	seen := map[string]bool{}
+	for _, v := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '|' }) {
+		v = strings.Trim(strings.TrimSpace(v), `"'`)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 func parseField(line string) *APIField {
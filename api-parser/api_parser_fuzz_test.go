@@ -0,0 +1,40 @@
+package apiparser
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// FuzzParseAPIDocsFrom feeds the parser malformed and adversarial docs. It
+// must not panic, and every API it returns must have come from a ### header
+// and have fields with names.
+func FuzzParseAPIDocsFrom(f *testing.F) {
+	for _, path := range []string{"../api-docs/apis.md", "../sandbox/demo_apis.md"} {
+		if doc, err := os.ReadFile(path); err == nil {
+			f.Add(string(doc))
+		}
+	}
+	f.Add("### Issue\n**Path:** /v1/ReqIssue\n**Fields:**\n- name: issue  type: xml  description: issue payload\n")
+	f.Add("### A\n**Fields:**\n-\n- name:\n- type: xml\n-  name: x  description:\n")
+	f.Add("**Fields:**\n- name: orphan type: string description: no header\n")
+	f.Add("### Old\n**Deprecated:** yes\n**Replaced by:** \n### \n###")
+	f.Add("### " + strings.Repeat("- name: ", 200))
+
+	f.Fuzz(func(t *testing.T, doc string) {
+		apis, _ := ParseAPIDocsFrom(strings.NewReader(doc))
+		for _, api := range apis {
+			if api.Name == "" {
+				t.Fatalf("API without a name: %+v", api)
+			}
+			if !strings.Contains(doc, api.Name) {
+				t.Fatalf("API name %q is not in the doc", api.Name)
+			}
+			for _, field := range api.Fields {
+				if field.Name == "" {
+					t.Fatalf("field without a name in %s: %+v", api.Name, field)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package apiparser
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDocsDir(t *testing.T) {
+	spec, err := os.ReadFile("testdata/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"payments/swagger.json": string(spec),
+		"package.json":          `{"name": "docs"}`,
+		"notes.txt":             "Issue is the one to use.",
+		".draft.md":             "### Draft",
+		".git/HEAD":             "ref: refs/heads/main",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	apis, err := ParseAPIDocs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseAPIDocs("testdata/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(apis, want) {
+		t.Errorf("APIs = %+v, want those of swagger.json", apis)
+	}
+	for _, line := range []string{
+		"skipping package.json: not an OpenAPI",
+		"skipping notes.txt: not a docs file",
+		"skipping hidden file .draft.md",
+		"skipping hidden directory .git",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("log lacks %q:\n%s", line, logs.String())
+		}
+	}
+}
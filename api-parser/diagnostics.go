@@ -0,0 +1,76 @@
+package apiparser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is one problem found in API docs: where it is and why it is
+// one. File is empty when the docs weren't read from a file, and Line is 0
+// when the problem has no single line, e.g. an OpenAPI document that
+// doesn't decode.
+type Diagnostic struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// String formats d as "file:line: reason", or "line N: reason" without a
+// file.
+func (d Diagnostic) String() string {
+	switch {
+	case d.File != "" && d.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Reason)
+	case d.File != "":
+		return d.File + ": " + d.Reason
+	case d.Line > 0:
+		return fmt.Sprintf("line %d: %s", d.Line, d.Reason)
+	}
+	return d.Reason
+}
+
+// DiagnosticsError lists every problem found in API docs. It matches
+// ErrInvalidDocs with errors.Is.
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticsError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidDocs, strings.Join(lines, "; "))
+}
+
+func (e *DiagnosticsError) Unwrap() error { return ErrInvalidDocs }
+
+// reErrorLine finds the "line N: reason" parts of decoder errors.
+var reErrorLine = regexp.MustCompile(`line (\d+): ([^;\n]+)`)
+
+// diagnose turns the error of parsing the docs file named file into
+// diagnostics for it.
+func diagnose(file string, err error) []Diagnostic {
+	var de *DiagnosticsError
+	if errors.As(err, &de) {
+		out := make([]Diagnostic, len(de.Diagnostics))
+		for i, d := range de.Diagnostics {
+			d.File = file
+			out[i] = d
+		}
+		return out
+	}
+	reason := strings.TrimPrefix(err.Error(), ErrInvalidDocs.Error()+": ")
+	var out []Diagnostic
+	for _, m := range reErrorLine.FindAllStringSubmatch(reason, -1) {
+		line, _ := strconv.Atoi(m[1])
+		out = append(out, Diagnostic{File: file, Line: line, Reason: strings.TrimSpace(m[2])})
+	}
+	if len(out) == 0 {
+		out = append(out, Diagnostic{File: file, Reason: reason})
+	}
+	return out
+}
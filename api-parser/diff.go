@@ -0,0 +1,182 @@
+package apiparser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CatalogDiff is what changed between two versions of the docs.
+type CatalogDiff struct {
+	Added   []APIDoc
+	Removed []APIDoc
+	Changed []APIChange
+}
+
+// Empty reports whether the two versions describe the same APIs.
+func (d CatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// APIChange lists what changed in one API, one change per line, e.g.
+// "+ field payload.status (string)" or "~ path: /v1/a -> /v2/a".
+type APIChange struct {
+	// Old and New are the API before and after.
+	Old, New APIDoc
+	Changes  []string
+}
+
+// Diff compares two versions of the docs. APIs are matched by versioned
+// name, and an API whose name changed but whose method and path didn't
+// counts as renamed rather than removed and added. Fields, responses and
+// errors are compared by name, status and code.
+func Diff(before, after []APIDoc) CatalogDiff {
+	var d CatalogDiff
+	matched := make([]bool, len(after))
+	find := func(a APIDoc) int {
+		for i, b := range after {
+			if !matched[i] && strings.EqualFold(a.VersionedName(), b.VersionedName()) {
+				return i
+			}
+		}
+		for i, b := range after {
+			if !matched[i] && strings.EqualFold(a.Method, b.Method) && a.Path == b.Path {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, a := range before {
+		i := find(a)
+		if i < 0 {
+			d.Removed = append(d.Removed, a)
+			continue
+		}
+		matched[i] = true
+		if changes := diffAPI(a, after[i]); len(changes) > 0 {
+			d.Changed = append(d.Changed, APIChange{Old: a, New: after[i], Changes: changes})
+		}
+	}
+	for i, b := range after {
+		if !matched[i] {
+			d.Added = append(d.Added, b)
+		}
+	}
+	return d
+}
+
+func diffAPI(a, b APIDoc) []string {
+	var changes []string
+	changed := func(what, before, after string) {
+		if before != after {
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", what, orNone(before), orNone(after)))
+		}
+	}
+	changed("name", a.VersionedName(), b.VersionedName())
+	changed("method", strings.ToUpper(a.Method), strings.ToUpper(b.Method))
+	changed("path", a.Path, b.Path)
+	changed("deprecated", yesNo(a.Deprecated), yesNo(b.Deprecated))
+	changed("replaced by", a.ReplacedBy, b.ReplacedBy)
+	changed("tags", strings.Join(a.Tags, ", "), strings.Join(b.Tags, ", "))
+	if a.Description != b.Description {
+		changes = append(changes, "~ description")
+	}
+	changes = append(changes, diffFields("field", a.Fields, b.Fields)...)
+
+	for _, r := range a.Responses {
+		i := slices.IndexFunc(b.Responses, func(s APIResponse) bool { return s.Status == r.Status })
+		if i < 0 {
+			changes = append(changes, "- response "+r.Status)
+			continue
+		}
+		changes = append(changes, diffFields("response "+r.Status+" field", r.Fields, b.Responses[i].Fields)...)
+	}
+	for _, r := range b.Responses {
+		if !slices.ContainsFunc(a.Responses, func(s APIResponse) bool { return s.Status == r.Status }) {
+			changes = append(changes, "+ response "+r.Status)
+		}
+	}
+
+	for _, e := range a.Errors {
+		after, ok := b.Error(e.Code)
+		switch {
+		case !ok:
+			changes = append(changes, "- error "+e.Code)
+		case e.Meaning != after.Meaning:
+			changes = append(changes, fmt.Sprintf("~ error %s: meaning", e.Code))
+		}
+		if ok && e.Retryable != after.Retryable {
+			changes = append(changes, fmt.Sprintf("~ error %s: retryable %s -> %s", e.Code, yesNo(e.Retryable), yesNo(after.Retryable)))
+		}
+	}
+	for _, e := range b.Errors {
+		if _, ok := a.Error(e.Code); !ok {
+			changes = append(changes, "+ error "+e.Code)
+		}
+	}
+	return changes
+}
+
+// diffFields compares two field lists by name; kind, e.g. "field",
+// starts each line.
+func diffFields(kind string, before, after []APIField) []string {
+	var changes []string
+	index := func(fields []APIField, name string) int {
+		return slices.IndexFunc(fields, func(f APIField) bool { return f.Name == name })
+	}
+	for _, f := range before {
+		i := index(after, f.Name)
+		if i < 0 {
+			changes = append(changes, fmt.Sprintf("- %s %s", kind, describeField(f)))
+			continue
+		}
+		g := after[i]
+		changed := func(what, a, b string) {
+			if a != b {
+				changes = append(changes, fmt.Sprintf("~ %s %s: %s %s -> %s", kind, f.Name, what, orNone(a), orNone(b)))
+			}
+		}
+		changed("type", f.Type, g.Type)
+		changed("in", f.Location(), g.Location())
+		changed("required", yesNo(f.Required), yesNo(g.Required))
+		changed("allowed", strings.Join(f.Enum, ","), strings.Join(g.Enum, ","))
+		changed("default", f.Default, g.Default)
+		changed("example", f.Example, g.Example)
+		if f.Description != g.Description {
+			changes = append(changes, fmt.Sprintf("~ %s %s: description", kind, f.Name))
+		}
+	}
+	for _, f := range after {
+		if index(before, f.Name) < 0 {
+			changes = append(changes, fmt.Sprintf("+ %s %s", kind, describeField(f)))
+		}
+	}
+	return changes
+}
+
+// describeField names a field with its type, e.g. "context.requestId
+// (string, required)" or "assetId (string, in path, required)".
+func describeField(f APIField) string {
+	attrs := f.Type
+	if f.IsParameter() {
+		attrs += ", in " + f.Location()
+	}
+	if f.Required {
+		attrs += ", required"
+	}
+	return fmt.Sprintf("%s (%s)", f.Name, attrs)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package apiparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldsOf lists the fields of the struct v, and of the structs nested in
+// it, as API fields, so docs can be generated from a request type instead
+// of copied from it by hand. Names are JSON paths, such as
+// payload.tokenizedAsset[].meta.name, types are Go types, and each
+// description names the Go field and its json tag. Fields tagged json:"-"
+// are left out, as encoding/json leaves them out.
+func FieldsOf(v any) []APIField {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []APIField
+	appendStructFields(&fields, t, "", map[reflect.Type]bool{})
+	return fields
+}
+
+// appendStructFields appends the fields of struct t under path. A struct
+// already being walked is not entered again, so a type that nests itself
+// doesn't recurse forever.
+func appendStructFields(fields *[]APIField, t reflect.Type, path string, walking map[reflect.Type]bool) {
+	walking[t] = true
+	defer delete(walking, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		name = joinFieldPath(path, name)
+
+		desc := fmt.Sprintf("%s.%s", t.Name(), f.Name)
+		if tag != "" {
+			desc += fmt.Sprintf(", json tag %q", tag)
+		}
+		*fields = append(*fields, APIField{Name: name, Type: goTypeName(f.Type), Description: desc})
+
+		// Elements of slices are reached through name[]
+		elem := f.Type
+		for {
+			switch elem.Kind() {
+			case reflect.Pointer:
+				elem = elem.Elem()
+				continue
+			case reflect.Slice, reflect.Array:
+				elem = elem.Elem()
+				name += "[]"
+				continue
+			}
+			break
+		}
+		if elem.Kind() == reflect.Struct && !walking[elem] {
+			appendStructFields(fields, elem, name, walking)
+		}
+	}
+}
+
+// goTypeName writes t as it is written in Go source within its own
+// package, e.g. *[]TokenizedAsset rather than *[]requestmodel.TokenizedAsset.
+func goTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + goTypeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + goTypeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), goTypeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + goTypeName(t.Key()) + "]" + goTypeName(t.Elem())
+	}
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// MarkdownFields writes fields as the **Fields:** block of a Markdown API
+// entry, one "- name: ...  type: ...  description: ..." line each.
+func MarkdownFields(fields []APIField) string {
+	var b strings.Builder
+	b.WriteString("**Fields:**\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "- name: %s  type: %s  description: %s\n", f.Name, f.Type, f.Description)
+	}
+	return b.String()
+}
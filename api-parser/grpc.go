@@ -0,0 +1,252 @@
+package apiparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MethodGRPC is the method of APIs read from protobuf service definitions,
+// whose path is the gRPC method path, e.g. /umi.v1.Tokens/Issue.
+const MethodGRPC = "GRPC"
+
+// protoSchema is what the catalog needs of a set of protobuf files, read
+// from .proto source or a compiled FileDescriptorSet. Messages and enums
+// are keyed by their full name without the leading dot, e.g.
+// umi.v1.IssueRequest.
+type protoSchema struct {
+	messages map[string]*protoMessage
+	enums    map[string][]string
+	services []protoService
+}
+
+type protoMessage struct {
+	fields []protoField
+	// mapEntry messages are the entries of a map field.
+	mapEntry bool
+}
+
+type protoField struct {
+	name     string
+	jsonName string
+	// kind is the scalar type, e.g. string or int64, or message or enum
+	// for the type named by typeName.
+	kind       string
+	typeName   string
+	repeated   bool
+	required   bool
+	deprecated bool
+	comment    string
+}
+
+type protoService struct {
+	// name is the full name, e.g. umi.v1.Tokens.
+	name    string
+	comment string
+	methods []protoMethod
+}
+
+type protoMethod struct {
+	name            string
+	input, output   string
+	clientStreaming bool
+	serverStreaming bool
+	deprecated      bool
+	comment         string
+}
+
+func newProtoSchema() *protoSchema {
+	return &protoSchema{messages: map[string]*protoMessage{}, enums: map[string][]string{}}
+}
+
+// apis maps every method of every service to an API: named by the method,
+// tagged with the service, with the request message flattened into fields
+// as OpenAPI request bodies are and the response message as its OK
+// response.
+func (s *protoSchema) apis() []APIDoc {
+	var apis []APIDoc
+	for _, svc := range s.services {
+		short := svc.name[strings.LastIndex(svc.name, ".")+1:]
+		for _, m := range svc.methods {
+			api := APIDoc{
+				Name:        m.name,
+				Path:        "/" + svc.name + "/" + m.name,
+				Method:      MethodGRPC,
+				Description: oneLine(m.comment),
+				Deprecated:  m.deprecated,
+				Tags:        tagList(short, "gRPC"),
+			}
+			if api.Description == "" {
+				api.Description = fmt.Sprintf("%s gRPC method %s of %s.", streamingKind(m), m.name, svc.name)
+			}
+			s.flatten(m.input, "", nil, &api.Fields)
+			response := APIResponse{Status: "ok", Description: "The method's response, " + m.output + "."}
+			if m.serverStreaming {
+				response.Description = "A stream of " + m.output + " messages."
+			}
+			s.flatten(m.output, "", nil, &response.Fields)
+			api.Responses = []APIResponse{response}
+			apis = append(apis, api)
+		}
+	}
+	return apis
+}
+
+func streamingKind(m protoMethod) string {
+	switch {
+	case m.clientStreaming && m.serverStreaming:
+		return "Bidirectional streaming"
+	case m.clientStreaming:
+		return "Client streaming"
+	case m.serverStreaming:
+		return "Server streaming"
+	}
+	return "Unary"
+}
+
+// flatten appends the fields of message msg under prefix, by their JSON
+// names. walking lists the messages being expanded, so a message that
+// contains itself ends as an object field.
+func (s *protoSchema) flatten(msg, prefix string, walking []string, fields *[]APIField) {
+	m := s.messages[msg]
+	if m == nil {
+		return
+	}
+	walking = append(walking[:len(walking):len(walking)], msg)
+	for _, f := range m.fields {
+		name := joinField(prefix, f.jsonName)
+		field := APIField{Name: name, Description: oneLine(f.comment), Required: f.required}
+		if f.deprecated {
+			field.Description = strings.TrimSpace("Deprecated. " + field.Description)
+		}
+
+		entry := s.messages[f.typeName]
+		switch {
+		case f.kind == "message" && entry != nil && entry.mapEntry:
+			field.Type = "object"
+			if len(entry.fields) == 2 {
+				field.Type = fmt.Sprintf("map<%s,%s>", s.typeOf(entry.fields[0]), s.typeOf(entry.fields[1]))
+			}
+		case f.kind == "message" && s.expandable(f.typeName, walking, name):
+			if f.repeated {
+				name += "[]"
+			}
+			s.flatten(f.typeName, name, walking, fields)
+			continue
+		case f.repeated:
+			field.Type = "array"
+		default:
+			field.Type = s.typeOf(f)
+		}
+		if f.kind == "enum" {
+			field.Enum = s.enums[f.typeName]
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+// expandable reports whether the fields of message msg should be listed
+// in its place: it is known, has fields, isn't a well-known type and isn't
+// already being expanded.
+func (s *protoSchema) expandable(msg string, walking []string, name string) bool {
+	m := s.messages[msg]
+	if m == nil || len(m.fields) == 0 || strings.HasPrefix(msg, "google.protobuf.") {
+		return false
+	}
+	for _, w := range walking {
+		if w == msg {
+			return false
+		}
+	}
+	return len(walking) < maxSchemaDepth && strings.Count(name, ".") < maxSchemaDepth
+}
+
+// typeOf names the type of f as it appears in JSON, in the type(format)
+// style of OpenAPI fields.
+func (s *protoSchema) typeOf(f protoField) string {
+	switch f.kind {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "bytes":
+		return "string(byte)"
+	case "double", "float":
+		return "number(" + f.kind + ")"
+	case "int32", "sint32", "sfixed32", "uint32", "fixed32":
+		return "integer(int32)"
+	case "int64", "sint64", "sfixed64", "uint64", "fixed64":
+		return "integer(int64)"
+	case "enum":
+		return "string"
+	}
+	switch f.typeName {
+	case "google.protobuf.Timestamp":
+		return "string(date-time)"
+	case "google.protobuf.Duration", "google.protobuf.FieldMask", "google.protobuf.StringValue":
+		return "string"
+	case "google.protobuf.BoolValue":
+		return "boolean"
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return "integer(int32)"
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return "integer(int64)"
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue":
+		return "number"
+	}
+	return "object"
+}
+
+// resolveType finds the message or enum name refers to from within scope,
+// the full name of the message or package it is used in, as protoc does:
+// innermost scope first. A name starting with a dot is already full. It
+// returns name without the dot when nothing matches.
+func (s *protoSchema) resolveType(scope, name string) (full, kind string) {
+	if strings.HasPrefix(name, ".") {
+		full = name[1:]
+		return full, s.kindOf(full)
+	}
+	for {
+		candidate := joinField(scope, name)
+		if kind := s.kindOf(candidate); kind != "" {
+			return candidate, kind
+		}
+		if scope == "" {
+			return name, ""
+		}
+		if i := strings.LastIndex(scope, "."); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+func (s *protoSchema) kindOf(full string) string {
+	if _, ok := s.messages[full]; ok {
+		return "message"
+	}
+	if _, ok := s.enums[full]; ok {
+		return "enum"
+	}
+	return ""
+}
+
+// protoJSONName is the JSON name protoc gives a field: its name in lower
+// camel case, e.g. assetId for asset_id.
+func protoJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper && r >= 'a' && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(r)
+			upper = false
+		}
+	}
+	return b.String()
+}
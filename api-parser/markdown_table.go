@@ -0,0 +1,140 @@
+package apiparser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tableColumns maps the header cells a field table may use, in lower case,
+// to the attribute the column holds.
+var tableColumns = map[string]string{
+	"name": "name", "field": "name", "field name": "name", "parameter": "name",
+	"type": "type", "example": "example", "default": "default",
+	"required": "required", "mandatory": "required",
+	"description": "description", "desc": "description", "details": "description",
+	"allowed": "allowed", "allowed values": "allowed", "enum": "allowed", "values": "allowed",
+	"in": "in", "location": "in",
+}
+
+// reTableRule is the delimiter row below a table header, e.g. |---|:--:|.
+var reTableRule = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)*\s*:?-+:?\s*\|?$`)
+
+// fieldTable reads the fields of a **Fields:** or **Response:** block
+// written as a markdown table, e.g.
+//
+//	| name | type | required | description |
+//	|------|------|----------|-------------|
+//	| context.requestId | string | yes | Unique id of the request |
+//
+// Columns are found by their header, in any order; allowed, example and
+// default columns are read like the markers of a field line, and an in
+// column says where each field is sent.
+type fieldTable struct {
+	// columns holds the attribute of each column, "" for ones not read.
+	columns []string
+}
+
+// newFieldTable reads the header row of a field table and what is wrong
+// with it. The rows of a table without a name column are skipped.
+func newFieldTable(line string) (*fieldTable, []string) {
+	t := &fieldTable{}
+	var problems []string
+	for _, cell := range tableCells(line) {
+		name := strings.ToLower(strings.Trim(cell, "*_` "))
+		column, ok := tableColumns[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown field table column %q; use name, type, required, description, allowed, example, default or in", cell))
+		}
+		t.columns = append(t.columns, column)
+	}
+	if !slices.Contains(t.columns, "name") {
+		problems = append(problems, "field table has no name column")
+	}
+	return t, problems
+}
+
+// row reads a data row of the table into a field, returning it unless the
+// row has no name, and the problems strict parsing reports.
+func (t *fieldTable) row(line string) (*APIField, []string) {
+	if !slices.Contains(t.columns, "name") {
+		return nil, nil
+	}
+	cells := tableCells(line)
+	var problems []string
+	if len(cells) != len(t.columns) {
+		problems = append(problems, fmt.Sprintf("field table row has %d cells; the header has %d", len(cells), len(t.columns)))
+	}
+	var field APIField
+	for i, cell := range cells {
+		if i >= len(t.columns) {
+			break
+		}
+		switch t.columns[i] {
+		case "name":
+			field.Name = strings.Trim(cell, "`")
+		case "type":
+			field.Type = strings.Trim(cell, "`")
+		case "description":
+			field.Description = cell
+		case "required":
+			switch strings.ToLower(strings.Trim(cell, "*_` ")) {
+			case "yes", "true", "required", "y", "x", "✓", "✔":
+				field.Required = true
+			case "no", "false", "optional", "n", "", "-":
+			default:
+				problems = append(problems, fmt.Sprintf("required is %q; use yes or no", cell))
+			}
+		case "allowed":
+			field.Enum = enumList(strings.Trim(cell, "`"))
+		case "example":
+			field.Example = strings.Trim(cell, "`\"'")
+		case "default":
+			field.Default = strings.Trim(cell, "`\"'")
+		case "in":
+			in, ok := fieldLocation(strings.Trim(cell, "`"))
+			if !ok {
+				problems = append(problems, fmt.Sprintf("in is %q; use body, path, query or header", cell))
+			}
+			field.In = in
+		}
+	}
+	if field.Name == "" {
+		return nil, append(problems, "field table row has no name")
+	}
+	if field.Type == "" {
+		problems = append(problems, fmt.Sprintf("field %q has no type", field.Name))
+	}
+	for _, v := range []struct{ name, value string }{{"example", field.Example}, {"default", field.Default}} {
+		if v.value != "" && len(field.Enum) > 0 && !slices.Contains(field.Enum, v.value) {
+			problems = append(problems, fmt.Sprintf("%s %q is not among the allowed values %s", v.name, v.value, strings.Join(field.Enum, ", ")))
+		}
+	}
+	return &field, problems
+}
+
+// tableCells splits a table row into its trimmed cells. A bar escaped as
+// \| belongs to the cell, as in allowed values written A\|B.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
@@ -0,0 +1,453 @@
+package apiparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnsupportedSpec is returned for OpenAPI documents of a version the
+// parser doesn't read.
+var ErrUnsupportedSpec = errors.New("unsupported spec")
+
+// maxSchemaDepth bounds how deep request bodies are flattened; it also
+// stops schemas that refer to themselves.
+const maxSchemaDepth = 16
+
+// openAPIDoc is the part of an OpenAPI 3.0 document the catalog needs.
+type openAPIDoc struct {
+	OpenAPI    string                 `json:"openapi" yaml:"openapi"`
+	Paths      map[string]openAPIPath `json:"paths" yaml:"paths"`
+	Components openAPIComponents      `json:"components" yaml:"components"`
+}
+
+type openAPIComponents struct {
+	Schemas       map[string]*openAPISchema      `json:"schemas" yaml:"schemas"`
+	RequestBodies map[string]*openAPIRequestBody `json:"requestBodies" yaml:"requestBodies"`
+	Responses     map[string]*openAPIRequestBody `json:"responses" yaml:"responses"`
+	Parameters    map[string]*openAPIParameter   `json:"parameters" yaml:"parameters"`
+}
+
+type openAPIPath struct {
+	Get     *openAPIOperation `json:"get" yaml:"get"`
+	Put     *openAPIOperation `json:"put" yaml:"put"`
+	Post    *openAPIOperation `json:"post" yaml:"post"`
+	Delete  *openAPIOperation `json:"delete" yaml:"delete"`
+	Options *openAPIOperation `json:"options" yaml:"options"`
+	Head    *openAPIOperation `json:"head" yaml:"head"`
+	Patch   *openAPIOperation `json:"patch" yaml:"patch"`
+	Trace   *openAPIOperation `json:"trace" yaml:"trace"`
+	// Parameters are shared by the path's operations.
+	Parameters []*openAPIParameter `json:"parameters" yaml:"parameters"`
+}
+
+type openAPIOperation struct {
+	OperationID string              `json:"operationId" yaml:"operationId"`
+	Summary     string              `json:"summary" yaml:"summary"`
+	Description string              `json:"description" yaml:"description"`
+	Deprecated  bool                `json:"deprecated" yaml:"deprecated"`
+	Tags        []string            `json:"tags" yaml:"tags"`
+	Parameters  []*openAPIParameter `json:"parameters" yaml:"parameters"`
+	RequestBody *openAPIRequestBody `json:"requestBody" yaml:"requestBody"`
+	// Responses are keyed by status. A response is read like a request
+	// body: its description and the schema of its content.
+	Responses map[string]*openAPIRequestBody `json:"responses" yaml:"responses"`
+}
+
+type openAPIRequestBody struct {
+	Ref         string                      `json:"$ref" yaml:"$ref"`
+	Description string                      `json:"description" yaml:"description"`
+	Content     map[string]openAPIMediaType `json:"content" yaml:"content"`
+}
+
+type openAPIParameter struct {
+	Ref         string         `json:"$ref" yaml:"$ref"`
+	Name        string         `json:"name" yaml:"name"`
+	In          string         `json:"in" yaml:"in"`
+	Description string         `json:"description" yaml:"description"`
+	Required    bool           `json:"required" yaml:"required"`
+	Schema      *openAPISchema `json:"schema" yaml:"schema"`
+	Example     any            `json:"example" yaml:"example"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema" yaml:"schema"`
+}
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref" yaml:"$ref"`
+	Type        string                    `json:"type" yaml:"type"`
+	Format      string                    `json:"format" yaml:"format"`
+	Description string                    `json:"description" yaml:"description"`
+	Properties  map[string]*openAPISchema `json:"properties" yaml:"properties"`
+	Required    []string                  `json:"required" yaml:"required"`
+	Items       *openAPISchema            `json:"items" yaml:"items"`
+	AllOf       []*openAPISchema          `json:"allOf" yaml:"allOf"`
+	OneOf       []*openAPISchema          `json:"oneOf" yaml:"oneOf"`
+	AnyOf       []*openAPISchema          `json:"anyOf" yaml:"anyOf"`
+	Enum        []any                     `json:"enum" yaml:"enum"`
+	Example     any                       `json:"example" yaml:"example"`
+	Default     any                       `json:"default" yaml:"default"`
+}
+
+// ParseOpenAPI reads an OpenAPI 3.0 document, as YAML or JSON, into the
+// catalog. Every operation becomes an API named by its operationId (else its
+// summary, else method and path), and the schema of its request body is
+// flattened into fields with dotted names, e.g. context.requestId. List
+// entries are named with [], e.g. payload.tokenizedAsset[].id. Path, query
+// and header parameters come first, as fields with In set; cookies are left
+// out.
+func ParseOpenAPI(r io.Reader) ([]APIDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc openAPIDoc
+	if err := decodeSpec(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%w: OpenAPI version %q; only 3.x documents are read", ErrUnsupportedSpec, doc.OpenAPI)
+	}
+	return doc.apis(), nil
+}
+
+// apis lists the document's operations by path, then method.
+func (d *openAPIDoc) apis() []APIDoc {
+	paths := make([]string, 0, len(d.Paths))
+	for p := range d.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var apis []APIDoc
+	for _, path := range paths {
+		item := d.Paths[path]
+		for _, op := range []struct {
+			method string
+			op     *openAPIOperation
+		}{
+			{"GET", item.Get}, {"PUT", item.Put}, {"POST", item.Post}, {"DELETE", item.Delete},
+			{"OPTIONS", item.Options}, {"HEAD", item.Head}, {"PATCH", item.Patch}, {"TRACE", item.Trace},
+		} {
+			if op.op != nil {
+				apis = append(apis, d.api(path, op.method, op.op, item.Parameters))
+			}
+		}
+	}
+	return apis
+}
+
+// decodeSpec decodes a JSON or YAML document into v.
+func decodeSpec(data []byte, v any) error {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		return json.Unmarshal(trimmed, v)
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+// api converts op, whose path declares the parameters shared.
+func (d *openAPIDoc) api(path, method string, op *openAPIOperation, shared []*openAPIParameter) APIDoc {
+	api := APIDoc{
+		Name:        op.OperationID,
+		Path:        path,
+		Method:      method,
+		Description: strings.TrimSpace(op.Description),
+		Deprecated:  op.Deprecated,
+		Tags:        tagList(op.Tags...),
+	}
+	if api.Name == "" {
+		api.Name = op.Summary
+	}
+	if api.Name == "" {
+		api.Name = method + " " + path
+	}
+	if api.Description == "" {
+		api.Description = op.Summary
+	}
+	api.Description = oneLine(api.Description)
+	api.Responses = d.responses(op.Responses)
+	api.Fields = d.parameters(shared, op.Parameters)
+
+	body := op.RequestBody
+	if body != nil && body.Ref != "" {
+		body = d.Components.RequestBodies[refName(body.Ref, "#/components/requestBodies/")]
+	}
+	if body == nil {
+		return api
+	}
+	schema, mediaType := bodySchema(body)
+	if schema == nil {
+		return api
+	}
+	api.Fields = append(api.Fields, d.bodyFields(body, schema, mediaType)...)
+	return api
+}
+
+// parameters lists the path, query and header parameters of an operation
+// as fields, in the order declared. The operation's own override the ones
+// its path shares by name and location.
+func (d *openAPIDoc) parameters(shared, own []*openAPIParameter) []APIField {
+	var fields []APIField
+	index := map[string]int{}
+	for _, p := range append(shared[:len(shared):len(shared)], own...) {
+		if p != nil && p.Ref != "" {
+			p = d.Components.Parameters[refName(p.Ref, "#/components/parameters/")]
+		}
+		if p == nil || p.Name == "" {
+			continue
+		}
+		in, ok := fieldLocation(p.In)
+		if !ok || in == "" {
+			continue
+		}
+		field := APIField{Name: p.Name, Type: "string", Description: oneLine(p.Description), Required: p.Required || in == InPath, Example: scalarValue(p.Example), In: in}
+		if s, _ := d.resolve(p.Schema, nil); s != nil {
+			field.Type, field.Enum, field.Default = schemaType(s, nil), enumValues(s.Enum), scalarValue(s.Default)
+			if field.Example == "" {
+				field.Example = scalarValue(s.Example)
+			}
+		}
+		key := in + " " + p.Name
+		if i, ok := index[key]; ok {
+			fields[i] = field
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// bodyFields flattens schema, the schema of body's content of mediaType,
+// into fields.
+func (d *openAPIDoc) bodyFields(body *openAPIRequestBody, schema *openAPISchema, mediaType string) []APIField {
+	var fields []APIField
+	d.flatten(schema, "", true, nil, &fields)
+	if len(fields) == 1 && fields[0].Name == "" {
+		// A body that isn't an object, such as an XML document sent as a
+		// string, is one field named after its media type. It is the
+		// payload itself rather than a value to ask for.
+		fields[0].Name = "body"
+		fields[0].Type = mediaTypeName(mediaType, fields[0].Type)
+		fields[0].Required = false
+		if fields[0].Description == "" {
+			fields[0].Description = strings.TrimSpace(body.Description)
+		}
+	}
+	return fields
+}
+
+// responses lists an operation's responses by status, with the fields of
+// the ones that have a body.
+func (d *openAPIDoc) responses(in map[string]*openAPIRequestBody) []APIResponse {
+	statuses := make([]string, 0, len(in))
+	for status := range in {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	var out []APIResponse
+	for _, status := range statuses {
+		r := in[status]
+		if r != nil && r.Ref != "" {
+			r = d.Components.Responses[refName(r.Ref, "#/components/responses/")]
+		}
+		if r == nil {
+			continue
+		}
+		response := APIResponse{Status: strings.ToLower(status), Description: oneLine(r.Description)}
+		if schema, mediaType := bodySchema(r); schema != nil {
+			response.Fields = d.bodyFields(r, schema, mediaType)
+		}
+		out = append(out, response)
+	}
+	return out
+}
+
+// bodySchema picks the request body's JSON schema, else its XML one, else
+// the first it has.
+func bodySchema(body *openAPIRequestBody) (*openAPISchema, string) {
+	types := make([]string, 0, len(body.Content))
+	for t := range body.Content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, want := range []string{"json", "xml"} {
+		for _, t := range types {
+			if strings.Contains(t, want) && body.Content[t].Schema != nil {
+				return body.Content[t].Schema, t
+			}
+		}
+	}
+	for _, t := range types {
+		if s := body.Content[t].Schema; s != nil {
+			return s, t
+		}
+	}
+	return nil, ""
+}
+
+// flatten appends the leaf fields of s under name. required is set when
+// the value at name must be sent: a property is required when its object
+// lists it as required and the object itself is required. refs are the
+// schemas being expanded, so a schema that contains itself ends as an
+// object field.
+func (d *openAPIDoc) flatten(s *openAPISchema, name string, required bool, refs []string, fields *[]APIField) {
+	ref := s
+	s, refs = d.resolve(s, refs)
+	if s == nil {
+		if ref != nil && name != "" {
+			*fields = append(*fields, APIField{Name: name, Type: "object", Description: oneLine(ref.Description), Required: required})
+		}
+		return
+	}
+	props := d.properties(s, refs)
+	switch {
+	case len(props) > 0 && len(refs) < maxSchemaDepth && strings.Count(name, ".") < maxSchemaDepth:
+		names := make([]string, 0, len(props))
+		for n := range props {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		requiredProps := d.required(s, refs)
+		for _, n := range names {
+			d.flatten(props[n], joinField(name, n), required && requiredProps[n], refs, fields)
+		}
+	case s.Type == "array" && s.Items != nil:
+		items, itemRefs := d.resolve(s.Items, refs)
+		if items != nil && len(d.properties(items, itemRefs)) > 0 && len(itemRefs) < maxSchemaDepth {
+			d.flatten(items, name+"[]", required, refs, fields)
+			return
+		}
+		*fields = append(*fields, APIField{Name: name, Type: "array", Description: oneLine(s.Description), Required: required})
+	default:
+		*fields = append(*fields, APIField{Name: name, Type: schemaType(s, props), Description: oneLine(s.Description), Required: required, Enum: enumValues(s.Enum), Example: scalarValue(s.Example), Default: scalarValue(s.Default)})
+	}
+}
+
+// resolve follows s's $ref to the components, recording it in refs. It
+// returns nil for a reference that can't be followed or is already being
+// expanded.
+func (d *openAPIDoc) resolve(s *openAPISchema, refs []string) (*openAPISchema, []string) {
+	for s != nil && s.Ref != "" {
+		// Swagger 2.0 documents keep their schemas under definitions
+		name := refName(refName(s.Ref, "#/components/schemas/"), "#/definitions/")
+		for _, r := range refs {
+			if r == name {
+				return nil, refs
+			}
+		}
+		refs = append(refs[:len(refs):len(refs)], name)
+		s = d.Components.Schemas[name]
+	}
+	return s, refs
+}
+
+// properties merges the properties of s with those of its allOf, oneOf and
+// anyOf schemas, so every field a body may have is listed.
+func (d *openAPIDoc) properties(s *openAPISchema, refs []string) map[string]*openAPISchema {
+	props := map[string]*openAPISchema{}
+	for n, p := range s.Properties {
+		props[n] = p
+	}
+	for _, group := range [][]*openAPISchema{s.AllOf, s.OneOf, s.AnyOf} {
+		for _, sub := range group {
+			sub, subRefs := d.resolve(sub, refs)
+			if sub == nil || len(subRefs) > maxSchemaDepth {
+				continue
+			}
+			for n, p := range d.properties(sub, subRefs) {
+				if _, ok := props[n]; !ok {
+					props[n] = p
+				}
+			}
+		}
+	}
+	return props
+}
+
+// required returns the names of the properties s requires, its own and
+// those of its allOf schemas. The properties of oneOf and anyOf schemas are
+// alternatives, so none of them is required.
+func (d *openAPIDoc) required(s *openAPISchema, refs []string) map[string]bool {
+	names := map[string]bool{}
+	for _, n := range s.Required {
+		names[n] = true
+	}
+	for _, sub := range s.AllOf {
+		sub, subRefs := d.resolve(sub, refs)
+		if sub == nil || len(subRefs) > maxSchemaDepth {
+			continue
+		}
+		for n := range d.required(sub, subRefs) {
+			names[n] = true
+		}
+	}
+	return names
+}
+
+// enumValues turns a schema's enum into the field's allowed values.
+func enumValues(enum []any) []string {
+	var values []string
+	for _, v := range enum {
+		if v != nil {
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	return values
+}
+
+// scalarValue renders a scalar example or default; objects and lists are
+// left out, since those values are given per field.
+func scalarValue(v any) string {
+	switch v.(type) {
+	case nil, map[string]any, []any:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func schemaType(s *openAPISchema, props map[string]*openAPISchema) string {
+	switch {
+	case s.Type != "" && s.Format != "":
+		return s.Type + "(" + s.Format + ")"
+	case s.Type != "":
+		return s.Type
+	case len(props) > 0:
+		return "object"
+	}
+	return "any"
+}
+
+// mediaTypeName names a non-object body by its media type, e.g. xml for
+// application/xml.
+func mediaTypeName(mediaType, fallback string) string {
+	for _, t := range []string{"json", "xml"} {
+		if strings.Contains(mediaType, t) {
+			return t
+		}
+	}
+	return fallback
+}
+
+func refName(ref, prefix string) string {
+	return strings.TrimPrefix(ref, prefix)
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
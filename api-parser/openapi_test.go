@@ -0,0 +1,73 @@
+package apiparser
+
+import "testing"
+
+// requiredFields maps each field of fields to whether it is required.
+func requiredFields(fields []APIField) map[string]bool {
+	out := map[string]bool{}
+	for _, f := range fields {
+		out[f.Name] = f.Required
+	}
+	return out
+}
+
+func checkRequired(t *testing.T, api APIDoc, want map[string]bool) {
+	t.Helper()
+	got := requiredFields(api.Fields)
+	if len(got) != len(want) {
+		t.Errorf("%s fields = %+v", api.Name, api.Fields)
+	}
+	for name, required := range want {
+		if r, ok := got[name]; !ok || r != required {
+			t.Errorf("%s field %s: present %v, required %v; want required %v", api.Name, name, ok, r, required)
+		}
+	}
+}
+
+func TestOpenAPIRequiredFields(t *testing.T) {
+	apis, err := ParseAPIDocs("testdata/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 1 {
+		t.Fatalf("APIs = %+v", apis)
+	}
+	checkRequired(t, apis[0], map[string]bool{
+		"assetId": true,
+		"dryRun":  false,
+		// Required through allOf
+		"requestId": true,
+		"trace":     false,
+		"note":      false,
+		// Nested in a required object
+		"asset.quantity":        true,
+		"asset.purity":          false,
+		"asset.holders[].id":    true,
+		"asset.holders[].share": false,
+		// Required only within an object that is optional
+		"asset.meta.vendor": false,
+		// Alternatives of a oneOf
+		"delivery.vault":   false,
+		"delivery.address": false,
+	})
+}
+
+func TestSwaggerRequiredFields(t *testing.T) {
+	apis, err := ParseAPIDocs("testdata/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 2 {
+		t.Fatalf("APIs = %+v", apis)
+	}
+	for _, api := range apis {
+		switch api.Name {
+		case "Lock":
+			checkRequired(t, api, map[string]bool{"assetId": true, "until": true, "reason": false})
+		case "Unlock":
+			checkRequired(t, api, map[string]bool{"assetId": true, "reason": false})
+		default:
+			t.Errorf("unexpected API %s", api.Name)
+		}
+	}
+}
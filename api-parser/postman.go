@@ -0,0 +1,283 @@
+package apiparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// postmanSchema is the start of the schema URL Postman v2.x exports name.
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2"
+
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item []postmanItem `json:"item"`
+}
+
+// postmanItem is a request, or a folder of items when Request is nil.
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Request *postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method      string          `json:"method"`
+	URL         json.RawMessage `json:"url"`
+	Description json.RawMessage `json:"description"`
+	Header      []postmanParam  `json:"header"`
+	Body        *struct {
+		Mode       string         `json:"mode"`
+		Raw        string         `json:"raw"`
+		URLEncoded []postmanParam `json:"urlencoded"`
+		FormData   []postmanParam `json:"formdata"`
+	} `json:"body"`
+}
+
+type postmanParam struct {
+	Key         string          `json:"key"`
+	Value       string          `json:"value"`
+	Type        string          `json:"type"`
+	Description json.RawMessage `json:"description"`
+	Disabled    bool            `json:"disabled"`
+}
+
+// ParsePostman reads a Postman collection v2.1 export into the catalog.
+// Every request, in folders or not, becomes an API named like the request
+// and tagged with the folders it is in.
+// Its example body gives the fields: a JSON body is flattened into dotted
+// names as ParseOpenAPI does, form bodies give a field per key, and the
+// example values are kept in the descriptions as hints. Path variables
+// (:id), query parameters and headers other than content negotiation come
+// first, as fields with In set.
+func ParsePostman(r io.Reader) ([]APIDoc, error) {
+	var c postmanCollection
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("parse Postman collection: %w", err)
+	}
+	if !strings.HasPrefix(c.Info.Schema, postmanSchema) {
+		return nil, fmt.Errorf("%w: Postman collection schema %q; only v2 collections are read", ErrUnsupportedSpec, c.Info.Schema)
+	}
+	var apis []APIDoc
+	var walk func(items []postmanItem, folders []string)
+	walk = func(items []postmanItem, folders []string) {
+		for _, it := range items {
+			if it.Request == nil {
+				walk(it.Item, append(folders[:len(folders):len(folders)], it.Name))
+				continue
+			}
+			api := it.api()
+			api.Tags = tagList(folders...)
+			apis = append(apis, api)
+		}
+	}
+	walk(c.Item, nil)
+	return apis, nil
+}
+
+func (it postmanItem) api() APIDoc {
+	req := it.Request
+	api := APIDoc{
+		Name:        strings.TrimSpace(it.Name),
+		Path:        postmanPath(req.URL),
+		Method:      strings.ToUpper(req.Method),
+		Description: oneLine(postmanText(req.Description)),
+	}
+	if api.Method == "" {
+		api.Method = "GET"
+	}
+	if api.Name == "" {
+		api.Name = api.Method + " " + api.Path
+	}
+	api.Fields = postmanParameters(req)
+	if req.Body == nil {
+		return api
+	}
+
+	switch req.Body.Mode {
+	case "raw":
+		api.Fields = append(api.Fields, exampleFields(req.Body.Raw)...)
+	case "urlencoded", "formdata":
+		for _, p := range append(req.Body.URLEncoded, req.Body.FormData...) {
+			if p.Disabled || p.Key == "" {
+				continue
+			}
+			typ := p.Type
+			if typ == "" {
+				typ = "text"
+			}
+			api.Fields = append(api.Fields, APIField{Name: p.Key, Type: typ, Description: withExample(postmanText(p.Description), p.Value), Example: postmanExample(p.Value)})
+		}
+	}
+	return api
+}
+
+// postmanPath returns the path of a request URL, given either as a string
+// or as an object. Variables such as {{baseUrl}} and the query are left
+// out.
+func postmanPath(raw json.RawMessage) string {
+	var u struct {
+		Raw  string   `json:"raw"`
+		Path []string `json:"path"`
+	}
+	if err := json.Unmarshal(raw, &u.Raw); err != nil {
+		json.Unmarshal(raw, &u)
+	}
+	if len(u.Path) > 0 {
+		return "/" + strings.Join(u.Path, "/")
+	}
+
+	s, _, _ := strings.Cut(u.Raw, "?")
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if strings.HasPrefix(s, "{{") {
+		if i := strings.Index(s, "}}"); i >= 0 {
+			s = s[i+2:]
+		}
+	} else if i := strings.Index(s, "/"); i >= 0 && !strings.HasPrefix(s, "/") {
+		s = s[i:]
+	}
+	if p, err := url.PathUnescape(s); err == nil {
+		s = p
+	}
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+	return s
+}
+
+// postmanParameters lists the path variables, query parameters and headers
+// of req as fields. Only URLs given as objects list their variables and
+// query.
+func postmanParameters(req *postmanRequest) []APIField {
+	var u struct {
+		Query    []postmanParam `json:"query"`
+		Variable []postmanParam `json:"variable"`
+	}
+	json.Unmarshal(req.URL, &u)
+	var fields []APIField
+	for _, group := range []struct {
+		in     string
+		params []postmanParam
+	}{{InPath, u.Variable}, {InQuery, u.Query}, {InHeader, req.Header}} {
+		for _, p := range group.params {
+			if p.Disabled || p.Key == "" {
+				continue
+			}
+			if group.in == InHeader {
+				switch strings.ToLower(p.Key) {
+				case "content-type", "accept", "content-length":
+					continue
+				}
+			}
+			fields = append(fields, APIField{
+				Name:        p.Key,
+				Type:        "string",
+				Description: withExample(postmanText(p.Description), p.Value),
+				Required:    group.in == InPath,
+				Example:     postmanExample(p.Value),
+				In:          group.in,
+			})
+		}
+	}
+	return fields
+}
+
+// postmanText reads a description, which exports write either as a string
+// or as {"content": "..."}.
+func postmanText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var d struct {
+		Content string `json:"content"`
+	}
+	json.Unmarshal(raw, &d)
+	return d.Content
+}
+
+// exampleFields flattens an example JSON body into fields whose
+// descriptions give the example values. Other bodies, such as XML, are one
+// body field.
+func exampleFields(raw string) []APIField {
+	body := strings.TrimSpace(raw)
+	if body == "" {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		typ := "text"
+		if strings.HasPrefix(body, "<") {
+			typ = "xml"
+		}
+		return []APIField{{Name: "body", Type: typ, Description: "example request body"}}
+	}
+	var fields []APIField
+	flattenExample(doc, "", 0, &fields)
+	return fields
+}
+
+func flattenExample(v any, name string, depth int, fields *[]APIField) {
+	switch t := v.(type) {
+	case map[string]any:
+		if len(t) > 0 && depth < maxSchemaDepth {
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				flattenExample(t[k], joinField(name, k), depth+1, fields)
+			}
+			return
+		}
+		*fields = append(*fields, APIField{Name: name, Type: "object"})
+	case []any:
+		if len(t) > 0 {
+			if _, ok := t[0].(map[string]any); ok && depth < maxSchemaDepth {
+				flattenExample(t[0], name+"[]", depth+1, fields)
+				return
+			}
+		}
+		*fields = append(*fields, APIField{Name: name, Type: "array"})
+	case string:
+		*fields = append(*fields, APIField{Name: name, Type: "string", Description: withExample("", t), Example: postmanExample(t)})
+	case float64:
+		*fields = append(*fields, APIField{Name: name, Type: "number", Description: withExample("", fmt.Sprint(t)), Example: fmt.Sprint(t)})
+	case bool:
+		*fields = append(*fields, APIField{Name: name, Type: "boolean", Description: withExample("", fmt.Sprint(t)), Example: fmt.Sprint(t)})
+	default:
+		*fields = append(*fields, APIField{Name: name, Type: "any"})
+	}
+}
+
+// postmanExample keeps value as a field's example unless it refers to a
+// variable such as {{walletAddress}}, which only means something in
+// Postman.
+func postmanExample(value string) string {
+	if strings.Contains(value, "{{") {
+		return ""
+	}
+	return value
+}
+
+// withExample adds an example value to a field description.
+func withExample(description, example string) string {
+	description = oneLine(description)
+	if example == "" {
+		return description
+	}
+	hint := fmt.Sprintf("e.g. %q", example)
+	if description == "" {
+		return hint
+	}
+	return description + " (" + hint + ")"
+}
@@ -0,0 +1,382 @@
+package apiparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// descriptorSetExts are the extensions compiled FileDescriptorSets are
+// saved with.
+var descriptorSetExts = map[string]bool{".pb": true, ".binpb": true, ".protoset": true, ".desc": true}
+
+// errProtoWire is returned for bytes that aren't a valid protobuf message.
+var errProtoWire = errors.New("malformed protobuf message")
+
+// ParseDescriptorSet reads a compiled FileDescriptorSet into the catalog,
+// as written by protoc --descriptor_set_out or buf build. Every method of
+// every service becomes an API named by the method, with the gRPC path,
+// e.g. /umi.v1.Tokens/Issue, and method GRPC. Its request message is
+// flattened into fields by their JSON names, as ParseOpenAPI flattens
+// request bodies. Messages from imported files are only expanded when the
+// set includes them (protoc --include_imports), and comments are only
+// kept when it has source info (protoc --include_source_info).
+func ParseDescriptorSet(r io.Reader) ([]APIDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var files [][]byte
+	err = walkProto(data, func(num int, _ uint64, b []byte) error {
+		if num == 1 {
+			files = append(files, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parse FileDescriptorSet: %w", err)
+	}
+
+	s := newProtoSchema()
+	var parsed []*descriptorFile
+	for _, f := range files {
+		file, err := readDescriptorFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("parse FileDescriptorSet: %w", err)
+		}
+		file.register(s)
+		parsed = append(parsed, file)
+	}
+	for _, file := range parsed {
+		s.services = append(s.services, file.services...)
+	}
+	return s.apis(), nil
+}
+
+// descriptorFile is the part of a FileDescriptorProto the catalog reads.
+type descriptorFile struct {
+	pkg      string
+	messages []descriptorMessage
+	enums    []descriptorEnum
+	services []protoService
+}
+
+type descriptorMessage struct {
+	name     string
+	fields   []protoField
+	nested   []descriptorMessage
+	enums    []descriptorEnum
+	mapEntry bool
+}
+
+type descriptorEnum struct {
+	name   string
+	values []string
+}
+
+// readDescriptorFile reads a FileDescriptorProto. Its source info comes
+// after the elements it describes, so those are read once it is indexed.
+func readDescriptorFile(data []byte) (*descriptorFile, error) {
+	f := &descriptorFile{}
+	var messages, services [][]byte
+	comments := map[string]string{}
+	err := walkProto(data, func(num int, _ uint64, b []byte) error {
+		switch num {
+		case 2:
+			f.pkg = string(b)
+		case 4:
+			messages = append(messages, b)
+		case 5:
+			e, err := readDescriptorEnum(b)
+			f.enums = append(f.enums, e)
+			return err
+		case 6:
+			services = append(services, b)
+		case 9:
+			return readSourceComments(b, comments)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range messages {
+		m, err := readDescriptorMessage(b, fmt.Sprintf("4.%d", i), comments)
+		if err != nil {
+			return nil, err
+		}
+		f.messages = append(f.messages, m)
+	}
+	for i, b := range services {
+		svc, err := readDescriptorService(b, f.pkg, fmt.Sprintf("6.%d", i), comments)
+		if err != nil {
+			return nil, err
+		}
+		f.services = append(f.services, svc)
+	}
+	return f, nil
+}
+
+// readDescriptorMessage reads a DescriptorProto found at the source path
+// path, e.g. 4.0.3.1 for the second message nested in the file's first.
+func readDescriptorMessage(data []byte, path string, comments map[string]string) (descriptorMessage, error) {
+	var m descriptorMessage
+	var nested [][]byte
+	err := walkProto(data, func(num int, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			m.name = string(b)
+		case 2:
+			f, err := readDescriptorField(b)
+			f.comment = comments[fmt.Sprintf("%s.2.%d", path, len(m.fields))]
+			m.fields = append(m.fields, f)
+			return err
+		case 3:
+			nested = append(nested, b)
+		case 4:
+			e, err := readDescriptorEnum(b)
+			m.enums = append(m.enums, e)
+			return err
+		case 7:
+			// MessageOptions.map_entry
+			return walkProto(b, func(num int, v uint64, _ []byte) error {
+				if num == 7 {
+					m.mapEntry = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+	for i, b := range nested {
+		n, err := readDescriptorMessage(b, fmt.Sprintf("%s.3.%d", path, i), comments)
+		if err != nil {
+			return m, err
+		}
+		m.nested = append(m.nested, n)
+	}
+	return m, nil
+}
+
+func readDescriptorEnum(data []byte) (descriptorEnum, error) {
+	var e descriptorEnum
+	err := walkProto(data, func(num int, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			e.name = string(b)
+		case 2:
+			return walkProto(b, func(num int, _ uint64, b []byte) error {
+				if num == 1 {
+					e.values = append(e.values, string(b))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return e, err
+}
+
+// descriptorTypes names the FieldDescriptorProto.Type values; groups are
+// read as messages.
+var descriptorTypes = map[uint64]string{
+	1: "double", 2: "float", 3: "int64", 4: "uint64", 5: "int32", 6: "fixed64",
+	7: "fixed32", 8: "bool", 9: "string", 10: "message", 11: "message", 12: "bytes",
+	13: "uint32", 14: "enum", 15: "sfixed32", 16: "sfixed64", 17: "sint32", 18: "sint64",
+}
+
+func readDescriptorField(data []byte) (protoField, error) {
+	var f protoField
+	err := walkProto(data, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			f.name = string(b)
+		case 4:
+			f.repeated, f.required = v == 3, v == 2
+		case 5:
+			f.kind = descriptorTypes[v]
+		case 6:
+			f.typeName = strings.TrimPrefix(string(b), ".")
+		case 8:
+			// FieldOptions.deprecated
+			return walkProto(b, func(num int, v uint64, _ []byte) error {
+				if num == 3 {
+					f.deprecated = v != 0
+				}
+				return nil
+			})
+		case 10:
+			f.jsonName = string(b)
+		}
+		return nil
+	})
+	if f.jsonName == "" {
+		f.jsonName = protoJSONName(f.name)
+	}
+	return f, err
+}
+
+// readDescriptorService reads a ServiceDescriptorProto of package pkg
+// found at the source path path.
+func readDescriptorService(data []byte, pkg, path string, comments map[string]string) (protoService, error) {
+	svc := protoService{comment: comments[path]}
+	err := walkProto(data, func(num int, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			svc.name = joinField(pkg, string(b))
+		case 2:
+			m := protoMethod{comment: comments[fmt.Sprintf("%s.2.%d", path, len(svc.methods))]}
+			err := walkProto(b, func(num int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					m.name = string(b)
+				case 2:
+					m.input = strings.TrimPrefix(string(b), ".")
+				case 3:
+					m.output = strings.TrimPrefix(string(b), ".")
+				case 4:
+					// MethodOptions.deprecated
+					return walkProto(b, func(num int, v uint64, _ []byte) error {
+						if num == 33 {
+							m.deprecated = v != 0
+						}
+						return nil
+					})
+				case 5:
+					m.clientStreaming = v != 0
+				case 6:
+					m.serverStreaming = v != 0
+				}
+				return nil
+			})
+			svc.methods = append(svc.methods, m)
+			return err
+		}
+		return nil
+	})
+	return svc, err
+}
+
+// readSourceComments indexes the comments of a SourceCodeInfo by source
+// path, e.g. "6.0.2.1" for the second method of the first service. The
+// leading comment of an element is taken, else its trailing one.
+func readSourceComments(data []byte, comments map[string]string) error {
+	return walkProto(data, func(num int, _ uint64, loc []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var path []string
+		var leading, trailing string
+		err := walkProto(loc, func(num int, v uint64, b []byte) error {
+			switch num {
+			case 1:
+				if b == nil {
+					path = append(path, fmt.Sprint(v))
+					return nil
+				}
+				// Packed path
+				for len(b) > 0 {
+					n, size := binary.Uvarint(b)
+					if size <= 0 {
+						return errProtoWire
+					}
+					path = append(path, fmt.Sprint(n))
+					b = b[size:]
+				}
+			case 3:
+				leading = string(b)
+			case 4:
+				trailing = string(b)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		comment := strings.TrimSpace(leading)
+		if comment == "" {
+			comment = strings.TrimSpace(trailing)
+		}
+		if comment != "" {
+			comments[strings.Join(path, ".")] = comment
+		}
+		return nil
+	})
+}
+
+// register adds the file's messages and enums to s by full name, so fields
+// can refer to them from any file of the set.
+func (f *descriptorFile) register(s *protoSchema) {
+	for _, e := range f.enums {
+		s.enums[joinField(f.pkg, e.name)] = e.values
+	}
+	var add func(scope string, msgs []descriptorMessage)
+	add = func(scope string, msgs []descriptorMessage) {
+		for _, m := range msgs {
+			full := joinField(scope, m.name)
+			s.messages[full] = &protoMessage{fields: m.fields, mapEntry: m.mapEntry}
+			for _, e := range m.enums {
+				s.enums[joinField(full, e.name)] = e.values
+			}
+			add(full, m.nested)
+		}
+	}
+	add(f.pkg, f.messages)
+}
+
+// walkProto calls fn with each field of the protobuf message data: its
+// number, and its value for varint and fixed-size fields or its bytes
+// for length-delimited ones. Groups aren't supported.
+func walkProto(data []byte, fn func(num int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoWire
+		}
+		data = data[n:]
+		num := int(key >> 3)
+		var v uint64
+		var b []byte
+		switch key & 7 {
+		case 0:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errProtoWire
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errProtoWire
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errProtoWire
+			}
+			b, data = data[n:n+int(size)], data[n+int(size):]
+			if b == nil {
+				b = []byte{}
+			}
+		case 5:
+			if len(data) < 4 {
+				return errProtoWire
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("%w: wire type %d", errProtoWire, key&7)
+		}
+		if num == 0 {
+			return errProtoWire
+		}
+		if err := fn(num, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
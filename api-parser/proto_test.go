@@ -0,0 +1,187 @@
+package apiparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProto(t *testing.T) {
+	apis, err := ParseAPIDocs("testdata/tokens.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 2 {
+		t.Fatalf("got %d APIs, want Issue and Watch: %+v", len(apis), apis)
+	}
+
+	issue := apis[0]
+	if issue.Name != "Issue" || issue.Method != MethodGRPC || issue.Path != "/umi.v1.Tokens/Issue" {
+		t.Errorf("Issue = %s %s %s", issue.Name, issue.Method, issue.Path)
+	}
+	if issue.Description != "Issue creates a new tokenized asset." || issue.Deprecated {
+		t.Errorf("Issue description %q, deprecated %v", issue.Description, issue.Deprecated)
+	}
+	if !reflect.DeepEqual(issue.Tags, []string{"Tokens", "gRPC"}) {
+		t.Errorf("Issue tags = %v", issue.Tags)
+	}
+	want := []APIField{
+		{Name: "requestId", Type: "string", Description: "Unique id of the request."},
+		// A nested message is expanded, and its enum resolved in its scope
+		{Name: "asset.kind", Type: "string", Enum: []string{"KIND_UNSPECIFIED", "GOLD"}},
+		// A sibling message resolved from a nested one, with json_name;
+		// it contains itself, so the inner one stays an object
+		{Name: "asset.holders[].holderId", Type: "string"},
+		{Name: "asset.holders[].parent", Type: "object", Description: "The holder this one holds for, if any."},
+		{Name: "asset.holdersById", Type: "map<string,object>"},
+		// The fields of a oneof are the message's own
+		{Name: "asset.grams", Type: "integer(int64)"},
+		{Name: "asset.ounces", Type: "number(double)"},
+		{Name: "tags", Type: "array"},
+		{Name: "attributes", Type: "map<string,string>"},
+		// Imported types aren't known: well-known ones keep their JSON
+		// type, others are objects
+		{Name: "issuedAt", Type: "string(date-time)"},
+		{Name: "price", Type: "object", Description: "Price of one unit."},
+		{Name: "oldRef", Type: "string", Description: "Deprecated."},
+	}
+	if !reflect.DeepEqual(issue.Fields, want) {
+		t.Errorf("Issue fields:\n got %+v\nwant %+v", issue.Fields, want)
+	}
+	if len(issue.Responses) != 1 || !reflect.DeepEqual(issue.Responses[0].Fields, []APIField{
+		{Name: "status", Type: "string", Enum: []string{"STATUS_UNSPECIFIED", "STATUS_ACTIVE"}},
+	}) {
+		t.Errorf("Issue responses = %+v", issue.Responses)
+	}
+
+	watch := apis[1]
+	if !watch.Deprecated || watch.Description != "Server streaming gRPC method Watch of umi.v1.Tokens." {
+		t.Errorf("Watch deprecated %v, description %q", watch.Deprecated, watch.Description)
+	}
+	if len(watch.Fields) != 0 {
+		t.Errorf("Watch fields = %+v, want none", watch.Fields)
+	}
+	if len(watch.Responses) != 1 || watch.Responses[0].Description != "A stream of umi.v1.Event messages." ||
+		!reflect.DeepEqual(watch.Responses[0].Fields, []APIField{{Name: "data", Type: "string(byte)"}}) {
+		t.Errorf("Watch responses = %+v", watch.Responses)
+	}
+}
+
+func TestParseProtoErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		line int
+	}{
+		{"syntax = \"proto3\";\nmessage A {\n  string a = 1;\n", 4},
+		{"message A {\n  string a 1;\n}", 2},
+		{"message A {\n  group G = 1 {}\n}", 2},
+		{"service S {\n  rpc M (A) (B);\n}", 2},
+		{"enum E {\n  A = 0;\n", 3},
+		{"package p;\nfoo bar;", 2},
+	} {
+		_, err := ParseProto(strings.NewReader(tc.src))
+		var diags *DiagnosticsError
+		if !errors.As(err, &diags) || len(diags.Diagnostics) != 1 {
+			t.Errorf("%q: err = %v, want a diagnostic", tc.src, err)
+			continue
+		}
+		if got := diags.Diagnostics[0].Line; got != tc.line {
+			t.Errorf("%q: error on line %d, want %d: %v", tc.src, got, tc.line, err)
+		}
+	}
+}
+
+// protoBuf encodes protobuf messages for descriptor set fixtures.
+type protoBuf []byte
+
+func (b protoBuf) varint(num int, v uint64) protoBuf {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func (b protoBuf) bytes(num int, v []byte) protoBuf {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b protoBuf) str(num int, s string) protoBuf { return b.bytes(num, []byte(s)) }
+
+// descriptorField is a FieldDescriptorProto: label 1 is optional and 3
+// repeated; type 9 is string, 3 int64, 11 message and 14 enum.
+func descriptorField(name string, number, label, typ uint64, typeName string) []byte {
+	f := protoBuf{}.str(1, name).varint(3, number).varint(4, label).varint(5, typ)
+	if typeName != "" {
+		f = f.str(6, typeName)
+	}
+	return f
+}
+
+// tokensDescriptorSet is a FileDescriptorSet of a tokens service built
+// with --include_imports and --include_source_info, so the Money message
+// it imports is in it.
+func tokensDescriptorSet() []byte {
+	money := protoBuf{}.str(1, "common/money.proto").str(2, "common").
+		bytes(4, protoBuf{}.str(1, "Money").
+			bytes(2, descriptorField("currency", 1, 1, 9, "")).
+			bytes(2, descriptorField("units", 2, 1, 3, "")))
+
+	entry := protoBuf{}.str(1, "AttributesEntry").
+		bytes(2, descriptorField("key", 1, 1, 9, "")).
+		bytes(2, descriptorField("value", 2, 1, 9, "")).
+		bytes(7, protoBuf{}.varint(7, 1))
+	request := protoBuf{}.str(1, "IssueRequest").
+		bytes(2, descriptorField("request_id", 1, 1, 9, "")).
+		bytes(2, descriptorField("price", 2, 1, 11, ".common.Money")).
+		bytes(2, descriptorField("tags", 3, 3, 9, "")).
+		bytes(2, descriptorField("attributes", 4, 3, 11, ".umi.v1.IssueRequest.AttributesEntry")).
+		bytes(2, descriptorField("kind", 5, 1, 14, ".umi.v1.Kind")).
+		bytes(3, entry)
+	kind := protoBuf{}.str(1, "Kind").bytes(2, protoBuf{}.str(1, "GOLD").varint(2, 0))
+	service := protoBuf{}.str(1, "Tokens").
+		bytes(2, protoBuf{}.str(1, "Issue").str(2, ".umi.v1.IssueRequest").str(3, ".umi.v1.IssueResponse"))
+	// The comment of the first method of the first service, path 6.0.2.0
+	var path []byte
+	for _, p := range []uint64{6, 0, 2, 0} {
+		path = binary.AppendUvarint(path, p)
+	}
+	sourceInfo := protoBuf{}.bytes(1, protoBuf{}.bytes(1, path).str(3, " Issue creates a new tokenized asset.\n"))
+	tokens := protoBuf{}.str(1, "umi/v1/tokens.proto").str(2, "umi.v1").str(3, "common/money.proto").
+		bytes(4, request).
+		bytes(4, protoBuf{}.str(1, "IssueResponse")).
+		bytes(5, kind).
+		bytes(6, service).
+		bytes(9, sourceInfo)
+
+	return protoBuf{}.bytes(1, money).bytes(1, tokens)
+}
+
+func TestParseDescriptorSet(t *testing.T) {
+	set := tokensDescriptorSet()
+	apis, err := ParseDescriptorSet(bytes.NewReader(set))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apis) != 1 || apis[0].Path != "/umi.v1.Tokens/Issue" || apis[0].Description != "Issue creates a new tokenized asset." {
+		t.Fatalf("APIs = %+v, want Issue with its comment", apis)
+	}
+	want := []APIField{
+		{Name: "requestId", Type: "string"},
+		// The imported message is in the set, so it is expanded
+		{Name: "price.currency", Type: "string"},
+		{Name: "price.units", Type: "integer(int64)"},
+		{Name: "tags", Type: "array"},
+		{Name: "attributes", Type: "map<string,string>"},
+		{Name: "kind", Type: "string", Enum: []string{"GOLD"}},
+	}
+	if !reflect.DeepEqual(apis[0].Fields, want) {
+		t.Errorf("Issue fields:\n got %+v\nwant %+v", apis[0].Fields, want)
+	}
+
+	if _, err := ParseDescriptorSet(bytes.NewReader(set[:len(set)-1])); !errors.Is(err, errProtoWire) {
+		t.Errorf("truncated set: err = %v, want %v", err, errProtoWire)
+	}
+}
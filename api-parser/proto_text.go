@@ -0,0 +1,554 @@
+package apiparser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// protoScalars are the scalar types of protobuf fields.
+var protoScalars = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true, "uint32": true, "uint64": true,
+	"sint32": true, "sint64": true, "fixed32": true, "fixed64": true, "sfixed32": true,
+	"sfixed64": true, "bool": true, "string": true, "bytes": true,
+}
+
+// ParseProto reads the services of a .proto file into the catalog, like
+// ParseDescriptorSet reads them from a compiled set. Types from imported
+// files aren't known, so fields of those types are listed as objects
+// rather than expanded; compile a set with protoc --include_imports to
+// expand them. Comments before a method or field, or after it on its
+// line, become its description. A syntax error is a *DiagnosticsError
+// with its line.
+func ParseProto(r io.Reader) ([]APIDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &protoParser{toks: tokenizeProto(string(data)), s: newProtoSchema(), scopes: map[*protoMessage]string{}}
+	if err := p.file(); err != nil {
+		return nil, err
+	}
+	p.resolve()
+	return p.s.apis(), nil
+}
+
+// protoToken is a word, number, quoted string or symbol of a .proto file,
+// with the comments before it.
+type protoToken struct {
+	text string
+	line int
+	// leading are the comments on the lines before the token; trailing is
+	// a comment on the line of the token before it, which belongs to that
+	// one.
+	leading  string
+	trailing string
+}
+
+func tokenizeProto(src string) []protoToken {
+	var toks []protoToken
+	var leading []string
+	trailing := ""
+	line, prevLine := 1, 0
+	comment := func(text string, at int) {
+		text = strings.TrimSpace(text)
+		if at == prevLine && len(toks) > 0 && len(leading) == 0 {
+			trailing = strings.TrimSpace(trailing + " " + text)
+			return
+		}
+		leading = append(leading, text)
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			comment(strings.TrimLeft(src[i+2:i+end], "/"), line)
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			body := src[i+2 : i+2+end]
+			var lines []string
+			for _, l := range strings.Split(body, "\n") {
+				lines = append(lines, strings.TrimLeft(strings.TrimSpace(l), "*"))
+			}
+			comment(strings.Join(lines, " "), line)
+			line += strings.Count(body, "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			toks = append(toks, protoToken{text: src[i:min(j+1, len(src))], line: line, leading: strings.Join(leading, " "), trailing: trailing})
+			leading, trailing, prevLine = nil, "", line
+			i = j + 1
+		case isProtoWordByte(c):
+			j := i
+			for j < len(src) && isProtoWordByte(src[j]) {
+				j++
+			}
+			toks = append(toks, protoToken{text: src[i:j], line: line, leading: strings.Join(leading, " "), trailing: trailing})
+			leading, trailing, prevLine = nil, "", line
+			i = j
+		default:
+			toks = append(toks, protoToken{text: string(c), line: line, leading: strings.Join(leading, " "), trailing: trailing})
+			leading, trailing, prevLine = nil, "", line
+			i++
+		}
+	}
+	return append(toks, protoToken{line: line, trailing: trailing})
+}
+
+// isProtoWordByte reports whether c is part of a name, a dotted name or a
+// number.
+func isProtoWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '+' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+type protoParser struct {
+	toks []protoToken
+	pos  int
+	pkg  string
+	s    *protoSchema
+	// scopes are the full names of the messages parsed, for resolving the
+	// types of their fields once every message is known.
+	scopes map[*protoMessage]string
+}
+
+func (p *protoParser) peek() protoToken { return p.toks[p.pos] }
+
+func (p *protoParser) next() protoToken {
+	t := p.toks[p.pos]
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *protoParser) errorf(t protoToken, format string, args ...any) error {
+	return &DiagnosticsError{Diagnostics: []Diagnostic{{Line: t.line, Reason: fmt.Sprintf(format, args...)}}}
+}
+
+func (p *protoParser) expect(text string) (protoToken, error) {
+	t := p.next()
+	if t.text != text {
+		return t, p.errorf(t, "expected %q, found %s", text, describeToken(t))
+	}
+	return t, nil
+}
+
+func (p *protoParser) name() (protoToken, error) {
+	t := p.next()
+	if t.text == "" || !isProtoWordByte(t.text[0]) {
+		return t, p.errorf(t, "expected a name, found %s", describeToken(t))
+	}
+	return t, nil
+}
+
+func describeToken(t protoToken) string {
+	if t.text == "" {
+		return "the end of the file"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// comment is the description of the declaration starting with first and
+// just read: the comments before it, else the one after it on its line.
+func (p *protoParser) comment(first protoToken) string {
+	if first.leading != "" {
+		return first.leading
+	}
+	return p.peek().trailing
+}
+
+func (p *protoParser) file() error {
+	for p.peek().text != "" {
+		t := p.next()
+		var err error
+		switch t.text {
+		case "syntax", "edition", "import", "option":
+			err = p.skipStatement()
+		case "package":
+			var name protoToken
+			if name, err = p.name(); err == nil {
+				p.pkg = name.text
+				_, err = p.expect(";")
+			}
+		case "message":
+			err = p.message(p.pkg)
+		case "enum":
+			err = p.enum(p.pkg)
+		case "service":
+			err = p.service(t)
+		case "extend":
+			err = p.skipStatement()
+		case ";":
+		default:
+			err = p.errorf(t, "unexpected %s at the top level", describeToken(t))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipStatement skips to the end of a statement: a semicolon, or a block
+// in braces.
+func (p *protoParser) skipStatement() error {
+	depth := 0
+	for {
+		t := p.next()
+		switch t.text {
+		case "":
+			return p.errorf(t, "unexpected end of the file")
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 && p.peek().text != ";" {
+				return nil
+			}
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (p *protoParser) message(scope string) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	full := joinField(scope, name.text)
+	m := &protoMessage{}
+	p.s.messages[full] = m
+	p.scopes[m] = full
+	if _, err := p.expect("{"); err != nil {
+		return err
+	}
+	return p.messageBody(m, full)
+}
+
+// messageBody reads the declarations of message m up to its closing
+// brace. A oneof's fields are read as the message's own.
+func (p *protoParser) messageBody(m *protoMessage, full string) error {
+	for {
+		t := p.peek()
+		var err error
+		switch t.text {
+		case "}":
+			p.next()
+			return nil
+		case "":
+			return p.errorf(t, "message %s isn't closed", full)
+		case ";":
+			p.next()
+		case "message":
+			p.next()
+			err = p.message(full)
+		case "enum":
+			p.next()
+			err = p.enum(full)
+		case "option", "reserved", "extensions", "extend":
+			p.next()
+			err = p.skipStatement()
+		case "oneof":
+			p.next()
+			if _, err = p.name(); err == nil {
+				if _, err = p.expect("{"); err == nil {
+					err = p.messageBody(m, full)
+				}
+			}
+		default:
+			err = p.field(m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// field reads a field declaration, e.g. repeated Asset assets = 3;. Its
+// type is resolved once every message is known.
+func (p *protoParser) field(m *protoMessage) error {
+	first := p.next()
+	f := protoField{}
+	typ := first
+	switch first.text {
+	case "repeated", "optional", "required":
+		f.repeated, f.required = first.text == "repeated", first.text == "required"
+		typ = p.next()
+	}
+	if typ.text == "map" && p.peek().text == "<" {
+		p.next()
+		key, err := p.name()
+		if err != nil {
+			return err
+		}
+		if _, err := p.expect(","); err != nil {
+			return err
+		}
+		value, err := p.name()
+		if err != nil {
+			return err
+		}
+		if _, err := p.expect(">"); err != nil {
+			return err
+		}
+		f.kind, f.typeName = "map", key.text+","+value.text
+	} else {
+		if typ.text == "" || !isProtoWordByte(typ.text[0]) {
+			return p.errorf(typ, "expected a field type, found %s", describeToken(typ))
+		}
+		if typ.text == "group" {
+			return p.errorf(typ, "groups aren't supported")
+		}
+		f.kind, f.typeName = typ.text, ""
+		if !protoScalars[typ.text] {
+			f.kind, f.typeName = "", typ.text
+		}
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	f.name, f.jsonName = name.text, protoJSONName(name.text)
+	if _, err := p.expect("="); err != nil {
+		return err
+	}
+	if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek().text == "[" {
+		if f.deprecated, f.jsonName, err = p.fieldOptions(f.jsonName); err != nil {
+			return err
+		}
+	}
+	if _, err := p.expect(";"); err != nil {
+		return err
+	}
+	f.comment = p.comment(first)
+	m.fields = append(m.fields, f)
+	return nil
+}
+
+// fieldOptions reads the options of a field in brackets, returning
+// whether it is deprecated and its JSON name, which json_name overrides.
+func (p *protoParser) fieldOptions(jsonName string) (deprecated bool, name string, err error) {
+	p.next()
+	for {
+		t := p.next()
+		switch {
+		case t.text == "]":
+			return deprecated, jsonName, nil
+		case t.text == "":
+			return false, "", p.errorf(t, "field options aren't closed")
+		case (t.text == "deprecated" || t.text == "json_name") && p.peek().text == "=":
+			p.next()
+			value := p.next()
+			if t.text == "deprecated" {
+				deprecated = value.text == "true"
+			} else {
+				jsonName = strings.Trim(value.text, `"'`)
+			}
+		}
+	}
+}
+
+func (p *protoParser) enum(scope string) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	full := joinField(scope, name.text)
+	if _, err := p.expect("{"); err != nil {
+		return err
+	}
+	var values []string
+	for {
+		t := p.next()
+		switch t.text {
+		case "}":
+			p.s.enums[full] = values
+			return nil
+		case "":
+			return p.errorf(t, "enum %s isn't closed", full)
+		case ";":
+		case "option", "reserved":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		default:
+			values = append(values, t.text)
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *protoParser) service(first protoToken) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	svc := protoService{name: joinField(p.pkg, name.text), comment: first.leading}
+	if _, err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		t := p.next()
+		switch t.text {
+		case "}":
+			p.s.services = append(p.s.services, svc)
+			return nil
+		case "":
+			return p.errorf(t, "service %s isn't closed", svc.name)
+		case ";":
+		case "option":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		case "rpc":
+			m, err := p.rpc(t)
+			if err != nil {
+				return err
+			}
+			svc.methods = append(svc.methods, m)
+		default:
+			return p.errorf(t, "unexpected %s in service %s", describeToken(t), svc.name)
+		}
+	}
+}
+
+// rpc reads a method, e.g. rpc Issue (IssueRequest) returns (stream
+// Event) {}. Its types are resolved with the messages'.
+func (p *protoParser) rpc(first protoToken) (protoMethod, error) {
+	var m protoMethod
+	name, err := p.name()
+	if err != nil {
+		return m, err
+	}
+	m.name = name.text
+	if m.clientStreaming, m.input, err = p.rpcType(); err != nil {
+		return m, err
+	}
+	if _, err := p.expect("returns"); err != nil {
+		return m, err
+	}
+	if m.serverStreaming, m.output, err = p.rpcType(); err != nil {
+		return m, err
+	}
+	if p.peek().text == ";" {
+		p.next()
+		m.comment = p.comment(first)
+		return m, nil
+	}
+	if _, err := p.expect("{"); err != nil {
+		return m, err
+	}
+	for {
+		t := p.next()
+		switch t.text {
+		case "}":
+			m.comment = p.comment(first)
+			if p.peek().text == ";" {
+				p.next()
+			}
+			return m, nil
+		case "":
+			return m, p.errorf(t, "method %s isn't closed", m.name)
+		case "option":
+			if p.peek().text == "deprecated" {
+				p.next()
+				if _, err := p.expect("="); err != nil {
+					return m, err
+				}
+				m.deprecated = p.next().text == "true"
+			}
+			if err := p.skipStatement(); err != nil {
+				return m, err
+			}
+		}
+	}
+}
+
+func (p *protoParser) rpcType() (stream bool, typ string, err error) {
+	if _, err := p.expect("("); err != nil {
+		return false, "", err
+	}
+	if p.peek().text == "stream" && p.toks[p.pos+1].text != ")" {
+		p.next()
+		stream = true
+	}
+	t, err := p.name()
+	if err != nil {
+		return false, "", err
+	}
+	if _, err := p.expect(")"); err != nil {
+		return false, "", err
+	}
+	return stream, t.text, nil
+}
+
+// resolve turns the type names of fields and methods into full names now
+// every message and enum of the file is known. Types from other files
+// are taken as messages.
+func (p *protoParser) resolve() {
+	for m, scope := range p.scopes {
+		for i := range m.fields {
+			f := &m.fields[i]
+			switch f.kind {
+			case "map":
+				key, value, _ := strings.Cut(f.typeName, ",")
+				entry := &protoMessage{mapEntry: true, fields: []protoField{p.typedField(scope, "key", key), p.typedField(scope, "value", value)}}
+				f.kind, f.typeName = "message", scope+"."+f.name+"Entry"
+				p.s.messages[f.typeName] = entry
+			case "":
+				full, kind := p.s.resolveType(scope, f.typeName)
+				if kind == "" {
+					kind = "message"
+				}
+				f.kind, f.typeName = kind, full
+			}
+		}
+	}
+	for i := range p.s.services {
+		svc := &p.s.services[i]
+		for j := range svc.methods {
+			svc.methods[j].input, _ = p.s.resolveType(p.pkg, svc.methods[j].input)
+			svc.methods[j].output, _ = p.s.resolveType(p.pkg, svc.methods[j].output)
+		}
+	}
+}
+
+func (p *protoParser) typedField(scope, name, typ string) protoField {
+	f := protoField{name: name, jsonName: name, kind: typ}
+	if !protoScalars[typ] {
+		f.typeName, f.kind = p.s.resolveType(scope, typ)
+		if f.kind == "" {
+			f.kind = "message"
+		}
+	}
+	return f
+}
@@ -0,0 +1,145 @@
+package apiparser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxRemoteDocs bounds the size of downloaded docs.
+const maxRemoteDocs = 32 << 20
+
+// IsURL reports whether the docs location is an http or https URL rather
+// than a path.
+func IsURL(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// cacheMeta is what is kept next to cached docs to revalidate them.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Fetched      string `json:"fetched"`
+}
+
+// FetchAPIDocs downloads and parses the API docs at rawURL, in any format
+// ParseAPIDocs reads. The last copy that parsed is cached in cacheDir and
+// revalidated with its ETag or Last-Modified date, so unchanged docs aren't
+// downloaded again. When the server can't be reached or fails, the cached
+// copy is used and stale says why; without one that is an error. Docs that
+// don't parse are an error and leave the cache as it was. A cache that
+// can't be written is logged.
+func FetchAPIDocs(ctx context.Context, client *http.Client, rawURL, cacheDir string) (apis []APIDoc, stale error, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch docs: %w", err)
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	base := filepath.Join(cacheDir, hex.EncodeToString(sum[:8]))
+	// The parser tells YAML docs by their extension
+	name := u.Path
+
+	var meta cacheMeta
+	cached, cacheErr := os.ReadFile(base + ".docs")
+	if cacheErr == nil {
+		if raw, err := os.ReadFile(base + ".json"); err == nil {
+			json.Unmarshal(raw, &meta)
+		}
+	}
+	useCache := func(why error) ([]APIDoc, error, error) {
+		if cacheErr != nil {
+			return nil, nil, fmt.Errorf("fetch docs %s: %w (no cached copy)", rawURL, why)
+		}
+		apis, err := parseDocs(name, cached, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cached docs for %s: %w", rawURL, err)
+		}
+		return apis, why, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch docs: %w", err)
+	}
+	if cacheErr == nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return useCache(err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cacheErr == nil:
+		apis, _, err := useCache(nil)
+		return apis, nil, err
+	case resp.StatusCode != http.StatusOK:
+		return useCache(fmt.Errorf("server answered %s", resp.Status))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteDocs+1))
+	if err != nil {
+		return useCache(err)
+	}
+	if len(data) > maxRemoteDocs {
+		return nil, nil, fmt.Errorf("fetch docs %s: larger than %d bytes", rawURL, maxRemoteDocs)
+	}
+	apis, err = parseDocs(name, data, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("docs at %s: %w", rawURL, err)
+	}
+
+	meta = cacheMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now().UTC().Format(time.RFC3339),
+	}
+	// The docs are good without a cached copy; the next start downloads
+	// them again
+	if err := writeCache(base, data, meta); err != nil {
+		log.Printf("cache docs %s: %v", rawURL, err)
+	}
+	return apis, nil, nil
+}
+
+// writeCache replaces the cached docs and their metadata, each by renaming
+// a complete file into place.
+func writeCache(base string, data []byte, meta cacheMeta) error {
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		path string
+		data []byte
+	}{{base + ".docs", data}, {base + ".json", raw}} {
+		tmp := f.path + ".tmp"
+		if err := os.WriteFile(tmp, f.data, 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, f.path); err != nil {
+			return errors.Join(err, os.Remove(tmp))
+		}
+	}
+	return nil
+}
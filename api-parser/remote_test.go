@@ -0,0 +1,40 @@
+package apiparser
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchAPIDocsWithoutCache(t *testing.T) {
+	spec, err := os.ReadFile("testdata/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(spec)
+	}))
+	defer srv.Close()
+	// The cache directory can't be made under a file
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	apis, stale, err := FetchAPIDocs(context.Background(), srv.Client(), srv.URL+"/swagger.json", filepath.Join(blocker, "cache"))
+	if err != nil || stale != nil || len(apis) == 0 {
+		t.Fatalf("FetchAPIDocs = %d APIs, stale %v, err %v; want the docs", len(apis), stale, err)
+	}
+	if !strings.Contains(logs.String(), "cache docs "+srv.URL) {
+		t.Errorf("log = %q, want the cache error", logs.String())
+	}
+}
@@ -0,0 +1,184 @@
+package apiparser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// swaggerDoc is the part of a Swagger 2.0 document the catalog needs.
+// Definitions use the same schema objects as OpenAPI 3.0.
+type swaggerDoc struct {
+	Swagger     string                       `json:"swagger" yaml:"swagger"`
+	BasePath    string                       `json:"basePath" yaml:"basePath"`
+	Consumes    []string                     `json:"consumes" yaml:"consumes"`
+	Produces    []string                     `json:"produces" yaml:"produces"`
+	Paths       map[string]swaggerPath       `json:"paths" yaml:"paths"`
+	Definitions map[string]*openAPISchema    `json:"definitions" yaml:"definitions"`
+	Parameters  map[string]*swaggerParameter `json:"parameters" yaml:"parameters"`
+}
+
+type swaggerPath struct {
+	Get        *swaggerOperation   `json:"get" yaml:"get"`
+	Put        *swaggerOperation   `json:"put" yaml:"put"`
+	Post       *swaggerOperation   `json:"post" yaml:"post"`
+	Delete     *swaggerOperation   `json:"delete" yaml:"delete"`
+	Options    *swaggerOperation   `json:"options" yaml:"options"`
+	Head       *swaggerOperation   `json:"head" yaml:"head"`
+	Patch      *swaggerOperation   `json:"patch" yaml:"patch"`
+	Parameters []*swaggerParameter `json:"parameters" yaml:"parameters"`
+}
+
+type swaggerOperation struct {
+	OperationID string              `json:"operationId" yaml:"operationId"`
+	Summary     string              `json:"summary" yaml:"summary"`
+	Description string              `json:"description" yaml:"description"`
+	Deprecated  bool                `json:"deprecated" yaml:"deprecated"`
+	Tags        []string            `json:"tags" yaml:"tags"`
+	Consumes    []string            `json:"consumes" yaml:"consumes"`
+	Produces    []string            `json:"produces" yaml:"produces"`
+	Parameters  []*swaggerParameter `json:"parameters" yaml:"parameters"`
+	Responses   map[string]*struct {
+		Description string         `json:"description" yaml:"description"`
+		Schema      *openAPISchema `json:"schema" yaml:"schema"`
+	} `json:"responses" yaml:"responses"`
+}
+
+type swaggerParameter struct {
+	Ref         string         `json:"$ref" yaml:"$ref"`
+	Name        string         `json:"name" yaml:"name"`
+	In          string         `json:"in" yaml:"in"`
+	Description string         `json:"description" yaml:"description"`
+	Required    bool           `json:"required" yaml:"required"`
+	Type        string         `json:"type" yaml:"type"`
+	Format      string         `json:"format" yaml:"format"`
+	Items       *openAPISchema `json:"items" yaml:"items"`
+	Schema      *openAPISchema `json:"schema" yaml:"schema"`
+	Enum        []any          `json:"enum" yaml:"enum"`
+	// Swagger 2.0 has no example on parameters; x-example is the usual
+	// extension.
+	Example any `json:"x-example" yaml:"x-example"`
+	Default any `json:"default" yaml:"default"`
+}
+
+// ParseSwagger reads a Swagger 2.0 document, as YAML or JSON, into the
+// catalog the way ParseOpenAPI reads OpenAPI 3.0: an API per operation,
+// with the schema of its body parameter, or else its form parameters,
+// flattened into fields. Paths include the document's basePath.
+func ParseSwagger(r io.Reader) ([]APIDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc swaggerDoc
+	if err := decodeSpec(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse Swagger document: %w", err)
+	}
+	if doc.Swagger != "2.0" {
+		return nil, fmt.Errorf("%w: Swagger version %q; only 2.0 documents are read", ErrUnsupportedSpec, doc.Swagger)
+	}
+	return doc.openAPI().apis(), nil
+}
+
+// openAPI converts the document to the OpenAPI 3.0 form ParseOpenAPI reads.
+func (d *swaggerDoc) openAPI() *openAPIDoc {
+	out := &openAPIDoc{
+		OpenAPI:    "3.0.0",
+		Paths:      make(map[string]openAPIPath, len(d.Paths)),
+		Components: openAPIComponents{Schemas: d.Definitions},
+	}
+	base := strings.TrimSuffix(d.BasePath, "/")
+	for path, item := range d.Paths {
+		op := func(o *swaggerOperation) *openAPIOperation {
+			if o == nil {
+				return nil
+			}
+			return d.operation(o, item.Parameters)
+		}
+		out.Paths[base+path] = openAPIPath{
+			Get: op(item.Get), Put: op(item.Put), Post: op(item.Post), Delete: op(item.Delete),
+			Options: op(item.Options), Head: op(item.Head), Patch: op(item.Patch),
+		}
+	}
+	return out
+}
+
+// operation converts o, whose path declares shared, moving its body or
+// form parameters into a request body. Its other parameters are kept as
+// they are.
+func (d *swaggerDoc) operation(o *swaggerOperation, shared []*swaggerParameter) *openAPIOperation {
+	out := &openAPIOperation{
+		OperationID: o.OperationID,
+		Summary:     o.Summary,
+		Description: o.Description,
+		Deprecated:  o.Deprecated,
+		Tags:        o.Tags,
+	}
+	mediaType := "application/json"
+	consumes := o.Consumes
+	if len(consumes) == 0 {
+		consumes = d.Consumes
+	}
+	if len(consumes) > 0 {
+		mediaType = consumes[0]
+	}
+
+	form := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, p := range append(shared[:len(shared):len(shared)], o.Parameters...) {
+		if p != nil && p.Ref != "" {
+			p = d.Parameters[strings.TrimPrefix(p.Ref, "#/parameters/")]
+		}
+		if p == nil {
+			continue
+		}
+		switch p.In {
+		case "body":
+			if p.Schema != nil {
+				out.RequestBody = &openAPIRequestBody{
+					Description: p.Description,
+					Content:     map[string]openAPIMediaType{mediaType: {Schema: p.Schema}},
+				}
+			}
+		case "formData":
+			form.Properties[p.Name] = &openAPISchema{Type: p.Type, Format: p.Format, Description: p.Description, Items: p.Items, Enum: p.Enum, Example: p.Example, Default: p.Default}
+			if p.Required {
+				form.Required = append(form.Required, p.Name)
+			}
+		case InPath, InQuery, InHeader:
+			out.Parameters = append(out.Parameters, &openAPIParameter{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required,
+				Schema:      &openAPISchema{Type: p.Type, Format: p.Format, Items: p.Items, Enum: p.Enum, Default: p.Default},
+				Example:     p.Example,
+			})
+		}
+	}
+	if out.RequestBody == nil && len(form.Properties) > 0 {
+		out.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{mediaType: {Schema: form}}}
+	}
+
+	produces := o.Produces
+	if len(produces) == 0 {
+		produces = d.Produces
+	}
+	responseType := "application/json"
+	if len(produces) > 0 {
+		responseType = produces[0]
+	}
+	for status, r := range o.Responses {
+		if r == nil {
+			continue
+		}
+		if out.Responses == nil {
+			out.Responses = map[string]*openAPIRequestBody{}
+		}
+		response := &openAPIRequestBody{Description: r.Description}
+		if r.Schema != nil {
+			response.Content = map[string]openAPIMediaType{responseType: {Schema: r.Schema}}
+		}
+		out.Responses[status] = response
+	}
+	return out
+}
@@ -0,0 +1,272 @@
+package apiparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidDocs is returned for API docs that don't follow their format.
+var ErrInvalidDocs = errors.New("invalid API docs")
+
+// yamlDocs is the YAML docs format:
+//
+//	apis:
+//	  - name: Issue
+//	    path: /token/ReqIssue
+//	    method: POST
+//	    description: Issue tokens for an asset
+//	    version: v2
+//	    tags: [Tokenization]
+//	    fields:
+//	      - name: dryRun
+//	        type: boolean
+//	        in: query
+//	      - name: context.requestId
+//	        type: string
+//	        required: true
+//	        description: Unique id of the request
+//	      - name: payload.tokenizedAsset[].status
+//	        type: string
+//	        allowed: [ACTIVE, LOCKED]
+//	    responses:
+//	      - status: 202
+//	        description: Accepted for processing
+//	        fields:
+//	          - name: ack.status
+//	            type: string
+//	    errors:
+//	      - code: E403
+//	        meaning: The caller may not issue this asset
+//	        retryable: false
+type yamlDocs struct {
+	APIs []yamlAPI `yaml:"apis"`
+}
+
+type yamlAPI struct {
+	Name        string         `yaml:"name"`
+	Path        string         `yaml:"path"`
+	Method      string         `yaml:"method"`
+	Description string         `yaml:"description"`
+	Version     string         `yaml:"version"`
+	Deprecated  bool           `yaml:"deprecated"`
+	ReplacedBy  string         `yaml:"replacedBy"`
+	Tags        []string       `yaml:"tags"`
+	Group       string         `yaml:"group"`
+	Categories  []string       `yaml:"categories"`
+	Fields      []yamlField    `yaml:"fields"`
+	Responses   []yamlResponse `yaml:"responses"`
+	Errors      []yamlError    `yaml:"errors"`
+}
+
+type yamlError struct {
+	Code      string `yaml:"code"`
+	Meaning   string `yaml:"meaning"`
+	Retryable bool   `yaml:"retryable"`
+}
+
+type yamlResponse struct {
+	Status      string      `yaml:"status"`
+	Description string      `yaml:"description"`
+	Fields      []yamlField `yaml:"fields"`
+}
+
+type yamlField struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	Required    bool     `yaml:"required"`
+	Allowed     []string `yaml:"allowed"`
+	Example     string   `yaml:"example"`
+	Default     string   `yaml:"default"`
+	Description string   `yaml:"description"`
+	In          string   `yaml:"in"`
+}
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// ParseYAMLDocs reads API docs in the YAML format. Unlike the markdown
+// format, nothing is skipped: unknown keys, APIs without a name, path or
+// method, and fields without a name or type are errors naming their line.
+func ParseYAMLDocs(r io.Reader) ([]APIDoc, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var docs yamlDocs
+	if err := dec.Decode(&docs); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: no apis", ErrInvalidDocs)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDocs, oneLine(strings.TrimPrefix(err.Error(), "yaml: ")))
+	}
+	if len(docs.APIs) == 0 {
+		return nil, fmt.Errorf("%w: no apis", ErrInvalidDocs)
+	}
+	// The same document as nodes, for the line numbers of errors
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocs, err)
+	}
+	apiNodes := sequence(&root, "apis")
+
+	var problems []Diagnostic
+	names := map[string]int{}
+	apis := make([]APIDoc, 0, len(docs.APIs))
+	for i, a := range docs.APIs {
+		line := lineOf(apiNodes, i)
+		api, fieldProblems := a.doc(nodeAt(apiNodes, i))
+		problems = append(problems, fieldProblems...)
+		switch {
+		case api.Name == "":
+			problems = append(problems, Diagnostic{Line: line, Reason: "api has no name"})
+		case names[strings.ToLower(api.VersionedName())] > 0:
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("api %q is already defined on line %d", api.VersionedName(), names[strings.ToLower(api.VersionedName())])})
+		default:
+			names[strings.ToLower(api.VersionedName())] = line
+		}
+		if !strings.HasPrefix(api.Path, "/") {
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("api %q needs a path starting with /", api.Name)})
+		}
+		if !validMethod(api.Method) {
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("api %q has method %q; use one of %s", api.Name, a.Method, strings.Join(httpMethods, ", "))})
+		}
+		apis = append(apis, api)
+	}
+	if len(problems) > 0 {
+		return nil, &DiagnosticsError{Diagnostics: problems}
+	}
+	return apis, nil
+}
+
+// doc converts a, whose node is node, listing the problems of its fields
+// and responses.
+func (a yamlAPI) doc(node *yaml.Node) (APIDoc, []Diagnostic) {
+	api := APIDoc{
+		Name:        strings.TrimSpace(a.Name),
+		Path:        strings.TrimSpace(a.Path),
+		Method:      strings.ToUpper(strings.TrimSpace(a.Method)),
+		Description: oneLine(a.Description),
+		Version:     strings.TrimSpace(a.Version),
+		Deprecated:  a.Deprecated,
+		ReplacedBy:  strings.TrimSpace(a.ReplacedBy),
+		Tags:        tagList(append(append([]string{a.Group}, a.Tags...), a.Categories...)...),
+	}
+	owner := fmt.Sprintf("api %q", api.Name)
+	var problems []Diagnostic
+	api.Fields, problems = yamlFields(a.Fields, sequence(node, "fields"), owner)
+
+	responseNodes := sequence(node, "responses")
+	for i, r := range a.Responses {
+		response := APIResponse{Status: strings.ToLower(strings.TrimSpace(r.Status)), Description: oneLine(r.Description)}
+		if !reStatus.MatchString(response.Status) {
+			problems = append(problems, Diagnostic{Line: lineOf(responseNodes, i), Reason: fmt.Sprintf("response of %s has status %q; use a status code such as 200, or default", owner, r.Status)})
+		}
+		var fieldProblems []Diagnostic
+		response.Fields, fieldProblems = yamlFields(r.Fields, sequence(nodeAt(responseNodes, i), "fields"), fmt.Sprintf("response %s of %s", response.Status, owner))
+		problems = append(problems, fieldProblems...)
+		api.Responses = append(api.Responses, response)
+	}
+
+	errorNodes := sequence(node, "errors")
+	for i, e := range a.Errors {
+		apiErr := APIError{Code: strings.TrimSpace(e.Code), Meaning: oneLine(e.Meaning), Retryable: e.Retryable}
+		line := lineOf(errorNodes, i)
+		_, dup := api.Error(apiErr.Code)
+		switch {
+		case apiErr.Code == "":
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("error of %s has no code", owner)})
+		case dup:
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("error %s of %s is listed twice", apiErr.Code, owner)})
+		case apiErr.Meaning == "":
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("error %s of %s has no meaning", apiErr.Code, owner)})
+		}
+		api.Errors = append(api.Errors, apiErr)
+	}
+	return api, problems
+}
+
+// yamlFields converts the fields of owner, e.g. `api "Issue"`, whose nodes
+// are nodes, listing their problems.
+func yamlFields(in []yamlField, nodes []*yaml.Node, owner string) ([]APIField, []Diagnostic) {
+	var fields []APIField
+	var problems []Diagnostic
+	seen := map[string]bool{}
+	for i, f := range in {
+		field := APIField{
+			Name:        strings.TrimSpace(f.Name),
+			Type:        strings.TrimSpace(f.Type),
+			Required:    f.Required,
+			Enum:        enumList(strings.Join(f.Allowed, ",")),
+			Example:     strings.TrimSpace(f.Example),
+			Default:     strings.TrimSpace(f.Default),
+			Description: oneLine(f.Description),
+		}
+		in, inOK := fieldLocation(f.In)
+		field.In = in
+		line := lineOf(nodes, i)
+		switch {
+		case field.Name == "":
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("field of %s has no name", owner)})
+		case seen[field.Name]:
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("field %q of %s is listed twice", field.Name, owner)})
+		case field.Type == "":
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("field %q of %s has no type", field.Name, owner)})
+		case field.Example != "" && len(field.Enum) > 0 && !slices.Contains(field.Enum, field.Example):
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("example %q of field %q is not among its allowed values", field.Example, field.Name)})
+		case field.Default != "" && len(field.Enum) > 0 && !slices.Contains(field.Enum, field.Default):
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("default %q of field %q is not among its allowed values", field.Default, field.Name)})
+		case !inOK:
+			problems = append(problems, Diagnostic{Line: line, Reason: fmt.Sprintf("field %q of %s is in %q; use body, path, query or header", field.Name, owner, f.In)})
+		}
+		seen[field.Name] = true
+		fields = append(fields, field)
+	}
+	return fields, problems
+}
+
+func validMethod(method string) bool {
+	for _, m := range httpMethods {
+		if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+// sequence returns the items of the sequence under key in the mapping n, or
+// in the document n.
+func sequence(n *yaml.Node, key string) []*yaml.Node {
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key && n.Content[i+1].Kind == yaml.SequenceNode {
+			return n.Content[i+1].Content
+		}
+	}
+	return nil
+}
+
+func nodeAt(nodes []*yaml.Node, i int) *yaml.Node {
+	if i < len(nodes) {
+		return nodes[i]
+	}
+	return nil
+}
+
+func lineOf(nodes []*yaml.Node, i int) int {
+	if n := nodeAt(nodes, i); n != nil {
+		return n.Line
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	archiveKindSession = "session"
+	archiveKindMessage = "message"
+)
+
+// ArchiveRecord is one line of a session archive. Archives are NDJSON: every
+// session is written as a "session" record carrying its metadata, followed by
+// one "message" record per stored message in chronological order.
+type ArchiveRecord struct {
+	Kind          string `json:"kind"`
+	Session       string `json:"session"`
+	Role          string `json:"role,omitempty"`
+	Content       string `json:"content,omitempty"`
+	Created       string `json:"created,omitempty"`
+	MessageCount  int    `json:"messageCount,omitempty"`
+	LastMessageAt string `json:"lastMessageAt,omitempty"`
+}
+
+// ImportResult summarises what an archive import changed.
+type ImportResult struct {
+	SessionsImported int      `json:"sessionsImported"`
+	SessionsSkipped  []string `json:"sessionsSkipped,omitempty"`
+	MessagesImported int      `json:"messagesImported"`
+}
+
+// ExportSessions streams every stored session to w as NDJSON.
+func (s *ChatService) ExportSessions(ctx context.Context, w io.Writer) error {
+	sessions, err := s.querySessions(ctx, -1)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, session := range sessions {
+		if err := enc.Encode(ArchiveRecord{
+			Kind:          archiveKindSession,
+			Session:       session.ID,
+			MessageCount:  session.MessageCount,
+			LastMessageAt: session.LastMessageAt,
+		}); err != nil {
+			return fmt.Errorf("write session %s: %w", session.ID, err)
+		}
+
+		messages, err := s.GetSessionMessages(ctx, session.ID, session.MessageCount)
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			if err := enc.Encode(ArchiveRecord{
+				Kind:    archiveKindMessage,
+				Session: session.ID,
+				Role:    msg.Role,
+				Content: msg.Content,
+				Created: msg.Created,
+			}); err != nil {
+				return fmt.Errorf("write message for %s: %w", session.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportSessions loads an archive produced by ExportSessions. Sessions that
+// already exist in the store are skipped rather than merged so re-running an
+// import is safe.
+func (s *ChatService) ImportSessions(ctx context.Context, r io.Reader) (ImportResult, error) {
+	if s.writes == nil {
+		return s.importSessions(ctx, r)
+	}
+	// Imported messages take ids the queue would otherwise hand out
+	var result ImportResult
+	err := s.writes.exclusive(ctx, func() error {
+		var err error
+		result, err = s.importSessions(ctx, r)
+		return err
+	})
+	return result, err
+}
+
+func (s *ChatService) importSessions(ctx context.Context, r io.Reader) (ImportResult, error) {
+	var result ImportResult
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	insert := fmt.Sprintf("INSERT INTO %s (session, content, type, created) VALUES (?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP));", s.table)
+	exists := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE session = ?;", s.table)
+
+	skipped := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+
+		var rec ArchiveRecord
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		rec.Session = strings.TrimSpace(rec.Session)
+		if rec.Session == "" {
+			return result, fmt.Errorf("line %d: session is required", line)
+		}
+
+		switch rec.Kind {
+		case archiveKindSession:
+			var count int
+			if err := tx.QueryRowContext(ctx, exists, rec.Session).Scan(&count); err != nil {
+				return result, fmt.Errorf("line %d: check session: %w", line, err)
+			}
+			if count > 0 {
+				skipped[rec.Session] = true
+				result.SessionsSkipped = append(result.SessionsSkipped, rec.Session)
+				continue
+			}
+			result.SessionsImported++
+		case archiveKindMessage:
+			if skipped[rec.Session] {
+				continue
+			}
+			var created sql.NullString
+			if rec.Created != "" {
+				created = sql.NullString{String: rec.Created, Valid: true}
+			}
+			if _, err := tx.ExecContext(ctx, insert, rec.Session, rec.Content, messageTypeFromRole(rec.Role), created); err != nil {
+				return result, fmt.Errorf("line %d: insert message: %w", line, err)
+			}
+			result.MessagesImported++
+		default:
+			return result, fmt.Errorf("line %d: unknown record kind %q", line, rec.Kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("read archive: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit import: %w", err)
+	}
+
+	return result, nil
+}
+
+func messageTypeFromRole(role string) string {
+	switch role {
+	case "user":
+		return string(llms.ChatMessageTypeHuman)
+	case "system":
+		return string(llms.ChatMessageTypeSystem)
+	default:
+		return string(llms.ChatMessageTypeAI)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"api-recommender/payload"
+
+	"github.com/google/uuid"
+)
+
+const artifactsSchema = `
+CREATE TABLE IF NOT EXISTS artifacts (
+	id TEXT PRIMARY KEY,
+	session TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_artifacts_session ON artifacts (session);`
+
+// Kinds of artifact. Payloads shown in a reply are stored under the kind
+// of the message that shows them.
+const (
+	ArtifactPayload      = MessageKindPayload
+	ArtifactEventPayload = MessageKindEventPayload
+	// ArtifactConverted is the output of POST /api/v1/convert.
+	ArtifactConverted = "converted"
+)
+
+// Artifact is a generated payload or export, stored so it can be downloaded
+// and shared by id instead of being copied out of a chat message.
+type Artifact struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"contentType"`
+	// SessionID is the session the artifact was generated in; empty for
+	// outputs of session-less endpoints such as conversion.
+	SessionID string `json:"sessionId,omitempty"`
+	// MessageID is the assistant message that presented the artifact.
+	MessageID int64  `json:"messageId,omitempty"`
+	Size      int    `json:"size"`
+	Created   string `json:"created,omitempty"`
+	URL       string `json:"url"`
+	// Generation is how a generated payload came about; nil for other
+	// artifacts and ones stored before it was recorded.
+	Generation *Generation `json:"generation,omitempty"`
+	Content    string      `json:"-"`
+}
+
+// ArtifactLink points a reply at a stored artifact.
+type ArtifactLink struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+	Size int    `json:"size"`
+	// Preview is set when the reply shows only part of the artifact, and
+	// Reason then says which limit the artifact broke.
+	Preview    bool        `json:"preview,omitempty"`
+	Reason     string      `json:"reason,omitempty"`
+	Generation *Generation `json:"generation,omitempty"`
+}
+
+func ensureArtifactsSchema(db *sql.DB) error {
+	if _, err := db.Exec(artifactsSchema); err != nil {
+		return fmt.Errorf("create artifacts schema: %w", err)
+	}
+	// The first artifacts were all oversized sample payloads
+	if err := addColumnIfMissing(db, "artifacts", "kind", "TEXT NOT NULL DEFAULT '"+ArtifactPayload+"'"); err != nil {
+		return fmt.Errorf("create artifacts schema: %w", err)
+	}
+	if err := addColumnIfMissing(db, "artifacts", "message_id", "INTEGER"); err != nil {
+		return fmt.Errorf("create artifacts schema: %w", err)
+	}
+	if err := addColumnIfMissing(db, "artifacts", "generation", "TEXT"); err != nil {
+		return fmt.Errorf("create artifacts schema: %w", err)
+	}
+	return nil
+}
+
+func artifactURL(id string) string {
+	return apiV1Prefix + "/artifacts/" + id
+}
+
+// storeArtifact keeps content as an artifact of kind and returns a link to
+// it. gen is nil for artifacts that weren't generated by the model.
+func (s *ChatService) storeArtifact(ctx context.Context, sessionID, kind, content string, gen *Generation) (ArtifactLink, error) {
+	id := uuid.NewString()
+	content = strings.TrimSpace(content)
+	var generation sql.NullString
+	if gen != nil {
+		data, err := json.Marshal(gen)
+		if err != nil {
+			return ArtifactLink{}, fmt.Errorf("store artifact: %w", err)
+		}
+		generation = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO artifacts (id, session, kind, content_type, content, generation) VALUES (?, ?, ?, ?, ?, ?);",
+		id, sessionID, kind, contentTypeOf(content), content, generation)
+	if err != nil {
+		return ArtifactLink{}, fmt.Errorf("store artifact: %w", err)
+	}
+	return ArtifactLink{ID: id, Kind: kind, URL: artifactURL(id), Size: len(content), Generation: gen}, nil
+}
+
+// decodeGeneration reads the generation column, which is NULL for
+// artifacts without one.
+func decodeGeneration(column sql.NullString) (*Generation, error) {
+	if !column.Valid || column.String == "" {
+		return nil, nil
+	}
+	var gen Generation
+	if err := json.Unmarshal([]byte(column.String), &gen); err != nil {
+		return nil, fmt.Errorf("decode artifact generation: %w", err)
+	}
+	return &gen, nil
+}
+
+// Artifact loads a stored artifact with its content.
+func (s *ChatService) Artifact(ctx context.Context, id string) (*Artifact, error) {
+	a := Artifact{ID: id, URL: artifactURL(id)}
+	var messageID sql.NullInt64
+	var created, generation sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT session, kind, content_type, content, message_id, created, generation FROM artifacts WHERE id = ?;", id).
+		Scan(&a.SessionID, &a.Kind, &a.ContentType, &a.Content, &messageID, &created, &generation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no artifact %s", ErrArtifactNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load artifact: %w", err)
+	}
+	if a.SessionID != "" {
+		if err := s.checkNotDeleted(ctx, a.SessionID); err != nil {
+			return nil, fmt.Errorf("%w: no artifact %s", ErrArtifactNotFound, id)
+		}
+	}
+	a.Size, a.MessageID, a.Created = len(a.Content), messageID.Int64, created.String
+	if a.Generation, err = decodeGeneration(generation); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SessionArtifacts lists the artifacts generated in a session, oldest
+// first, without their content.
+func (s *ChatService) SessionArtifacts(ctx context.Context, sessionID string) ([]Artifact, error) {
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, content_type, length(content), message_id, created, generation
+		FROM artifacts WHERE session = ? ORDER BY created, rowid;`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	artifacts := []Artifact{}
+	for rows.Next() {
+		a := Artifact{SessionID: sessionID}
+		var messageID sql.NullInt64
+		var created, generation sql.NullString
+		if err := rows.Scan(&a.ID, &a.Kind, &a.ContentType, &a.Size, &messageID, &created, &generation); err != nil {
+			return nil, fmt.Errorf("scan artifact: %w", err)
+		}
+		a.URL, a.MessageID, a.Created = artifactURL(a.ID), messageID.Int64, created.String
+		var err error
+		if a.Generation, err = decodeGeneration(generation); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// storePayloads stores the recommendation's payloads as artifacts with how
+// they were generated. Payloads over the configured limits are swapped for
+// a preview in the copy of the recommendation it returns, and watermarked
+// ones carry their generation; rec itself keeps the payloads as generated.
+func (s *ChatService) storePayloads(ctx context.Context, sessionID string, rec *Recommendation) (*Recommendation, []ArtifactLink, error) {
+	shown := *rec
+	gen := s.generation(ctx, sessionID)
+	var links []ArtifactLink
+	for _, p := range []struct {
+		kind string
+		raw  *string
+	}{
+		{ArtifactPayload, &shown.Payload},
+		{ArtifactEventPayload, &shown.EventPayload},
+	} {
+		if strings.TrimSpace(*p.raw) == "" {
+			continue
+		}
+		*p.raw = s.watermark(ctx, *p.raw, gen)
+		link, err := s.storeArtifact(ctx, sessionID, p.kind, *p.raw, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		if preview, over := payload.Summarize(*p.raw, s.payloadLimits()); over {
+			link.Preview, link.Reason = true, preview.Reason
+			*p.raw = preview.Text
+		}
+		links = append(links, link)
+	}
+	return &shown, links, nil
+}
+
+func (s *ChatService) payloadLimits() payload.Limits {
+	return payload.Limits{
+		MaxBytes:     s.cfg.PayloadLimits.MaxBytes,
+		MaxDepth:     s.cfg.PayloadLimits.MaxDepth,
+		PreviewItems: s.cfg.PayloadLimits.PreviewItems,
+	}
+}
+
+// linkArtifacts records which of the turn's messages presents each
+// artifact: the first message of the artifact's kind.
+func (s *ChatService) linkArtifacts(ctx context.Context, links []ArtifactLink, replies []TurnMessage) error {
+	for _, l := range links {
+		for _, m := range replies {
+			if m.Kind != l.Kind {
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, "UPDATE artifacts SET message_id = ? WHERE id = ?;", m.ID, l.ID); err != nil {
+				return fmt.Errorf("link artifact: %w", err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// contentTypeOf tells XML payloads from JSON ones.
+func contentTypeOf(content string) string {
+	if strings.HasPrefix(strings.TrimSpace(content), "<") {
+		return "application/xml"
+	}
+	return "application/json"
+}
@@ -0,0 +1,174 @@
+// Package assets looks up existing assets so flows that act on an asset, such
+// as burn, can use real ids instead of placeholders.
+package assets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an asset id is unknown to the lookup.
+var ErrNotFound = errors.New("asset not found")
+
+// Asset is the subset of an asset's attributes the recommender needs.
+type Asset struct {
+	ID      string `json:"id"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Created string `json:"created,omitempty"` // RFC 3339
+}
+
+// AssetRegistry is the source of existing assets. Implementations back onto a
+// local export or the ledger's query service.
+type AssetRegistry interface {
+	// Get returns the asset with id, or ErrNotFound.
+	Get(ctx context.Context, id string) (Asset, error)
+	// ListByOwner returns the assets held by owner, or every known asset when
+	// owner is empty.
+	ListByOwner(ctx context.Context, owner string) ([]Asset, error)
+}
+
+// Local is an AssetRegistry over a fixed set of assets, typically loaded from
+// a JSON file exported from the ledger.
+type Local struct {
+	assets []Asset
+}
+
+// NewLocal returns a registry over assets.
+func NewLocal(assets []Asset) *Local {
+	return &Local{assets: assets}
+}
+
+// LoadLocal reads a JSON array of assets from path.
+func LoadLocal(path string) (*Local, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read asset registry: %w", err)
+	}
+
+	var assets []Asset
+	if err := json.Unmarshal(data, &assets); err != nil {
+		return nil, fmt.Errorf("parse asset registry %s: %w", path, err)
+	}
+	return NewLocal(assets), nil
+}
+
+func (l *Local) Get(ctx context.Context, id string) (Asset, error) {
+	for _, a := range l.assets {
+		if strings.EqualFold(a.ID, id) {
+			return a, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+func (l *Local) ListByOwner(ctx context.Context, owner string) ([]Asset, error) {
+	var out []Asset
+	for _, a := range l.assets {
+		if owner == "" || strings.EqualFold(a.Owner, owner) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// QueryAPI is an AssetRegistry backed by an HTTP query service.
+// GET BaseURL?owner={owner} returns a JSON array of assets and GET
+// BaseURL/{id} a single asset, or 404.
+type QueryAPI struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewQueryAPI returns a QueryAPI with a bounded request timeout.
+func NewQueryAPI(baseURL string) *QueryAPI {
+	return &QueryAPI{BaseURL: strings.TrimRight(baseURL, "/"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (q *QueryAPI) Get(ctx context.Context, id string) (Asset, error) {
+	var asset Asset
+	if err := q.get(ctx, q.BaseURL+"/"+url.PathEscape(id), &asset); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Asset{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return Asset{}, err
+	}
+	return asset, nil
+}
+
+func (q *QueryAPI) ListByOwner(ctx context.Context, owner string) ([]Asset, error) {
+	target := q.BaseURL
+	if owner != "" {
+		target += "?owner=" + url.QueryEscape(owner)
+	}
+
+	var assets []Asset
+	if err := q.get(ctx, target, &assets); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (q *QueryAPI) get(ctx context.Context, target string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("build asset query: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := q.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("query assets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("asset query returned %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("decode asset query response: %w", err)
+	}
+	return nil
+}
+
+// Latest returns the most recently created asset in list. Assets without a
+// creation time sort first.
+func Latest(list []Asset) (Asset, bool) {
+	if len(list) == 0 {
+		return Asset{}, false
+	}
+	latest := list[0]
+	for _, a := range list[1:] {
+		if a.Created > latest.Created {
+			latest = a
+		}
+	}
+	return latest, true
+}
+
+type ownerKey struct{}
+
+// WithOwner returns a context identifying owner as the user making requests,
+// which is who "my" refers to when resolving assets.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// OwnerFrom returns the owner stored by WithOwner, if any.
+func OwnerFrom(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"api-recommender/payload"
+	"api-recommender/recommend"
+)
+
+// maxAttachmentBytes caps the size of an attached file.
+const maxAttachmentBytes = 256 << 10
+
+// Attachment is a file the user sent with a chat message: a payload to check
+// or an excerpt of the API spec to ask about.
+type Attachment struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// What an attachment turned out to be.
+const (
+	AttachmentPayload = "payload"
+	AttachmentSpec    = "spec"
+)
+
+// AttachmentReview reports what was found in an attachment. Corrected is
+// set when a fixed version of an attached payload was generated.
+type AttachmentReview struct {
+	Name      string            `json:"name,omitempty"`
+	Kind      string            `json:"kind"`
+	Format    string            `json:"format,omitempty"`
+	Operation string            `json:"operation,omitempty"`
+	Problems  []payload.Problem `json:"problems,omitempty"`
+	Corrected string            `json:"corrected,omitempty"`
+}
+
+type attachmentKey struct{}
+
+// withAttachment attaches a file to the chat turn run with ctx.
+func withAttachment(ctx context.Context, a *Attachment) context.Context {
+	return context.WithValue(ctx, attachmentKey{}, a)
+}
+
+func attachmentFrom(ctx context.Context) *Attachment {
+	a, _ := ctx.Value(attachmentKey{}).(*Attachment)
+	return a
+}
+
+// payloadKeys are top-level keys of a request payload; JSON without any of
+// them is treated as part of a spec.
+var payloadKeys = []string{"context", "payload", "source", "destination"}
+
+// checkAttachment works out whether content is a payload and, if so,
+// checks it against the request model and the operation's rules, reading
+// timestamps with c.
+func checkAttachment(name, content string, c *payload.Clock) *AttachmentReview {
+	review := &AttachmentReview{Name: name, Kind: AttachmentSpec}
+	if !looksLikePayload(content) {
+		return review
+	}
+	report := payload.Check(content, "", c)
+	review.Kind, review.Format, review.Operation = AttachmentPayload, report.Format, report.Operation
+	review.Problems = report.Problems()
+	return review
+}
+
+func looksLikePayload(content string) bool {
+	body := strings.TrimSpace(content)
+	if strings.HasPrefix(body, "<") {
+		return true
+	}
+	if !strings.HasPrefix(body, "{") {
+		return false
+	}
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		// Broken JSON is most likely a payload the user wants fixed
+		return true
+	}
+	return hasAnyKey(doc, payloadKeys)
+}
+
+func hasAnyKey(doc map[string]any, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := doc[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// correctionWords mark a request for a fixed version of the attachment.
+var correctionWords = []string{"fix", "correct", "repair", "update", "rewrite"}
+
+// reviewAttachment checks an attachment and answers the user's message
+// about it. A payload with problems, or one the user asks to have fixed,
+// also gets a corrected version, watermarked with gen.
+func (s *ChatService) reviewAttachment(ctx context.Context, a *Attachment, question string, gen *Generation) (*AttachmentReview, []TurnMessage, error) {
+	review := checkAttachment(a.Name, a.Content, s.clock)
+	problems := problemStrings(review.Problems)
+
+	var messages []TurnMessage
+	if review.Kind == AttachmentPayload {
+		messages = append(messages, TurnMessage{Kind: MessageKindCheck, Content: attachmentCheck(review)})
+	}
+
+	ctx = s.engine.Context(ctx)
+	answer, err := recommend.ReviewAttachment(ctx, question, a.Content, problems, s.model)
+	if err != nil {
+		return nil, nil, fmt.Errorf("review attachment: %w", err)
+	}
+	messages = append(messages, TurnMessage{Kind: MessageKindAnswer, Content: answer})
+
+	lower := strings.ToLower(question)
+	asked := false
+	for _, w := range correctionWords {
+		if strings.Contains(lower, w) {
+			asked = true
+			break
+		}
+	}
+	if review.Kind != AttachmentPayload || (len(problems) == 0 && !asked) {
+		return review, messages, nil
+	}
+
+	corrected, err := recommend.CorrectPayload(ctx, a.Content, problems, s.model)
+	if err != nil {
+		return nil, nil, fmt.Errorf("correct attachment: %w", err)
+	}
+	review.Corrected = s.watermark(ctx, corrected, gen)
+	messages = append(messages, TurnMessage{Kind: MessageKindPayload, Content: "Corrected payload:\n" + review.Corrected})
+	if remaining := checkAttachment(a.Name, corrected, s.clock); len(remaining.Problems) > 0 {
+		remaining.Name = "the corrected payload"
+		messages = append(messages, TurnMessage{Kind: MessageKindCheck, Content: attachmentCheck(remaining)})
+	}
+	return review, messages, nil
+}
+
+// attachmentCheck lists the problems found in an attached payload.
+func attachmentCheck(review *AttachmentReview) string {
+	name := review.Name
+	if name == "" {
+		name = "the attachment"
+	}
+	if len(review.Problems) == 0 {
+		return fmt.Sprintf("Checked %s: no problems found.", name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %s:\n", name)
+	for _, p := range review.Problems {
+		if p.Path == "" {
+			fmt.Fprintf(&b, " - %s\n", p.Message)
+			continue
+		}
+		fmt.Fprintf(&b, " - %s: %s\n", p.Path, p.Message)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func problemStrings(problems []payload.Problem) []string {
+	out := make([]string, len(problems))
+	for i, p := range problems {
+		if p.Path == "" {
+			out[i] = p.Message
+		} else {
+			out[i] = p.Path + ": " + p.Message
+		}
+	}
+	return out
+}
+
+// withAttachmentText appends the attachment to the user's message so later
+// turns can refer back to it.
+func withAttachmentText(userInput string, a *Attachment) string {
+	name := a.Name
+	if name == "" {
+		name = "file"
+	}
+	return fmt.Sprintf("%s\n\nAttached %s:\n%s", userInput, name, strings.TrimSpace(a.Content))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+)
+
+// apiSnapshot is what a recommended API looked like when the user last
+// heard about it, so a docs reload that changes it can be pointed out.
+type apiSnapshot struct {
+	Name       string   `json:"name"`
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Fields     []string `json:"fields,omitempty"`
+	Deprecated bool     `json:"deprecated,omitempty"`
+	// Removed is set once the user was told the API left the catalog.
+	Removed bool `json:"removed,omitempty"`
+}
+
+func snapshotAPI(api apiparser.APIDoc) apiSnapshot {
+	snap := apiSnapshot{Name: api.VersionedName(), Method: api.Method, Path: api.Path, Deprecated: api.Deprecated}
+	for _, f := range api.Fields {
+		// Body fields read as they did before fields had a location, so
+		// older snapshots don't all look changed
+		attrs := f.Type
+		if f.IsParameter() {
+			attrs += ", in " + f.Location()
+		}
+		if f.Required {
+			attrs += ", required"
+		}
+		snap.Fields = append(snap.Fields, fmt.Sprintf("%s (%s)", f.Name, attrs))
+	}
+	return snap
+}
+
+func (a apiSnapshot) encode() string {
+	data, _ := json.Marshal(a)
+	return string(data)
+}
+
+// lines lists what a recommendation depends on, one fact per line, for
+// diffing two snapshots.
+func (a apiSnapshot) lines() []string {
+	lines := []string{"method: " + a.Method, "path: " + a.Path}
+	for _, f := range a.Fields {
+		lines = append(lines, "field: "+f)
+	}
+	if a.Deprecated {
+		lines = append(lines, "deprecated")
+	}
+	return lines
+}
+
+// diffLines is a diff of two snapshots' lines: what went, prefixed "- ",
+// then what came, prefixed "+ ". Lines in both are left out.
+func diffLines(before, after []string) []string {
+	var out []string
+	for _, l := range before {
+		if !slices.Contains(after, l) {
+			out = append(out, "- "+l)
+		}
+	}
+	for _, l := range after {
+		if !slices.Contains(before, l) {
+			out = append(out, "+ "+l)
+		}
+	}
+	return out
+}
+
+// catalogChangeNotice tells the user when the API of the session's latest
+// recommendation changed or left the catalog since they were shown it, as
+// after a docs reload, so they don't build on a stale path. Each change is
+// told once. It is "" when nothing changed.
+func (s *ChatService) catalogChangeNotice(ctx context.Context, sessionID string) (string, error) {
+	var id int64
+	var seenJSON sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, api_seen FROM recommendations WHERE session = ? ORDER BY id DESC LIMIT 1;",
+		sessionID).Scan(&id, &seenJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("load recommended api: %w", err)
+	}
+	var seen apiSnapshot
+	// Recommendations made before snapshots were kept can't be compared
+	if seenJSON.String == "" || json.Unmarshal([]byte(seenJSON.String), &seen) != nil || seen.Removed {
+		return "", nil
+	}
+
+	catalog := s.catalog(ctx)
+	var current apiparser.APIDoc
+	found := false
+	for _, a := range catalog {
+		if a.Path == seen.Path && strings.EqualFold(a.Method, seen.Method) {
+			current, found = a, true
+			break
+		}
+	}
+	if !found {
+		current, found = apiparser.Find(catalog, seen.Name)
+	}
+
+	label := fmt.Sprintf("%s (%s %s)", seen.Name, seen.Method, seen.Path)
+	var notice string
+	now := apiSnapshot{Name: seen.Name, Method: seen.Method, Path: seen.Path, Removed: true}
+	if !found {
+		notice = fmt.Sprintf("Heads up: the API docs changed since I recommended %s in this session, and it is no longer in the catalog. Don't build on that recommendation; ask again for a current one.", label)
+	} else {
+		now = snapshotAPI(current)
+		diff := diffLines(seen.lines(), now.lines())
+		if len(diff) == 0 {
+			return "", nil
+		}
+		notice = fmt.Sprintf("Heads up: the API docs changed since I recommended %s in this session:\n\n```diff\n%s\n```\n\nPayloads from that recommendation may no longer fit; ask again for an updated one.",
+			label, strings.Join(diff, "\n"))
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE recommendations SET api_seen = ? WHERE id = ?;", now.encode(), id); err != nil {
+		return "", fmt.Errorf("record catalog change: %w", err)
+	}
+	return notice, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/config"
+)
+
+// These tests are meant for go test -race: readers of the catalog run
+// while it is swapped.
+
+// version returns a catalog of n APIs all marked with version v, so a
+// reader can tell a whole snapshot from a mix of two.
+func version(v, n int) []apiparser.APIDoc {
+	apis := make([]apiparser.APIDoc, n)
+	for i := range apis {
+		apis[i] = apiparser.APIDoc{
+			Name: fmt.Sprintf("API%d", i),
+			Path: fmt.Sprintf("/v%d/api%d", v, i),
+		}
+	}
+	return apis
+}
+
+// consistent reports whether every API of apis is from the same version.
+func consistent(apis []apiparser.APIDoc) bool {
+	first := -1
+	for _, a := range apis {
+		var v, i int
+		if _, err := fmt.Sscanf(a.Path, "/v%d/api%d", &v, &i); err != nil {
+			return false
+		}
+		if first < 0 {
+			first = v
+		}
+		if v != first || a.Name != fmt.Sprintf("API%d", i) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCatalogSwapWhileReading(t *testing.T) {
+	cfg := config.Default()
+	cfg.Access.Tenants = map[string][]string{"restricted": {"API1", "API3"}}
+	s := &ChatService{cfg: cfg}
+	s.SetAPIs(version(0, 8))
+
+	const readers, swaps = 8, 500
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan string, readers)
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			ctx := context.Background()
+			if r%2 == 1 {
+				ctx = withTenant(ctx, "restricted")
+			}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				apis := s.catalog(ctx)
+				if !consistent(apis) {
+					errs <- fmt.Sprintf("reader %d saw a mixed catalog: %+v", r, apis)
+					return
+				}
+				if r%2 == 1 && len(apis) != 2 {
+					errs <- fmt.Sprintf("restricted reader %d saw %d APIs, want 2", r, len(apis))
+					return
+				}
+			}
+		}(r)
+	}
+
+	for v := 1; v <= swaps; v++ {
+		s.SetAPIs(version(v, 8))
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCatalogSnapshotIsNotChangedBySwap(t *testing.T) {
+	s := &ChatService{cfg: config.Default()}
+	next := version(1, 3)
+	s.SetAPIs(version(0, 3))
+
+	held := s.APIs()
+	s.SetAPIs(next)
+	next[0].Path = "/changed"
+
+	if !consistent(held) || held[0].Path != "/v0/api0" {
+		t.Fatalf("the snapshot held before the swap changed: %+v", held)
+	}
+	if got := s.APIs(); got[0].Path != "/v1/api0" {
+		t.Fatalf("changing the slice passed to SetAPIs changed the catalog: %+v", got)
+	}
+}
+
+// TestChatWhileCatalogSwaps runs chat turns through the server while the
+// catalog is swapped between two versions of the sandbox catalog.
+func TestChatWhileCatalogSwaps(t *testing.T) {
+	ts := newTestServer(t)
+	sandboxAPIs := ts.svc.APIs()
+	renamed := make([]apiparser.APIDoc, len(sandboxAPIs))
+	copy(renamed, sandboxAPIs)
+	for i := range renamed {
+		renamed[i].Description += " (reloaded)"
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				ts.svc.SetAPIs(renamed)
+			} else {
+				ts.svc.SetAPIs(sandboxAPIs)
+			}
+		}
+	}()
+
+	var chats sync.WaitGroup
+	results := make(chan ChatResult, 4)
+	for i := 0; i < cap(results); i++ {
+		chats.Add(1)
+		go func() {
+			defer chats.Done()
+			res, err := ts.svc.Chat(context.Background(), "", firstTurn)
+			if err != nil {
+				t.Errorf("first turn: %v", err)
+				return
+			}
+			if res, err = ts.svc.Chat(context.Background(), res.SessionID, secondTurn); err != nil {
+				t.Errorf("second turn: %v", err)
+				return
+			}
+			results <- *res
+		}()
+	}
+	chats.Wait()
+	close(stop)
+	wg.Wait()
+	close(results)
+
+	for res := range results {
+		if res.Intent != IntentRecommendation || res.Recommendation == nil || res.Recommendation.API.Name != "Issue" {
+			t.Errorf("turn during catalog swaps: intent %q, recommendation %+v", res.Intent, res.Recommendation)
+		}
+	}
+}
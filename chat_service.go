@@ -2,12 +2,30 @@ package main
 
 import (
 	apiparser "api-recommender/api-parser"
+	"api-recommender/assets"
+	"api-recommender/config"
+	"api-recommender/content"
+	"api-recommender/hooks"
 	llmprovider "api-recommender/llm_provider"
+	"api-recommender/mailer"
+	"api-recommender/markdown"
+	"api-recommender/payload"
 	"api-recommender/recommend"
+	"api-recommender/recommender"
+	"api-recommender/sandbox"
+	"api-recommender/tickets"
+	"api-recommender/tools"
+	"api-recommender/xsd"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
@@ -15,6 +33,7 @@ import (
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/memory"
 	"github.com/tmc/langchaingo/memory/sqlite3"
+	"github.com/tmc/langchaingo/schema"
 )
 
 const defaultSessionListLimit = 50
@@ -27,28 +46,170 @@ type SessionSummary struct {
 }
 
 type StoredMessage struct {
+	ID      int64  `json:"id"`
 	Role    string `json:"role"`
 	Content string `json:"content"`
 	Created string `json:"created,omitempty"`
+	// RegeneratedFrom is the downvoted message this one replaces.
+	RegeneratedFrom int64 `json:"regeneratedFrom,omitempty"`
+}
+
+// Intents describe how a user turn was handled. Attachments and session
+// settings are handled here; every other intent comes from the recommender.
+const (
+	IntentIrrelevant     = recommender.IntentIrrelevant
+	IntentFieldQuestion  = recommender.IntentFieldQuestion
+	IntentFollowUp       = recommender.IntentFollowUp
+	IntentRecommendation = recommender.IntentRecommendation
+	IntentCapabilities   = recommender.IntentCapabilities
+	IntentSimulate       = recommender.IntentSimulate
+	IntentResponses      = recommender.IntentResponses
+	IntentAttachment     = "attachment"
+	// IntentSetting is a turn that only changed a session setting, such as
+	// "always give me XML".
+	IntentSetting = "setting"
+	// IntentEmail is a turn that asked for the recommendation by email,
+	// e.g. "email this to dev@example.com".
+	IntentEmail = "email"
+	// IntentTicket is a turn that asked for the recommendation to be raised
+	// as a ticket, e.g. "raise a ticket for this".
+	IntentTicket = "ticket"
+)
+
+// Recommendation is the structured form of a final API recommendation.
+type Recommendation = recommender.Recommendation
+
+// ChatResult is the outcome of a single user turn.
+type ChatResult struct {
+	SessionID      string               `json:"sessionId"`
+	SessionToken   string               `json:"sessionToken,omitempty"`
+	MessageID      int64                `json:"messageId,omitempty"`
+	Message        string               `json:"message"`
+	Intent         string               `json:"intent"`
+	QueryInfo      *recommend.QueryInfo `json:"queryInfo,omitempty"`
+	Recommendation *Recommendation      `json:"recommendation,omitempty"`
+	// RegeneratedFrom is the downvoted message this reply replaces.
+	RegeneratedFrom int64 `json:"regeneratedFrom,omitempty"`
+	// Welcome is set on the first reply of a new session when the
+	// onboarding message is enabled.
+	Welcome *Welcome `json:"welcome,omitempty"`
+	// Segments is Message split into paragraphs, lists and code blocks.
+	// It is left out for recommendations.
+	Segments []markdown.Segment `json:"segments,omitempty"`
+	// Messages are the assistant messages of the turn in order. Message
+	// joins them and MessageID is the first one's id.
+	Messages []TurnMessage `json:"messages,omitempty"`
+	// Attachment is what was found in the file sent with the message.
+	Attachment *AttachmentReview `json:"attachment,omitempty"`
+	// Ticket is the ticket a "raise a ticket" message raised.
+	Ticket *tickets.Ref `json:"ticket,omitempty"`
+	// Anonymized is set when the message and attachment were stored and
+	// answered with fakes in place of their VPAs, addresses and ids.
+	Anonymized bool `json:"anonymized,omitempty"`
+	// ToolCalls are the tools the assistant called for its answer.
+	ToolCalls []tools.Call `json:"toolCalls,omitempty"`
+	// Simulation lists the stages of a simulated flow, in order.
+	Simulation []recommender.Step `json:"simulation,omitempty"`
+	// Artifacts link to the payloads of the turn, stored for download.
+	// Payloads too big to show in full are previewed in the reply.
+	Artifacts []ArtifactLink `json:"artifacts,omitempty"`
+	// Debug is how the turn was handled, when the request asked for it.
+	Debug *TurnDebug `json:"debug,omitempty"`
+}
+
+// TurnDebug is the trace of a turn sent back to requests with debug set.
+type TurnDebug struct {
+	// Scoring is how the recommended API was chosen.
+	Scoring *recommend.ScoreReport `json:"scoring,omitempty"`
+	// Timings is how long the turn and its stages took.
+	Timings recommend.Timings `json:"timings"`
+	// Errors are model failures the turn recovered from, e.g. by falling
+	// back to keyword rules or leaving out the event payload.
+	Errors []string `json:"errors,omitempty"`
 }
 
 type ChatService struct {
-	apis  []apiparser.APIDoc
-	db    *sql.DB
-	model llms.Model
-	table string
+	// apis is the catalog. It is swapped whole and never changed in place,
+	// so readers need no lock and keep the snapshot they loaded.
+	apis    atomic.Pointer[[]apiparser.APIDoc]
+	db      *sql.DB
+	model   llms.Model
+	table   string
+	hooks   []hooks.Hook
+	tools   []tools.Tool
+	cfg     config.Config
+	content *content.Store
+	stmts   *historyStatements
+	// writes queues message writes when write-behind is enabled.
+	writes *writeBehind
+	// fakeKey seeds the fakes of anonymized turns.
+	fakeKey []byte
+	engine  *recommender.Engine
+	sweeper sweeper
+	// instance names this replica in job leases.
+	instance string
+	// schema checks XML payloads when XSD files are configured.
+	schema *xsd.Schema
+	// readiness is the outcome of the last LLM preflight, nil when none
+	// has run.
+	readiness atomic.Pointer[Readiness]
+	// mailer sends recommendations by email, nil when email is off.
+	mailer mailer.Sender
+	// clock timestamps and checks payloads, in the configured timezone and
+	// format.
+	clock *payload.Clock
 }
 
-func NewChatService(apis []apiparser.APIDoc, dbPath string) (*ChatService, error) {
-	model, err := llmprovider.NewGroqLLM()
+func NewChatService(apis []apiparser.APIDoc, dbPath string, cfg config.Config) (*ChatService, error) {
+	var model llms.Model = sandbox.NewLLM()
+	if !cfg.Sandbox {
+		var err error
+		if model, err = llmprovider.NewGroqLLM(); err != nil {
+			return nil, err
+		}
+		// Requests can bring their own key; the sandbox ignores them
+		model = llmprovider.NewPerRequestLLM(model)
+	}
+	// The sandbox has no embedding model; its scores leave embeddings out.
+	// Embeddings are made with the deployment's key, not a client's
+	scorer := &recommend.Scorer{Weights: cfg.Scoring}
+	if cfg.Scoring.Embedding > 0 && !cfg.Sandbox {
+		var err error
+		if scorer.Embedder, err = llmprovider.NewEmbedder(cfg.Scoring.EmbeddingModel); err != nil {
+			return nil, err
+		}
+	}
+
+	assetRegistry, err := newAssetRegistry(cfg.Assets)
 	if err != nil {
 		return nil, err
 	}
+	clock, err := newClock(cfg.Timestamps)
+	if err != nil {
+		return nil, err
+	}
+	var xmlSchema *xsd.Schema
+	if len(cfg.XML.Schemas) > 0 {
+		if xmlSchema, err = xsd.Load(cfg.XML.Schemas...); err != nil {
+			return nil, err
+		}
+	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	dsn := dbPath
+	if cfg.Cluster.Enabled {
+		dsn = withBusyTimeout(dbPath, clusterBusyTimeout)
+	}
+	db, err := openDB(dsn, os.Getenv("DB_PASSPHRASE"))
 	if err != nil {
 		return nil, fmt.Errorf("open chat history db: %w", err)
 	}
+	if cfg.Cluster.Enabled {
+		// Replicas read while others write; the setting sticks to the file
+		if _, err := db.Exec("PRAGMA journal_mode = WAL;"); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("enable write-ahead log: %w", err)
+		}
+	}
 
 	bootstrapHistory := sqlite3.NewSqliteChatMessageHistory(
 		sqlite3.WithDB(db),
@@ -56,23 +217,247 @@ func NewChatService(apis []apiparser.APIDoc, dbPath string) (*ChatService, error
 		sqlite3.WithSession("bootstrap"),
 	)
 
-	return &ChatService{
-		apis:  apis,
-		db:    db,
-		model: model,
-		table: bootstrapHistory.TableName,
-	}, nil
+	table := bootstrapHistory.TableName
+	if err := checkHistoryTable(table); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateHistoryIndexes(db, table); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSessionSummariesSchema(db, table); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureRecommendationsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSessionTokensSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureMessageFeedbackSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureRegenerationsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSessionSettingsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureArtifactsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureDeletedSessionsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureJobLeasesSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureFollowUpsSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store, err := content.Open(context.Background(), db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	stmts, err := prepareHistoryStatements(db, table)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	fakeKey, err := anonymizationKey(cfg.Cluster)
+	if err != nil {
+		stmts.Close()
+		db.Close()
+		return nil, err
+	}
+	var writes *writeBehind
+	if cfg.WriteBehind.Enabled {
+		if writes, err = newWriteBehind(db, table, cfg.WriteBehind); err != nil {
+			stmts.Close()
+			db.Close()
+			return nil, err
+		}
+	}
+
+	s := &ChatService{
+		db:       db,
+		model:    model,
+		table:    table,
+		stmts:    stmts,
+		writes:   writes,
+		fakeKey:  fakeKey,
+		cfg:      cfg,
+		content:  store,
+		instance: instanceID(cfg.Cluster.InstanceID),
+		schema:   xmlSchema,
+		mailer:   newMailer(cfg.Email, os.Getenv("SMTP_PASSWORD")),
+		clock:    clock,
+	}
+	s.SetAPIs(apis)
+	if status := cfg.NetworkStatus; status.URL != "" {
+		s.AddTool(tools.NetworkStatus(status.URL, time.Duration(status.TimeoutMillis)*time.Millisecond))
+	}
+	opts := []recommender.Option{
+		recommender.WithCatalog(s.catalog),
+		recommender.WithPresets(cfg.Presets),
+		recommender.WithFees(cfg.Fees),
+		recommender.WithXML(cfg.XML),
+		recommender.WithAssets(assetRegistry, cfg.Assets.Owner),
+		recommender.WithRedirectMessage(cfg.Persona.Render(cfg.Persona.RedirectMessage)),
+		recommender.WithTools(func() []tools.Tool { return s.tools }),
+		recommender.WithPersona(cfg.Persona),
+		recommender.WithQuestions(cfg.Questions),
+		recommender.WithTunables(store),
+		recommender.WithClock(clock),
+	}
+	if xmlSchema != nil {
+		opts = append(opts, recommender.WithSchema(xmlSchema, cfg.XML.SchemaRetry))
+	}
+	if cfg.Simulation.Topic != "" {
+		opts = append(opts, recommender.WithEventTopic(cfg.Persona.Render(cfg.Simulation.Topic)))
+	}
+	scorer.Acceptance = s.apiAcceptance
+	opts = append(opts, recommender.WithScorer(scorer))
+	s.engine = recommender.New(model, apis, opts...)
+	if minutes := cfg.Retention.SweepMinutes; minutes > 0 {
+		s.startSweeper(time.Duration(minutes) * time.Minute)
+	}
+	return s, nil
+}
+
+// clusterBusyTimeout is how long a replica's statement waits for another
+// replica's lock on the database before failing with SQLITE_BUSY.
+const clusterBusyTimeout = 10 * time.Second
+
+// withBusyTimeout sets the busy timeout in the SQLite DSN dbPath. Unlike
+// PRAGMA busy_timeout on the pool, it applies to every connection opened.
+func withBusyTimeout(dbPath string, timeout time.Duration) string {
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d", dbPath, sep, timeout.Milliseconds())
+}
+
+// newClock returns the clock of the configured timestamp timezone and
+// format.
+func newClock(cfg config.Timestamps) (*payload.Clock, error) {
+	location, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := cfg.Layout()
+	if err != nil {
+		return nil, err
+	}
+	return payload.NewClock(nil, location, layout), nil
+}
+
+// newAssetRegistry returns the configured registry, or nil when none is set.
+func newAssetRegistry(cfg config.Assets) (assets.AssetRegistry, error) {
+	switch {
+	case cfg.Registry != "":
+		local, err := assets.LoadLocal(cfg.Registry)
+		if err != nil {
+			return nil, err
+		}
+		return local, nil
+	case cfg.QueryURL != "":
+		return assets.NewQueryAPI(cfg.QueryURL), nil
+	}
+	return nil, nil
+}
+
+type colorKey struct{}
+
+// withColor makes ProcessMessage color its replies for a terminal.
+func withColor(ctx context.Context) context.Context {
+	return context.WithValue(ctx, colorKey{}, true)
 }
 
+// ProcessMessage handles one user turn and returns the assistant's reply as
+// text together with the (possibly newly created) session id.
 func (s *ChatService) ProcessMessage(ctx context.Context, sessionID, userInput string) (string, string, error) {
+	result, err := s.Chat(ctx, sessionID, userInput)
+	if err != nil {
+		return "", sessionID, err
+	}
+	render := markdown.Text
+	if color, _ := ctx.Value(colorKey{}).(bool); color {
+		render = markdown.ColorText
+	}
+	message := result.Message
+	switch {
+	case len(result.Segments) > 0:
+		message = render(result.Segments)
+	case len(result.Messages) > 1 && result.Messages[0].Kind == MessageKindNotice:
+		// A notice is markdown even when the rest of the turn isn't
+		message = render(markdown.Parse(result.Messages[0].Content)) + "\n\n" + joinMessages(result.Messages[1:])
+	}
+	if result.Welcome != nil {
+		return result.Welcome.String() + "\n\n" + message, result.SessionID, nil
+	}
+	return message, result.SessionID, nil
+}
+
+// Chat handles one user turn and returns a structured result describing how
+// the turn was interpreted alongside the reply text.
+func (s *ChatService) Chat(ctx context.Context, sessionID, userInput string) (*ChatResult, error) {
+	started := time.Now()
 	userInput = strings.TrimSpace(userInput)
 	if userInput == "" {
-		return "", sessionID, fmt.Errorf("empty user input")
+		return nil, fmt.Errorf("%w: empty user input", ErrInvalidInput)
 	}
 
 	trimmedSession := strings.TrimSpace(sessionID)
 	if trimmedSession == "" {
 		trimmedSession = uuid.NewString()
+	} else if err := s.checkNotDeleted(ctx, trimmedSession); err != nil {
+		return nil, err
+	}
+	// Another replica may have changed the prompts or glossary
+	if err := s.content.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	// The session picks the arm of any prompt rollout
+	ctx = content.WithSession(ctx, trimmedSession)
+	ctx, verbosity, err := s.sessionVerbosity(ctx, trimmedSession)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := recommend.ValueProfileFrom(ctx); !ok && s.cfg.ValueProfile != "" {
+		ctx = recommend.WithValueProfile(ctx, s.cfg.ValueProfile)
+	}
+	if ctx, err = s.sessionOutputFormat(ctx, trimmedSession); err != nil {
+		return nil, err
+	}
+	if ctx, err = s.sessionSmartDefaults(ctx, trimmedSession); err != nil {
+		return nil, err
+	}
+	format, formatOnly, formatCommand := recommend.ParseFormatCommand(userInput)
+	if formatCommand {
+		if err := s.setSessionOutputFormat(ctx, trimmedSession, format); err != nil {
+			return nil, err
+		}
+		ctx = recommend.WithOutputFormat(ctx, format)
+	}
+	emailTo, emailCommand := parseEmailCommand(userInput)
+	ticketCommand := isTicketCommand(userInput)
+	anonymized := anonymizeRequested(ctx)
+	if anonymized {
+		ctx, userInput = s.anonymizeTurn(ctx, trimmedSession, userInput)
 	}
 
 	chatHistory := s.newChatHistory(trimmedSession)
@@ -89,7 +474,7 @@ func (s *ChatService) ProcessMessage(ctx context.Context, sessionID, userInput s
 	history := ""
 	historyVars, err := conversationChain.Memory.LoadMemoryVariables(ctx, map[string]any{"input": userInput})
 	if err != nil {
-		return "", sessionID, fmt.Errorf("load history: %w", err)
+		return nil, fmt.Errorf("load history: %w", err)
 	}
 
 	if historyVars != nil {
@@ -98,106 +483,167 @@ func (s *ChatService) ProcessMessage(ctx context.Context, sessionID, userInput s
 		case []llms.ChatMessage:
 			history, err = llms.GetBufferString(v, "Human", "AI")
 			if err != nil {
-				return "", sessionID, fmt.Errorf("format history: %w", err)
+				return nil, fmt.Errorf("format history: %w", err)
 			}
 		case string:
 			history = v
 		}
 	}
 
-	// Classify the query: is it a creation request or a field question? Is it relevant?
-	isCreationRequest, isRelevant, err := recommend.ClassifyQuery(ctx, userInput, history, s.model)
-	if err != nil {
-		// If classification fails, default to creation request to maintain backward compatibility
-		isCreationRequest = true
-		isRelevant = true
+	var sessionToken string
+	if history == "" {
+		// A session's first turn claims it: issue the access token the client
+		// must present on later reads and writes.
+		sessionToken, err = s.issueSessionToken(ctx, trimmedSession)
+		if err != nil {
+			return nil, err
+		}
+		// A concurrent first turn claimed the id after it was found
+		// claimable; its token is the only one
+		if sessionToken == "" {
+			return nil, fmt.Errorf("%w: session %s was claimed by another request", ErrSessionForbidden, trimmedSession)
+		}
 	}
+	// Until the turn is saved the client hasn't got the token; a turn that
+	// fails gives the session id up again
+	claimed := false
+	defer func() {
+		if sessionToken != "" && !claimed {
+			if err := s.releaseSessionToken(context.WithoutCancel(ctx), trimmedSession); err != nil {
+				log.Printf("release token of session %s: %v", trimmedSession, err)
+			}
+		}
+	}()
 
 	var response string
+	var replies []TurnMessage
+	var recommendationID int64
+	var questions []string
+	result := &ChatResult{SessionID: trimmedSession, SessionToken: sessionToken, Anonymized: anonymized}
+	if history == "" {
+		result.Welcome = s.welcome(ctx)
+	}
+
+	// The previous recommendation is checked before this turn can make a
+	// new one
+	notice, err := s.catalogChangeNotice(ctx, trimmedSession)
+	if err != nil {
+		return nil, err
+	}
 
-	// Handle irrelevant requests
-	if !isRelevant {
-		response = "I'm an AI agent for the UMI (Unified Market Interface) project. I can help you with UMI project-related requests like creating assets, bonds, transactions, or answering questions about API fields and project-specific concepts. Your request doesn't seem to be related to the UMI project. How can I help you with UMI-related tasks?"
-	} else if !isCreationRequest {
-		// User is asking about a field - answer without suggesting APIs
-		// Don't use history for field questions - they should be answered based on current question only
-		// This prevents lagging behind previous questions
-		response, err = recommend.AnswerFieldQuestion(ctx, userInput, "", s.model)
+	// Attachments are reviewed and format choices confirmed here;
+	// everything else goes through the recommendation pipeline
+	attachment := attachmentFrom(ctx)
+	switch {
+	case attachment == nil && formatOnly:
+		result.Intent = IntentSetting
+		response = formatConfirmation(format)
+	case attachment == nil && emailCommand:
+		result.Intent = IntentEmail
+		if response, err = s.emailReply(ctx, trimmedSession, emailTo); err != nil {
+			return nil, err
+		}
+	case attachment == nil && ticketCommand:
+		result.Intent = IntentTicket
+		if result.Ticket, response, err = s.ticketReply(ctx, trimmedSession); err != nil {
+			return nil, err
+		}
+	case attachment != nil:
+		result.Intent = IntentAttachment
+		gen := s.generation(ctx, trimmedSession)
+		result.Attachment, replies, err = s.reviewAttachment(ctx, attachment, userInput, gen)
 		if err != nil {
-			return "", trimmedSession, fmt.Errorf("answer field question: %w", err)
+			return nil, err
 		}
-	} else {
-		// User wants to create something - detect if this is a new request
-		// A new request typically starts with creation keywords
-		isNewRequest := isNewCreationRequest(userInput, history)
-
-		// For continuation (answering questions), use more history to capture previous Q&A
-		// For new requests, use less history
-		var recentHistory string
-		if isNewRequest {
-			// New request - minimal history
-			recentHistory = getRecentHistoryForContext(history, 2)
-		} else {
-			// Continuation - use more history to capture the questions and answers
-			recentHistory = getRecentHistoryForContext(history, 10)
-		}
-
-		// Extract query info - from current request context
-		queryInfo, err := recommend.ExtractQueryInfo(ctx, userInput, recentHistory, s.model, isNewRequest)
+		if corrected := result.Attachment.Corrected; corrected != "" {
+			link, err := s.storeArtifact(ctx, trimmedSession, ArtifactPayload, corrected, gen)
+			if err != nil {
+				return nil, err
+			}
+			result.Artifacts = []ArtifactLink{link}
+		}
+	default:
+		turn, err := s.engine.Respond(ctx, userInput, history)
 		if err != nil {
-			return "", trimmedSession, fmt.Errorf("extract query info: %w", err)
+			return nil, err
 		}
-
-		// If usecase is mentioned but operation is not specified, ask about operation FIRST
-		// Do NOT ask the 4 questions until operation is selected
-		if queryInfo.UseCase != "" && queryInfo.Operation == "" {
-			response = fmt.Sprintf(`For %s usecase, which operation do you want to perform?
-
-- CREATE/ISSUE → use **req issue** API
-- BURN/MANAGE → use **req manage** API  
-- TRADE/SETTLE → use **req settle** API
-
-Please specify: create, burn, or trade`, queryInfo.UseCase)
-		} else {
-			// Check if all required pieces of information are present
-			hasAllInfo := queryInfo.IsAsync != nil &&
-				queryInfo.IsUMICompliant != nil &&
-				queryInfo.IsPrivate != nil &&
-				len(queryInfo.FieldNames) > 0
-
-			// If async is true, also need event fields
-			if queryInfo.IsAsync != nil && *queryInfo.IsAsync {
-				hasAllInfo = hasAllInfo && len(queryInfo.EventFields) > 0
+		result.Intent, result.QueryInfo, response = turn.Intent, turn.QueryInfo, turn.Reply
+		result.ToolCalls, result.Simulation = turn.ToolCalls, turn.Simulation
+		questions = turn.Questions
+		if rec := turn.Recommendation; rec != nil {
+			shown, links, err := s.storePayloads(ctx, trimmedSession, rec)
+			if err != nil {
+				return nil, err
 			}
+			result.Recommendation, result.Artifacts = shown, links
+			replies = recommendationMessages(shown, verbosity, links, s.FeatureEnabled(ctx, config.FeatureResponseSchemas))
 
-			if !hasAllInfo {
-				// Generate follow-up questions for missing information
-				questions, err := recommend.GenerateFollowUpQuestions(ctx, queryInfo, s.model)
-				if err != nil {
-					return "", trimmedSession, fmt.Errorf("generate follow-up questions: %w", err)
-				}
-				response = questions
-			} else {
-				// All information is present - proceed with API recommendation
-				// Use recent history for context
-				prompt := composeConversationAwareRequest(recentHistory, userInput)
-				api, fields, samplePayload, eventPayload, err := recommend.Recommend1(ctx, s.apis, prompt, queryInfo)
-				if err != nil {
-					return "", trimmedSession, err
-				}
-				response = formatRecommendation(api, fields, samplePayload, eventPayload)
+			recommendationID, err = s.recordRecommendation(ctx, trimmedSession, userInput, turn.QueryInfo, rec.API, rec.Payload)
+			if err != nil {
+				return nil, err
 			}
+
+			s.runHooks(ctx, hooks.Event{
+				SessionID:    trimmedSession,
+				Query:        userInput,
+				QueryInfo:    turn.QueryInfo,
+				API:          rec.API,
+				Payload:      rec.Payload,
+				EventPayload: rec.EventPayload,
+			})
 		}
 	}
 
-	if err := conversationChain.Memory.SaveContext(ctx,
-		map[string]any{"input": userInput},
-		map[string]any{"output": response},
-	); err != nil {
-		return "", trimmedSession, fmt.Errorf("save conversation: %w", err)
+	if replies == nil {
+		kind := MessageKindAnswer
+		if result.Intent == IntentFollowUp {
+			kind = MessageKindQuestion
+		}
+		replies = []TurnMessage{{Kind: kind, Content: response}}
+	}
+	// A notice goes first; the turn's own reply keeps being the one rated
+	// and linked to the recommendation
+	first := 0
+	if notice != "" {
+		replies = append([]TurnMessage{{Kind: MessageKindNotice, Content: notice}}, replies...)
+		first = 1
+	}
+	response = joinMessages(replies)
+	saved := userInput
+	if attachment != nil {
+		saved = withAttachmentText(userInput, attachment)
+	}
+	if err := s.saveTurn(ctx, trimmedSession, saved, replies); err != nil {
+		return nil, err
+	}
+	claimed = true
+
+	// The reply's id lets clients rate this message later
+	result.MessageID = replies[first].ID
+	result.Messages = replies
+	if err := s.linkArtifacts(ctx, result.Artifacts, replies); err != nil {
+		return nil, err
+	}
+	if recommendationID != 0 {
+		if err := s.linkRecommendation(ctx, recommendationID, result.MessageID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.trackFollowUps(ctx, trimmedSession, result.Intent, questions, result.MessageID); err != nil {
+		return nil, err
 	}
 
-	return response, trimmedSession, nil
+	result.Message = response
+	if result.Intent != IntentRecommendation && result.Intent != IntentAttachment {
+		// Recommendations and attachment reviews embed raw payloads, which
+		// aren't markdown
+		result.Segments = markdown.Parse(response)
+	}
+	if trace := recommend.TraceFrom(ctx); trace != nil {
+		result.Debug = &TurnDebug{Scoring: trace.Scoring(), Timings: trace.Timings(), Errors: trace.Errors()}
+		result.Debug.Timings.TotalMs = time.Since(started).Milliseconds()
+	}
+	return result, nil
 }
 
 func (s *ChatService) ListSessions(ctx context.Context, limit int) ([]SessionSummary, error) {
@@ -205,25 +651,66 @@ func (s *ChatService) ListSessions(ctx context.Context, limit int) ([]SessionSum
 		limit = defaultSessionListLimit
 	}
 
-	query := fmt.Sprintf(`
-		SELECT
-			session,
-			MAX(created) AS last_created,
-			(
-				SELECT content
-				FROM %s m2
-				WHERE m2.session = m1.session
-				ORDER BY created DESC
-				LIMIT 1
-			) AS last_content,
-			COUNT(*) AS total
-		FROM %s m1
-		WHERE session IS NOT NULL AND session != ''
-		GROUP BY session
-		ORDER BY last_created DESC
-		LIMIT ?;`, s.table, s.table)
-
-	rows, err := s.db.QueryContext(ctx, query, limit)
+	return s.querySessions(ctx, limit)
+}
+
+// ListSessionsByID lists only the given sessions, latest first.
+func (s *ChatService) ListSessionsByID(ctx context.Context, ids []string, limit int) ([]SessionSummary, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = defaultSessionListLimit
+	}
+
+	return s.querySessions(ctx, limit, ids...)
+}
+
+// LatestSession returns the most recently active session that hasn't been
+// deleted. A database without one is ErrSessionNotFound.
+func (s *ChatService) LatestSession(ctx context.Context) (SessionSummary, error) {
+	if err := s.flushWrites(ctx); err != nil {
+		return SessionSummary{}, err
+	}
+	var id string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT session FROM session_summaries
+		WHERE session NOT IN (SELECT session FROM deleted_sessions)
+		ORDER BY last_message_at DESC LIMIT 1;`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SessionSummary{}, fmt.Errorf("%w: there are no sessions yet", ErrSessionNotFound)
+	}
+	if err != nil {
+		return SessionSummary{}, fmt.Errorf("find latest session: %w", err)
+	}
+	sessions, err := s.querySessions(ctx, 1, id)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	if len(sessions) == 0 {
+		return SessionSummary{ID: id}, nil
+	}
+	return sessions[0], nil
+}
+
+// querySessions lists sessions latest first, optionally restricted to ids. A
+// negative limit returns every matching session.
+func (s *ChatService) querySessions(ctx context.Context, limit int, ids ...string) ([]SessionSummary, error) {
+	if err := s.flushWrites(ctx); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+	var err error
+	if len(ids) > 0 {
+		idsJSON, jerr := json.Marshal(ids)
+		if jerr != nil {
+			return nil, fmt.Errorf("list sessions: %w", jerr)
+		}
+		rows, err = s.stmts.listSessionsByID.QueryContext(ctx, string(idsJSON), limit)
+	} else {
+		rows, err = s.stmts.listSessions.QueryContext(ctx, limit)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("list sessions: %w", err)
 	}
@@ -259,15 +746,20 @@ func (s *ChatService) ListSessions(ctx context.Context, limit int) ([]SessionSum
 func (s *ChatService) GetSessionMessages(ctx context.Context, sessionID string, limit int) ([]StoredMessage, error) {
 	sessionID = strings.TrimSpace(sessionID)
 	if sessionID == "" {
-		return nil, fmt.Errorf("session id is required")
+		return nil, fmt.Errorf("%w: session id is required", ErrInvalidInput)
 	}
 
 	if limit <= 0 {
 		limit = sqlite3.DefaultLimit
 	}
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	if err := s.flushSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
 
-	query := fmt.Sprintf("SELECT content, type, created FROM %s WHERE session = ? ORDER BY created ASC LIMIT ?;", s.table)
-	rows, err := s.db.QueryContext(ctx, query, sessionID, limit)
+	rows, err := s.stmts.sessionMessages.QueryContext(ctx, sessionID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("load session messages: %w", err)
 	}
@@ -275,16 +767,20 @@ func (s *ChatService) GetSessionMessages(ctx context.Context, sessionID string,
 
 	var messages []StoredMessage
 	for rows.Next() {
+		var id int64
 		var content string
 		var msgType string
 		var created sql.NullString
-		if err := rows.Scan(&content, &msgType, &created); err != nil {
+		var regeneratedFrom int64
+		if err := rows.Scan(&id, &content, &msgType, &created, &regeneratedFrom); err != nil {
 			return nil, fmt.Errorf("scan message: %w", err)
 		}
 
 		msg := StoredMessage{
-			Role:    roleFromMessageType(msgType),
-			Content: content,
+			ID:              id,
+			Role:            roleFromMessageType(msgType),
+			Content:         content,
+			RegeneratedFrom: regeneratedFrom,
 		}
 		if created.Valid {
 			msg.Created = created.String
@@ -296,22 +792,82 @@ func (s *ChatService) GetSessionMessages(ctx context.Context, sessionID string,
 		return nil, fmt.Errorf("iterate messages: %w", err)
 	}
 
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
 	return messages, nil
 }
 
+// AddHook registers a hook to run after every final recommendation.
+func (s *ChatService) AddHook(h hooks.Hook) {
+	s.hooks = append(s.hooks, h)
+}
+
+// AddTool makes a tool available to the assistant when it answers
+// questions. Tools are added at startup, before the service handles turns.
+func (s *ChatService) AddTool(t tools.Tool) {
+	s.tools = append(s.tools, t)
+}
+
+// runHooks invokes every hook in registration order. Hook failures are logged
+// and never fail the user's turn.
+func (s *ChatService) runHooks(ctx context.Context, event hooks.Event) {
+	for _, h := range s.hooks {
+		if err := h.AfterRecommendation(ctx, event); err != nil {
+			log.Printf("recommendation hook failed for session %s: %v", event.SessionID, err)
+		}
+	}
+}
+
 func (s *ChatService) Close() error {
+	s.stopSweeper()
+	if s.writes != nil {
+		if err := s.writes.Close(); err != nil {
+			log.Printf("flush queued messages: %v", err)
+		}
+	}
+	if s.stmts != nil {
+		s.stmts.Close()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
 	return nil
 }
 
-func (s *ChatService) newChatHistory(sessionID string) *sqlite3.SqliteChatMessageHistory {
-	return sqlite3.NewSqliteChatMessageHistory(
+func (s *ChatService) newChatHistory(sessionID string) schema.ChatMessageHistory {
+	history := sqlite3.NewSqliteChatMessageHistory(
 		sqlite3.WithDB(s.db),
 		sqlite3.WithSession(sessionID),
 		sqlite3.WithTableName(s.table),
 	)
+	if s.writes == nil {
+		return history
+	}
+	return &queuedHistory{SqliteChatMessageHistory: history, queue: s.writes, session: sessionID}
+}
+
+// flushSession writes the session's queued messages before it is read.
+func (s *ChatService) flushSession(ctx context.Context, sessionID string) error {
+	if s.writes == nil {
+		return nil
+	}
+	if err := s.writes.flushSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("flush queued messages: %w", err)
+	}
+	return nil
+}
+
+// flushWrites writes every queued message, for reads across sessions.
+func (s *ChatService) flushWrites(ctx context.Context) error {
+	if s.writes == nil {
+		return nil
+	}
+	if err := s.writes.flush(ctx); err != nil {
+		return fmt.Errorf("flush queued messages: %w", err)
+	}
+	return nil
 }
 
 func roleFromMessageType(value string) string {
@@ -327,98 +883,120 @@ func roleFromMessageType(value string) string {
 	}
 }
 
-func composeConversationAwareRequest(history, latest string) string {
-	latest = strings.TrimSpace(latest)
-	if history == "" {
-		return latest
-	}
-	return fmt.Sprintf("Conversation so far:\n%s\n\nLatest user request: %s", history, latest)
-}
+// conciseFieldLimit caps the suggested fields listed in concise replies.
+const conciseFieldLimit = 5
 
-// getRecentHistoryForContext extracts only the last N messages from history for context
-func getRecentHistoryForContext(history string, n int) string {
-	if history == "" {
-		return ""
-	}
+// recommendationMessages renders a recommendation as the turn's replies:
+// the API and its fields, the sample payload, the event payload and the
+// payload check, each a message of its own. Concise replies leave out
+// descriptions and the value mapping and list only the first few fields;
+// detailed replies add the rationale. Payloads shown as a preview are
+// linked to their full download. With responses set, the API's documented
+// responses follow its fields.
+func recommendationMessages(rec *Recommendation, verbosity recommend.Verbosity, links []ArtifactLink, responses bool) []TurnMessage {
+	api, fields := rec.API, rec.Fields
+	concise := verbosity == recommend.VerbosityConcise
 
-	// Split by message pairs (Human/AI)
-	parts := strings.Split(history, "\n\n")
-	if len(parts) <= n {
-		return history
+	var builder strings.Builder
+	builder.WriteString("Recommended API:\n")
+	if concise {
+		builder.WriteString(fmt.Sprintf(" Name: %s\n Path: %s\n Method: %s\n", api.Name, api.Path, api.Method))
+	} else {
+		builder.WriteString(fmt.Sprintf(" Name: %s\n Path: %s\n Method: %s\n Description: %s\n", api.Name, api.Path, api.Method, api.Description))
 	}
-
-	// Get last N parts
-	start := len(parts) - n
-	if start < 0 {
-		start = 0
+	if api.Version != "" {
+		builder.WriteString(fmt.Sprintf(" Version: %s\n", api.Version))
 	}
-
-	return strings.Join(parts[start:], "\n\n")
-}
-
-// isNewCreationRequest detects if this is a new creation request (not a continuation)
-func isNewCreationRequest(userInput, history string) bool {
-	lower := strings.ToLower(userInput)
-
-	// Check for creation keywords that indicate a new request
-	creationKeywords := []string{"create", "make", "generate", "build", "new", "want to", "need to", "burn", "lock"}
-	for _, keyword := range creationKeywords {
-		if strings.Contains(lower, keyword) {
-			// Check if it's not just answering a question
-			// If it contains creation keywords and is not just "yes"/"no", it's a new request
-			isJustAnswer := strings.Contains(lower, "yes") || strings.Contains(lower, "no")
-			// Also check if it's a full sentence with creation intent
-			hasCreationIntent := strings.Contains(lower, keyword) &&
-				(strings.Contains(lower, "asset") || strings.Contains(lower, "bond") ||
-					strings.Contains(lower, "transaction") || strings.Contains(lower, "gold") ||
-					strings.Contains(lower, "token"))
-
-			if hasCreationIntent || (!isJustAnswer && len(strings.Fields(lower)) > 2) {
-				return true
-			}
-		}
+	if len(api.Tags) > 0 {
+		builder.WriteString(fmt.Sprintf(" Groups: %s\n", strings.Join(api.Tags, ", ")))
 	}
-
-	// If it's a short answer (yes/no/field names), it's likely a continuation
-	if len(strings.Fields(lower)) <= 3 {
-		return false
+	if rec.Deprecation != "" {
+		builder.WriteString(fmt.Sprintf(" Warning: %s\n", rec.Deprecation))
+	}
+	if len(rec.Defaults) > 0 {
+		builder.WriteString(fmt.Sprintf(" Defaults applied: %s\n", strings.Join(rec.Defaults, ", ")))
+	}
+	if verbosity == recommend.VerbosityDetailed && rec.Rationale != "" {
+		builder.WriteString(fmt.Sprintf(" Why: %s\n", rec.Rationale))
 	}
 
-	return false
-}
-
-func formatRecommendation(api apiparser.APIDoc, fields []apiparser.APIField, samplePayload, eventPayload string) string {
-	var builder strings.Builder
-	builder.WriteString("Recommended API:\n")
-	builder.WriteString(fmt.Sprintf(" Name: %s\n Path: %s\n Method: %s\n Description: %s\n", api.Name, api.Path, api.Method, api.Description))
+	// Parameters go in the URL and headers; the sample payload is the body
+	if req := rec.Request; req != nil {
+		builder.WriteString(fmt.Sprintf("Request:\n %s %s\n", req.Method, req.URL))
+		for _, h := range req.Headers {
+			builder.WriteString(fmt.Sprintf(" %s: %s\n", h.Name, h.Value))
+		}
+	}
 
-	if len(fields) == 0 {
+	switch {
+	case len(fields) == 0:
 		builder.WriteString("Suggested fields: not required\n")
-	} else {
+	case concise:
+		names := make([]string, 0, conciseFieldLimit)
+		for i, f := range fields {
+			if i == conciseFieldLimit {
+				names = append(names, fmt.Sprintf("and %d more", len(fields)-i))
+				break
+			}
+			names = append(names, f.Name)
+		}
+		builder.WriteString("Suggested fields: " + strings.Join(names, ", ") + "\n")
+	default:
 		builder.WriteString("Suggested fields:\n")
 		for _, f := range fields {
-			builder.WriteString(fmt.Sprintf(" - %s (%s): %s\n", f.Name, f.Type, f.Description))
+			typ := f.Type
+			if f.IsParameter() {
+				typ += ", in " + f.Location()
+			}
+			builder.WriteString(fmt.Sprintf(" - %s (%s): %s\n", f.Name, typ, f.Description))
 		}
 	}
+	if lines := recommend.ResponseLines(api); responses && len(lines) > 0 {
+		builder.WriteString("Returns:\n" + strings.Join(lines, "\n") + "\n")
+	}
 
-	samplePayload = strings.TrimSpace(samplePayload)
-
-	if samplePayload != "" {
-		builder.WriteString("Sample payload:\n")
-		builder.WriteString(samplePayload)
-		if !strings.HasSuffix(samplePayload, "\n") {
-			builder.WriteString("\n")
+	if len(rec.Mapping) > 0 && !concise {
+		builder.WriteString("\nYour values were placed as follows:\n")
+		for _, a := range rec.Mapping {
+			builder.WriteString(fmt.Sprintf(" - %s=%s -> %s\n", a.Name, a.Value, a.Target))
 		}
 	}
-
-	eventPayload = strings.TrimSpace(eventPayload)
-	if eventPayload != "" {
-		builder.WriteString("\nEvent payload (for async requests):\n")
-		builder.WriteString(eventPayload)
-		if !strings.HasSuffix(eventPayload, "\n") {
-			builder.WriteString("\n")
+	if len(rec.Fees) > 0 && !concise {
+		builder.WriteString("\nFees were computed as follows:\n")
+		for _, f := range rec.Fees {
+			builder.WriteString(fmt.Sprintf(" - %s = %s %s (%s)\n", f.Field, f.Value, f.Unit, f.Basis))
+		}
+	}
+	for _, l := range links {
+		if !l.Preview {
+			continue
 		}
+		name := "sample payload"
+		if l.Kind == MessageKindEventPayload {
+			name = "event payload"
+		}
+		builder.WriteString(fmt.Sprintf("\nThe %s is %s, so only a preview is shown. Download the full payload from %s\n", name, l.Reason, l.URL))
+	}
+
+	messages := []TurnMessage{{Kind: MessageKindAnswer, Content: strings.TrimSpace(builder.String())}}
+	if samplePayload := strings.TrimSpace(rec.Payload); samplePayload != "" {
+		messages = append(messages, TurnMessage{Kind: MessageKindPayload, Content: "Sample payload:\n" + samplePayload})
+	}
+	if eventPayload := strings.TrimSpace(rec.EventPayload); eventPayload != "" {
+		messages = append(messages, TurnMessage{Kind: MessageKindEventPayload, Content: "Event payload (for async requests):\n" + eventPayload})
 	}
 
-	return strings.TrimSpace(builder.String())
+	if len(rec.Problems) > 0 {
+		builder.Reset()
+		builder.WriteString("Payload check:\n")
+		for _, p := range rec.Problems {
+			if p.Path == "" {
+				builder.WriteString(fmt.Sprintf(" - %s\n", p.Message))
+				continue
+			}
+			builder.WriteString(fmt.Sprintf(" - %s: %s\n", p.Path, p.Message))
+		}
+		messages = append(messages, TurnMessage{Kind: MessageKindCheck, Content: strings.TrimSpace(builder.String())})
+	}
+	return messages
 }
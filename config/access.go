@@ -0,0 +1,45 @@
+package config
+
+import "strings"
+
+// Access restricts which catalog APIs tenants can see and be recommended.
+type Access struct {
+	// Tenants lists the APIs, by name or path, each tenant may use; "*"
+	// allows every API. Once any tenant is listed, a tenant that isn't sees
+	// nothing. The deployment itself, e.g. the CLI, has no tenant and sees
+	// the whole catalog.
+	Tenants map[string][]string `json:"tenants"`
+	// APIKeys pins API keys to tenants. A pinned key's tenant can't be
+	// changed with the X-Tenant-ID header, so its scope can't be widened by
+	// the caller. The keys must also be accepted with -api-keys.
+	APIKeys map[string]string `json:"apiKeys"`
+}
+
+// TenantForKey returns the tenant an API key is pinned to.
+func (a Access) TenantForKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	tenant, ok := a.APIKeys[key]
+	return tenant, ok
+}
+
+// Restricted reports whether catalogs are scoped per tenant.
+func (a Access) Restricted() bool {
+	return len(a.Tenants) > 0
+}
+
+// Allows reports whether tenant may use the API with the given name and
+// path.
+func (a Access) Allows(tenant, name, path string) bool {
+	if !a.Restricted() || tenant == "" {
+		return true
+	}
+	for _, ref := range a.Tenants[tenant] {
+		ref = strings.TrimSpace(ref)
+		if ref == "*" || strings.EqualFold(ref, name) || strings.EqualFold(ref, path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,651 @@
+// Package config holds the deployment settings that tailor the recommender to
+// a particular product. Everything has a default matching the original UMI
+// deployment, so the config file is optional and may be partial.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Config is the root of the JSON config file.
+type Config struct {
+	Persona Persona `json:"persona"`
+	// Sandbox serves the embedded demo catalog with a stub LLM instead of
+	// the configured docs and model.
+	Sandbox bool   `json:"sandbox"`
+	Assets  Assets `json:"assets"`
+	// Presets are named context flag combinations users can refer to
+	// instead of answering the flag questions one by one.
+	Presets   []Preset  `json:"presets"`
+	Questions Questions `json:"questions"`
+	Welcome   Welcome   `json:"welcome"`
+	Features  Features  `json:"features"`
+	Rollout   Rollout   `json:"rollout"`
+	Access    Access    `json:"access"`
+	// WriteBehind batches chat message writes in the background.
+	WriteBehind WriteBehind `json:"writeBehind"`
+	// NetworkStatus lets the assistant check whether the settlement network
+	// is up.
+	NetworkStatus NetworkStatus `json:"networkStatus"`
+	// Fees are the rules for computing fee fields, keyed by field name.
+	Fees       map[string]FeeRule `json:"fees"`
+	Simulation Simulation         `json:"simulation"`
+	Timestamps Timestamps         `json:"timestamps"`
+	// ValueProfile picks the default dummy values of sample payloads:
+	// minimal, realistic-india or stress-test.
+	ValueProfile string `json:"valueProfile"`
+	// PayloadLimits bounds the payloads shown in chat replies.
+	PayloadLimits PayloadLimits `json:"payloadLimits"`
+	Retention     Retention     `json:"retention"`
+	Cluster       Cluster       `json:"cluster"`
+	OutputFormat  OutputFormat  `json:"outputFormat"`
+	XML           XML           `json:"xml"`
+	Scoring       Scoring       `json:"scoring"`
+	Email         Email         `json:"email"`
+	Tickets       Tickets       `json:"tickets"`
+}
+
+// Email lets users send the final recommendation of a session to a
+// colleague through an SMTP server. It is off while Host is empty. The
+// SMTP password is read from SMTP_PASSWORD rather than the config file.
+type Email struct {
+	Host string `json:"host"`
+	// Port is 587 by default; 465 connects with TLS from the start,
+	// other ports upgrade with STARTTLS when the server offers it.
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	// From is the sender address.
+	From string `json:"from"`
+	// AllowedDomains are the only domains mail may be sent to, e.g.
+	// "example.com", which also allows its subdomains.
+	AllowedDomains []string `json:"allowedDomains"`
+	// TimeoutMillis bounds sending one message.
+	TimeoutMillis int `json:"timeoutMillis"`
+}
+
+// Enabled reports whether email is configured.
+func (e Email) Enabled() bool {
+	return strings.TrimSpace(e.Host) != ""
+}
+
+// Allows reports whether mail may be sent to address, an address already
+// known to be valid.
+func (e Email) Allows(address string) bool {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSuffix(address[at+1:], "."))
+	for _, allowed := range e.AllowedDomains {
+		allowed = strings.ToLower(strings.Trim(strings.TrimSpace(allowed), "."))
+		if allowed != "" && (domain == allowed || strings.HasSuffix(domain, "."+allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Email) validate() error {
+	if !e.Enabled() {
+		return nil
+	}
+	if _, err := mail.ParseAddress(e.From); err != nil {
+		return fmt.Errorf("email.from must be an email address: %w", err)
+	}
+	if len(e.AllowedDomains) == 0 {
+		return fmt.Errorf("email.allowedDomains must list the domains mail may be sent to")
+	}
+	if e.Port < 1 || e.Port > 65535 || e.TimeoutMillis < 1 {
+		return fmt.Errorf("email.port must be a port number and email.timeoutMillis at least 1")
+	}
+	return nil
+}
+
+// Scoring weighs the signals that choose the API for a request. Every
+// candidate scores between 0 and 1 on each signal, and the one with the
+// highest weighted sum is recommended. A weight of 0 leaves its signal out.
+type Scoring struct {
+	// Model weighs the API the model picked.
+	Model float64 `json:"model"`
+	// Embedding weighs how close the request is to the API's name,
+	// description and groups, by embeddings from EmbeddingModel.
+	Embedding float64 `json:"embedding"`
+	// EmbeddingModel is the provider's embedding model, needed for a
+	// non-zero Embedding weight.
+	EmbeddingModel string `json:"embeddingModel"`
+	// Rules weighs keyword rules: the API named outright, the operation's
+	// API type, the request's groups and its usecase.
+	Rules float64 `json:"rules"`
+	// History weighs how often users accepted the API, from their
+	// feedback on its recommendations.
+	History float64 `json:"history"`
+}
+
+// XML names the root element of XML payloads and the namespace bound to
+// its prefix, for the whole catalog and per API.
+type XML struct {
+	XMLRoot
+	// APIs overrides the catalog's root per API, keyed by API name. Fields
+	// left empty are the catalog's.
+	APIs map[string]XMLRoot `json:"apis"`
+	// Schemas are XSD files, or directories of them, that XML payloads
+	// are checked against.
+	Schemas []string `json:"schemas"`
+	// SchemaRetry generates a payload that breaks the schemas once more,
+	// telling the model what to fix.
+	SchemaRetry bool `json:"schemaRetry"`
+}
+
+// XMLRoot is the root element of an XML payload, e.g. token:ReqIssue with
+// xmlns:token set to the token schema namespace.
+type XMLRoot struct {
+	// Name is the root element without its prefix. Empty uses the last
+	// segment of the API's path, e.g. ReqIssue for /token/ReqIssue.
+	Name string `json:"root"`
+	// Prefix is bound to Namespace. Empty puts the root element in
+	// Namespace as the default namespace, unprefixed.
+	Prefix    string `json:"prefix"`
+	Namespace string `json:"namespace"`
+}
+
+// For returns the root of the XML payloads of the API named api, whose path
+// is path.
+func (x XML) For(api, path string) XMLRoot {
+	root := x.XMLRoot
+	if o, ok := x.APIs[api]; ok {
+		if o.Name != "" {
+			root.Name = o.Name
+		}
+		if o.Prefix != "" {
+			root.Prefix = o.Prefix
+		}
+		if o.Namespace != "" {
+			root.Namespace = o.Namespace
+		}
+	}
+	if root.Name == "" {
+		path = strings.TrimSuffix(path, "/")
+		root.Name = path[strings.LastIndex(path, "/")+1:]
+	}
+	return root
+}
+
+// validate checks that the names of r can be used in XML. where names r in
+// errors.
+func (r XMLRoot) validate(where string) error {
+	for _, n := range []struct{ key, value string }{{"root", r.Name}, {"prefix", r.Prefix}} {
+		if n.value != "" && !xmlName(n.value) {
+			return fmt.Errorf("%s.%s %q is not an XML name", where, n.key, n.value)
+		}
+	}
+	return nil
+}
+
+// xmlName reports whether s is an XML name without a prefix.
+func xmlName(s string) bool {
+	for i, c := range s {
+		letter := c == '_' || unicode.IsLetter(c)
+		if i == 0 && !letter || !letter && !unicode.IsDigit(c) && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return !strings.HasPrefix(strings.ToLower(s), "xml")
+}
+
+// OutputFormat is the format, "json" or "xml", sample payloads are given in
+// when the user doesn't name one. A session can choose its own by asking,
+// e.g. "always give me XML".
+type OutputFormat struct {
+	Default string `json:"default"`
+	// Tenants overrides Default for particular tenants, keyed by tenant id.
+	Tenants map[string]string `json:"tenants"`
+}
+
+// For returns the output format of tenant.
+func (o OutputFormat) For(tenant string) string {
+	if f, ok := o.Tenants[tenant]; ok {
+		return f
+	}
+	return o.Default
+}
+
+// Cluster is set when several replicas of the server share one database
+// behind a load balancer. No session state then lives only in one
+// replica's memory, so requests need no sticky routing. The database is
+// opened in WAL mode, which needs the replicas on one host sharing a local
+// filesystem, not a network one.
+type Cluster struct {
+	Enabled bool `json:"enabled"`
+	// InstanceID names this replica when it takes the lead of background
+	// jobs. Empty uses the host name and process id.
+	InstanceID string `json:"instanceId"`
+}
+
+// Retention sets how long generated data is kept. A background sweep
+// removes artifacts past their retention and purges deleted sessions.
+type Retention struct {
+	// ArtifactDays is how long artifacts, and so their download links,
+	// stay available. Zero keeps them forever.
+	ArtifactDays int `json:"artifactDays"`
+	// SweepMinutes is how often the sweep runs. Zero turns the background
+	// sweep off; it can still be run through the admin API.
+	SweepMinutes int `json:"sweepMinutes"`
+}
+
+// PayloadLimits bounds the size and nesting of payloads shown in chat. A
+// payload over a limit is stored in full for download and the reply shows
+// a preview of it. Zero turns a limit off.
+type PayloadLimits struct {
+	MaxBytes int `json:"maxBytes"`
+	MaxDepth int `json:"maxDepth"`
+	// PreviewItems is how many entries of each list a preview keeps.
+	PreviewItems int `json:"previewItems"`
+}
+
+// Timestamps sets the timezone and format of the timestamps payloads are
+// built and checked with.
+type Timestamps struct {
+	// Timezone is an IANA name such as "Asia/Kolkata".
+	Timezone string `json:"timezone"`
+	// Format is RFC3339, RFC3339Nano, DateTime or a Go time layout.
+	Format string `json:"format"`
+}
+
+// namedFormats are the formats Timestamps.Format may name.
+var namedFormats = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"DateTime":    time.DateTime,
+}
+
+// Location loads the timezone.
+func (t Timestamps) Location() (*time.Location, error) {
+	loc, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timestamps.timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// Layout returns the Go layout of the format. Formats that can't hold a
+// time to the second are rejected, since they couldn't be read back.
+func (t Timestamps) Layout() (string, error) {
+	layout, ok := namedFormats[t.Format]
+	if !ok {
+		layout = t.Format
+	}
+	probe := time.Date(2026, time.December, 31, 23, 59, 58, 0, time.UTC)
+	back, err := time.Parse(layout, probe.Format(layout))
+	if err != nil || !back.Equal(probe) {
+		return "", fmt.Errorf("timestamps.format %q can't hold a date and time to the second", t.Format)
+	}
+	return layout, nil
+}
+
+// Simulation configures the walkthrough of a payload's downstream flow.
+type Simulation struct {
+	// Topic is the Kafka topic async events are produced to. {{operation}}
+	// stands for the operation, e.g. "issue", and the persona placeholders
+	// may be used too.
+	Topic string `json:"topic"`
+}
+
+// Fee fields a rule can be set for.
+const (
+	FeeTDS                 = "tdsFee"
+	FeeSwitch              = "switchFee"
+	FeePreMatureWithdrawal = "preMatureWithdrawalFee"
+)
+
+// Bases a percentage fee can be taken of.
+const (
+	FeeOfPrincipal = "principal"
+	FeeOfInterest  = "interest"
+)
+
+// FeeRule says how one fee field is computed. A Percent with no Of is
+// stored as a rate ("1 percent"); with Of it is taken of the principal or
+// of the simple interest earned over the tenure and stored as an amount.
+// Otherwise the fee is the flat Amount.
+type FeeRule struct {
+	Percent float64 `json:"percent"`
+	Of      string  `json:"of"`
+	Amount  float64 `json:"amount"`
+	// Currency is the unit of amounts; INR when empty.
+	Currency string `json:"currency"`
+}
+
+func (r FeeRule) validate(field string) error {
+	switch field {
+	case FeeTDS, FeeSwitch, FeePreMatureWithdrawal:
+	default:
+		return fmt.Errorf("unknown fee %q; use %s, %s or %s", field, FeeTDS, FeeSwitch, FeePreMatureWithdrawal)
+	}
+	switch {
+	case r.Of != "" && r.Of != FeeOfPrincipal && r.Of != FeeOfInterest:
+		return fmt.Errorf("fees.%s.of must be %s or %s", field, FeeOfPrincipal, FeeOfInterest)
+	case r.Percent != 0 && r.Amount != 0:
+		return fmt.Errorf("set only one of fees.%s.percent and fees.%s.amount", field, field)
+	case r.Percent < 0 || r.Amount < 0:
+		return fmt.Errorf("fees.%s must not be negative", field)
+	case r.Of != "" && r.Percent == 0:
+		return fmt.Errorf("fees.%s.of needs a percent", field)
+	}
+	return nil
+}
+
+// NetworkStatus configures the endpoint the network_status tool reads. The
+// tool is only offered when URL is set.
+type NetworkStatus struct {
+	// URL is fetched with GET; its response, JSON or text, is shown to the
+	// model as the network's status.
+	URL string `json:"url"`
+	// TimeoutMillis bounds each status check.
+	TimeoutMillis int `json:"timeoutMillis"`
+}
+
+// WriteBehind queues chat messages in memory and writes them in batches,
+// taking the database writes off the request path. Queued messages are
+// written before any read of their session and when the service closes.
+type WriteBehind struct {
+	Enabled bool `json:"enabled"`
+	// FlushMillis is the longest a message waits in the queue.
+	FlushMillis int `json:"flushMillis"`
+	// BatchSize flushes the queue early once it holds this many messages.
+	BatchSize int `json:"batchSize"`
+}
+
+// Rollout sets when a candidate prompt is rolled back: once both arms have
+// MinSamples rated recommendations and the candidate's share of thumbs-up is
+// Threshold or more below the stable prompt's.
+type Rollout struct {
+	Threshold  float64 `json:"threshold"`
+	MinSamples int     `json:"minSamples"`
+	// AlertURL receives a JSON POST for every automatic rollback.
+	AlertURL string `json:"alertUrl"`
+}
+
+// Welcome configures the onboarding message sent with the first reply of a
+// new session.
+type Welcome struct {
+	Enabled bool `json:"enabled"`
+	// Message introduces the example prompts and may use the persona
+	// placeholders.
+	Message string `json:"message"`
+}
+
+// Items of the required-information checklist.
+const (
+	QuestionAsync        = "async"
+	QuestionUMICompliant = "umiCompliant"
+	QuestionPrivacy      = "privacy"
+	QuestionFields       = "fields"
+)
+
+// Questions selects what the assistant must know before it recommends an API,
+// so teams that never care about e.g. compliance aren't asked about it.
+type Questions struct {
+	// Required lists the checklist items asked for by default.
+	Required []string `json:"required"`
+	// Usecases replaces Required for particular usecases, keyed by usecase
+	// name.
+	Usecases map[string][]string `json:"usecases"`
+}
+
+// Requires reports whether item must be known for usecase.
+func (q Questions) Requires(usecase, item string) bool {
+	required := q.Required
+	for name, items := range q.Usecases {
+		if strings.EqualFold(name, usecase) {
+			required = items
+			break
+		}
+	}
+	for _, r := range required {
+		if r == item {
+			return true
+		}
+	}
+	return false
+}
+
+func (q Questions) validate() error {
+	lists := [][]string{q.Required}
+	for _, items := range q.Usecases {
+		lists = append(lists, items)
+	}
+	for _, items := range lists {
+		for _, item := range items {
+			switch item {
+			case QuestionAsync, QuestionUMICompliant, QuestionPrivacy, QuestionFields:
+			default:
+				return fmt.Errorf("unknown question %q; use %s, %s, %s or %s", item, QuestionAsync, QuestionUMICompliant, QuestionPrivacy, QuestionFields)
+			}
+		}
+	}
+	return nil
+}
+
+// Preset sets several request context flags at once when a user mentions its
+// name, e.g. "prod-sync-private". Unset flags are still asked for.
+type Preset struct {
+	Name           string `json:"name"`
+	IsAsync        *bool  `json:"isAsync"`
+	IsUMICompliant *bool  `json:"isUMICompliant"`
+	IsPrivate      *bool  `json:"isPrivate"`
+	NetworkID      string `json:"networkId"`
+	Version        string `json:"version"`
+}
+
+// Assets configures where existing asset ids are looked up. At most one
+// source should be set; lookups are off when both are empty.
+type Assets struct {
+	// Registry is a local JSON file listing known assets.
+	Registry string `json:"registry"`
+	// QueryURL is the base URL of an HTTP asset query service.
+	QueryURL string `json:"queryUrl"`
+	// Owner is who "my" refers to when a request does not identify its
+	// user, e.g. in the CLI.
+	Owner string `json:"owner"`
+	// Owners is who "my" refers to per tenant, keyed by tenant id. The
+	// tenant is the one the caller's API key is pinned to (see Access).
+	Owners map[string]string `json:"owners"`
+}
+
+// OwnerFor returns the owner of the tenant's assets, or "" when none is
+// configured.
+func (a Assets) OwnerFor(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return a.Owners[tenant]
+}
+
+// Persona describes who the assistant claims to be. Text fields may use the
+// {{product}} and {{productFullName}} placeholders, which are expanded by
+// Render so a deployment only has to change the product names.
+type Persona struct {
+	// ProductName is the short product name, e.g. "UMI".
+	ProductName string `json:"productName"`
+	// ProductFullName is the expanded product name, e.g. "Unified Market Interface".
+	ProductFullName string `json:"productFullName"`
+	// Greeting is the banner shown when a CLI session starts.
+	Greeting string `json:"greeting"`
+	// UserLabel prefixes the user's input in the CLI.
+	UserLabel string `json:"userLabel"`
+	// Intro is how the assistant introduces itself in prompts and answers.
+	Intro string `json:"intro"`
+	// RedirectMessage is returned for requests unrelated to the product.
+	RedirectMessage string `json:"redirectMessage"`
+	// OffTopicAnswer is what the field-question prompt tells the model to say
+	// when a question is outside the product.
+	OffTopicAnswer string `json:"offTopicAnswer"`
+}
+
+// Default returns the built-in configuration.
+func Default() Config {
+	return Config{
+		Persona: Persona{
+			ProductName:     "UMI",
+			ProductFullName: "Unified Market Interface",
+			Greeting:        "API Recommender Chatbot",
+			UserLabel:       "Ayush",
+			Intro:           "I'm an AI agent for the {{product}} ({{productFullName}}) project.",
+			RedirectMessage: "{{intro}} I can help you with {{product}} project-related requests like creating assets, bonds, transactions, or answering questions about API fields and project-specific concepts. Your request doesn't seem to be related to the {{product}} project. How can I help you with {{product}}-related tasks?",
+			OffTopicAnswer:  "I'm an AI agent for the {{product}} project. I can only answer questions related to this project. How can I help you with {{product}}-related questions?",
+		},
+		Welcome: Welcome{
+			Message: "{{intro}} Here are a few things you can ask me:",
+		},
+		Questions: Questions{
+			Required: []string{QuestionAsync, QuestionUMICompliant, QuestionPrivacy, QuestionFields},
+		},
+		Rollout:       Rollout{Threshold: 0.1, MinSamples: 20},
+		WriteBehind:   WriteBehind{FlushMillis: 50, BatchSize: 64},
+		NetworkStatus: NetworkStatus{TimeoutMillis: 3000},
+		Timestamps:    Timestamps{Timezone: "UTC", Format: "RFC3339"},
+		ValueProfile:  "minimal",
+		PayloadLimits: PayloadLimits{MaxBytes: 64 << 10, MaxDepth: 16, PreviewItems: 3},
+		Retention:     Retention{ArtifactDays: 30, SweepMinutes: 60},
+		OutputFormat:  OutputFormat{Default: "json"},
+		XML:           XML{XMLRoot: XMLRoot{Prefix: "token", Namespace: "http://npci.org/token/schema/"}},
+		// The other signals can't outweigh the model's pick by default
+		Scoring: Scoring{Model: 1, Rules: 0.3, History: 0.2},
+		Email:   Email{Port: 587, TimeoutMillis: 10000},
+		Tickets: Tickets{TimeoutMillis: 10000},
+	}
+}
+
+// Load reads the config file at path on top of the defaults. An empty path
+// returns the defaults. FEATURE_* environment variables override the feature
+// flags either way.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if err := cfg.Features.applyEnv(); err != nil {
+		return cfg, err
+	}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if strings.TrimSpace(cfg.Persona.ProductName) == "" {
+		return cfg, fmt.Errorf("parse config %s: persona.productName must not be empty", path)
+	}
+	if cfg.Assets.Registry != "" && cfg.Assets.QueryURL != "" {
+		return cfg, fmt.Errorf("parse config %s: set only one of assets.registry and assets.queryUrl", path)
+	}
+	seen := map[string]bool{}
+	for _, p := range cfg.Presets {
+		name := strings.ToLower(strings.TrimSpace(p.Name))
+		if name == "" {
+			return cfg, fmt.Errorf("parse config %s: every preset needs a name", path)
+		}
+		if seen[name] {
+			return cfg, fmt.Errorf("parse config %s: duplicate preset %q", path, p.Name)
+		}
+		seen[name] = true
+	}
+	if err := cfg.Questions.validate(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if err := cfg.Features.validate(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if cfg.Rollout.Threshold < 0 || cfg.Rollout.Threshold > 1 || cfg.Rollout.MinSamples < 1 {
+		return cfg, fmt.Errorf("parse config %s: rollout.threshold must be between 0 and 1 and rollout.minSamples at least 1", path)
+	}
+	if cfg.WriteBehind.FlushMillis < 1 || cfg.WriteBehind.BatchSize < 1 {
+		return cfg, fmt.Errorf("parse config %s: writeBehind.flushMillis and writeBehind.batchSize must be at least 1", path)
+	}
+	if u := cfg.NetworkStatus.URL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return cfg, fmt.Errorf("parse config %s: networkStatus.url must be an http or https URL", path)
+	}
+	if _, err := cfg.Timestamps.Location(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if _, err := cfg.Timestamps.Layout(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	for field, rule := range cfg.Fees {
+		if err := rule.validate(field); err != nil {
+			return cfg, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+	if l := cfg.PayloadLimits; l.MaxBytes < 0 || l.MaxDepth < 0 || l.PreviewItems < 1 {
+		return cfg, fmt.Errorf("parse config %s: payloadLimits.maxBytes and payloadLimits.maxDepth must not be negative and payloadLimits.previewItems must be at least 1", path)
+	}
+	if cfg.Cluster.Enabled && cfg.WriteBehind.Enabled {
+		return cfg, fmt.Errorf("parse config %s: writeBehind keeps messages in one replica's memory and can't be enabled with cluster.enabled", path)
+	}
+	for tenant, f := range cfg.OutputFormat.Tenants {
+		if f != "json" && f != "xml" {
+			return cfg, fmt.Errorf("parse config %s: outputFormat.tenants.%s must be json or xml, not %q", path, tenant, f)
+		}
+	}
+	if f := cfg.OutputFormat.Default; f != "json" && f != "xml" {
+		return cfg, fmt.Errorf("parse config %s: outputFormat.default must be json or xml, not %q", path, f)
+	}
+	if err := cfg.XML.validate("xml"); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if cfg.XML.SchemaRetry && len(cfg.XML.Schemas) == 0 {
+		return cfg, fmt.Errorf("parse config %s: xml.schemaRetry needs xml.schemas", path)
+	}
+	for api, root := range cfg.XML.APIs {
+		if err := root.validate("xml.apis." + api); err != nil {
+			return cfg, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+	if cfg.Retention.ArtifactDays < 0 || cfg.Retention.SweepMinutes < 0 {
+		return cfg, fmt.Errorf("parse config %s: retention.artifactDays and retention.sweepMinutes must not be negative", path)
+	}
+	if cfg.NetworkStatus.TimeoutMillis < 1 {
+		return cfg, fmt.Errorf("parse config %s: networkStatus.timeoutMillis must be at least 1", path)
+	}
+	if err := cfg.Scoring.validate(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if err := cfg.Email.validate(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if err := cfg.Tickets.validate(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Render expands the persona placeholders in s. {{intro}} is expanded first
+// so the intro itself may refer to the product names.
+func (p Persona) Render(s string) string {
+	s = strings.ReplaceAll(s, "{{intro}}", p.Intro)
+	return strings.NewReplacer(
+		"{{product}}", p.ProductName,
+		"{{productFullName}}", p.ProductFullName,
+	).Replace(s)
+}
+
+func (s Scoring) validate() error {
+	if s.Model < 0 || s.Embedding < 0 || s.Rules < 0 || s.History < 0 {
+		return fmt.Errorf("scoring weights must not be negative")
+	}
+	if s.Model+s.Embedding+s.Rules+s.History == 0 {
+		return fmt.Errorf("scoring needs at least one weight above 0")
+	}
+	if s.Embedding > 0 && strings.TrimSpace(s.EmbeddingModel) == "" {
+		return fmt.Errorf("scoring.embedding needs scoring.embeddingModel")
+	}
+	return nil
+}
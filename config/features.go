@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature flags for features that are rolled out gradually.
+const (
+	FeatureStreaming   = "streaming"
+	FeatureExecuteMode = "executeMode"
+	FeatureNewSelector = "newSelector"
+	// FeatureResponseSchemas adds what the API returns to recommendations.
+	FeatureResponseSchemas = "responseSchemas"
+	// FeatureClientKeys lets callers send their own LLM API key, and
+	// model, for the calls made for their requests.
+	FeatureClientKeys = "clientKeys"
+	// FeatureWatermark embeds how a payload was generated in the payload
+	// itself, as an XML comment or a JSON "_meta" field.
+	FeatureWatermark = "watermark"
+)
+
+// KnownFeatures lists every flag, so typos in the config are caught at startup.
+var KnownFeatures = []string{FeatureStreaming, FeatureExecuteMode, FeatureNewSelector, FeatureResponseSchemas, FeatureClientKeys, FeatureWatermark}
+
+// Features switches flagged features on or off for the whole deployment and
+// per tenant. Flags that aren't set are off.
+type Features struct {
+	// Flags is the deployment-wide setting of each flag.
+	Flags map[string]bool `json:"flags"`
+	// Tenants overrides Flags for particular tenants, keyed by tenant id.
+	Tenants map[string]map[string]bool `json:"tenants"`
+	// env holds the FEATURE_* environment overrides, which win over the
+	// config file so a flag can be flipped without editing it.
+	env map[string]bool
+}
+
+// Enabled reports whether flag is on for tenant. An empty tenant gets the
+// deployment-wide setting.
+func (f Features) Enabled(flag, tenant string) bool {
+	if on, ok := f.env[flag]; ok {
+		return on
+	}
+	if on, ok := f.Tenants[tenant][flag]; ok {
+		return on
+	}
+	return f.Flags[flag]
+}
+
+// Resolve returns the setting of every known flag for tenant.
+func (f Features) Resolve(tenant string) map[string]bool {
+	out := make(map[string]bool, len(KnownFeatures))
+	for _, name := range KnownFeatures {
+		out[name] = f.Enabled(name, tenant)
+	}
+	return out
+}
+
+// FeatureEnv is the environment variable overriding flag, e.g.
+// FEATURE_EXECUTE_MODE for executeMode.
+func FeatureEnv(flag string) string {
+	var b strings.Builder
+	b.WriteString("FEATURE_")
+	for i, r := range flag {
+		if r >= 'A' && r <= 'Z' && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// applyEnv reads the FEATURE_* overrides from the environment.
+func (f *Features) applyEnv() error {
+	for _, name := range KnownFeatures {
+		key := FeatureEnv(name)
+		raw, ok := os.LookupEnv(key)
+		if !ok || strings.TrimSpace(raw) == "" {
+			continue
+		}
+		on, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, raw)
+		}
+		if f.env == nil {
+			f.env = map[string]bool{}
+		}
+		f.env[name] = on
+	}
+	return nil
+}
+
+func (f Features) validate() error {
+	lists := []map[string]bool{f.Flags}
+	for _, flags := range f.Tenants {
+		lists = append(lists, flags)
+	}
+	for _, flags := range lists {
+		for name := range flags {
+			if !knownFeature(name) {
+				known := append([]string(nil), KnownFeatures...)
+				sort.Strings(known)
+				return fmt.Errorf("unknown feature flag %q; use one of %s", name, strings.Join(known, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func knownFeature(name string) bool {
+	for _, k := range KnownFeatures {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Tickets connects tenants to their issue trackers, so users can raise a
+// recommendation as a ticket. A tenant without a connector of its own uses
+// Default; with neither, tickets are off.
+type Tickets struct {
+	Default TicketConnector `json:"default"`
+	// Tenants overrides Default for particular tenants, keyed by tenant id.
+	Tenants map[string]TicketConnector `json:"tenants"`
+	// TimeoutMillis bounds raising one ticket.
+	TimeoutMillis int `json:"timeoutMillis"`
+}
+
+// TicketConnector is one issue tracker to raise tickets in.
+type TicketConnector struct {
+	// Kind is jira or servicenow.
+	Kind string `json:"kind"`
+	// URL is the tracker's base URL, e.g. https://example.atlassian.net.
+	URL string `json:"url"`
+	// Project is the Jira project key, or the ServiceNow table tickets
+	// are created in, incident by default.
+	Project string `json:"project"`
+	// IssueType is the Jira issue type, Task by default.
+	IssueType string `json:"issueType"`
+	// Username is sent with the token for basic authentication. Without
+	// it the token is sent as a bearer token.
+	Username string `json:"username"`
+	// TokenEnv names the environment variable holding the API token or
+	// password, which is kept out of the config file.
+	TokenEnv string `json:"tokenEnv"`
+}
+
+// Ticket connector kinds.
+const (
+	TicketsJira       = "jira"
+	TicketsServiceNow = "servicenow"
+)
+
+// For returns the connector of tenant, reporting false when it has none.
+func (t Tickets) For(tenant string) (TicketConnector, bool) {
+	if c, ok := t.Tenants[tenant]; ok {
+		return c, c.Kind != ""
+	}
+	return t.Default, t.Default.Kind != ""
+}
+
+func (t Tickets) validate() error {
+	if t.TimeoutMillis < 1 {
+		return fmt.Errorf("tickets.timeoutMillis must be at least 1")
+	}
+	if err := t.Default.validate("tickets.default"); err != nil {
+		return err
+	}
+	for tenant, c := range t.Tenants {
+		if err := c.validate("tickets.tenants." + tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c TicketConnector) validate(key string) error {
+	switch c.Kind {
+	case "":
+		return nil
+	case TicketsJira:
+		if strings.TrimSpace(c.Project) == "" {
+			return fmt.Errorf("%s.project must name the Jira project", key)
+		}
+	case TicketsServiceNow:
+	default:
+		return fmt.Errorf("%s.kind must be %s or %s, not %q", key, TicketsJira, TicketsServiceNow, c.Kind)
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%s.url must be an http or https URL, not %q", key, c.URL)
+	}
+	if strings.TrimSpace(c.TokenEnv) == "" {
+		return fmt.Errorf("%s.tokenEnv must name the variable holding the tracker's token", key)
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+// Package content stores the tunable content admins manage at runtime: extra
+// prompt instructions, glossary entries and usecase field lists. Items are
+// versioned so concurrent editors can't silently overwrite each other.
+package content
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of content.
+const (
+	KindPrompts  = "prompts"
+	KindGlossary = "glossary"
+	KindUsecases = "usecases"
+)
+
+// PromptNames are the prompts that accept extra instructions.
+var PromptNames = []string{"classify", "extract", "followup", "answer", "pick", "fields", "payload", "event", "attachment"}
+
+var (
+	// ErrNotFound is returned for unknown items.
+	ErrNotFound = errors.New("content not found")
+	// ErrVersionConflict is returned when an update or delete names a
+	// version other than the stored one.
+	ErrVersionConflict = errors.New("content version conflict")
+	// ErrInvalid is returned for unknown kinds and malformed values.
+	ErrInvalid = errors.New("invalid content")
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS content_items (
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (kind, key)
+);
+CREATE TABLE IF NOT EXISTS content_revision (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	revision INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO content_revision (id, revision) VALUES (1, 0);
+CREATE TRIGGER IF NOT EXISTS content_items_insert AFTER INSERT ON content_items
+BEGIN UPDATE content_revision SET revision = revision + 1; END;
+CREATE TRIGGER IF NOT EXISTS content_items_update AFTER UPDATE ON content_items
+BEGIN UPDATE content_revision SET revision = revision + 1; END;
+CREATE TRIGGER IF NOT EXISTS content_items_delete AFTER DELETE ON content_items
+BEGIN UPDATE content_revision SET revision = revision + 1; END;`
+
+// Item is one piece of content. Version starts at 1 and increases with every
+// update.
+type Item struct {
+	Kind    string          `json:"kind"`
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Version int             `json:"version"`
+	Updated string          `json:"updated,omitempty"`
+}
+
+// Prompt is the value of a prompts item: instructions appended to the named
+// prompt. A Candidate rolls out a new version of them alongside Text.
+type Prompt struct {
+	Text      string     `json:"text"`
+	Candidate *Candidate `json:"candidate,omitempty"`
+}
+
+// Term is the value of a glossary item.
+type Term struct {
+	Definition string `json:"definition"`
+}
+
+// Usecase is the value of a usecases item: the typical fields per operation.
+type Usecase struct {
+	Operations map[string][]string `json:"operations"`
+}
+
+// Store persists content in SQLite and keeps a snapshot in memory for the
+// prompt builders, which read it on every request. Every change to the
+// table bumps content_revision, whichever process made it, so replicas
+// sharing the database can tell their snapshot is stale; see Refresh.
+type Store struct {
+	db *sql.DB
+
+	mu       sync.RWMutex
+	items    map[string]map[string]Item
+	revision int64
+}
+
+// Open creates the content table if needed and loads the stored items.
+func Open(ctx context.Context, db *sql.DB) (*Store, error) {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("create content schema: %w", err)
+	}
+	s := &Store{db: db}
+	if err := s.reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Refresh reloads the snapshot if the content changed since it was taken,
+// e.g. through the admin API of another replica.
+func (s *Store) Refresh(ctx context.Context) error {
+	revision, err := s.storedRevision(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	current := revision == s.revision
+	s.mu.RUnlock()
+	if current {
+		return nil
+	}
+	return s.reload(ctx)
+}
+
+func (s *Store) storedRevision(ctx context.Context) (int64, error) {
+	var revision int64
+	if err := s.db.QueryRowContext(ctx, "SELECT revision FROM content_revision WHERE id = 1;").Scan(&revision); err != nil {
+		return 0, fmt.Errorf("load content revision: %w", err)
+	}
+	return revision, nil
+}
+
+func (s *Store) reload(ctx context.Context) error {
+	// Read the revision first: a change landing during the load leaves the
+	// snapshot marked stale rather than current
+	revision, err := s.storedRevision(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT kind, key, value, version, updated FROM content_items;")
+	if err != nil {
+		return fmt.Errorf("load content: %w", err)
+	}
+	defer rows.Close()
+
+	items := map[string]map[string]Item{}
+	for rows.Next() {
+		var it Item
+		var value string
+		var updated sql.NullString
+		if err := rows.Scan(&it.Kind, &it.Key, &value, &it.Version, &updated); err != nil {
+			return fmt.Errorf("scan content: %w", err)
+		}
+		it.Value = json.RawMessage(value)
+		it.Updated = updated.String
+		if items[it.Kind] == nil {
+			items[it.Kind] = map[string]Item{}
+		}
+		items[it.Kind][it.Key] = it
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate content: %w", err)
+	}
+
+	s.mu.Lock()
+	s.items, s.revision = items, revision
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns the items of kind ordered by key.
+func (s *Store) List(kind string) ([]Item, error) {
+	if err := checkKind(kind); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Item, 0, len(s.items[kind]))
+	for _, it := range s.items[kind] {
+		out = append(out, it)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Get returns one item.
+func (s *Store) Get(kind, key string) (Item, error) {
+	if err := checkKind(kind); err != nil {
+		return Item{}, err
+	}
+	key = normalizeKey(kind, key)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	it, ok := s.items[kind][key]
+	if !ok {
+		return Item{}, fmt.Errorf("%w: %s/%s", ErrNotFound, kind, key)
+	}
+	return it, nil
+}
+
+// Put creates or replaces an item. version must be the stored version, or 0
+// to create a new item; the saved item carries the next version.
+func (s *Store) Put(ctx context.Context, kind, key string, value json.RawMessage, version int) (Item, error) {
+	key = normalizeKey(kind, key)
+	if err := validate(kind, key, value); err != nil {
+		return Item{}, err
+	}
+	if kind == KindPrompts {
+		value = stampCandidate(value)
+	}
+
+	var res sql.Result
+	var err error
+	if version == 0 {
+		res, err = s.db.ExecContext(ctx,
+			"INSERT OR IGNORE INTO content_items (kind, key, value, version) VALUES (?, ?, ?, 1);",
+			kind, key, string(value))
+	} else {
+		res, err = s.db.ExecContext(ctx,
+			"UPDATE content_items SET value = ?, version = version + 1, updated = CURRENT_TIMESTAMP WHERE kind = ? AND key = ? AND version = ?;",
+			string(value), kind, key, version)
+	}
+	if err != nil {
+		return Item{}, fmt.Errorf("save content: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Item{}, s.conflict(kind, key, version)
+	}
+
+	if err := s.reload(ctx); err != nil {
+		return Item{}, err
+	}
+	return s.Get(kind, key)
+}
+
+// Delete removes an item if version is still the stored version.
+func (s *Store) Delete(ctx context.Context, kind, key string, version int) error {
+	if err := checkKind(kind); err != nil {
+		return err
+	}
+	key = normalizeKey(kind, key)
+
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM content_items WHERE kind = ? AND key = ? AND version = ?;", kind, key, version)
+	if err != nil {
+		return fmt.Errorf("delete content: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return s.conflict(kind, key, version)
+	}
+	return s.reload(ctx)
+}
+
+// conflict explains why a versioned write matched nothing.
+func (s *Store) conflict(kind, key string, version int) error {
+	current, err := s.Get(kind, key)
+	switch {
+	case err != nil && version == 0:
+		// Created concurrently by another writer
+		return fmt.Errorf("%w: %s/%s already exists", ErrVersionConflict, kind, key)
+	case err != nil:
+		return err
+	case version == 0:
+		return fmt.Errorf("%w: %s/%s already exists at version %d", ErrVersionConflict, kind, key, current.Version)
+	}
+	return fmt.Errorf("%w: %s/%s is at version %d, not %d", ErrVersionConflict, kind, key, current.Version, version)
+}
+
+// normalizeKey trims keys and lower-cases usecase names, which are matched
+// case-insensitively.
+func normalizeKey(kind, key string) string {
+	key = strings.TrimSpace(key)
+	if kind == KindUsecases {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+func checkKind(kind string) error {
+	switch kind {
+	case KindPrompts, KindGlossary, KindUsecases:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown kind %q", ErrInvalid, kind)
+}
+
+// validate checks that value has the shape its kind expects.
+func validate(kind, key string, value json.RawMessage) error {
+	if err := checkKind(kind); err != nil {
+		return err
+	}
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("%w: key is required", ErrInvalid)
+	}
+
+	switch kind {
+	case KindPrompts:
+		var p Prompt
+		if err := decodeStrict(value, &p); err != nil {
+			return err
+		}
+		if !knownPrompt(key) {
+			return fmt.Errorf("%w: unknown prompt %q; use one of %s", ErrInvalid, key, strings.Join(PromptNames, ", "))
+		}
+		if c := p.Candidate; c != nil && (c.Share < 0 || c.Share > 100) {
+			return fmt.Errorf("%w: candidate share must be between 0 and 100", ErrInvalid)
+		}
+	case KindGlossary:
+		var t Term
+		if err := decodeStrict(value, &t); err != nil {
+			return err
+		}
+		if strings.TrimSpace(t.Definition) == "" {
+			return fmt.Errorf("%w: definition is required", ErrInvalid)
+		}
+	case KindUsecases:
+		var u Usecase
+		if err := decodeStrict(value, &u); err != nil {
+			return err
+		}
+		if len(u.Operations) == 0 {
+			return fmt.Errorf("%w: operations are required", ErrInvalid)
+		}
+	}
+	return nil
+}
+
+func decodeStrict(value json.RawMessage, dst any) error {
+	dec := json.NewDecoder(strings.NewReader(string(value)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+func knownPrompt(name string) bool {
+	for _, n := range PromptNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PromptAddendum returns the extra instructions for the named prompt. Sessions
+// in the candidate arm of an active rollout get the candidate's instructions.
+func (s *Store) PromptAddendum(ctx context.Context, name string) string {
+	var p Prompt
+	if !s.decode(KindPrompts, name, &p) {
+		return ""
+	}
+	if p.Candidate.Active() && ArmFor(sessionFrom(ctx), name, p.Candidate.Share) == ArmCandidate {
+		return strings.TrimSpace(p.Candidate.Text)
+	}
+	return strings.TrimSpace(p.Text)
+}
+
+// PromptVersion is the version of a prompt's extra instructions a session
+// is served, and the arm of the prompt's rollout it is in.
+type PromptVersion struct {
+	Prompt  string `json:"prompt"`
+	Version int    `json:"version"`
+	// Arm is ArmStable or ArmCandidate while the prompt has an active
+	// rollout, and empty otherwise.
+	Arm string `json:"arm,omitempty"`
+}
+
+// PromptVersions lists the prompts with extra instructions, ordered by
+// name, as the session on ctx is served them.
+func (s *Store) PromptVersions(ctx context.Context) []PromptVersion {
+	items, _ := s.List(KindPrompts)
+	out := make([]PromptVersion, 0, len(items))
+	for _, it := range items {
+		v := PromptVersion{Prompt: it.Key, Version: it.Version}
+		var p Prompt
+		if json.Unmarshal(it.Value, &p) == nil && p.Candidate.Active() {
+			v.Arm = ArmFor(sessionFrom(ctx), it.Key, p.Candidate.Share)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// Revision returns the content revision the snapshot was taken at. It
+// increases with every change to any item.
+func (s *Store) Revision() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision
+}
+
+// Glossary returns every glossary term with its definition.
+func (s *Store) Glossary() map[string]string {
+	items, _ := s.List(KindGlossary)
+	out := make(map[string]string, len(items))
+	for _, it := range items {
+		var t Term
+		if json.Unmarshal(it.Value, &t) == nil {
+			out[it.Key] = t.Definition
+		}
+	}
+	return out
+}
+
+// UsecaseFields returns the fields configured for usecase and operation.
+func (s *Store) UsecaseFields(usecase, operation string) ([]string, bool) {
+	var u Usecase
+	if !s.decode(KindUsecases, strings.ToLower(usecase), &u) {
+		return nil, false
+	}
+	fields, ok := u.Operations[strings.ToLower(operation)]
+	return fields, ok
+}
+
+// Usecases returns the names of the configured usecases.
+func (s *Store) Usecases() []string {
+	items, _ := s.List(KindUsecases)
+	names := make([]string, 0, len(items))
+	for _, it := range items {
+		names = append(names, it.Key)
+	}
+	return names
+}
+
+func (s *Store) decode(kind, key string, dst any) bool {
+	it, err := s.Get(kind, key)
+	return err == nil && json.Unmarshal(it.Value, dst) == nil
+}
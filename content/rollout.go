@@ -0,0 +1,117 @@
+package content
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Arms of a prompt rollout.
+const (
+	ArmStable    = "stable"
+	ArmCandidate = "candidate"
+)
+
+// Candidate is a new version of a prompt's instructions served to Share
+// percent of sessions until it is promoted by editing Text, or rolled back.
+type Candidate struct {
+	Text  string `json:"text"`
+	Share int    `json:"share"`
+	// Started is when the rollout began (RFC 3339). It is set on save and
+	// only feedback given since then is compared.
+	Started string `json:"started,omitempty"`
+	// RolledBack and Reason are set when traffic was routed back to Text.
+	RolledBack string `json:"rolledBack,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Active reports whether the candidate is still receiving traffic.
+func (c *Candidate) Active() bool {
+	return c != nil && c.Share > 0 && c.RolledBack == ""
+}
+
+// Rollout is an active candidate of one prompt.
+type Rollout struct {
+	Prompt  string `json:"prompt"`
+	Share   int    `json:"share"`
+	Started string `json:"started"`
+}
+
+type sessionKey struct{}
+
+// WithSession records the chat session a request belongs to, which decides
+// the rollout arm it is served.
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+func sessionFrom(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+// ArmFor assigns a session to an arm of prompt's rollout. The assignment is
+// a hash of both, so a session keeps its arm for the whole conversation and
+// sessions are split independently for each prompt.
+func ArmFor(sessionID, prompt string, share int) string {
+	h := fnv.New32a()
+	h.Write([]byte(prompt + "/" + sessionID))
+	if int(h.Sum32()%100) < share {
+		return ArmCandidate
+	}
+	return ArmStable
+}
+
+// Rollouts lists the prompts with an active candidate.
+func (s *Store) Rollouts() []Rollout {
+	items, _ := s.List(KindPrompts)
+	var out []Rollout
+	for _, it := range items {
+		var p Prompt
+		if json.Unmarshal(it.Value, &p) == nil && p.Candidate.Active() {
+			out = append(out, Rollout{Prompt: it.Key, Share: p.Candidate.Share, Started: p.Candidate.Started})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Prompt < out[j].Prompt })
+	return out
+}
+
+// Rollback routes all traffic for prompt back to its stable instructions.
+// The candidate is kept, marked with when and why it was rolled back.
+func (s *Store) Rollback(ctx context.Context, prompt, reason string) (Item, error) {
+	it, err := s.Get(KindPrompts, prompt)
+	if err != nil {
+		return Item{}, err
+	}
+	var p Prompt
+	if err := json.Unmarshal(it.Value, &p); err != nil {
+		return Item{}, fmt.Errorf("decode prompt %s: %w", prompt, err)
+	}
+	if !p.Candidate.Active() {
+		return it, nil
+	}
+
+	p.Candidate.RolledBack = time.Now().UTC().Format(time.RFC3339)
+	p.Candidate.Reason = reason
+	value, err := json.Marshal(p)
+	if err != nil {
+		return Item{}, fmt.Errorf("encode prompt %s: %w", prompt, err)
+	}
+	return s.Put(ctx, KindPrompts, prompt, value, it.Version)
+}
+
+// stampCandidate records when a newly added candidate started.
+func stampCandidate(value json.RawMessage) json.RawMessage {
+	var p Prompt
+	if json.Unmarshal(value, &p) != nil || p.Candidate == nil || p.Candidate.Started != "" {
+		return value
+	}
+	p.Candidate.Started = time.Now().UTC().Format(time.RFC3339)
+	if out, err := json.Marshal(p); err == nil {
+		return out
+	}
+	return value
+}
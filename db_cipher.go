@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	sqlite "github.com/mattn/go-sqlite3"
+)
+
+// ErrNoSQLCipher is returned when a database passphrase is set but the
+// binary links plain SQLite, which would ignore the key and write the
+// history unencrypted.
+var ErrNoSQLCipher = errors.New("database encryption needs a SQLCipher build")
+
+// cipherDrivers holds the sqlite3 driver registered per passphrase, since
+// database/sql drivers can't be unregistered or registered twice.
+var (
+	cipherDriversMu sync.Mutex
+	cipherDrivers   = map[string]string{}
+)
+
+// cipherDriver returns the name of a sqlite3 driver that keys every
+// connection it opens with passphrase, so pooled connections can read the
+// database too.
+func cipherDriver(passphrase string) string {
+	cipherDriversMu.Lock()
+	defer cipherDriversMu.Unlock()
+	if name, ok := cipherDrivers[passphrase]; ok {
+		return name
+	}
+	name := fmt.Sprintf("sqlite3_cipher_%d", len(cipherDrivers))
+	pragma := "PRAGMA key = '" + strings.ReplaceAll(passphrase, "'", "''") + "';"
+	sql.Register(name, &sqlite.SQLiteDriver{
+		ConnectHook: func(conn *sqlite.SQLiteConn) error {
+			// Without cgo the driver is a stub with no Exec, which can't
+			// open a database anyway
+			execer, ok := any(conn).(driver.Execer)
+			if !ok {
+				return ErrNoSQLCipher
+			}
+			_, err := execer.Exec(pragma, nil)
+			return err
+		},
+	})
+	cipherDrivers[passphrase] = name
+	return name
+}
+
+// openDB opens the SQLite database at dbPath, encrypted with SQLCipher
+// when passphrase isn't empty. A new database is created encrypted; an
+// existing one must have been encrypted with the same passphrase.
+func openDB(dbPath, passphrase string) (*sql.DB, error) {
+	if passphrase == "" {
+		return sql.Open("sqlite3", dbPath)
+	}
+	db, err := sql.Open(cipherDriver(passphrase), dbPath)
+	if err != nil {
+		return nil, err
+	}
+	// Plain SQLite has no cipher_version and takes PRAGMA key silently
+	var version string
+	err = db.QueryRow("PRAGMA cipher_version;").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version == "") {
+		db.Close()
+		return nil, fmt.Errorf("%w: rebuild with SQLCipher or unset DB_PASSPHRASE", ErrNoSQLCipher)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The key is only checked when the file is first read
+	if _, err := db.Exec("SELECT count(*) FROM sqlite_master;"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unlock %s: wrong passphrase, or the database isn't encrypted: %w", dbPath, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	apiparser "api-recommender/api-parser"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// docsSettle is how long the docs must go unchanged before they are
+// reloaded, so a save that writes in steps or a checkout of many files is
+// parsed once.
+const docsSettle = 500 * time.Millisecond
+
+// loadDocs parses the API docs at location, downloading them when it is a
+// URL. Downloads are cached in cacheDir, or under the user cache directory
+// when it is empty, and the cached copy stands in when the server is down.
+func loadDocs(location, cacheDir string) ([]apiparser.APIDoc, error) {
+	if !apiparser.IsURL(location) {
+		return apiparser.ParseAPIDocs(location)
+	}
+	if cacheDir == "" {
+		cacheDir = ".docs-cache"
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "api-recommender", "docs")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	apis, stale, err := apiparser.FetchAPIDocs(ctx, &http.Client{Timeout: 30 * time.Second}, location, cacheDir)
+	if stale != nil {
+		log.Printf("Using cached API docs for %s: %v", location, stale)
+	}
+	return apis, err
+}
+
+// watchDocs reloads the catalog of service whenever the docs file or
+// directory at path changes, until stop is called. Turns already running
+// keep the catalog they started with. Docs that no longer parse are logged
+// and the current catalog kept, as are docs without any APIs, so a
+// half-finished edit doesn't empty it.
+func watchDocs(service *ChatService, path string) (stop func(), err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.Clean(path)
+	isDir := info.IsDir()
+	if isDir {
+		err = watchTree(w, path)
+	} else {
+		// Editors often save by writing a new file and renaming it over the
+		// old one, which a watch on the file itself would lose
+		err = w.Add(filepath.Dir(path))
+	}
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	reload := func() {
+		apis, err := apiparser.ParseAPIDocs(path)
+		if err == nil && len(apis) == 0 {
+			err = fmt.Errorf("no APIs in %s", path)
+		}
+		if err != nil {
+			log.Printf("Keeping the current API docs: %v", err)
+			return
+		}
+		service.SetAPIs(apis)
+		log.Printf("Reloaded %d APIs from %s", len(apis), path)
+	}
+	var mu sync.Mutex
+	var pending *time.Timer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if isDir {
+					if strings.HasPrefix(filepath.Base(name), ".") {
+						continue
+					}
+					if event.Has(fsnotify.Create) {
+						if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+							if err := watchTree(w, name); err != nil {
+								log.Printf("watch API docs: %v", err)
+							}
+						}
+					}
+				} else if name != path {
+					continue
+				}
+				mu.Lock()
+				if pending != nil {
+					pending.Stop()
+				}
+				pending = time.AfterFunc(docsSettle, reload)
+				mu.Unlock()
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("watch API docs: %v", err)
+			}
+		}
+	}()
+	return func() {
+		w.Close()
+		<-done
+		mu.Lock()
+		if pending != nil {
+			pending.Stop()
+		}
+		mu.Unlock()
+	}, nil
+}
+
+// watchTree watches dir and the directories below it, skipping hidden ones
+// as the docs parser does.
+func watchTree(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// runValidate parses the docs at path strictly for CI, printing every
+// problem on a line of its own. It returns the exit code: 0 when the docs
+// are clean, 1 otherwise.
+func runValidate(path string) int {
+	if apiparser.IsURL(path) {
+		fmt.Fprintln(os.Stderr, "-validate checks docs files and directories, not URLs")
+		return 1
+	}
+	apis, err := apiparser.ParseAPIDocsStrict(path)
+	var de *apiparser.DiagnosticsError
+	switch {
+	case errors.As(err, &de):
+		for _, d := range de.Diagnostics {
+			fmt.Println(d)
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) in %s\n", len(de.Diagnostics), path)
+		return 1
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	case len(apis) == 0:
+		fmt.Fprintf(os.Stderr, "no APIs in %s\n", path)
+		return 1
+	}
+	fmt.Printf("%s: %d APIs, no problems\n", path, len(apis))
+	return 0
+}
+
+// runDiffDocs prints the APIs added and removed between the docs at
+// oldPath and newPath, and what changed in the ones kept, for reviewing a
+// docs update before the recommender uses it. Either may be a URL, e.g.
+// the docs deployed now. It returns the exit code: 1 when either doesn't
+// parse.
+func runDiffDocs(oldPath, newPath string) int {
+	before, err := loadDocs(oldPath, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", oldPath, err)
+		return 1
+	}
+	after, err := loadDocs(newPath, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", newPath, err)
+		return 1
+	}
+	diff := apiparser.Diff(before, after)
+	for _, api := range diff.Added {
+		fmt.Printf("+ %s (%s %s)\n", api.VersionedName(), strings.ToUpper(api.Method), api.Path)
+	}
+	for _, api := range diff.Removed {
+		fmt.Printf("- %s (%s %s)\n", api.VersionedName(), strings.ToUpper(api.Method), api.Path)
+	}
+	for _, c := range diff.Changed {
+		fmt.Printf("~ %s (%s %s)\n", c.Old.VersionedName(), strings.ToUpper(c.Old.Method), c.Old.Path)
+		for _, line := range c.Changes {
+			fmt.Println("    " + line)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d added, %d removed, %d changed (%d APIs before, %d after)\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), len(before), len(after))
+	return 0
+}
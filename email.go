@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"api-recommender/config"
+	"api-recommender/mailer"
+)
+
+var (
+	// ErrEmailUnavailable is returned when email isn't configured or the
+	// SMTP server can't be reached.
+	ErrEmailUnavailable = errors.New("email unavailable")
+	// ErrRecipientNotAllowed is returned for an address outside the
+	// allowed domains.
+	ErrRecipientNotAllowed = errors.New("recipient not allowed")
+)
+
+// reEmailCommand matches a request to email the recommendation, e.g. "send
+// the recommendation to dev@example.com". The thing sent must be named, so
+// requests that merely contain an address aren't taken for one.
+var reEmailCommand = regexp.MustCompile(`(?i)^\s*(?:please\s+)?(?:e-?mail|mail|send|forward)\s+(?:this|it|that|the\s+(?:last\s+|latest\s+|final\s+)?(?:recommendation|summary|payload|result))(?:\s+(?:by\s+)?e-?mail)?\s+to\s+<?([^\s<>@]+@[^\s<>@]+?)>?\s*[.!]?\s*$`)
+
+// parseEmailCommand returns the address a message asks the recommendation
+// to be emailed to, reporting false for other messages.
+func parseEmailCommand(input string) (string, bool) {
+	m := reEmailCommand.FindStringSubmatch(input)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// newMailer returns the SMTP sender for cfg, or nil when email is off.
+func newMailer(cfg config.Email, password string) mailer.Sender {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &mailer.SMTP{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: password,
+		Timeout:  time.Duration(cfg.TimeoutMillis) * time.Millisecond,
+	}
+}
+
+// EmailRecommendation emails the latest recommendation of a session, with
+// its payloads, to the address to, which must be in one of the allowed
+// domains. It returns the address as sent to.
+func (s *ChatService) EmailRecommendation(ctx context.Context, sessionID, to string) (string, error) {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return "", fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+	if s.mailer == nil {
+		return "", fmt.Errorf("%w: email is not configured", ErrEmailUnavailable)
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(to))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not an email address", ErrInvalidInput, to)
+	}
+	if !s.cfg.Email.Allows(addr.Address) {
+		return "", fmt.Errorf("%w: %s is not in an allowed domain (%s)", ErrRecipientNotAllowed, addr.Address, strings.Join(s.cfg.Email.AllowedDomains, ", "))
+	}
+	rec, err := s.latestRecommendation(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	product := s.cfg.Persona.ProductName
+	msg := mailer.Message{
+		From:    s.cfg.Email.From,
+		To:      addr.Address,
+		Subject: fmt.Sprintf("%s API recommendation: %s", product, rec.APIName),
+		Body: fmt.Sprintf("%s API recommendation from session %s.\n\nRequest: %s\n\n%s\n\n-- \nSent by the %s API recommender.\n",
+			product, sessionID, rec.Query, rec.Replies, product),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrEmailUnavailable, err)
+	}
+	return addr.Address, nil
+}
+
+// emailReply emails the session's recommendation for a chat command and
+// says how it went. Only storage failures are returned as errors.
+func (s *ChatService) emailReply(ctx context.Context, sessionID, to string) (string, error) {
+	sent, err := s.EmailRecommendation(ctx, sessionID, to)
+	switch {
+	case err == nil:
+		return fmt.Sprintf("I've emailed the latest recommendation to %s.", sent), nil
+	case s.mailer == nil:
+		return "Email isn't set up on this server, so I can't send the recommendation.", nil
+	case errors.Is(err, ErrRecipientNotAllowed):
+		return fmt.Sprintf("I can only send email to addresses at %s.", strings.Join(s.cfg.Email.AllowedDomains, ", ")), nil
+	case errors.Is(err, ErrInvalidInput):
+		return fmt.Sprintf("%q isn't an email address I can send to.", to), nil
+	case errors.Is(err, ErrSessionNotFound):
+		return "There's no recommendation in this session to email yet. Ask me for one first.", nil
+	case errors.Is(err, ErrEmailUnavailable):
+		log.Printf("email recommendation of %s: %v", sessionID, err)
+		return "I couldn't send the email; the mail server didn't accept it. Please try again later.", nil
+	}
+	return "", err
+}
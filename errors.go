@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"api-recommender/content"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+	"api-recommender/recommender"
+
+	"github.com/google/uuid"
+)
+
+// Machine-readable error codes returned in the error envelope. These are part
+// of the public API contract; add new codes rather than renaming existing ones.
+const (
+	CodeInvalidInput     = "invalid_input"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeVersionConflict  = "version_conflict"
+	CodeSessionNotFound  = "session_not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeRateLimited      = "rate_limited"
+	CodeLLMUnavailable   = "llm_unavailable"
+	CodeEmailUnavailable = "email_unavailable"
+	CodeInternal         = "internal_error"
+	// CodeTicketsUnavailable is returned when no issue tracker is set up
+	// or it didn't take the ticket.
+	CodeTicketsUnavailable = "tickets_unavailable"
+	// CodeUnparseableOutput is returned when the LLM answered with
+	// something other than what it was asked for; retrying may help.
+	CodeUnparseableOutput = "unparseable_output"
+	// CodeNoCandidate is returned when no API in the catalog could be
+	// chosen for the request.
+	CodeNoCandidate = "no_candidate"
+)
+
+// Sentinel errors returned by ChatService so callers can branch on failure
+// modes.
+var (
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrArtifactNotFound = errors.New("artifact not found")
+	ErrSessionForbidden = errors.New("session access denied")
+	ErrLLMUnavailable   = recommender.ErrLLMUnavailable
+
+	ErrUnparseableOutput = recommend.ErrUnparseableOutput
+	ErrNoCandidate       = recommend.ErrNoCandidate
+
+	// ErrClientKeysDisabled is returned for an LLM key sent by a tenant
+	// the clientKeys feature is off for.
+	ErrClientKeysDisabled = errors.New("client LLM keys are not enabled")
+	// ErrTenantRequired is returned to callers whose tenant isn't known
+	// from their API key while catalogs are scoped per tenant.
+	ErrTenantRequired = errors.New("tenant required")
+)
+
+// APIError is the JSON envelope for every error response.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+type requestIDKey struct{}
+
+// withRequestID assigns every request an id, honouring an incoming
+// X-Request-ID, and echoes it in the response headers.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// writeError writes the error envelope with the given status.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	writeJSONBody(w, APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestIDFrom(r.Context()),
+	})
+}
+
+// writeServiceError maps a ChatService error onto the error envelope.
+// Unexpected errors may carry SQL or internal detail, so they are logged
+// under the request id and the client only gets the id. So are failures of
+// the mail server, issue tracker and model, whose errors can name hosts,
+// accounts or model output; the client gets a fixed message per code.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidInput):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidInput, err.Error(), nil)
+	case errors.Is(err, ErrSessionForbidden), errors.Is(err, ErrRecipientNotAllowed), errors.Is(err, ErrClientKeysDisabled), errors.Is(err, ErrTenantRequired):
+		writeError(w, r, http.StatusForbidden, CodeForbidden, err.Error(), nil)
+	case errors.Is(err, ErrSessionNotFound):
+		writeError(w, r, http.StatusNotFound, CodeSessionNotFound, err.Error(), nil)
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, ErrArtifactNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, err.Error(), nil)
+	case errors.Is(err, content.ErrInvalid):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidInput, err.Error(), nil)
+	case errors.Is(err, content.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, err.Error(), nil)
+	case errors.Is(err, payload.ErrUnconvertible):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidInput, err.Error(), nil)
+	case errors.Is(err, content.ErrVersionConflict):
+		writeError(w, r, http.StatusConflict, CodeVersionConflict, err.Error(), nil)
+	case errors.Is(err, ErrEmailUnavailable):
+		logServiceError(r, err)
+		writeError(w, r, http.StatusServiceUnavailable, CodeEmailUnavailable, "email unavailable", nil)
+	case errors.Is(err, ErrTicketsUnavailable):
+		logServiceError(r, err)
+		writeError(w, r, http.StatusServiceUnavailable, CodeTicketsUnavailable, "tickets unavailable", nil)
+	case errors.Is(err, ErrLLMUnavailable):
+		logServiceError(r, err)
+		writeError(w, r, http.StatusBadGateway, CodeLLMUnavailable, "llm unavailable", nil)
+	case errors.Is(err, ErrUnparseableOutput):
+		logServiceError(r, err)
+		writeError(w, r, http.StatusBadGateway, CodeUnparseableOutput, "unparseable model output", nil)
+	case errors.Is(err, ErrNoCandidate):
+		writeError(w, r, http.StatusUnprocessableEntity, CodeNoCandidate, err.Error(), nil)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, r, http.StatusGatewayTimeout, CodeLLMUnavailable, err.Error(), nil)
+	default:
+		logServiceError(r, err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "internal server error", nil)
+	}
+}
+
+// logServiceError logs an error the client only gets a fixed message for,
+// under the request id it does get.
+func logServiceError(r *http.Request, err error) {
+	log.Printf("%s %s (request %s): %v", r.Method, r.URL.Path, requestIDFrom(r.Context()), err)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// Where the meaning of an explained field came from.
+const (
+	MeaningGlossary = "glossary"
+	MeaningCatalog  = "catalog"
+	MeaningModel    = "model"
+)
+
+// explainedField is a populated payload field with what it means.
+type explainedField struct {
+	payload.Field
+	Meaning string `json:"meaning,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// missingField is a field the payload should, or may, carry but doesn't.
+type missingField struct {
+	Path     string `json:"path"`
+	Required bool   `json:"required"`
+	Reason   string `json:"reason"`
+}
+
+// explainedAPI is the catalog entry the payload was explained against.
+type explainedAPI struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Method      string `json:"method"`
+	Description string `json:"description"`
+}
+
+// explainResponse is the outcome of POST /api/v1/explain.
+type explainResponse struct {
+	Format    string            `json:"format"`
+	Operation string            `json:"operation,omitempty"`
+	API       *explainedAPI     `json:"api,omitempty"`
+	Fields    []explainedField  `json:"fields"`
+	Missing   []missingField    `json:"missing"`
+	Problems  []payload.Problem `json:"problems"`
+}
+
+// handleExplain explains a JSON or XML payload sent as the request body
+// field by field, and lists what it lacks. Meanings come from the admin
+// glossary, then the catalog entry of the API (?api=, else the one named
+// by context.action), then the request model. ?operation= picks the rules
+// required fields are taken from, as for /validate.
+func (s *server) handleExplain(w http.ResponseWriter, r *http.Request) {
+	v := &requestValidator{}
+	body := readPayloadBody(w, r, v)
+	q := r.URL.Query()
+	operation := strings.TrimSpace(q.Get("operation"))
+	v.text("operation", operation, false, 64)
+	ref := strings.TrimSpace(q.Get("api"))
+	v.text("api", ref, false, 200)
+
+	ctx, err := s.tenantContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	catalog := s.service.catalog(ctx)
+	var api apiparser.APIDoc
+	var found bool
+	if ref != "" {
+		if api, found = apiparser.Find(catalog, ref); !found {
+			v.add("api", "is not in the API catalog")
+		}
+	}
+	if v.failed(w, r) {
+		return
+	}
+
+	report := payload.Check(body, operation, s.service.clock)
+	// An unreadable payload has no fields; the report says why
+	fields, _ := payload.Fields(body)
+	if !found {
+		for _, f := range fields {
+			if f.Path == "context.action" {
+				api, found = apiparser.Find(catalog, f.Value)
+				break
+			}
+		}
+	}
+
+	resp := explainResponse{
+		Format:    report.Format,
+		Operation: report.Operation,
+		Fields:    []explainedField{},
+		Missing:   []missingField{},
+		Problems:  append([]payload.Problem{}, report.Structure...),
+	}
+	if found {
+		resp.API = &explainedAPI{Name: api.Name, Path: api.Path, Method: api.Method, Description: api.Description}
+	}
+
+	glossary := s.service.content.Glossary()
+	populated := map[string]bool{}
+	for _, f := range fields {
+		resp.Fields = append(resp.Fields, explainField(f, glossary, api.Fields))
+		populated[strings.ToLower(f.Name)] = true
+	}
+
+	required := map[string]bool{}
+	for _, p := range payload.RequiredPaths(report.Operation) {
+		required[p] = true
+	}
+	for _, p := range report.Rules {
+		if required[p.Path] {
+			resp.Missing = append(resp.Missing, missingField{Path: p.Path, Required: true, Reason: p.Message})
+		} else {
+			resp.Problems = append(resp.Problems, p)
+		}
+	}
+	for _, f := range api.Fields {
+		if describesBody(f) || populated[strings.ToLower(f.Name)] {
+			continue
+		}
+		resp.Missing = append(resp.Missing, missingField{
+			Path:   f.Name,
+			Reason: "listed for " + api.Name + " in the API catalog: " + f.Description,
+		})
+	}
+	writeJSON(w, resp)
+}
+
+// explainField finds the meaning of f, preferring the project's own words.
+func explainField(f payload.Field, glossary map[string]string, apiFields []apiparser.APIField) explainedField {
+	out := explainedField{Field: f}
+	for term, definition := range glossary {
+		if strings.EqualFold(term, f.Name) {
+			out.Meaning, out.Source = definition, MeaningGlossary
+			return out
+		}
+	}
+	for _, af := range apiFields {
+		if strings.EqualFold(af.Name, f.Name) && !describesBody(af) && af.Description != "" {
+			out.Meaning, out.Source = af.Description, MeaningCatalog
+			return out
+		}
+	}
+	if m := payload.Describe(f.Path); m != "" {
+		out.Meaning, out.Source = m, MeaningModel
+	}
+	return out
+}
+
+// describesBody reports whether a catalog field stands for the whole
+// request body, as "manage  type: xml" does, rather than a field within it.
+func describesBody(f apiparser.APIField) bool {
+	switch strings.ToLower(strings.TrimSpace(f.Type)) {
+	case "xml", "json":
+		return true
+	}
+	return false
+}
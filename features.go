@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type tenantKey struct{}
+
+// withTenant records which tenant a request is for, so feature flags can be
+// rolled out per tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// FeatureEnabled reports whether a feature flag is on for the tenant in ctx.
+func (s *ChatService) FeatureEnabled(ctx context.Context, flag string) bool {
+	return s.cfg.Features.Enabled(flag, tenantFrom(ctx))
+}
+
+// tenant identifies the caller's tenant: the one its API key is pinned to,
+// or else the X-Tenant-ID header. With catalogs scoped per tenant the
+// header could widen the caller's scope, so only a pinned key will do.
+func (s *server) tenant(r *http.Request) (string, error) {
+	access := s.service.cfg.Access
+	if tenant, ok := access.TenantForKey(apiKey(r)); ok {
+		return tenant, nil
+	}
+	if access.Restricted() {
+		return "", fmt.Errorf("%w: catalogs are scoped per tenant; use an API key pinned to yours", ErrTenantRequired)
+	}
+	return strings.TrimSpace(r.Header.Get("X-Tenant-ID")), nil
+}
+
+// tenantContext is the request's context with the caller's tenant.
+func (s *server) tenantContext(r *http.Request) (context.Context, error) {
+	tenant, err := s.tenant(r)
+	if err != nil {
+		return nil, err
+	}
+	return withTenant(r.Context(), tenant), nil
+}
+
+// handleFeatures reports the feature flags in effect for the caller's tenant.
+func (s *server) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenant(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"tenant":   tenant,
+		"features": s.service.cfg.Features.Resolve(tenant),
+	})
+}
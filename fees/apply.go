@@ -0,0 +1,131 @@
+package fees
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"api-recommender/config"
+	"api-recommender/payload"
+)
+
+// Apply fills the fee fields of a JSON payload's meta blocks (each tokenized
+// asset's and the payload's own) with values computed from rules and the
+// user's key=value entries. A fee is filled where the payload already has
+// it or where requested names it; fees the user gave a value for are left
+// alone. Fees that can't be computed are reported, since any value the
+// payload has for them was made up. Payloads that aren't JSON are returned
+// unchanged.
+func Apply(raw string, rules map[string]config.FeeRule, pairs []payload.Pair, requested []string) (string, []Fee, []payload.Problem) {
+	if len(rules) == 0 {
+		return raw, nil, nil
+	}
+	// Numbers are kept as written rather than going through float64
+	var doc map[string]any
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return raw, nil, nil
+	}
+	body, _ := doc["payload"].(map[string]any)
+	if body == nil {
+		return raw, nil, nil
+	}
+
+	given := map[string]bool{}
+	for _, p := range pairs {
+		given[strings.ToLower(p.Name)] = true
+	}
+	asked := map[string]bool{}
+	for _, f := range requested {
+		asked[strings.ToLower(f)] = true
+	}
+
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	in := InputsFrom(pairs)
+	var (
+		fees     []Fee
+		problems []payload.Problem
+		changed  bool
+	)
+	for _, field := range fields {
+		key := strings.ToLower(field)
+		if given[key] {
+			continue
+		}
+		present := false
+		for _, meta := range metaBlocks(body, false) {
+			if _, ok := meta[field]; ok {
+				present = true
+			}
+		}
+		if !present && !asked[key] {
+			continue
+		}
+
+		fee, err := Compute(field, rules[field], in)
+		if err != nil {
+			msg := err.Error()
+			if present {
+				msg += "; the value shown is only an example"
+			}
+			problems = append(problems, payload.Problem{Path: field, Message: msg})
+			continue
+		}
+		for _, meta := range metaBlocks(body, asked[key]) {
+			if _, ok := meta[field]; ok || asked[key] {
+				meta[field], meta[field+"Unit"] = fee.Value, fee.Unit
+				changed = true
+			}
+		}
+		fees = append(fees, fee)
+	}
+	if !changed {
+		return raw, fees, problems
+	}
+
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return raw, nil, problems
+	}
+	return strings.TrimSuffix(out.String(), "\n"), fees, problems
+}
+
+// metaBlocks returns the meta objects of body's tokenized assets, or body's
+// own meta when it has no assets. With create set, missing meta blocks are
+// added so requested fees have somewhere to go.
+func metaBlocks(body map[string]any, create bool) []map[string]any {
+	var owners []map[string]any
+	if assets, ok := body["tokenizedAsset"].([]any); ok {
+		for _, a := range assets {
+			if asset, ok := a.(map[string]any); ok {
+				owners = append(owners, asset)
+			}
+		}
+	}
+	if len(owners) == 0 {
+		owners = []map[string]any{body}
+	}
+
+	var metas []map[string]any
+	for _, owner := range owners {
+		meta, ok := owner["meta"].(map[string]any)
+		if !ok && create {
+			meta = map[string]any{}
+			owner["meta"] = meta
+			ok = true
+		}
+		if ok {
+			metas = append(metas, meta)
+		}
+	}
+	return metas
+}
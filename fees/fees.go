@@ -0,0 +1,143 @@
+// Package fees computes the fee fields of a payload (tdsFee, switchFee and
+// preMatureWithdrawalFee) from the principal, tenure and interest rate the
+// user gave, following the deployment's fee rules, so sample payloads carry
+// figures that add up rather than ones the model made up.
+package fees
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"api-recommender/config"
+	"api-recommender/payload"
+)
+
+// defaultCurrency is the unit of fee amounts when a rule names none.
+const defaultCurrency = "INR"
+
+// Fee is one computed fee field.
+type Fee struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Unit  string `json:"unit"`
+	// Basis shows how the value was reached, e.g.
+	// "10% of 7500.00 INR interest".
+	Basis string `json:"basis"`
+}
+
+// Inputs are the figures fees are computed from. A nil figure was not given.
+type Inputs struct {
+	Principal *float64
+	// Rate is the yearly interest rate in percent.
+	Rate *float64
+	// Years is the tenure in years.
+	Years *float64
+}
+
+// principalNames and rateNames are the keys users give the principal and
+// the interest rate under.
+var (
+	principalNames = []string{"principal", "amount", "faceValue"}
+	rateNames      = []string{"interest", "interestRate"}
+)
+
+// yearsPer converts a tenure unit to years.
+var yearsPer = map[string]float64{"days": 1.0 / 365, "weeks": 7.0 / 365, "months": 1.0 / 12, "years": 1}
+
+// InputsFrom reads the inputs from the user's normalized key=value entries.
+// A tenure without a unit is taken to be in years.
+func InputsFrom(pairs []payload.Pair) Inputs {
+	values := map[string]string{}
+	for _, p := range pairs {
+		values[strings.ToLower(p.Name)] = p.Value
+	}
+	number := func(names ...string) *float64 {
+		for _, name := range names {
+			v, ok := values[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+			v = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), "%")
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return &f
+			}
+		}
+		return nil
+	}
+
+	in := Inputs{Principal: number(principalNames...)}
+	if unit := values["interestunit"]; unit == "" || unit == "percent" {
+		in.Rate = number(rateNames...)
+	}
+	if tenure := number("tenure"); tenure != nil {
+		unit := values["tenureunit"]
+		if unit == "" {
+			unit = "years"
+		}
+		if per, ok := yearsPer[unit]; ok {
+			years := *tenure * per
+			in.Years = &years
+		}
+	}
+	return in
+}
+
+// Compute works out field following rule. It fails naming the inputs that
+// are missing, with an example of each.
+func Compute(field string, rule config.FeeRule, in Inputs) (Fee, error) {
+	currency := rule.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	fee := Fee{Field: field, Unit: currency}
+	switch rule.Of {
+	case "":
+		if rule.Percent != 0 {
+			fee.Value, fee.Unit = number(rule.Percent), "percent"
+			fee.Basis = "flat rate of " + number(rule.Percent) + "%"
+			return fee, nil
+		}
+		fee.Value = money(rule.Amount)
+		fee.Basis = "flat amount"
+		return fee, nil
+	case config.FeeOfPrincipal:
+		if in.Principal == nil {
+			return Fee{}, errors.New("needs the principal, e.g. principal=100000")
+		}
+		fee.Value = money(*in.Principal * rule.Percent / 100)
+		fee.Basis = fmt.Sprintf("%s%% of %s %s principal", number(rule.Percent), money(*in.Principal), currency)
+		return fee, nil
+	case config.FeeOfInterest:
+		var missing []string
+		if in.Principal == nil {
+			missing = append(missing, "principal=100000")
+		}
+		if in.Rate == nil {
+			missing = append(missing, "interest=7.5%")
+		}
+		if in.Years == nil {
+			missing = append(missing, "tenure=5 years")
+		}
+		if len(missing) > 0 {
+			return Fee{}, fmt.Errorf("needs the principal, interest rate and tenure; give e.g. %s", strings.Join(missing, ", "))
+		}
+		// Simple interest, which is what TDS is deducted from
+		interest := *in.Principal * *in.Rate / 100 * *in.Years
+		fee.Value = money(interest * rule.Percent / 100)
+		fee.Basis = fmt.Sprintf("%s%% of %s %s interest", number(rule.Percent), money(interest), currency)
+		return fee, nil
+	}
+	return Fee{}, fmt.Errorf("unknown basis %q", rule.Of)
+}
+
+// money rounds an amount to paise or cents.
+func money(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', 2, 64)
+}
+
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// followUpsSchema holds one row per question kind a follow-up asked. The
+// outcome stays NULL until the user's next request settles it.
+const followUpsSchema = `
+CREATE TABLE IF NOT EXISTS follow_ups (
+	id INTEGER PRIMARY KEY,
+	session TEXT NOT NULL,
+	message_id INTEGER NOT NULL,
+	question TEXT NOT NULL,
+	outcome TEXT,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_follow_ups_session ON follow_ups (session, outcome);`
+
+// Outcomes of a follow-up question.
+const (
+	followUpAnswered   = "answered"
+	followUpUnanswered = "unanswered"
+)
+
+// followUpAbandonAfter is how long a follow-up may go without a reply
+// before it counts as abandoned.
+const followUpAbandonAfter = "-30 minutes"
+
+// QuestionStats tallies the outcomes of one kind of follow-up question.
+// Unanswered questions were asked again because the reply left them open;
+// pending ones are still within the abandonment window.
+type QuestionStats struct {
+	Question   string `json:"question"`
+	Asked      int    `json:"asked"`
+	Answered   int    `json:"answered"`
+	Unanswered int    `json:"unanswered"`
+	Abandoned  int    `json:"abandoned"`
+	Pending    int    `json:"pending"`
+}
+
+// FollowUpStats tallies follow-up messages by how the user replied: with
+// everything asked, with only part of it, or not at all.
+type FollowUpStats struct {
+	Total     int             `json:"total"`
+	Complete  int             `json:"complete"`
+	Partial   int             `json:"partial"`
+	Abandoned int             `json:"abandoned"`
+	Pending   int             `json:"pending"`
+	Questions []QuestionStats `json:"questions"`
+}
+
+func ensureFollowUpsSchema(db *sql.DB) error {
+	if _, err := db.Exec(followUpsSchema); err != nil {
+		return fmt.Errorf("create follow-ups schema: %w", err)
+	}
+	return nil
+}
+
+// trackFollowUps settles the session's open follow-up questions with the
+// turn that answers them and records the questions the turn asks in
+// messageID. A recommendation answers everything asked; a new follow-up
+// leaves the questions it asks again unanswered. Other turns, such as
+// questions about a field, leave them open.
+func (s *ChatService) trackFollowUps(ctx context.Context, sessionID, intent string, questions []string, messageID int64) error {
+	if intent != IntentFollowUp && intent != IntentRecommendation {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("track follow-ups: %w", err)
+	}
+	defer tx.Rollback()
+
+	askedAgain, args := "0", []any{}
+	if intent == IntentFollowUp && len(questions) > 0 {
+		askedAgain = "question IN (?" + strings.Repeat(", ?", len(questions)-1) + ")"
+		for _, q := range questions {
+			args = append(args, q)
+		}
+	}
+	args = append(args, followUpUnanswered, followUpAnswered, sessionID)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE follow_ups SET outcome = CASE WHEN %s THEN ? ELSE ? END WHERE session = ? AND outcome IS NULL;", askedAgain),
+		args...)
+	if err != nil {
+		return fmt.Errorf("track follow-ups: %w", err)
+	}
+	if intent == IntentFollowUp {
+		for _, q := range questions {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO follow_ups (session, message_id, question) VALUES (?, ?, ?);",
+				sessionID, messageID, q); err != nil {
+				return fmt.Errorf("track follow-ups: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("track follow-ups: %w", err)
+	}
+	return nil
+}
+
+// followUpAnalytics tallies follow-up outcomes per question kind and per
+// follow-up message.
+func (s *ChatService) followUpAnalytics(ctx context.Context) (FollowUpStats, error) {
+	stats := FollowUpStats{Questions: []QuestionStats{}}
+	// Open questions past the window are abandoned
+	const state = `CASE WHEN outcome IS NOT NULL THEN outcome
+		WHEN created < datetime('now', ?) THEN 'abandoned' ELSE 'pending' END`
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT question, COUNT(*),
+			SUM(CASE WHEN st = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN st = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN st = 'abandoned' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN st = 'pending' THEN 1 ELSE 0 END)
+		FROM (SELECT question, %s AS st FROM follow_ups)
+		GROUP BY question ORDER BY COUNT(*) DESC, question;`, state),
+		followUpAnswered, followUpUnanswered, followUpAbandonAfter)
+	if err != nil {
+		return stats, fmt.Errorf("count follow-ups: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var q QuestionStats
+		if err := rows.Scan(&q.Question, &q.Asked, &q.Answered, &q.Unanswered, &q.Abandoned, &q.Pending); err != nil {
+			return stats, fmt.Errorf("count follow-ups: %w", err)
+		}
+		stats.Questions = append(stats.Questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("count follow-ups: %w", err)
+	}
+
+	// A follow-up's questions are settled together, so one of them tells
+	// whether it was left, and whether any went unanswered tells the rest
+	err = s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN st = 'complete' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN st = 'partial' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN st = 'abandoned' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN st = 'pending' THEN 1 ELSE 0 END), 0)
+		FROM (
+			SELECT CASE
+				WHEN MAX(st) IN ('abandoned', 'pending') THEN MAX(st)
+				WHEN SUM(st = ?) > 0 THEN 'partial'
+				ELSE 'complete' END AS st
+			FROM (SELECT message_id, %s AS st FROM follow_ups)
+			GROUP BY message_id
+		);`, state),
+		followUpUnanswered, followUpAbandonAfter).
+		Scan(&stats.Total, &stats.Complete, &stats.Partial, &stats.Abandoned, &stats.Pending)
+	if err != nil {
+		return stats, fmt.Errorf("count follow-ups: %w", err)
+	}
+	return stats, nil
+}
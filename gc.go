@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deleted_sessions marks sessions deleted by their owner. They disappear at
+// once; the sweeper purges their messages and everything else stored for
+// them.
+const deletedSessionsSchema = `
+CREATE TABLE IF NOT EXISTS deleted_sessions (
+	session TEXT PRIMARY KEY,
+	deleted TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+// sessionTables hold a session column and are purged with the session.
+var sessionTables = []string{"recommendations", "message_feedback", "regenerations", "session_tokens", "session_settings", "follow_ups"}
+
+// SweepStats counts what one or more sweeps removed.
+type SweepStats struct {
+	// Artifacts are artifacts past their retention; their download links
+	// stop working with them.
+	Artifacts int64 `json:"artifacts"`
+	// Sessions are deleted sessions purged, with their Messages,
+	// SessionArtifacts and other Rows (recommendations, feedback, tokens
+	// and settings).
+	Sessions         int64 `json:"sessions"`
+	Messages         int64 `json:"messages"`
+	SessionArtifacts int64 `json:"sessionArtifacts"`
+	Rows             int64 `json:"rows"`
+	// ReclaimedBytes is the size of the message and artifact content
+	// removed.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
+
+func (s *SweepStats) add(o SweepStats) {
+	s.Artifacts += o.Artifacts
+	s.Sessions += o.Sessions
+	s.Messages += o.Messages
+	s.SessionArtifacts += o.SessionArtifacts
+	s.Rows += o.Rows
+	s.ReclaimedBytes += o.ReclaimedBytes
+}
+
+// GCMetrics reports the sweeps run since the service started.
+type GCMetrics struct {
+	Sweeps    int        `json:"sweeps"`
+	LastSweep string     `json:"lastSweep,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	Last      SweepStats `json:"last"`
+	Total     SweepStats `json:"total"`
+	// ArtifactDays and SweepMinutes are the retention policy in force.
+	ArtifactDays int `json:"artifactDays"`
+	SweepMinutes int `json:"sweepMinutes"`
+	// In cluster mode only the replica holding the sweep lease sweeps in
+	// the background. Instance is this replica and Leader whether it held
+	// the lease at its last turn; the sweeps of other replicas are not
+	// counted here.
+	Instance string `json:"instance,omitempty"`
+	Leader   bool   `json:"leader,omitempty"`
+}
+
+// sweeper runs Sweep in the background and keeps its metrics.
+type sweeper struct {
+	mu      sync.Mutex
+	metrics GCMetrics
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func ensureDeletedSessionsSchema(db *sql.DB) error {
+	if _, err := db.Exec(deletedSessionsSchema); err != nil {
+		return fmt.Errorf("create deleted sessions schema: %w", err)
+	}
+	return nil
+}
+
+// startSweeper sweeps every interval until Close. In cluster mode a turn is
+// skipped unless this replica holds the sweep lease, which lasts two
+// intervals so the leader keeps it while it is running.
+func (s *ChatService) startSweeper(interval time.Duration) {
+	s.sweeper.stop, s.sweeper.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.sweeper.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.sweeper.stop:
+				return
+			case <-ticker.C:
+			}
+			if !s.leadSweep(2 * interval) {
+				continue
+			}
+			if _, err := s.Sweep(context.Background()); err != nil {
+				log.Printf("sweep: %v", err)
+			}
+		}
+	}()
+}
+
+// leadSweep reports whether this replica should run the background sweep.
+func (s *ChatService) leadSweep(ttl time.Duration) bool {
+	if !s.cfg.Cluster.Enabled {
+		return true
+	}
+	leader, err := s.acquireLease(context.Background(), jobSweep, ttl)
+	if err != nil {
+		log.Printf("sweep: %v", err)
+	}
+	s.sweeper.mu.Lock()
+	s.sweeper.metrics.Leader = leader
+	s.sweeper.mu.Unlock()
+	return leader
+}
+
+func (s *ChatService) stopSweeper() {
+	if s.sweeper.stop == nil {
+		return
+	}
+	close(s.sweeper.stop)
+	<-s.sweeper.done
+	if s.cfg.Cluster.Enabled {
+		if err := s.releaseLease(context.Background(), jobSweep); err != nil {
+			log.Printf("sweep: %v", err)
+		}
+	}
+}
+
+// DeleteSession deletes a session. It is gone for clients at once; its
+// messages and data are purged by the next sweep.
+func (s *ChatService) DeleteSession(ctx context.Context, sessionID string) error {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return err
+	}
+	// Queued messages must land before the session's summary goes
+	if err := s.flushSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM session_summaries WHERE session = ?;", sessionID)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO deleted_sessions (session) VALUES (?);", sessionID); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// checkNotDeleted fails with ErrSessionNotFound for a deleted session.
+func (s *ChatService) checkNotDeleted(ctx context.Context, sessionID string) error {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM deleted_sessions WHERE session = ?;", sessionID).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("check deleted sessions: %w", err)
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return nil
+}
+
+// Sweep removes artifacts past their retention and purges deleted
+// sessions, returning what it removed. The outcome is added to the metrics.
+func (s *ChatService) Sweep(ctx context.Context) (SweepStats, error) {
+	stats, err := s.sweep(ctx)
+
+	s.sweeper.mu.Lock()
+	defer s.sweeper.mu.Unlock()
+	m := &s.sweeper.metrics
+	m.Sweeps++
+	m.LastSweep = time.Now().UTC().Format(time.RFC3339)
+	m.LastError = ""
+	if err != nil {
+		m.LastError = err.Error()
+		return stats, err
+	}
+	m.Last = stats
+	m.Total.add(stats)
+	return stats, nil
+}
+
+func (s *ChatService) sweep(ctx context.Context) (SweepStats, error) {
+	var stats SweepStats
+	if err := s.flushWrites(ctx); err != nil {
+		return stats, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, fmt.Errorf("sweep: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Removes the rows matching where and counts them and their content
+	remove := func(table, column, where string, args ...any) (int64, int64, error) {
+		var n, size int64
+		err := tx.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(length(%s)), 0) FROM %s WHERE %s;", column, table, where), args...).
+			Scan(&n, &size)
+		if err != nil || n == 0 {
+			return 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s;", table, where), args...); err != nil {
+			return 0, 0, err
+		}
+		return n, size, nil
+	}
+
+	if days := s.cfg.Retention.ArtifactDays; days > 0 {
+		n, size, err := remove("artifacts", "content", "created < datetime('now', ?)", fmt.Sprintf("-%d days", days))
+		if err != nil {
+			return stats, fmt.Errorf("sweep artifacts: %w", err)
+		}
+		stats.Artifacts, stats.ReclaimedBytes = n, size
+	}
+
+	const deleted = "session IN (SELECT session FROM deleted_sessions)"
+	n, size, err := remove(s.table, "content", deleted)
+	if err != nil {
+		return stats, fmt.Errorf("sweep deleted sessions: %w", err)
+	}
+	stats.Messages, stats.ReclaimedBytes = n, stats.ReclaimedBytes+size
+	n, size, err = remove("artifacts", "content", deleted)
+	if err != nil {
+		return stats, fmt.Errorf("sweep deleted sessions: %w", err)
+	}
+	stats.SessionArtifacts, stats.ReclaimedBytes = n, stats.ReclaimedBytes+size
+	for _, table := range sessionTables {
+		n, _, err := remove(table, "session", deleted)
+		if err != nil {
+			return stats, fmt.Errorf("sweep deleted sessions: %w", err)
+		}
+		stats.Rows += n
+	}
+	// The tombstones go last; a session id deleted and purged may be used
+	// again
+	if stats.Sessions, _, err = remove("deleted_sessions", "session", "1 = 1"); err != nil {
+		return stats, fmt.Errorf("sweep deleted sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("sweep: %w", err)
+	}
+	return stats, nil
+}
+
+// GCMetrics returns the sweep metrics.
+func (s *ChatService) GCMetrics() GCMetrics {
+	s.sweeper.mu.Lock()
+	defer s.sweeper.mu.Unlock()
+	m := s.sweeper.metrics
+	m.ArtifactDays, m.SweepMinutes = s.cfg.Retention.ArtifactDays, s.cfg.Retention.SweepMinutes
+	if s.cfg.Cluster.Enabled {
+		m.Instance = s.instance
+	}
+	return m
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-recommender/config"
+	"api-recommender/content"
+	llmprovider "api-recommender/llm_provider"
+	"api-recommender/payload"
+)
+
+// Generation records how a payload artifact was generated, so a payload
+// found later, e.g. pasted into a ticket, can be traced back to the session
+// and request that created it.
+type Generation struct {
+	Model string `json:"model"`
+	// ContentRevision is the revision of the admin-managed content, which
+	// includes the prompts' extra instructions, the payload was generated
+	// with.
+	ContentRevision int64 `json:"contentRevision"`
+	// Prompts are the versions of the prompts' extra instructions served
+	// to the session, with the arm of any rollout.
+	Prompts []content.PromptVersion `json:"prompts,omitempty"`
+	// Generated is when, in RFC 3339 and UTC.
+	Generated string `json:"generated"`
+	// TraceID is the id of the HTTP request (X-Request-ID) that generated
+	// the payload; empty in the CLI.
+	TraceID   string `json:"traceId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// generation describes a payload generated now, with ctx, in session.
+func (s *ChatService) generation(ctx context.Context, sessionID string) *Generation {
+	model := "sandbox"
+	if !s.cfg.Sandbox {
+		model = llmprovider.ModelFor(ctx)
+	}
+	return &Generation{
+		Model:           model,
+		ContentRevision: s.content.Revision(),
+		Prompts:         s.content.PromptVersions(content.WithSession(ctx, sessionID)),
+		Generated:       time.Now().UTC().Format(time.RFC3339),
+		TraceID:         requestIDFrom(ctx),
+		SessionID:       sessionID,
+	}
+}
+
+// watermark returns content with gen embedded when the watermark flag is
+// on for the tenant in ctx, and content unchanged otherwise.
+func (s *ChatService) watermark(ctx context.Context, content string, gen *Generation) string {
+	if gen == nil || !s.FeatureEnabled(ctx, config.FeatureWatermark) {
+		return content
+	}
+	return gen.embed(content)
+}
+
+// embed adds g to a payload: to XML as a comment after the declaration, to
+// a JSON object as its first field, payload.MetaField. Other payloads are
+// returned unchanged.
+func (g Generation) embed(content string) string {
+	trimmed := strings.TrimSpace(content)
+	switch {
+	case strings.HasPrefix(trimmed, "<"):
+		comment := "<!-- " + g.comment() + " -->"
+		if strings.HasPrefix(trimmed, "<?xml") {
+			if end := strings.Index(trimmed, "?>"); end >= 0 {
+				return trimmed[:end+2] + "\n" + comment + trimmed[end+2:]
+			}
+		}
+		return comment + "\n" + trimmed
+	case strings.HasPrefix(trimmed, "{"):
+		meta, err := json.Marshal(g)
+		if err != nil {
+			return content
+		}
+		rest := strings.TrimSpace(trimmed[1:])
+		if rest == "}" {
+			return `{"` + payload.MetaField + `": ` + string(meta) + "}"
+		}
+		// Keep the indentation of the first field, if the payload has any
+		indent := ""
+		if after, ok := strings.CutPrefix(trimmed[1:], "\n"); ok {
+			indent = "\n" + after[:len(after)-len(strings.TrimLeft(after, " \t"))]
+		}
+		return "{" + indent + `"` + payload.MetaField + `": ` + string(meta) + "," + trimmed[1:]
+	}
+	return content
+}
+
+// comment is g as key=value pairs. Values can't close the comment: XML
+// comments may not contain "--".
+func (g Generation) comment() string {
+	pairs := []string{
+		"generated-by=api-recommender",
+		"session=" + g.SessionID,
+		"trace=" + g.TraceID,
+		"model=" + g.Model,
+		fmt.Sprintf("content-revision=%d", g.ContentRevision),
+		"generated=" + g.Generated,
+	}
+	if len(g.Prompts) > 0 {
+		prompts := make([]string, len(g.Prompts))
+		for i, p := range g.Prompts {
+			prompts[i] = fmt.Sprintf("%s@%d", p.Prompt, p.Version)
+			if p.Arm != "" {
+				prompts[i] += "/" + p.Arm
+			}
+		}
+		pairs = append(pairs, "prompts="+strings.Join(prompts, ","))
+	}
+	return strings.ReplaceAll(strings.Join(pairs, " "), "--", "- -")
+}
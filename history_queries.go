@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/tmc/langchaingo/memory/sqlite3"
+)
+
+// historyTables whitelists the chat history tables the service queries. The
+// table name is spliced into SQL text, so anything else is rejected.
+var historyTables = map[string]bool{
+	sqlite3.DefaultTableName: true,
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkHistoryTable rejects table names that aren't whitelisted identifiers.
+func checkHistoryTable(name string) error {
+	if !historyTables[name] || !identifierPattern.MatchString(name) {
+		return fmt.Errorf("chat history table %q is not allowed", name)
+	}
+	return nil
+}
+
+// sessionListQuery lists sessions latest first from the summary table.
+// %s restricts the sessions listed.
+const sessionListQuery = `
+	SELECT session, last_message_at, preview, message_count
+	FROM session_summaries
+	WHERE 1 = 1%s
+	ORDER BY last_message_at DESC
+	LIMIT ?;`
+
+// historyStatements are the chat history queries, prepared once at startup.
+type historyStatements struct {
+	listSessions     *sql.Stmt
+	listSessionsByID *sql.Stmt
+	sessionMessages  *sql.Stmt
+	insertMessage    *sql.Stmt
+}
+
+func prepareHistoryStatements(db *sql.DB, table string) (*historyStatements, error) {
+	st := &historyStatements{}
+	queries := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&st.listSessions, fmt.Sprintf(sessionListQuery, "")},
+		// The ids are passed as one JSON array so the statement can be prepared
+		{&st.listSessionsByID, fmt.Sprintf(sessionListQuery, " AND session IN (SELECT value FROM json_each(?))")},
+		{&st.sessionMessages, fmt.Sprintf(`
+			SELECT m.id, m.content, m.type, m.created, COALESCE(g.original_id, 0)
+			FROM %s m LEFT JOIN regenerations g ON g.message_id = m.id
+			WHERE m.session = ? ORDER BY m.created ASC, m.id ASC LIMIT ?;`, table)},
+		{&st.insertMessage, fmt.Sprintf("INSERT INTO %s (session, content, type) VALUES (?, ?, ?);", table)},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.Prepare(q.query)
+		if err != nil {
+			st.Close()
+			return nil, fmt.Errorf("prepare history query: %w", err)
+		}
+		*q.dst = stmt
+	}
+	return st, nil
+}
+
+// Close releases the prepared statements.
+func (st *historyStatements) Close() error {
+	var first error
+	for _, stmt := range []*sql.Stmt{st.listSessions, st.listSessionsByID, st.sessionMessages, st.insertMessage} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// migrateHistoryIndexes adds the (session, created) index that history reads
+// rely on to databases created without it.
+func migrateHistoryIndexes(db *sql.DB, table string) error {
+	index := "idx_" + table + "_session_created"
+	if _, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (session, created);", index, table)); err != nil {
+		return fmt.Errorf("create history index: %w", err)
+	}
+	return nil
+}
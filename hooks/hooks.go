@@ -0,0 +1,111 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/recommend"
+)
+
+// Event describes a final recommendation handed to hooks.
+type Event struct {
+	SessionID    string               `json:"sessionId"`
+	Query        string               `json:"query"`
+	QueryInfo    *recommend.QueryInfo `json:"queryInfo"`
+	API          apiparser.APIDoc     `json:"api"`
+	Payload      string               `json:"payload"`
+	EventPayload string               `json:"eventPayload,omitempty"`
+}
+
+// Hook is invoked after each final recommendation. Returned errors are logged
+// by the caller and never change the response sent to the user.
+type Hook interface {
+	AfterRecommendation(ctx context.Context, event Event) error
+}
+
+// Func adapts an ordinary function to the Hook interface.
+type Func func(ctx context.Context, event Event) error
+
+// AfterRecommendation calls f(ctx, event).
+func (f Func) AfterRecommendation(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+var (
+	mu         sync.RWMutex
+	registered = map[string]Hook{}
+)
+
+// Register makes a hook available under name. Deployments typically call it
+// from an init function in a file added to the main package, so custom
+// behaviour can be plugged in without editing the chat service.
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	if hook == nil {
+		panic("hooks: Register hook is nil")
+	}
+	if _, dup := registered[name]; dup {
+		panic("hooks: Register called twice for hook " + name)
+	}
+	registered[name] = hook
+}
+
+// Registered returns every registered hook keyed by name.
+func Registered() map[string]Hook {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make(map[string]Hook, len(registered))
+	for name, hook := range registered {
+		out[name] = hook
+	}
+	return out
+}
+
+// Webhook posts each event as JSON to URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook with a bounded request timeout.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// AfterRecommendation delivers event to the webhook URL.
+func (h *Webhook) AfterRecommendation(ctx context.Context, event Event) error {
+	return h.Post(ctx, event)
+}
+
+// Post delivers v as JSON to the webhook URL, for notices other than
+// recommendations sent to the same kind of endpoint.
+func (h *Webhook) Post(ctx context.Context, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode hook event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,764 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/assets"
+	"api-recommender/config"
+	"api-recommender/content"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+	"api-recommender/recommender"
+	"api-recommender/sandbox"
+)
+
+// The integration tests drive the whole server over HTTP: routes,
+// middleware, the chat service and a SQLite file, with the sandbox LLM
+// standing in for the model.
+
+const (
+	firstTurn  = "I want to issue a gold token, sync, UMI compliant, private"
+	secondTurn = "not async, fields: purity, quantity"
+)
+
+// testServer is a running server over one database file. restart swaps in
+// a fresh service over the same file, as a redeploy would.
+type testServer struct {
+	t      *testing.T
+	dbPath string
+	svc    *ChatService
+	http   *httptest.Server
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ts := &testServer{t: t, dbPath: filepath.Join(t.TempDir(), "chat.db")}
+	ts.start()
+	t.Cleanup(ts.stop)
+	return ts
+}
+
+func (ts *testServer) start() {
+	ts.t.Helper()
+	apis, err := sandbox.Catalog()
+	if err != nil {
+		ts.t.Fatalf("load sandbox catalog: %v", err)
+	}
+	cfg := config.Default()
+	cfg.Sandbox = true
+	ts.svc, err = NewChatService(apis, ts.dbPath, cfg)
+	if err != nil {
+		ts.t.Fatalf("start chat service: %v", err)
+	}
+	srv := &server{service: ts.svc, cfg: serverConfig{requireSessionTokens: true}}
+	ts.http = httptest.NewServer(srv.handler())
+}
+
+func (ts *testServer) stop() {
+	if ts.http != nil {
+		ts.http.Close()
+		ts.http = nil
+	}
+	if ts.svc != nil {
+		ts.svc.Close()
+		ts.svc = nil
+	}
+}
+
+func (ts *testServer) restart() {
+	ts.stop()
+	ts.start()
+}
+
+// do sends a request and decodes the JSON reply into out, failing the test
+// unless the status is want.
+func (ts *testServer) do(method, path string, header http.Header, body io.Reader, want int, out any) {
+	ts.t.Helper()
+	req, err := http.NewRequest(method, ts.http.URL+path, body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		ts.t.Fatalf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, want, raw)
+	}
+	if out == nil {
+		return
+	}
+	if s, ok := out.(*string); ok {
+		*s = string(raw)
+		return
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		ts.t.Fatalf("%s %s: decode %s: %v", method, path, raw, err)
+	}
+}
+
+// chat sends one user turn, continuing session when it is set.
+func (ts *testServer) chat(session, token, message string) ChatResult {
+	ts.t.Helper()
+	body, _ := json.Marshal(map[string]string{"sessionId": session, "message": message})
+	var res ChatResult
+	ts.do(http.MethodPost, "/api/v1/chat", sessionHeader(token), bytes.NewReader(body), http.StatusOK, &res)
+	return res
+}
+
+func (ts *testServer) history(session, token string) []StoredMessage {
+	ts.t.Helper()
+	var out struct {
+		Messages []StoredMessage `json:"messages"`
+	}
+	ts.do(http.MethodGet, "/api/v1/sessions/"+session+"/messages", sessionHeader(token), nil, http.StatusOK, &out)
+	return out.Messages
+}
+
+func sessionHeader(token string) http.Header {
+	if token == "" {
+		return nil
+	}
+	return http.Header{"X-Session-Token": {token}}
+}
+
+func TestFollowUpFlow(t *testing.T) {
+	ts := newTestServer(t)
+
+	first := ts.chat("", "", firstTurn)
+	if first.Intent != IntentFollowUp {
+		t.Fatalf("first turn intent = %q, want %q", first.Intent, IntentFollowUp)
+	}
+	if first.SessionID == "" || first.SessionToken == "" {
+		t.Fatalf("first turn did not open a session: %+v", first)
+	}
+	if len(first.Messages) != 1 || first.Messages[0].Kind != MessageKindQuestion {
+		t.Fatalf("first turn messages = %+v, want one question", first.Messages)
+	}
+	if first.QueryInfo == nil || first.QueryInfo.IsAsync != nil {
+		t.Fatalf("first turn query info = %+v, want async unknown", first.QueryInfo)
+	}
+
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Intent != IntentRecommendation {
+		t.Fatalf("second turn intent = %q, want %q: %s", second.Intent, IntentRecommendation, second.Message)
+	}
+	if second.SessionID != first.SessionID {
+		t.Fatalf("second turn session = %q, want %q", second.SessionID, first.SessionID)
+	}
+	rec := second.Recommendation
+	if rec == nil || rec.API.Name != "Issue" {
+		t.Fatalf("recommendation = %+v, want the Issue API", rec)
+	}
+	for _, field := range []string{"purity", "quantity"} {
+		if !strings.Contains(rec.Payload, `"`+field+`"`) {
+			t.Errorf("payload lacks requested field %s:\n%s", field, rec.Payload)
+		}
+	}
+
+	msgs := ts.history(first.SessionID, first.SessionToken)
+	roles := make([]string, len(msgs))
+	for i, m := range msgs {
+		roles[i] = m.Role
+	}
+	if got, want := strings.Join(roles, ","), "user,assistant,user,assistant,assistant"; got != want {
+		t.Fatalf("history roles = %s, want %s", got, want)
+	}
+	if msgs[0].Content != firstTurn || msgs[2].Content != secondTurn {
+		t.Errorf("history lost the user turns: %+v", msgs)
+	}
+}
+
+func TestGeneratedPayloadIsValid(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn)
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Recommendation == nil {
+		t.Fatalf("no recommendation: %s", second.Message)
+	}
+	if len(second.Artifacts) != 1 {
+		t.Fatalf("artifacts = %+v, want the payload", second.Artifacts)
+	}
+
+	var stored string
+	ts.do(http.MethodGet, second.Artifacts[0].URL, sessionHeader(first.SessionToken), nil, http.StatusOK, &stored)
+	if strings.TrimSpace(stored) != strings.TrimSpace(second.Recommendation.Payload) {
+		t.Fatalf("stored artifact differs from the payload shown:\n%s\n---\n%s", stored, second.Recommendation.Payload)
+	}
+	if !json.Valid([]byte(stored)) {
+		t.Fatalf("payload is not valid JSON:\n%s", stored)
+	}
+
+	var report validateResponse
+	ts.do(http.MethodPost, "/api/v1/validate", nil, strings.NewReader(stored), http.StatusOK, &report)
+	if !report.Valid {
+		t.Fatalf("payload fails validation: %+v", report.Report)
+	}
+}
+
+func TestKeyValuesStayWithTheirRequest(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn+", purity=24k, quantity=100")
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Recommendation == nil || !strings.Contains(second.Recommendation.Payload, "24k") {
+		t.Fatalf("payload lacks the values given: %+v", second.Recommendation)
+	}
+
+	// A new request in the same session, in XML and without values
+	ts.chat(first.SessionID, first.SessionToken, "I want to issue a silver token in XML, sync, UMI compliant, private")
+	fourth := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	rec := fourth.Recommendation
+	if rec == nil {
+		t.Fatalf("no recommendation: %s", fourth.Message)
+	}
+	if strings.Contains(rec.Payload, "24k") || len(rec.Mapping) > 0 {
+		t.Errorf("values of the earlier request carried over:\n%s", rec.Payload)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(rec.Payload), "<") {
+		t.Errorf("payload is not the XML asked for:\n%s", rec.Payload)
+	}
+}
+
+func TestWatermarkedPayloadRoundTrips(t *testing.T) {
+	ts := newTestServer(t)
+	ts.svc.cfg.Features.Flags = map[string]bool{config.FeatureWatermark: true}
+	first := ts.chat("", "", firstTurn)
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Recommendation == nil {
+		t.Fatalf("no recommendation: %s", second.Message)
+	}
+	marked := second.Recommendation.Payload
+	if !strings.Contains(marked, `"_meta"`) {
+		t.Fatalf("payload is not watermarked:\n%s", marked)
+	}
+
+	var report validateResponse
+	ts.do(http.MethodPost, "/api/v1/validate", nil, strings.NewReader(marked), http.StatusOK, &report)
+	if !report.Valid {
+		t.Fatalf("watermarked JSON fails validation: %+v", report.Report)
+	}
+	var toXML convertResponse
+	ts.do(http.MethodPost, "/api/v1/convert?to=xml", nil, strings.NewReader(marked), http.StatusOK, &toXML)
+
+	// The XML form, watermarked in turn, converts back and still validates
+	xmlMarked := ts.svc.generation(t.Context(), first.SessionID).embed(toXML.Payload)
+	ts.do(http.MethodPost, "/api/v1/validate", nil, strings.NewReader(xmlMarked), http.StatusOK, &report)
+	if !report.Valid {
+		t.Fatalf("watermarked XML fails validation: %+v", report.Report)
+	}
+	var back convertResponse
+	ts.do(http.MethodPost, "/api/v1/convert?to=json", nil, strings.NewReader(xmlMarked), http.StatusOK, &back)
+	if strings.Contains(back.Payload, "_meta") {
+		t.Fatalf("watermark carried into the converted payload:\n%s", back.Payload)
+	}
+}
+
+func TestGenerationRecordsPromptVersions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.svc.cfg.Features.Flags = map[string]bool{config.FeatureWatermark: true}
+	stable := json.RawMessage(`{"text":"Prefer ISO dates."}`)
+	item, err := ts.svc.content.Put(t.Context(), content.KindPrompts, "payload", stable, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every session is in the candidate arm
+	rollout := json.RawMessage(`{"text":"Prefer ISO dates.","candidate":{"text":"Use RFC 3339 dates.","share":100}}`)
+	if item, err = ts.svc.content.Put(t.Context(), content.KindPrompts, "payload", rollout, item.Version); err != nil {
+		t.Fatal(err)
+	}
+
+	first := ts.chat("", "", firstTurn)
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Recommendation == nil || len(second.Artifacts) == 0 {
+		t.Fatalf("no recommendation: %s", second.Message)
+	}
+	gen := second.Artifacts[0].Generation
+	want := []content.PromptVersion{{Prompt: "payload", Version: item.Version, Arm: content.ArmCandidate}}
+	if gen == nil || gen.ContentRevision != ts.svc.content.Revision() || !reflect.DeepEqual(gen.Prompts, want) {
+		t.Fatalf("generation = %+v, want revision %d and prompts %+v", gen, ts.svc.content.Revision(), want)
+	}
+	if !strings.Contains(second.Recommendation.Payload, `"arm":"candidate"`) {
+		t.Errorf("watermark lacks the rollout arm:\n%s", second.Recommendation.Payload)
+	}
+	comment := gen.comment()
+	if !strings.Contains(comment, "prompts=payload@2/candidate") || !strings.Contains(comment, fmt.Sprintf("content-revision=%d", gen.ContentRevision)) {
+		t.Errorf("watermark comment = %s", comment)
+	}
+}
+
+func TestSessionSurvivesRestart(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn)
+
+	// The pending question and session token are read back from the
+	// database, not from the previous service's memory
+	ts.restart()
+	second := ts.chat(first.SessionID, first.SessionToken, secondTurn)
+	if second.Intent != IntentRecommendation {
+		t.Fatalf("after restart intent = %q, want %q: %s", second.Intent, IntentRecommendation, second.Message)
+	}
+	if got := len(ts.history(first.SessionID, first.SessionToken)); got != 5 {
+		t.Fatalf("history has %d messages after restart, want 5", got)
+	}
+
+	var listed struct {
+		Sessions []SessionSummary `json:"sessions"`
+	}
+	// With session tokens required, only sessions whose token is presented
+	// are listed
+	owned := http.Header{"X-Session-Tokens": {first.SessionID + ":" + first.SessionToken}}
+	ts.do(http.MethodGet, "/api/v1/sessions", owned, nil, http.StatusOK, &listed)
+	if len(listed.Sessions) != 1 || listed.Sessions[0].ID != first.SessionID || listed.Sessions[0].MessageCount != 5 {
+		t.Fatalf("sessions = %+v, want the one session with 5 messages", listed.Sessions)
+	}
+}
+
+func TestSessionTokenRequired(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn)
+
+	body, _ := json.Marshal(map[string]string{"sessionId": first.SessionID, "message": secondTurn})
+	var envelope APIError
+	ts.do(http.MethodPost, "/api/v1/chat", sessionHeader("wrong"), bytes.NewReader(body), http.StatusForbidden, &envelope)
+	if envelope.Code != "forbidden" || envelope.RequestID == "" {
+		t.Fatalf("error envelope = %+v", envelope)
+	}
+	ts.do(http.MethodGet, "/api/v1/sessions/"+first.SessionID+"/messages", nil, nil, http.StatusForbidden, nil)
+}
+
+func TestSessionWithoutTokenRefused(t *testing.T) {
+	ts := newTestServer(t)
+	// A session from before tokens were required: messages, no token
+	if err := ts.svc.saveTurn(t.Context(), "legacy", firstTurn, []TurnMessage{{Kind: MessageKindAnswer, Content: "ok"}}); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]string{"sessionId": "legacy", "message": secondTurn})
+	ts.do(http.MethodPost, "/api/v1/chat", nil, bytes.NewReader(body), http.StatusForbidden, nil)
+	ts.do(http.MethodGet, "/api/v1/sessions/legacy/messages", nil, nil, http.StatusForbidden, nil)
+
+	tokens, err := ts.svc.IssueMissingSessionTokens(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := ts.history("legacy", tokens["legacy"]); len(msgs) != 2 {
+		t.Fatalf("history = %d messages, want 2", len(msgs))
+	}
+}
+
+func TestFailedFirstTurnReleasesSession(t *testing.T) {
+	ts := newTestServer(t)
+	fail := fmt.Sprintf("CREATE TRIGGER fail_save BEFORE INSERT ON %s BEGIN SELECT RAISE(ABORT, 'disk full'); END;", ts.svc.table)
+	if _, err := ts.svc.db.Exec(fail); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]string{"sessionId": "chosen", "message": firstTurn})
+	var envelope APIError
+	ts.do(http.MethodPost, "/api/v1/chat", nil, bytes.NewReader(body), http.StatusInternalServerError, &envelope)
+	// The cause is logged, not sent
+	if strings.Contains(envelope.Message, "disk full") || envelope.RequestID == "" {
+		t.Fatalf("error envelope = %+v", envelope)
+	}
+
+	if _, err := ts.svc.db.Exec("DROP TRIGGER fail_save;"); err != nil {
+		t.Fatal(err)
+	}
+	if res := ts.chat("chosen", "", firstTurn); res.SessionToken == "" {
+		t.Fatal("retried first turn got no session token")
+	}
+}
+
+// restrictTenant limits the tenant pinned to key to the first API of the
+// sandbox catalog and returns the name of another, hidden from it.
+func (ts *testServer) restrictTenant(key string) (hidden string) {
+	ts.t.Helper()
+	apis := ts.svc.APIs()
+	if len(apis) < 2 {
+		ts.t.Fatalf("sandbox catalog has %d APIs", len(apis))
+	}
+	ts.svc.cfg.Access.Tenants = map[string][]string{"restricted": {apis[0].Name}}
+	ts.svc.cfg.Access.APIKeys = map[string]string{key: "restricted"}
+	return apis[1].Name
+}
+
+func TestExplainKeepsToTenantCatalog(t *testing.T) {
+	ts := newTestServer(t)
+	hidden := ts.restrictTenant("k-restricted")
+	header := http.Header{"X-API-Key": {"k-restricted"}}
+
+	var envelope APIError
+	ts.do(http.MethodPost, "/api/v1/explain?api="+url.QueryEscape(hidden), header, strings.NewReader("{}"), http.StatusBadRequest, &envelope)
+	if envelope.Code != CodeInvalidInput {
+		t.Fatalf("error envelope = %+v", envelope)
+	}
+	// Another caller still sees the API
+	ts.svc.cfg.Access.Tenants["partner"] = []string{"*"}
+	ts.svc.cfg.Access.APIKeys["k-partner"] = "partner"
+	ts.do(http.MethodPost, "/api/v1/explain?api="+url.QueryEscape(hidden), http.Header{"X-API-Key": {"k-partner"}}, strings.NewReader("{}"), http.StatusOK, nil)
+}
+
+// With catalogs scoped per tenant, the tenant must come from a pinned key,
+// and a tenant that isn't listed sees nothing.
+func TestScopedCatalogFailsClosed(t *testing.T) {
+	ts := newTestServer(t)
+	ts.restrictTenant("k-restricted")
+	first := ts.svc.APIs()[0].Name
+
+	claimed := http.Header{"X-Tenant-ID": {"restricted"}}
+	ts.do(http.MethodGet, "/api/v1/features", claimed, nil, http.StatusForbidden, nil)
+	ts.do(http.MethodPost, "/api/v1/explain", claimed, strings.NewReader("{}"), http.StatusForbidden, nil)
+	body, _ := json.Marshal(map[string]string{"message": firstTurn})
+	ts.do(http.MethodPost, "/api/v1/chat", claimed, bytes.NewReader(body), http.StatusForbidden, nil)
+
+	ts.svc.cfg.Access.APIKeys["k-unlisted"] = "unlisted"
+	ts.do(http.MethodPost, "/api/v1/explain?api="+url.QueryEscape(first), http.Header{"X-API-Key": {"k-unlisted"}}, strings.NewReader("{}"), http.StatusBadRequest, nil)
+}
+
+func TestConvertKeepsToTenantCatalog(t *testing.T) {
+	ts := newTestServer(t)
+	hidden := ts.restrictTenant("k-restricted")
+	header := http.Header{"X-API-Key": {"k-restricted"}}
+
+	var envelope APIError
+	ts.do(http.MethodPost, "/api/v1/convert?api="+url.QueryEscape(hidden), header, strings.NewReader("{}"), http.StatusBadRequest, &envelope)
+	if envelope.Code != CodeInvalidInput {
+		t.Fatalf("error envelope = %+v", envelope)
+	}
+}
+
+func TestLegacyMessagesOfUnknownSession(t *testing.T) {
+	ts := newTestServer(t)
+	// Without session tokens, as legacy clients ran
+	h := (&server{service: ts.svc}).handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/api/v1/sessions/unknown/messages"); rec.Code != http.StatusNotFound {
+		t.Fatalf("v1: status %d, want 404", rec.Code)
+	}
+	rec := get("/api/sessions/unknown/messages")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("legacy: status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var out struct {
+		Messages []StoredMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Messages == nil || len(out.Messages) != 0 {
+		t.Fatalf("legacy body = %s, want an empty message list", rec.Body)
+	}
+}
+
+func TestAssetOwnerComesFromPinnedKey(t *testing.T) {
+	ts := newTestServer(t)
+	ts.svc.cfg.Access.APIKeys = map[string]string{"k-acme": "acme"}
+	ts.svc.cfg.Assets.Owners = map[string]string{"acme": "org-acme", "other": "org-other"}
+	srv := &server{service: ts.svc}
+
+	owner := func(header http.Header) string {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		ctx, err := srv.chatContext(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return assets.OwnerFrom(ctx)
+	}
+	if got := owner(http.Header{"X-Api-Key": {"k-acme"}, "X-Asset-Owner": {"org-other"}}); got != "org-acme" {
+		t.Fatalf("owner with a pinned key = %q, want org-acme", got)
+	}
+	if got := owner(http.Header{"X-Asset-Owner": {"org-other"}, "X-Tenant-Id": {"other"}}); got != "" {
+		t.Fatalf("owner without a pinned key = %q, want none", got)
+	}
+}
+
+func TestDatasetExportIsAnonymized(t *testing.T) {
+	ts := newTestServer(t)
+	info := &recommend.QueryInfo{
+		FieldNames: []string{"vendor"},
+		Operation:  "burn",
+		AssetID:    "GOLD-BAR-7731",
+		Correction: "the owner is ravi.k@okaxis, not the one you used",
+		KeyValues: []payload.Pair{
+			{Name: "vendor", Value: "0x9f8e7d6c5b4a39281706"},
+			{Name: "account", Value: "123456789012"},
+		},
+	}
+	if _, err := ts.svc.recordRecommendation(t.Context(), "s1", "burn GOLD-BAR-7731", info, apiparser.APIDoc{Name: "Manage", Path: "/v1/ReqManage"}, "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ts.svc.ExportDataset(t.Context(), &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"GOLD-BAR-7731", "ravi.k@okaxis", "0x9f8e7d6c5b4a39281706", "123456789012"} {
+		if strings.Contains(out.String(), leak) {
+			t.Errorf("dataset export contains %q:\n%s", leak, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), `"name":"vendor"`) {
+		t.Errorf("dataset export lost the key=value names:\n%s", out.String())
+	}
+}
+
+func TestTicketGoesToCallersTracker(t *testing.T) {
+	trackers := map[string]*int{}
+	tracker := func(name string) string {
+		n := new(int)
+		trackers[name] = n
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*n++
+			fmt.Fprintf(w, `{"key":"%s-%d"}`, strings.ToUpper(name), *n)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+
+	ts := newTestServer(t)
+	ts.svc.cfg.Tickets = config.Tickets{
+		Default: config.TicketConnector{Kind: config.TicketsJira, URL: tracker("default"), Project: "DEF"},
+		Tenants: map[string]config.TicketConnector{
+			"acme":   {Kind: config.TicketsJira, URL: tracker("acme"), Project: "ACME"},
+			"globex": {Kind: config.TicketsJira, URL: tracker("globex"), Project: "GLX"},
+		},
+		TimeoutMillis: 5000,
+	}
+	ts.svc.cfg.Access.APIKeys = map[string]string{"k-acme": "acme", "k-globex": "globex"}
+
+	first := ts.chat("", "", firstTurn)
+	if second := ts.chat(first.SessionID, first.SessionToken, secondTurn); second.Recommendation == nil {
+		t.Fatalf("no recommendation: %s", second.Message)
+	}
+	for _, tenant := range []string{"acme", "globex"} {
+		header := sessionHeader(first.SessionToken)
+		header.Set("X-API-Key", "k-"+tenant)
+		var out struct {
+			Ticket struct{ Key string } `json:"ticket"`
+		}
+		ts.do(http.MethodPost, "/api/v1/sessions/"+first.SessionID+"/ticket", header, nil, http.StatusCreated, &out)
+		if want := strings.ToUpper(tenant) + "-1"; out.Ticket.Key != want {
+			t.Errorf("%s ticket = %q, want %q", tenant, out.Ticket.Key, want)
+		}
+	}
+	for name, n := range trackers {
+		want := 1
+		if name == "default" {
+			want = 0
+		}
+		if *n != want {
+			t.Errorf("tracker %s got %d tickets, want %d", name, *n, want)
+		}
+	}
+}
+
+func TestEnginesKeepTheirOwnSettings(t *testing.T) {
+	apis, err := sandbox.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := func() time.Time { return time.Date(2026, time.March, 4, 5, 6, 7, 0, time.UTC) }
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := config.Default().Persona
+	acme.ProductName, acme.ProductFullName = "ACME", "Acme Ledger"
+	// Under this checklist fd requests need only their fields
+	questions := config.Default().Questions
+	questions.Usecases = map[string][]string{"fd": {config.QuestionFields}}
+
+	engines := []struct {
+		engine    *recommender.Engine
+		persona   config.Persona
+		timestamp string
+		// short is the intent of a request naming only its fields
+		short string
+	}{
+		{
+			engine: recommender.New(sandbox.NewLLM(), apis,
+				recommender.WithPersona(acme),
+				recommender.WithQuestions(questions),
+				recommender.WithClock(payload.NewClock(now, kolkata, "2006-01-02 15:04:05"))),
+			persona:   acme,
+			timestamp: "2026-03-04 10:36:07",
+			short:     IntentRecommendation,
+		},
+		{
+			engine:    recommender.New(sandbox.NewLLM(), apis, recommender.WithClock(payload.NewClock(now, time.UTC, time.RFC3339))),
+			persona:   config.Default().Persona,
+			timestamp: "2026-03-04T05:06:07Z",
+			short:     IntentFollowUp,
+		},
+	}
+	ctx := context.Background()
+	for _, e := range engines {
+		name := e.persona.ProductName
+		res, err := e.engine.Respond(ctx, "what can you do?", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intro := e.persona.Render(e.persona.Intro); !strings.HasPrefix(res.Reply, intro) {
+			t.Errorf("%s engine: capabilities %q, want them to start with %q", name, res.Reply, intro)
+		}
+
+		res, err = e.engine.Respond(ctx, "create fd sync umi=yes public fields=principal principal=1000", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Recommendation == nil || !strings.Contains(res.Recommendation.Payload, e.timestamp) {
+			t.Errorf("%s engine: intent %s, reply %q, want a payload timestamped %s", name, res.Intent, res.Reply, e.timestamp)
+		}
+
+		res, err = e.engine.Respond(ctx, "create fd fields=principal principal=1000", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Intent != e.short {
+			t.Errorf("%s engine: request without context flags is %s, want %s: %q", name, res.Intent, e.short, res.Reply)
+		}
+	}
+}
+
+func TestFirstTurnOfSessionClaimedMeanwhileIsRefused(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	const session = "raced-session"
+	// Another first turn claims the id after this one found it claimable
+	claimable, err := ts.svc.sessionClaimable(ctx, session)
+	if err != nil || !claimable {
+		t.Fatalf("claimable = %v, %v", claimable, err)
+	}
+	winner, err := ts.svc.issueSessionToken(ctx, session)
+	if err != nil || winner == "" {
+		t.Fatalf("claim session: %q, %v", winner, err)
+	}
+
+	if res, err := ts.svc.Chat(ctx, session, firstTurn); !errors.Is(err, ErrSessionForbidden) {
+		t.Fatalf("Chat = %+v, %v; want %v", res, err, ErrSessionForbidden)
+	}
+	// The session stays the winner's, with nothing of the refused turn
+	if err := ts.svc.VerifySessionToken(ctx, session, winner); err != nil {
+		t.Fatalf("winner's token: %v", err)
+	}
+	var n int
+	if err := ts.svc.db.QueryRow("SELECT COUNT(*) FROM "+ts.svc.table+" WHERE session = ?;", session).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d messages saved (%v), want none", n, err)
+	}
+}
+
+func TestImportTranscriptRepliesWithJSON(t *testing.T) {
+	ts := newTestServer(t)
+	h := (&server{service: ts.svc, cfg: serverConfig{adminToken: "admin-secret"}}).handler()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/sessions/import-transcript?session=imported",
+		strings.NewReader("Human: what is isAsync?\nAI: It picks the async flow.\n"))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201: %s", rec.Code, rec.Body)
+	}
+	// Result has the headers as sent, not as set after the status
+	if got := rec.Result().Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var res TranscriptResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.SessionID != "imported" || res.MessagesImported != 2 {
+		t.Errorf("body = %s (%v)", rec.Body, err)
+	}
+}
+
+func TestEmailBodyIsLimited(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn)
+
+	body := `{"to": "ops@example.com", "note": "` + strings.Repeat("x", maxRequestBodyBytes) + `"}`
+	var envelope struct {
+		Code    string       `json:"code"`
+		Details []FieldError `json:"details"`
+	}
+	ts.do(http.MethodPost, "/api/v1/sessions/"+first.SessionID+"/email", sessionHeader(first.SessionToken), strings.NewReader(body), http.StatusBadRequest, &envelope)
+	if envelope.Code != CodeInvalidInput || len(envelope.Details) != 1 || envelope.Details[0].Field != "body" {
+		t.Errorf("error envelope = %+v, want the body rejected as too large", envelope)
+	}
+}
+
+func TestUnavailableServicesGetFixedMessages(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.chat("", "", firstTurn)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, tc := range []struct {
+		path, body, message, detail string
+	}{
+		{"/email", `{"to": "ops@example.com"}`, "email unavailable", "email is not configured"},
+		{"/ticket", "", "tickets unavailable", "no issue tracker is configured"},
+	} {
+		var envelope APIError
+		ts.do(http.MethodPost, "/api/v1/sessions/"+first.SessionID+tc.path, sessionHeader(first.SessionToken), strings.NewReader(tc.body), http.StatusServiceUnavailable, &envelope)
+		if envelope.Message != tc.message {
+			t.Errorf("%s: message %q, want %q", tc.path, envelope.Message, tc.message)
+		}
+		// The detail is logged under the request id instead
+		if !strings.Contains(logs.String(), "request "+envelope.RequestID+"): ") || !strings.Contains(logs.String(), tc.detail) {
+			t.Errorf("%s: log %q lacks request %s and %q", tc.path, logs.String(), envelope.RequestID, tc.detail)
+		}
+	}
+}
+
+func TestClusterModeWaitsForLocks(t *testing.T) {
+	t.Setenv("ANONYMIZE_KEY", "test-key")
+	apis, err := sandbox.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Sandbox = true
+	cfg.Cluster.Enabled = true
+	svc, err := NewChatService(apis, filepath.Join(t.TempDir(), "chat.db"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+
+	// Every pooled connection waits, not just the one a PRAGMA ran on
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := svc.db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		var ms int64
+		if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout;").Scan(&ms); err != nil || ms != clusterBusyTimeout.Milliseconds() {
+			t.Errorf("connection %d: busy_timeout = %d (%v), want %d", i, ms, err, clusterBusyTimeout.Milliseconds())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// job_leases elect the replica that runs a background job. A replica holds
+// a job's lease until it expires; it renews the lease each time it runs the
+// job, and another replica can take it over once it has expired.
+const jobLeasesSchema = `
+CREATE TABLE IF NOT EXISTS job_leases (
+	job TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	expires INTEGER NOT NULL
+);`
+
+// Background jobs that only one replica runs.
+const jobSweep = "sweep"
+
+func ensureJobLeasesSchema(db *sql.DB) error {
+	if _, err := db.Exec(jobLeasesSchema); err != nil {
+		return fmt.Errorf("create job leases schema: %w", err)
+	}
+	return nil
+}
+
+// instanceID names this replica in job leases.
+func instanceID(id string) string {
+	if id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// acquireLease takes or renews the lease on job for ttl and reports whether
+// this replica now holds it. The lease is only taken from another replica
+// once it has expired.
+func (s *ChatService) acquireLease(ctx context.Context, job string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO job_leases (job, holder, expires) VALUES (?, ?, ?)
+		ON CONFLICT (job) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE job_leases.holder = excluded.holder OR job_leases.expires <= ?;`,
+		job, s.instance, now.Add(ttl).Unix(), now.Unix())
+	if err != nil {
+		return false, fmt.Errorf("acquire %s lease: %w", job, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquire %s lease: %w", job, err)
+	}
+	return n > 0, nil
+}
+
+// releaseLease gives up the lease on job if this replica holds it, so
+// another replica can take the job over without waiting for it to expire.
+func (s *ChatService) releaseLease(ctx context.Context, job string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM job_leases WHERE job = ? AND holder = ?;", job, s.instance); err != nil {
+		return fmt.Errorf("release %s lease: %w", job, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package llmprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// maxClientKeys bounds how many per-key clients are kept; the one used
+// least recently is dropped first.
+const maxClientKeys = 256
+
+// ClientKey is an LLM API key a client sent with its request, so the
+// calls made for the request are billed to it, and optionally the model
+// to call with it. The key never appears in its printed form.
+type ClientKey struct {
+	Token string
+	// Model is empty for the deployment's model.
+	Model string
+}
+
+// String prints the key without its token, so it is safe to log.
+func (k ClientKey) String() string {
+	model := k.Model
+	if model == "" {
+		model = "default"
+	}
+	return "client key (model " + model + ")"
+}
+
+// GoString is String, so %#v doesn't print the token either.
+func (k ClientKey) GoString() string { return k.String() }
+
+type clientKeyKey struct{}
+
+// WithClientKey makes the calls a PerRequestLLM makes with ctx use key.
+func WithClientKey(ctx context.Context, key ClientKey) context.Context {
+	return context.WithValue(ctx, clientKeyKey{}, key)
+}
+
+// ClientKeyFrom returns the client key set on ctx, if any.
+func ClientKeyFrom(ctx context.Context) (ClientKey, bool) {
+	key, ok := ctx.Value(clientKeyKey{}).(ClientKey)
+	return key, ok && key.Token != ""
+}
+
+// ModelFor returns the model the calls a PerRequestLLM makes with ctx
+// use: the client key's, or else the deployment's.
+func ModelFor(ctx context.Context) string {
+	if key, ok := ClientKeyFrom(ctx); ok && key.Model != "" {
+		return key.Model
+	}
+	return modelName()
+}
+
+// PerRequestLLM is an llms.Model that makes each call with the client key
+// on its context, on the deployment's endpoint (LLM_BASE_URL), or with the
+// deployment's model when there is none. Clients are built once per key
+// and model and kept by their hash, never by the key itself. It is safe
+// for concurrent use.
+type PerRequestLLM struct {
+	fallback llms.Model
+
+	mu      sync.Mutex
+	clients map[[sha256.Size]byte]*keyedClient
+}
+
+type keyedClient struct {
+	llm      llms.Model
+	lastUsed time.Time
+}
+
+// NewPerRequestLLM returns a model that calls fallback unless a call's
+// context carries a client key.
+func NewPerRequestLLM(fallback llms.Model) *PerRequestLLM {
+	return &PerRequestLLM{fallback: fallback, clients: map[[sha256.Size]byte]*keyedClient{}}
+}
+
+// GenerateContent implements llms.Model.
+func (m *PerRequestLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	llm, err := m.model(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := llm.GenerateContent(ctx, messages, options...)
+	if key, ok := ClientKeyFrom(ctx); ok && err != nil {
+		// Providers quote bad keys back in their errors
+		err = &redactedError{err: err, token: key.Token}
+	}
+	return resp, err
+}
+
+// Call implements llms.Model.
+func (m *PerRequestLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// model returns the client for the key on ctx, building it on first use.
+func (m *PerRequestLLM) model(ctx context.Context) (llms.Model, error) {
+	key, ok := ClientKeyFrom(ctx)
+	if !ok {
+		return m.fallback, nil
+	}
+	model := ModelFor(ctx)
+	hash := sha256.Sum256([]byte(key.Token + "\x00" + model))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.clients[hash]; ok {
+		c.lastUsed = time.Now()
+		return c.llm, nil
+	}
+	llm, err := openai.New(
+		openai.WithToken(key.Token),
+		openai.WithBaseURL(baseURL()),
+		openai.WithModel(model),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.clients) >= maxClientKeys {
+		m.evictOldest()
+	}
+	m.clients[hash] = &keyedClient{llm: llm, lastUsed: time.Now()}
+	return llm, nil
+}
+
+// redactedError hides a client key in the message of the error it wraps.
+type redactedError struct {
+	err   error
+	token string
+}
+
+func (e *redactedError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.token, "[redacted]")
+}
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+func (m *PerRequestLLM) evictOldest() {
+	var oldest [sha256.Size]byte
+	var oldestAt time.Time
+	for hash, c := range m.clients {
+		if oldestAt.IsZero() || c.lastUsed.Before(oldestAt) {
+			oldest, oldestAt = hash, c.lastUsed
+		}
+	}
+	delete(m.clients, oldest)
+}
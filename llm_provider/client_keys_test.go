@@ -0,0 +1,58 @@
+package llmprovider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// authServer answers chat and embedding calls like an OpenAI-compatible
+// endpoint and records the bearer token of each, by path.
+func authServer(t *testing.T) (*httptest.Server, map[string]string) {
+	var mu sync.Mutex
+	tokens := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens[r.URL.Path] = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}]}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, tokens
+}
+
+func TestClientKeyNotUsedForEmbeddings(t *testing.T) {
+	srv, tokens := authServer(t)
+	t.Setenv("LLM_BASE_URL", srv.URL)
+	t.Setenv("LLM_API_TOKEN", "deployment-key")
+
+	ctx := WithClientKey(t.Context(), ClientKey{Token: "client-key"})
+	fallback, err := NewGroqLLM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPerRequestLLM(fallback).Call(ctx, "hello"); err != nil {
+		t.Fatalf("chat call: %v", err)
+	}
+	embedder, err := NewEmbedder("embed-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := embedder.CreateEmbedding(ctx, []string{"issue a gold token"}); err != nil {
+		t.Fatalf("embedding call: %v", err)
+	}
+
+	if got := tokens["/chat/completions"]; got != "client-key" {
+		t.Errorf("chat call made with %q, want the client key", got)
+	}
+	if got := tokens["/embeddings"]; got != "deployment-key" {
+		t.Errorf("embedding call made with %q, want the deployment key", got)
+	}
+}
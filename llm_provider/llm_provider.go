@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/tmc/langchaingo/embeddings"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 )
@@ -25,19 +26,44 @@ func NewGroqLLM() (llms.Model, error) {
 		return nil, fmt.Errorf("missing LLM_API_TOKEN environment variable")
 	}
 
-	baseURL := strings.TrimSpace(os.Getenv("LLM_BASE_URL"))
-	if baseURL == "" {
-		baseURL = defaultBaseURL
+	return openai.New(
+		openai.WithToken(token),
+		openai.WithBaseURL(baseURL()),
+		openai.WithModel(modelName()),
+	)
+}
+
+// baseURL is the endpoint set by LLM_BASE_URL, or the default one.
+func baseURL() string {
+	if url := strings.TrimSpace(os.Getenv("LLM_BASE_URL")); url != "" {
+		return url
+	}
+	return defaultBaseURL
+}
+
+// modelName is the model set by LLM_MODEL, or the default one.
+func modelName() string {
+	if model := strings.TrimSpace(os.Getenv("LLM_MODEL")); model != "" {
+		return model
 	}
+	return defaultModel
+}
 
-	model := strings.TrimSpace(os.Getenv("LLM_MODEL"))
-	if model == "" {
-		model = defaultModel
+// NewEmbedder constructs an embedding client for model on the same
+// OpenAI-compatible endpoint as NewGroqLLM, configured by the same
+// environment variables. It always uses the deployment's key, also for
+// requests that carry a client key: the scorer shares the embeddings of
+// API descriptions between requests, and a client's key may have no
+// access to the embedding model.
+func NewEmbedder(model string) (embeddings.EmbedderClient, error) {
+	token := strings.TrimSpace(os.Getenv("LLM_API_TOKEN"))
+	if token == "" {
+		return nil, fmt.Errorf("missing LLM_API_TOKEN environment variable")
 	}
 
 	return openai.New(
 		openai.WithToken(token),
-		openai.WithBaseURL(baseURL),
-		openai.WithModel(model),
+		openai.WithBaseURL(baseURL()),
+		openai.WithEmbeddingModel(model),
 	)
 }
@@ -3,16 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	apiparser "api-recommender/api-parser"
+	"api-recommender/config"
+	"api-recommender/hooks"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+	"api-recommender/requestmodel"
+	"api-recommender/sandbox"
+	"api-recommender/tools"
 )
 
 func main() {
@@ -23,25 +29,127 @@ func main() {
 	var mode string
 	var addr string
 	var staticDir string
-	flag.StringVar(&docPath, "docs", "api-docs/apis.md", "Path to API docs")
+	var adminToken string
+	var archivePath string
+	var hookURL string
+	var apiKeys string
+	var rateLimitPerMinute int
+	var trustedProxies string
+	var requireSessionTokens bool
+	var configPath string
+	var sandboxMode bool
+	var verbosity string
+	var valueProfile string
+	var docsCache string
+	var smartDefaults bool
+	var preflight bool
+	var validateDocs bool
+	var modelFields bool
+	var resumeLast bool
+	var pidFile string
+	var logPath string
+	var logMaxMB int
+	flag.StringVar(&docPath, "docs", "api-docs/apis.md", "Path to API docs, a directory of them, or an http(s) URL to download them from")
+	flag.StringVar(&docsCache, "docs-cache", "", "Directory caching docs downloaded from a URL (the user cache directory when empty)")
 	flag.StringVar(&initialQuery, "q", "", "Initial user request/prompt")
 	flag.StringVar(&dbPath, "db", "chat_memory.db", "Path to SQLite database for chat history")
 	flag.StringVar(&sessionID, "session", "", "Conversation session ID (optional, auto-generated if empty)")
-	flag.StringVar(&mode, "mode", "cli", "Mode to run: cli or server")
+	flag.BoolVar(&resumeLast, "last", false, "In the CLI, resume the most recently active session")
+	flag.StringVar(&mode, "mode", "cli", "Mode to run: cli, server, export, import, import-transcript, dataset or issue-tokens")
 	flag.StringVar(&addr, "addr", ":8080", "Server listen address (only for server mode)")
 	flag.StringVar(&staticDir, "static", "frontend/dist", "Directory containing frontend static assets")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token required for /api/admin endpoints (disabled when empty)")
+	flag.StringVar(&archivePath, "archive", "", "Archive file for export/import/import-transcript/dataset modes (stdout/stdin when empty)")
+	flag.StringVar(&hookURL, "hook-url", os.Getenv("RECOMMENDATION_HOOK_URL"), "URL that receives a JSON POST after every final recommendation (optional)")
+	flag.StringVar(&apiKeys, "api-keys", os.Getenv("API_KEYS"), "Comma-separated API keys required for /api endpoints (open when empty)")
+	flag.IntVar(&rateLimitPerMinute, "rate-limit", 0, "Requests per minute allowed per client in server mode (0 disables)")
+	flag.StringVar(&trustedProxies, "trusted-proxies", os.Getenv("TRUSTED_PROXIES"), "Comma-separated addresses or CIDR networks of reverse proxies whose X-Forwarded-For header identifies the client for -rate-limit (none when empty)")
+	flag.BoolVar(&requireSessionTokens, "require-session-tokens", false, "Require the per-session token (X-Session-Token) for reading or continuing a session")
+	flag.StringVar(&configPath, "config", os.Getenv("APP_CONFIG"), "Path to a JSON config file with persona and branding overrides (optional)")
+	flag.BoolVar(&sandboxMode, "sandbox", false, "Try the product with an embedded demo catalog and a stub LLM; no API key or docs needed")
+	flag.StringVar(&verbosity, "verbosity", "", "Reply verbosity for the CLI session: concise, normal or detailed (keeps the session's setting when empty)")
+	flag.BoolVar(&validateDocs, "validate", false, "Check the -docs strictly, print every problem as file:line: reason and exit (1 when there are problems); for CI")
+	flag.BoolVar(&modelFields, "model-fields", false, "Print the request model's fields as a **Fields:** block for Markdown API docs and exit")
+	flag.BoolVar(&preflight, "preflight", false, "In server mode, check the LLM with a tiny round trip and a JSON answer before serving; on failure the server starts degraded and GET /readyz says why")
+	flag.BoolVar(&smartDefaults, "smart-defaults", false, "Default the context questions a reply leaves unanswered (sync, UMI compliant, public) in the CLI session instead of asking again")
+	flag.StringVar(&pidFile, "pid-file", "", "In server mode, write the process id to this file while running, for systemd's PIDFile= or log rotation scripts")
+	flag.StringVar(&logPath, "log-file", "", "Append the log to this file instead of stderr; it is reopened on SIGHUP, as logrotate expects")
+	flag.IntVar(&logMaxMB, "log-max-mb", 0, "Rotate the -log-file once it reaches this many MB, keeping 3 old files (0 leaves rotation to logrotate)")
+	flag.StringVar(&valueProfile, "value-profile", "", "Dummy values for sample payloads in the CLI session: "+strings.Join(payload.Profiles(), ", ")+" (the config's valueProfile when empty)")
 	flag.Parse()
+	// "api-recommender chat --session <id>", as printed when a CLI session
+	// ends, is the CLI mode with its flags after the word
+	if flag.Arg(0) == "chat" {
+		mode = "cli"
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if logPath != "" {
+		logFile, err := setupLogFile(logPath, logMaxMB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+	}
+	if validateDocs {
+		os.Exit(runValidate(docPath))
+	}
+	// "api-recommender diff-docs old.md new.md" reviews a docs update
+	if flag.Arg(0) == "diff-docs" {
+		if flag.NArg() != 3 {
+			fmt.Fprintln(os.Stderr, "usage: "+filepath.Base(os.Args[0])+" diff-docs <old docs> <new docs>")
+			os.Exit(2)
+		}
+		os.Exit(runDiffDocs(flag.Arg(1), flag.Arg(2)))
+	}
+	if modelFields {
+		fmt.Print(apiparser.MarkdownFields(apiparser.FieldsOf(requestmodel.Request{})))
+		return
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if !payload.ValidProfile(cfg.ValueProfile) {
+		log.Fatalf("Failed to load config: unknown valueProfile %q; use %s", cfg.ValueProfile, strings.Join(payload.Profiles(), ", "))
+	}
+	if sandboxMode {
+		cfg.Sandbox = true
+	}
 
-	apis, err := apiparser.ParseAPIDocs(docPath)
+	var apis []apiparser.APIDoc
+	if cfg.Sandbox {
+		log.Printf("Sandbox mode: using the embedded demo catalog and a stub LLM")
+		apis, err = sandbox.Catalog()
+		if !flagSet("db") {
+			dbPath = "file:sandbox?mode=memory&cache=shared"
+		}
+	} else {
+		apis, err = loadDocs(docPath, docsCache)
+	}
 	if err != nil {
 		log.Fatalf("Failed to parse API docs: %v", err)
 	}
 
-	service, err := NewChatService(apis, dbPath)
+	service, err := NewChatService(apis, dbPath, cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize chat service: %v", err)
 	}
 
+	for name, h := range hooks.Registered() {
+		log.Printf("Registering recommendation hook %q", name)
+		service.AddHook(h)
+	}
+	if hookURL != "" {
+		service.AddHook(hooks.NewWebhook(hookURL))
+	}
+	for _, t := range tools.Registered() {
+		log.Printf("Registering assistant tool %q", t.Definition().Name)
+		service.AddTool(t)
+	}
+
 	ctx := context.Background()
 	defer func() {
 		if err := service.Close(); err != nil {
@@ -51,15 +159,102 @@ func main() {
 
 	switch strings.ToLower(mode) {
 	case "server":
-		runServer(ctx, service, addr, staticDir)
+		if !cfg.Sandbox && !apiparser.IsURL(docPath) {
+			stop, err := watchDocs(service, docPath)
+			if err != nil {
+				log.Fatalf("Failed to watch API docs: %v", err)
+			}
+			defer stop()
+		}
+		if pidFile != "" {
+			removePID, err := writePIDFile(pidFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer removePID()
+		}
+		if preflight {
+			runPreflight(ctx, service)
+		}
+		proxies, err := parseTrustedProxies(splitList(trustedProxies))
+		if err != nil {
+			log.Fatalf("Invalid -trusted-proxies: %v", err)
+		}
+		serve := func(ctx context.Context) {
+			runServer(ctx, service, serverConfig{
+				addr:       addr,
+				staticDir:  staticDir,
+				adminToken: adminToken,
+				apiKeys:    splitList(apiKeys),
+				rateLimit:  rateLimitPerMinute,
+
+				trustedProxies:       proxies,
+				requireSessionTokens: requireSessionTokens,
+			})
+		}
+		if !runAsService(ctx, serve) {
+			serve(ctx)
+		}
+	case "export":
+		runExport(ctx, service, archivePath)
+	case "import":
+		runImport(ctx, service, archivePath)
+	case "import-transcript":
+		runImportTranscript(ctx, service, archivePath, sessionID)
+	case "dataset":
+		runDatasetExport(ctx, service, archivePath)
+	case "issue-tokens":
+		runIssueTokens(ctx, service)
 	default:
-		runCLI(ctx, service, sessionID, initialQuery)
+		if verbosity != "" {
+			v, ok := recommend.ParseVerbosity(verbosity)
+			if !ok {
+				log.Fatalf("Unknown verbosity %q; use concise, normal or detailed", verbosity)
+			}
+			ctx = recommend.WithVerbosity(ctx, v)
+		}
+		if valueProfile != "" {
+			if !payload.ValidProfile(valueProfile) {
+				log.Fatalf("Unknown value profile %q; use %s", valueProfile, strings.Join(payload.Profiles(), ", "))
+			}
+			ctx = recommend.WithValueProfile(ctx, valueProfile)
+		}
+		if flagSet("smart-defaults") {
+			ctx = recommend.WithSmartDefaults(ctx, smartDefaults)
+		}
+		if resumeLast {
+			if sessionID != "" {
+				log.Fatalf("Use either -session or -last, not both")
+			}
+			last, err := service.LatestSession(ctx)
+			if err != nil {
+				log.Fatalf("Failed to find the last session: %v", err)
+			}
+			sessionID = last.ID
+			fmt.Printf("Resuming session %s (%d messages, last at %s)\n", last.ID, last.MessageCount, last.LastMessageAt)
+		}
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == "" {
+			ctx = withColor(ctx)
+		}
+		// An in-memory database is gone once the CLI exits
+		resumable := !strings.Contains(dbPath, "mode=memory") && !strings.Contains(dbPath, ":memory:")
+		runCLI(ctx, service, cfg.Persona, sessionID, initialQuery, resumable)
 	}
 }
 
-func runCLI(ctx context.Context, service *ChatService, sessionID, initialQuery string) {
-	fmt.Println("API Recommender Chatbot (type 'quit' or 'exit' to finish)")
-	fmt.Println("---------------------------------------------------------")
+// runCLI chats on the terminal until the user quits. When resumable, it
+// then prints the command that continues the session.
+func runCLI(ctx context.Context, service *ChatService, persona config.Persona, sessionID, initialQuery string, resumable bool) {
+	bye := func() {
+		fmt.Println("See You Later!")
+		if resumable && sessionID != "" {
+			fmt.Printf("Resume this conversation with: %s\n", resumeCommand(sessionID))
+		}
+	}
+
+	banner := fmt.Sprintf("%s (type 'quit' or 'exit' to finish)", persona.Render(persona.Greeting))
+	fmt.Println(banner)
+	fmt.Println(strings.Repeat("-", len(banner)))
 
 	if trimmed := strings.TrimSpace(initialQuery); trimmed != "" {
 		response, sid, err := service.ProcessMessage(ctx, sessionID, trimmed)
@@ -74,12 +269,13 @@ func runCLI(ctx context.Context, service *ChatService, sessionID, initialQuery s
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
-		fmt.Print("Ayush: ")
+		fmt.Printf("%s: ", persona.UserLabel)
 		if !scanner.Scan() {
 			if err := scanner.Err(); err != nil {
 				log.Fatalf("Input error: %v", err)
 			}
-			fmt.Println("\nSee You Later!")
+			fmt.Println()
+			bye()
 			return
 		}
 
@@ -88,7 +284,7 @@ func runCLI(ctx context.Context, service *ChatService, sessionID, initialQuery s
 			continue
 		}
 		if strings.EqualFold(input, "quit") || strings.EqualFold(input, "exit") {
-			fmt.Println("See You Later!")
+			bye()
 			return
 		}
 
@@ -102,161 +298,133 @@ func runCLI(ctx context.Context, service *ChatService, sessionID, initialQuery s
 	}
 }
 
-func runServer(ctx context.Context, service *ChatService, addr, staticDir string) {
-	log.Printf("Starting API recommender server on %s", addr)
-
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			writeCORSHeaders(w)
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		if r.Method != http.MethodPost {
-			writeCORSHeaders(w)
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		writeCORSHeaders(w)
-
-		var req struct {
-			SessionID string `json:"sessionId"`
-			Message   string `json:"message"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
-			return
-		}
-
-		response, sessionID, err := service.ProcessMessage(r.Context(), req.SessionID, req.Message)
+func runExport(ctx context.Context, service *ChatService, archivePath string) {
+	out := os.Stdout
+	if archivePath != "" {
+		f, err := os.Create(archivePath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("chat error: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		writeJSON(w, map[string]any{
-			"sessionId": sessionID,
-			"message":   response,
-		})
-	})
-
-	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			writeCORSHeaders(w)
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		if r.Method != http.MethodGet {
-			writeCORSHeaders(w)
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
+			log.Fatalf("create archive: %v", err)
 		}
+		defer f.Close()
+		out = f
+	}
 
-		writeCORSHeaders(w)
+	if err := service.ExportSessions(ctx, out); err != nil {
+		log.Fatalf("export sessions: %v", err)
+	}
+}
 
-		limit := parseLimit(r.URL.Query().Get("limit"))
-		sessions, err := service.ListSessions(r.Context(), limit)
+func runImport(ctx context.Context, service *ChatService, archivePath string) {
+	in := os.Stdin
+	if archivePath != "" {
+		f, err := os.Open(archivePath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("list sessions error: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		writeJSON(w, map[string]any{"sessions": sessions})
-	})
-
-	mux.HandleFunc("/api/sessions/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			writeCORSHeaders(w)
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		if r.Method != http.MethodGet {
-			writeCORSHeaders(w)
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
+			log.Fatalf("open archive: %v", err)
 		}
+		defer f.Close()
+		in = f
+	}
 
-		writeCORSHeaders(w)
+	result, err := service.ImportSessions(ctx, in)
+	if err != nil {
+		log.Fatalf("import sessions: %v", err)
+	}
+	log.Printf("Imported %d sessions (%d messages), skipped %d existing sessions",
+		result.SessionsImported, result.MessagesImported, len(result.SessionsSkipped))
+}
 
-		path := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
-		if path == "" {
-			http.Error(w, "session id required", http.StatusBadRequest)
-			return
+func runImportTranscript(ctx context.Context, service *ChatService, transcriptPath, sessionID string) {
+	in := os.Stdin
+	if transcriptPath != "" {
+		f, err := os.Open(transcriptPath)
+		if err != nil {
+			log.Fatalf("open transcript: %v", err)
 		}
+		defer f.Close()
+		in = f
+	}
 
-		parts := strings.Split(path, "/")
-		sessionID := parts[0]
-
-		if len(parts) == 1 {
-			http.Error(w, "resource not found", http.StatusNotFound)
-			return
-		}
+	result, err := service.ImportTranscript(ctx, sessionID, in)
+	if err != nil {
+		log.Fatalf("import transcript: %v", err)
+	}
+	log.Printf("Imported %d messages (%d with timestamps) into session %s",
+		result.MessagesImported, result.Stamped, result.SessionID)
+}
 
-		if parts[1] != "messages" {
-			http.Error(w, "resource not found", http.StatusNotFound)
-			return
-		}
+// runIssueTokens prints a token for every session that has none, one
+// "session token" line each, for handing sessions from before
+// -require-session-tokens back to their users.
+func runIssueTokens(ctx context.Context, service *ChatService) {
+	tokens, err := service.IssueMissingSessionTokens(ctx)
+	if err != nil {
+		log.Fatalf("issue session tokens: %v", err)
+	}
+	ids := make([]string, 0, len(tokens))
+	for id := range tokens {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("%s %s\n", id, tokens[id])
+	}
+	log.Printf("Issued tokens for %d sessions", len(ids))
+}
 
-		limit := parseLimit(r.URL.Query().Get("limit"))
-		messages, err := service.GetSessionMessages(r.Context(), sessionID, limit)
+func runDatasetExport(ctx context.Context, service *ChatService, archivePath string) {
+	out := os.Stdout
+	if archivePath != "" {
+		f, err := os.Create(archivePath)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("load session messages error: %v", err), http.StatusInternalServerError)
-			return
+			log.Fatalf("create dataset: %v", err)
 		}
-
-		writeJSON(w, map[string]any{
-			"sessionId": sessionID,
-			"messages":  messages,
-		})
-	})
-
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		writeCORSHeaders(w)
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
-
-	if fi, err := os.Stat(staticDir); err == nil && fi.IsDir() {
-		fileServer := http.FileServer(http.Dir(staticDir))
-		mux.Handle("/", fileServer)
-		log.Printf("Serving static files from %s", staticDir)
-	} else {
-		log.Printf("Static directory %s not found or not a directory; skipping static file serving", staticDir)
+		defer f.Close()
+		out = f
 	}
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("server error: %v", err)
+	if err := service.ExportDataset(ctx, out); err != nil {
+		log.Fatalf("export dataset: %v", err)
 	}
 }
 
-func parseLimit(raw string) int {
-	if raw == "" {
-		return 0
+// resumeCommand is the command line that continues sessionID, keeping the
+// flags that were given for where sessions, docs and config live.
+func resumeCommand(sessionID string) string {
+	parts := []string{filepath.Base(os.Args[0]), "chat"}
+	for _, name := range []string{"db", "docs", "config", "sandbox"} {
+		if f := flag.Lookup(name); f != nil && flagSet(name) {
+			parts = append(parts, fmt.Sprintf("--%s=%s", name, shellQuote(f.Value.String())))
+		}
 	}
+	return strings.Join(append(parts, "--session", shellQuote(sessionID)), " ")
+}
 
-	limit, err := strconv.Atoi(raw)
-	if err != nil || limit < 0 {
-		return 0
+// shellQuote quotes s for a POSIX shell when it needs quoting.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`&|;<>()*?[]#~") {
+		return s
 	}
-
-	return limit
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
-func writeCORSHeaders(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
 }
 
-func writeJSON(w http.ResponseWriter, payload any) {
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		http.Error(w, fmt.Sprintf("encode response: %v", err), http.StatusInternalServerError)
-	}
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
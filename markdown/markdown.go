@@ -0,0 +1,185 @@
+// Package markdown splits the assistant's markdown answers into structured
+// segments, so clients can render them without a markdown parser of their
+// own.
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Segment types.
+const (
+	TypeHeading   = "heading"
+	TypeParagraph = "paragraph"
+	TypeList      = "list"
+	TypeCode      = "code"
+)
+
+// Segment is one block of an answer. Text holds headings, paragraphs and
+// code; Items holds list entries. Bold markers are removed from text.
+type Segment struct {
+	Type     string   `json:"type"`
+	Text     string   `json:"text,omitempty"`
+	Items    []string `json:"items,omitempty"`
+	Ordered  bool     `json:"ordered,omitempty"`
+	Language string   `json:"language,omitempty"`
+}
+
+var (
+	reBullet   = regexp.MustCompile(`^\s*[-*•]\s+(.*)$`)
+	reNumbered = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	reHeading  = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	// A line that is bold as a whole, e.g. "**Async Flow:**", is used as a
+	// heading by the model.
+	reBoldLine = regexp.MustCompile(`^\*\*([^*]+)\*\*:?$`)
+	reBold     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+)
+
+// Parse splits text into segments. Blank lines end paragraphs and lists;
+// fenced code blocks are kept verbatim.
+func Parse(text string) []Segment {
+	var segments []Segment
+	var para []string
+	var list *Segment
+
+	flush := func() {
+		if len(para) > 0 {
+			segments = append(segments, Segment{Type: TypeParagraph, Text: inline(strings.Join(para, " "))})
+			para = nil
+		}
+		if list != nil {
+			segments = append(segments, *list)
+			list = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			code := Segment{Type: TypeCode, Language: strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))}
+			var body []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				body = append(body, lines[i])
+			}
+			code.Text = strings.Join(body, "\n")
+			segments = append(segments, code)
+			continue
+		}
+
+		if trimmed == "" {
+			flush()
+			continue
+		}
+
+		if m := reHeading.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			segments = append(segments, Segment{Type: TypeHeading, Text: inline(m[1])})
+			continue
+		}
+		if m := reBoldLine.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			segments = append(segments, Segment{Type: TypeHeading, Text: strings.TrimSuffix(strings.TrimSpace(m[1]), ":")})
+			continue
+		}
+
+		bullet, numbered := reBullet.FindStringSubmatch(line), reNumbered.FindStringSubmatch(line)
+		if bullet != nil || numbered != nil {
+			item, ordered := "", numbered != nil
+			if ordered {
+				item = numbered[1]
+			} else {
+				item = bullet[1]
+			}
+			if list == nil || list.Ordered != ordered {
+				flush()
+				list = &Segment{Type: TypeList, Ordered: ordered}
+			}
+			list.Items = append(list.Items, inline(item))
+			continue
+		}
+
+		if list != nil {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				// Continuation of the previous item
+				last := len(list.Items) - 1
+				list.Items[last] += " " + inline(trimmed)
+				continue
+			}
+			flush()
+		}
+		para = append(para, trimmed)
+	}
+	flush()
+	return segments
+}
+
+// inline removes bold markers.
+func inline(s string) string {
+	return strings.TrimSpace(reBold.ReplaceAllString(s, "$1$2"))
+}
+
+// ANSI colors for diff lines.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// Text renders segments as plain text for terminals.
+func Text(segments []Segment) string {
+	return text(segments, false)
+}
+
+// ColorText renders segments like Text, coloring the removed and added
+// lines of diff blocks red and green for terminals that show ANSI colors.
+func ColorText(segments []Segment) string {
+	return text(segments, true)
+}
+
+func text(segments []Segment, color bool) string {
+	blocks := make([]string, 0, len(segments))
+	for _, s := range segments {
+		switch s.Type {
+		case TypeList:
+			items := make([]string, len(s.Items))
+			for i, item := range s.Items {
+				if s.Ordered {
+					items[i] = fmt.Sprintf(" %d. %s", i+1, item)
+				} else {
+					items[i] = " - " + item
+				}
+			}
+			blocks = append(blocks, strings.Join(items, "\n"))
+		case TypeHeading:
+			blocks = append(blocks, s.Text+":")
+		case TypeCode:
+			if color && s.Language == "diff" {
+				blocks = append(blocks, colorDiff(s.Text))
+				continue
+			}
+			blocks = append(blocks, s.Text)
+		default:
+			blocks = append(blocks, s.Text)
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func colorDiff(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, l := range lines {
+		switch {
+		case strings.HasPrefix(l, "-"):
+			lines[i] = ansiRed + l + ansiReset
+		case strings.HasPrefix(l, "+"):
+			lines[i] = ansiGreen + l + ansiReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const messageFeedbackSchema = `
+CREATE TABLE IF NOT EXISTS message_feedback (
+	message_id INTEGER PRIMARY KEY,
+	session TEXT NOT NULL,
+	rating INTEGER NOT NULL,
+	comment TEXT,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_message_feedback_session ON message_feedback (session);`
+
+// FeedbackCounts tallies ratings.
+type FeedbackCounts struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+// Analytics aggregates feedback and follow-up outcomes across all sessions.
+type Analytics struct {
+	Recommendations struct {
+		Total int `json:"total"`
+		FeedbackCounts
+	} `json:"recommendations"`
+	Messages struct {
+		Assistant int `json:"assistant"`
+		FeedbackCounts
+	} `json:"messages"`
+	FollowUps FollowUpStats `json:"followUps"`
+}
+
+func ensureMessageFeedbackSchema(db *sql.DB) error {
+	if _, err := db.Exec(messageFeedbackSchema); err != nil {
+		return fmt.Errorf("create message feedback schema: %w", err)
+	}
+	return nil
+}
+
+// RateMessage stores a thumbs-up or thumbs-down on one assistant message.
+// Rating the same message again replaces the earlier rating. It reports
+// whether the message can now be regenerated, which is offered for
+// recommendations downvoted with a reason.
+func (s *ChatService) RateMessage(ctx context.Context, sessionID string, messageID int64, rating int, comment string) (bool, error) {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return false, fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+	if rating != FeedbackUp && rating != FeedbackDown {
+		return false, fmt.Errorf("%w: rating must be %d or %d", ErrInvalidInput, FeedbackUp, FeedbackDown)
+	}
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return false, err
+	}
+	if err := s.flushSession(ctx, sessionID); err != nil {
+		return false, err
+	}
+
+	var msgType string
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT type FROM %s WHERE id = ? AND session = ?;", s.table),
+		messageID, sessionID).Scan(&msgType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("%w: %s has no message %d", ErrMessageNotFound, sessionID, messageID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("load message: %w", err)
+	}
+	if msgType != string(llms.ChatMessageTypeAI) {
+		return false, fmt.Errorf("%w: only assistant messages can be rated", ErrInvalidInput)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO message_feedback (message_id, session, rating, comment) VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE SET rating = excluded.rating, comment = excluded.comment, created = CURRENT_TIMESTAMP;`,
+		messageID, sessionID, rating, strings.TrimSpace(comment))
+	if err != nil {
+		return false, fmt.Errorf("store message feedback: %w", err)
+	}
+	s.evaluateRollouts(ctx)
+
+	if rating != FeedbackDown || strings.TrimSpace(comment) == "" {
+		return false, nil
+	}
+	return s.canRegenerate(ctx, sessionID, messageID)
+}
+
+// Analytics counts recommendation and per-message feedback. The two are
+// tallied separately: rating a recommendation does not rate its message.
+func (s *ChatService) Analytics(ctx context.Context) (*Analytics, error) {
+	if err := s.flushWrites(ctx); err != nil {
+		return nil, err
+	}
+
+	var a Analytics
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN feedback = ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN feedback = ? THEN 1 ELSE 0 END), 0)
+		FROM recommendations;`, FeedbackUp, FeedbackDown).
+		Scan(&a.Recommendations.Total, &a.Recommendations.Up, &a.Recommendations.Down)
+	if err != nil {
+		return nil, fmt.Errorf("count recommendation feedback: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE type = ?;", s.table),
+		string(llms.ChatMessageTypeAI)).Scan(&a.Messages.Assistant)
+	if err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END), 0)
+		FROM message_feedback;`, FeedbackUp, FeedbackDown).
+		Scan(&a.Messages.Up, &a.Messages.Down)
+	if err != nil {
+		return nil, fmt.Errorf("count message feedback: %w", err)
+	}
+
+	if a.FollowUps, err = s.followUpAnalytics(ctx); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// middleware wraps a handler with cross-cutting behaviour.
+type middleware func(http.Handler) http.Handler
+
+// chain applies mws to h so that the first middleware is the outermost.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+				writeError(w, r, http.StatusInternalServerError, CodeInternal, "internal server error", nil)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s request_id=%s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond), requestIDFrom(r.Context()))
+	})
+}
+
+// cors sets the CORS headers on every response and answers preflight requests.
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Session-Token, X-Session-Tokens, X-Tenant-ID, X-LLM-API-Key, X-LLM-Model")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func allowMethods(methods ...string) middleware {
+	allow := strings.Join(methods, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, m := range methods {
+				if r.Method == m {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set("Allow", allow)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed", map[string]any{"allowed": methods})
+		})
+	}
+}
+
+// requireAdminToken guards admin routes. Admin routes are disabled entirely
+// when no token is configured.
+func requireAdminToken(adminToken string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminToken == "" {
+				writeError(w, r, http.StatusNotFound, CodeNotFound, "admin endpoints are disabled", nil)
+				return
+			}
+			if !tokenMatches(bearerToken(r), adminToken) {
+				writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAPIKey checks the X-API-Key header (or bearer token) against the
+// configured keys. Authentication is off when no keys are configured.
+func requireAPIKey(keys []string) middleware {
+	return func(next http.Handler) http.Handler {
+		if len(keys) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented := apiKey(r)
+			for _, k := range keys {
+				if tokenMatches(presented, k) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "unauthorized", nil)
+		})
+	}
+}
+
+// apiKey is the API key the caller presented, in X-API-Key or as a bearer
+// token.
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return bearerToken(r)
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func tokenMatches(presented, expected string) bool {
+	return presented != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) == 1
+}
+
+// rateLimit applies a per-client token bucket allowing perMinute requests per
+// minute with bursts of the same size. A non-positive limit disables it.
+// Clients are told apart by clientIP.
+func rateLimit(perMinute int, trusted []netip.Prefix) middleware {
+	return func(next http.Handler) http.Handler {
+		if perMinute <= 0 {
+			return next
+		}
+
+		var mu sync.Mutex
+		buckets := map[string]*tokenBucket{}
+		rate := float64(perMinute) / 60
+		swept := time.Now()
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := clientIP(r, trusted)
+			now := time.Now()
+
+			mu.Lock()
+			// A bucket idle for a minute has refilled and is no different
+			// from a new one, so it can go
+			if now.Sub(swept) >= bucketIdleTTL {
+				sweepBuckets(buckets, now)
+				swept = now
+			}
+			b, ok := buckets[client]
+			if !ok {
+				b = &tokenBucket{tokens: float64(perMinute), updated: now}
+				buckets[client] = b
+			}
+			allowed := b.take(now, rate, float64(perMinute))
+			mu.Unlock()
+
+			if !allowed {
+				w.Header().Set("Retry-After", "60")
+				writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bucketIdleTTL is how long a client's bucket is kept after its last
+// request: a minute refills any bucket.
+const bucketIdleTTL = time.Minute
+
+func sweepBuckets(buckets map[string]*tokenBucket, now time.Time) {
+	for client, b := range buckets {
+		if now.Sub(b.updated) >= bucketIdleTTL {
+			delete(buckets, client)
+		}
+	}
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate, capacity float64) bool {
+	b.tokens += now.Sub(b.updated).Seconds() * rate
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is only
+// believed when the request comes through a trusted proxy: the client is
+// then the last address in it that isn't a trusted proxy, since anything
+// before that could have been sent by the client itself.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host, trusted) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop, trusted) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(host string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses the -trusted-proxies list: addresses, e.g.
+// 10.0.0.7, or networks, e.g. 10.0.0.0/8.
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range list {
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// gzipResponseWriter compresses the body of responses that are allowed to
+// carry one. The encoding is decided when the status is written.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+	enabled     bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified {
+		w.enabled = true
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.enabled {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.gz == nil {
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.enabled && w.gz == nil {
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// compress gzips responses for clients that accept it.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"spoofed header from an untrusted caller", "203.0.113.5:4000", "198.51.100.1", "203.0.113.5"},
+		{"through a trusted proxy", "10.0.0.7:4000", "198.51.100.1", "198.51.100.1"},
+		{"client prepends a fake hop", "10.0.0.7:4000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.7:4000", "198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.7:4000", "", "10.0.0.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Fatalf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := parseTrustedProxies([]string{"10.0.0.7", "192.168.1.0/24", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Bits() != 32 || got[1].Bits() != 24 || got[2].Bits() != 128 {
+		t.Fatalf("prefixes = %v", got)
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.internal"}); err == nil {
+		t.Fatal("host name accepted as a trusted proxy")
+	}
+}
+
+func TestSweepBuckets(t *testing.T) {
+	now := time.Now()
+	buckets := map[string]*tokenBucket{
+		"idle":   {updated: now.Add(-2 * bucketIdleTTL)},
+		"active": {updated: now.Add(-time.Second)},
+	}
+	sweepBuckets(buckets, now)
+	if _, ok := buckets["idle"]; ok {
+		t.Fatal("idle bucket kept")
+	}
+	if _, ok := buckets["active"]; !ok {
+		t.Fatal("active bucket dropped")
+	}
+}
@@ -0,0 +1,161 @@
+package payload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Allowed maps field names to the only values the fields may take. A name
+// is a dotted path with [] for list entries, e.g.
+// payload.tokenizedAsset[].status, or a bare field name.
+type Allowed map[string][]string
+
+// For returns the values allowed for the field at name, which may carry
+// list indexes, found as lookupField finds it. It returns nil for unlimited
+// fields.
+func (a Allowed) For(name string) []string {
+	values, _ := lookupField(a, name)
+	return values
+}
+
+// lookupField returns the entry of m for the field at name, which may carry
+// list indexes. The field is looked up by its full path, or by its last
+// part when either name is bare, so "status" finds
+// payload.tokenizedAsset[].status and the other way round, but
+// context.status doesn't.
+func lookupField[V any](m map[string]V, name string) (V, bool) {
+	norm := strings.ToLower(reIndex.ReplaceAllString(name, "[]"))
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if strings.ToLower(key) == norm {
+			return m[key], true
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dotted := strings.Contains(key, ".") && strings.Contains(norm, ".")
+		if !dotted && bareName(key) == bareName(norm) {
+			return m[key], true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// bareName returns the last part of a field name, lower-cased and without
+// list markers.
+func bareName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(reIndex.ReplaceAllString(name, ""), "[]", ""))
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// allowedValue returns how value is spelled among values, matching case
+// insensitively.
+func allowedValue(values []string, value string) (string, bool) {
+	for _, v := range values {
+		if v == value {
+			return v, true
+		}
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// CheckAllowed checks user-supplied values against their fields' allowed
+// values. Values that match but for case are respelled; the others are left
+// out and reported.
+func CheckAllowed(pairs []Pair, allowed Allowed) ([]Pair, []Problem) {
+	var out []Pair
+	var problems []Problem
+	for _, p := range pairs {
+		values := allowed.For(p.Name)
+		if len(values) == 0 {
+			out = append(out, p)
+			continue
+		}
+		v, ok := allowedValue(values, p.Value)
+		if !ok {
+			problems = append(problems, Problem{Path: p.Name, Message: fmt.Sprintf("%q is not allowed; use one of %s", p.Value, strings.Join(values, ", "))})
+			continue
+		}
+		out = append(out, Pair{Name: p.Name, Value: v})
+	}
+	return out, problems
+}
+
+// EnforceAllowed rewrites the values of a JSON payload that their fields
+// don't allow: a value that differs only in case is respelled, and any other
+// is replaced by the first allowed value. meta.details entries are checked
+// by their name. Other payloads are returned unchanged.
+func EnforceAllowed(raw string, allowed Allowed) string {
+	if len(allowed) == 0 {
+		return raw
+	}
+	doc, ok := decodeObject(raw)
+	if !ok {
+		return raw
+	}
+	if !enforceAllowed(doc, "", allowed) {
+		return raw
+	}
+	out, err := encodeIndented(doc)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// enforceAllowed rewrites v in place, reporting whether anything changed.
+func enforceAllowed(v any, path string, allowed Allowed) bool {
+	changed := false
+	fix := func(name string, value any) (string, bool) {
+		values := allowed.For(name)
+		if len(values) == 0 || value == nil {
+			return "", false
+		}
+		if _, isObject := value.(map[string]any); isObject {
+			return "", false
+		}
+		if _, isList := value.([]any); isList {
+			return "", false
+		}
+		s := fmt.Sprint(value)
+		if v, ok := allowedValue(values, s); ok {
+			return v, v != s
+		}
+		return values[0], true
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		if name, value, ok := namedEntry(t); ok {
+			if v, ok := fix(name, value); ok {
+				t["value"], changed = v, true
+			}
+			return changed
+		}
+		for _, k := range sortedKeys(t) {
+			p := join(path, k)
+			if v, ok := fix(p, t[k]); ok {
+				t[k], changed = v, true
+				continue
+			}
+			if enforceAllowed(t[k], p, allowed) {
+				changed = true
+			}
+		}
+	case []any:
+		for i, item := range t {
+			if enforceAllowed(item, fmt.Sprintf("%s[%d]", path, i), allowed) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,167 @@
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// Pair is one key=value entry supplied by the user.
+type Pair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Spec is what the deterministic builder knows about a request.
+type Spec struct {
+	IsAsync        bool
+	IsUMICompliant bool
+	IsPrivate      bool
+	NetworkID      string
+	Version        string
+	// Fields are the requested field names; pairs supply values for some or
+	// all of them.
+	Fields []string
+	Pairs  []Pair
+	// Profile picks the dummy values of fields without one; see Profiles.
+	Profile string
+	// Examples are the documented values of fields, used ahead of the
+	// profile's dummy values.
+	Examples Examples
+	// Clock timestamps the payload and dates its dummy values; nil is the
+	// system time in UTC.
+	Clock *Clock
+}
+
+// placeholderRequestID keeps built payloads deterministic; their timestamp
+// comes from the spec's clock, which tests can fix.
+const placeholderRequestID = "sample-request-id"
+
+// pairPattern reads a comma followed by a digit as digit grouping ("1,000"),
+// not as the end of the value.
+var pairPattern = regexp.MustCompile(`([A-Za-z_][\w.-]*)\s*=\s*("[^"]*"|(?:,\d|[^,;\n])+)`)
+
+// ParsePairs extracts key=value entries from text, e.g.
+// "store maxLimit=100, region=south". Later entries for the same key win.
+func ParsePairs(text string) []Pair {
+	var pairs []Pair
+	index := map[string]int{}
+	for _, m := range pairPattern.FindAllStringSubmatch(text, -1) {
+		name := m[1]
+		value := strings.Trim(strings.TrimSpace(m[2]), `"`)
+		if i, ok := index[strings.ToLower(name)]; ok {
+			pairs[i].Value = value
+			continue
+		}
+		index[strings.ToLower(name)] = len(pairs)
+		pairs = append(pairs, Pair{Name: name, Value: value})
+	}
+	return pairs
+}
+
+// Build renders the payload for operation without calling the model. Asset
+// creation is built whenever the user supplied key=value pairs. It reports
+// false when the operation has no deterministic builder.
+func Build(operation string, spec Spec) (string, bool, error) {
+	var build func(Spec) requestmodel.Request
+	if t, ok := TemplateFor(operation); ok {
+		build = t.Build
+	}
+	if build == nil && len(spec.Pairs) > 0 && (operation == "" || operation == "create") {
+		build = buildTokenizedAsset
+	}
+	if build == nil {
+		return "", false, nil
+	}
+
+	req := build(spec)
+	req.Context.RequestId = placeholderRequestID
+	req.Context.Timestamp = spec.Clock.Timestamp()
+	req.Context.IsAsync = spec.IsAsync
+	req.Context.IsUMICompliant = spec.IsUMICompliant
+	req.Context.NetworkId = spec.NetworkID
+	req.Context.Version = spec.Version
+	if spec.IsPrivate {
+		req.Source = []requestmodel.BusinessIdentifier{{Id: "sample-source-id"}}
+		req.Destination = []requestmodel.BusinessIdentifier{{Id: "sample-destination-id"}}
+	}
+
+	out, err := encodeJSON(req)
+	if err != nil {
+		return "", true, fmt.Errorf("encode %s payload: %w", operation, err)
+	}
+	return out, true, nil
+}
+
+// encodeJSON renders req as indented JSON without empty blocks.
+func encodeJSON(req requestmodel.Request) (string, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Struct-valued fields such as context.meta can't be omitted by tags
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return "", err
+	}
+	return encodeIndented(prune(doc))
+}
+
+// encodeIndented renders a decoded JSON document with two-space indents.
+// Values such as URLs keep their & and < rather than \u escapes.
+func encodeIndented(doc any) (string, error) {
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// prune drops empty objects and arrays from a decoded JSON document.
+func prune(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if child = prune(child); isEmpty(child) {
+				delete(t, k)
+			} else {
+				t[k] = child
+			}
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = prune(child)
+		}
+	}
+	return v
+}
+
+func isEmpty(v any) bool {
+	switch t := v.(type) {
+	case map[string]any:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	}
+	return false
+}
+
+// buildKeyValue stores every field as a keyValue detail, taking values from
+// the user's pairs and falling back to a placeholder.
+func buildKeyValue(spec Spec) requestmodel.Request {
+	var details []requestmodel.Detail
+	for _, p := range withPlaceholders(spec) {
+		details = append(details, requestmodel.Detail{Name: p.Name, Value: p.Value})
+	}
+
+	return requestmodel.Request{
+		Payload: requestmodel.Payload{Type: "keyValue", KeyValue: &details},
+	}
+}
@@ -0,0 +1,143 @@
+package payload
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock supplies the timestamps that payloads are built with and checked
+// against, in one timezone and format. Tests can fix the time it reports.
+// A nil *Clock reads the system time in UTC and formats as RFC 3339.
+type Clock struct {
+	now      func() time.Time
+	location *time.Location
+	layout   string
+}
+
+// NewClock returns a clock reading now, or the system time when now is nil,
+// in location and formatting with layout, a Go time layout.
+func NewClock(now func() time.Time, location *time.Location, layout string) *Clock {
+	if now == nil {
+		now = time.Now
+	}
+	return &Clock{now: now, location: location, layout: layout}
+}
+
+// defaultClock is what a nil *Clock stands for.
+var defaultClock = NewClock(nil, time.UTC, time.RFC3339)
+
+func (c *Clock) orDefault() *Clock {
+	if c == nil {
+		return defaultClock
+	}
+	return c
+}
+
+// Now returns the current time in the clock's timezone.
+func (c *Clock) Now() time.Time {
+	c = c.orDefault()
+	return c.now().In(c.location)
+}
+
+// Format renders t in the clock's timezone and format.
+func (c *Clock) Format(t time.Time) string {
+	c = c.orDefault()
+	return t.In(c.location).Format(c.layout)
+}
+
+// Timestamp is Format(Now()).
+func (c *Clock) Timestamp() string {
+	return c.Format(c.Now())
+}
+
+// Layout returns the clock's format as a Go time layout.
+func (c *Clock) Layout() string {
+	c = c.orDefault()
+	return c.layout
+}
+
+// Parse reads a timestamp in the clock's format. Times without a zone are
+// taken to be in the clock's timezone.
+func (c *Clock) Parse(s string) (time.Time, error) {
+	c = c.orDefault()
+	t, err := time.ParseInLocation(c.layout, s, c.location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not in the format %s", s, c.layout)
+	}
+	return t, nil
+}
+
+// ParseAny reads a timestamp or date in the clock's format or any spelling
+// accepted from users. Slash and dash dates are read day first.
+func (c *Clock) ParseAny(s string) (time.Time, error) {
+	c = c.orDefault()
+	if t, err := c.Parse(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, c.location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", s)
+}
+
+// timestampProblems reports date and timestamp fields that aren't in the
+// format of c.
+func timestampProblems(doc map[string]any, c *Clock) []Problem {
+	var problems []Problem
+	walkDates(doc, "", func(path, value string) string {
+		if _, err := c.Parse(value); err != nil {
+			problems = append(problems, Problem{Path: path, Message: fmt.Sprintf("%q is not in the timestamp format, e.g. %s", value, c.Timestamp())})
+		}
+		return value
+	})
+	return problems
+}
+
+// FormatTimestamps rewrites the readable date and timestamp fields of a JSON
+// payload in the timezone and format of c, so a generated payload uses one
+// format throughout. Other payloads are returned unchanged.
+func FormatTimestamps(raw string, c *Clock) string {
+	doc, ok := decodeObject(raw)
+	if !ok {
+		return raw
+	}
+	changed := false
+	walkDates(doc, "", func(path, value string) string {
+		t, err := c.ParseAny(value)
+		if err != nil || c.Format(t) == value {
+			return value
+		}
+		changed = true
+		return c.Format(t)
+	})
+	if !changed {
+		return raw
+	}
+	out, err := encodeIndented(doc)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// walkDates calls fn with each string value of a date field in v, judged
+// by its name, and stores what fn returns.
+func walkDates(v any, path string, fn func(path, value string) string) {
+	switch t := v.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(t) {
+			p := join(path, k)
+			if s, ok := t[k].(string); ok && s != "" && isDateField(k) {
+				t[k] = fn(p, s)
+				continue
+			}
+			walkDates(t[k], p, fn)
+		}
+	case []any:
+		for i, item := range t {
+			walkDates(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// XMLNamespace is the token schema namespace, bound to the "token" prefix
+// in XML payloads.
+const XMLNamespace = "http://npci.org/token/schema/"
+
+// defaultXMLRoot names the root element of converted XML when the caller
+// doesn't.
+const defaultXMLRoot = "Request"
+
+// XMLRoot is the root element of an XML payload and the namespace its
+// prefix is bound to. Without a prefix the namespace is the default one.
+type XMLRoot struct {
+	Name      string
+	Prefix    string
+	Namespace string
+}
+
+// TokenXMLRoot returns the root element name in the token schema
+// namespace, e.g. token:ReqIssue.
+func TokenXMLRoot(name string) XMLRoot {
+	return XMLRoot{Name: name, Prefix: "token", Namespace: XMLNamespace}
+}
+
+// QName is the root element's name with its prefix.
+func (r XMLRoot) QName() string {
+	if r.Prefix == "" {
+		return r.Name
+	}
+	return r.Prefix + ":" + r.Name
+}
+
+// StartTag is the root's start tag, declaring its namespace.
+func (r XMLRoot) StartTag() string {
+	var b strings.Builder
+	b.WriteString("<" + r.QName())
+	for _, a := range r.declare(nil) {
+		b.WriteString(" " + qualified(a.Name) + `="`)
+		xml.EscapeText(&b, []byte(a.Value))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// declare replaces the namespace declarations in attrs with r's.
+func (r XMLRoot) declare(attrs []xml.Attr) []xml.Attr {
+	var out []xml.Attr
+	if r.Namespace != "" {
+		name := xml.Name{Local: "xmlns"}
+		if r.Prefix != "" {
+			name = xml.Name{Space: "xmlns", Local: r.Prefix}
+		}
+		out = append(out, xml.Attr{Name: name, Value: r.Namespace})
+	}
+	for _, a := range attrs {
+		if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// ErrUnconvertible is returned for payloads that can't be converted without
+// losing content.
+var ErrUnconvertible = errors.New("payload cannot be converted")
+
+// Converted is a payload re-encoded in another format.
+type Converted struct {
+	Format  string `json:"format"`
+	Payload string `json:"payload"`
+	// Root is the XML root element, without its namespace prefix.
+	Root string `json:"root,omitempty"`
+}
+
+// Convert re-encodes raw as JSON or XML (to; the other format when empty)
+// through requestmodel.Request, so values are copied rather than rewritten.
+// root is the XML root element, e.g. TokenXMLRoot("ReqIssue"); without a
+// name, an XML payload keeps its own. Content the request model has no
+// place for is reported instead of being dropped; a watermark isn't
+// content and isn't carried over.
+func Convert(raw, to string, root XMLRoot) (Converted, error) {
+	body := withoutMeta(strings.TrimSpace(raw))
+	from := FormatJSON
+	if strings.HasPrefix(body, "<") {
+		from = FormatXML
+	}
+	switch to {
+	case "":
+		to = FormatXML
+		if from == FormatXML {
+			to = FormatJSON
+		}
+	case FormatJSON, FormatXML:
+	default:
+		return Converted{}, fmt.Errorf("%w: unknown format %q; use %s or %s", ErrUnconvertible, to, FormatJSON, FormatXML)
+	}
+
+	var req requestmodel.Request
+	if from == FormatXML {
+		if err := xml.Unmarshal([]byte(body), &req); err != nil {
+			return Converted{}, fmt.Errorf("%w: payload is not valid XML: %v", ErrUnconvertible, err)
+		}
+		if root.Name == "" {
+			root.Name = req.XMLName.Local
+		}
+	} else {
+		dec := json.NewDecoder(strings.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return Converted{}, fmt.Errorf("%w: payload does not match the request model: %v", ErrUnconvertible, strings.TrimPrefix(err.Error(), "json: "))
+		}
+	}
+	if root.Name == "" {
+		root.Name = defaultXMLRoot
+	}
+
+	out, err := encodeXML(req, root)
+	if err != nil {
+		return Converted{}, fmt.Errorf("encode XML payload: %w", err)
+	}
+	if err := checkLossless(from, body, req, out); err != nil {
+		return Converted{}, err
+	}
+	if to == FormatXML {
+		return Converted{Format: FormatXML, Payload: out, Root: root.Name}, nil
+	}
+
+	out, err = encodeJSON(req)
+	if err != nil {
+		return Converted{}, fmt.Errorf("encode JSON payload: %w", err)
+	}
+	return Converted{Format: FormatJSON, Payload: out, Root: root.Name}, nil
+}
+
+// checkLossless makes sure the XML form of req carries everything the
+// original payload did. XML input is compared value by value, since
+// unmarshalling ignores elements the model doesn't know; JSON input was
+// decoded strictly and only has to survive the trip through XML.
+func checkLossless(from, original string, req requestmodel.Request, encoded string) error {
+	if from == FormatXML {
+		lost, err := lostXML(original, encoded)
+		if err != nil {
+			return fmt.Errorf("%w: payload is not valid XML: %v", ErrUnconvertible, err)
+		}
+		if len(lost) > 0 {
+			return fmt.Errorf("%w: the request model has no place for %s", ErrUnconvertible, strings.Join(lost, ", "))
+		}
+		return nil
+	}
+
+	var back requestmodel.Request
+	if err := xml.Unmarshal([]byte(encoded), &back); err != nil {
+		return fmt.Errorf("encode XML payload: %w", err)
+	}
+	want, err := encodeJSON(req)
+	if err != nil {
+		return fmt.Errorf("encode JSON payload: %w", err)
+	}
+	got, err := encodeJSON(back)
+	if err != nil {
+		return fmt.Errorf("encode JSON payload: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("%w: the XML form of the request model can't hold this payload exactly", ErrUnconvertible)
+	}
+	return nil
+}
+
+// encodeXML renders req as indented XML under root, without the empty
+// wrapper elements encoding/xml leaves for unset blocks.
+func encodeXML(req requestmodel.Request, root XMLRoot) (string, error) {
+	req.XMLName = xml.Name{Local: root.QName()}
+	raw, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	tree, err := parseXML(raw)
+	if err != nil {
+		return "", err
+	}
+	tree.prune()
+	// The request model declares the token prefix, whatever root uses
+	tree.attrs = root.declare(tree.attrs)
+
+	var b strings.Builder
+	tree.write(&b, 0)
+	return strings.TrimSpace(b.String()), nil
+}
+
+// xmlNode is an element of a parsed XML document. Names keep their prefix.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+	// omitted counts the children a preview left out.
+	omitted int
+}
+
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: qualified(t.Name), attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+	return root, nil
+}
+
+func qualified(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// prune drops descendants that carry no attributes, text or children.
+func (n *xmlNode) prune() {
+	kept := n.children[:0]
+	for _, c := range n.children {
+		c.prune()
+		if len(c.attrs) > 0 || len(c.children) > 0 || strings.TrimSpace(c.text) != "" {
+			kept = append(kept, c)
+		}
+	}
+	n.children = kept
+}
+
+func (n *xmlNode) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent + "<" + n.name)
+	for _, a := range n.attrs {
+		b.WriteString(" " + qualified(a.Name) + `="`)
+		xml.EscapeText(b, []byte(a.Value))
+		b.WriteString(`"`)
+	}
+
+	text := strings.TrimSpace(n.text)
+	leaf := len(n.children) == 0 && n.omitted == 0
+	switch {
+	case leaf && text == "":
+		b.WriteString("/>\n")
+	case leaf:
+		b.WriteString(">")
+		xml.EscapeText(b, []byte(text))
+		b.WriteString("</" + n.name + ">\n")
+	default:
+		b.WriteString(">\n")
+		if text != "" {
+			b.WriteString(indent + "  ")
+			xml.EscapeText(b, []byte(text))
+			b.WriteString("\n")
+		}
+		for _, c := range n.children {
+			c.write(b, depth+1)
+		}
+		if n.omitted > 0 {
+			b.WriteString(indent + "  <!-- " + count(n.omitted, "more element") + " omitted -->\n")
+		}
+		b.WriteString(indent + "</" + n.name + ">\n")
+	}
+}
+
+// lostXML lists the attributes and text of original that encoded lacks,
+// by path below the root element.
+func lostXML(original, encoded string) ([]string, error) {
+	before, err := parseXML([]byte(original))
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseXML([]byte(encoded))
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]int{}
+	after.values("", have)
+	want := map[string]int{}
+	before.values("", want)
+
+	var lost []string
+	for key, n := range want {
+		if have[key] < n {
+			path, _, _ := strings.Cut(key, "=")
+			lost = append(lost, path)
+		}
+	}
+	sort.Strings(lost)
+	return lost, nil
+}
+
+// values counts the attribute and text values below n, keyed by path and
+// value. Namespace declarations are left out.
+func (n *xmlNode) values(path string, out map[string]int) {
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		out[path+"@"+a.Name.Local+"="+a.Value]++
+	}
+	if text := strings.TrimSpace(n.text); text != "" && path != "" {
+		out[path+"="+text]++
+	}
+	for _, c := range n.children {
+		name := c.name
+		if _, local, ok := strings.Cut(name, ":"); ok {
+			name = local
+		}
+		c.values(path+"/"+name, out)
+	}
+}
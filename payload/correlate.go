@@ -0,0 +1,156 @@
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eventTimestamps are the event fields that must not be earlier than the
+// request they answer.
+var eventTimestamps = []string{"timestamp", "creationTimestamp"}
+
+// Correlate ties the event payload of an async flow to its request, as the
+// backend matches them: the event's context carries the request's requestId
+// as originalRequestId and its timestamp as originalTimestamp, and event
+// timestamps earlier than the request are moved up to it. The request may be
+// JSON or XML; the event must be JSON. The event is returned unchanged when
+// the request has no requestId to link to. Timestamps are read and written
+// with c.
+func Correlate(request, event string, c *Clock) (string, error) {
+	requestID, requestTime, err := requestContext(request, c)
+	if err != nil {
+		return event, err
+	}
+	if requestID == "" {
+		return event, nil
+	}
+	doc, err := decodeEvent(event)
+	if err != nil {
+		return event, err
+	}
+
+	ctx, _ := doc["context"].(map[string]any)
+	if ctx == nil {
+		ctx = map[string]any{}
+		doc["context"] = ctx
+	}
+	ctx["originalRequestId"] = requestID
+	if !requestTime.IsZero() {
+		ctx["originalTimestamp"] = c.Format(requestTime)
+		for _, e := range objects(doc, "payload", "event") {
+			for _, key := range eventTimestamps {
+				s, _ := e[key].(string)
+				if t, err := parseTime(s, c); err == nil && t.Before(requestTime) {
+					e[key] = c.Format(requestTime)
+				}
+			}
+		}
+	}
+
+	out, err := encodeIndented(doc)
+	if err != nil {
+		return event, fmt.Errorf("encode event payload: %w", err)
+	}
+	return out, nil
+}
+
+// CheckCorrelation reports where an event payload fails to link to its
+// request: a missing requestId, an originalRequestId or originalTimestamp
+// that doesn't match the request, or an event dated before the request.
+// Timestamps are read with c.
+func CheckCorrelation(request, event string, c *Clock) []Problem {
+	requestID, requestTime, err := requestContext(request, c)
+	if err != nil {
+		return []Problem{{Message: "request payload can't be read: " + err.Error()}}
+	}
+	if requestID == "" {
+		return []Problem{{Path: "context.requestId", Message: "the request has no requestId, so its event can't be matched to it"}}
+	}
+	doc, err := decodeEvent(event)
+	if err != nil {
+		return []Problem{{Message: "event " + err.Error()}}
+	}
+
+	var problems []Problem
+	ctx, _ := doc["context"].(map[string]any)
+	if got, _ := ctx["originalRequestId"].(string); got != requestID {
+		problems = append(problems, Problem{Path: "event context.originalRequestId", Message: fmt.Sprintf("should be the request's requestId %q", requestID)})
+	}
+	if requestTime.IsZero() {
+		return problems
+	}
+	if got, _ := ctx["originalTimestamp"].(string); got != "" {
+		if t, err := parseTime(got, c); err != nil || !t.Equal(requestTime) {
+			problems = append(problems, Problem{Path: "event context.originalTimestamp", Message: "should be the request's timestamp " + c.Format(requestTime)})
+		}
+	}
+	for i, e := range objects(doc, "payload", "event") {
+		for _, key := range eventTimestamps {
+			s, _ := e[key].(string)
+			if t, err := parseTime(s, c); err == nil && t.Before(requestTime) {
+				problems = append(problems, Problem{Path: fmt.Sprintf("event payload.event[%d].%s", i, key), Message: "is earlier than the request it answers"})
+			}
+		}
+	}
+	return problems
+}
+
+// requestContext reads the requestId and timestamp of a request payload. A
+// timestamp that can't be read counts as none.
+func requestContext(request string, c *Clock) (string, time.Time, error) {
+	fields, err := Fields(jsonBody(request))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var id string
+	var ts time.Time
+	for _, f := range fields {
+		switch f.Path {
+		case "context.requestId":
+			id = f.Value
+		case "context.timestamp":
+			ts, _ = parseTime(f.Value, c)
+		}
+	}
+	return id, ts, nil
+}
+
+func decodeEvent(event string) (map[string]any, error) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(jsonBody(event)), &doc); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	return doc, nil
+}
+
+// decodeObject decodes a JSON object payload, keeping numbers as written.
+func decodeObject(raw string) (map[string]any, bool) {
+	body := jsonBody(raw)
+	if !strings.HasPrefix(body, "{") {
+		return nil, false
+	}
+	var doc map[string]any
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// jsonBody strips whatever the model wrote around a JSON payload, such as a
+// code fence. XML is returned as it is.
+func jsonBody(raw string) string {
+	body := strings.TrimSpace(raw)
+	start, end := strings.Index(body, "{"), strings.LastIndex(body, "}")
+	if strings.HasPrefix(body, "<") || start < 0 || end < start {
+		return body
+	}
+	return body[start : end+1]
+}
+
+func parseTime(s string, c *Clock) (time.Time, error) {
+	return c.ParseAny(strings.TrimSpace(s))
+}
@@ -0,0 +1,31 @@
+package payload
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzCorrelate feeds Correlate and CheckCorrelation request and event
+// payloads as a model might write them. jsonBody strips what surrounds the
+// JSON, so neither may panic on whatever is left, and a correlated event
+// must pass the check.
+func FuzzCorrelate(f *testing.F) {
+	f.Add(`{"context": {"requestId": "r-1", "timestamp": "2024-01-02T03:04:05Z"}}`,
+		"```json\n{\"payload\": {\"event\": [{\"timestamp\": \"2023-01-01T00:00:00Z\"}]}}\n```")
+	f.Add(`<Request><context requestId="r-1"/></Request>`, `{"context": null, "payload": {"event": "x"}}`)
+	f.Add(`{"context": {"requestId": 7}}`, `}{`)
+	f.Add(`prose {`, `{"payload": {"event": [null, 1, {"creationTimestamp": {}}]}}`)
+
+	f.Fuzz(func(t *testing.T, request, event string) {
+		out, err := Correlate(request, event, nil)
+		problems := CheckCorrelation(request, event, nil)
+		if err != nil || out == event {
+			return
+		}
+		for _, p := range CheckCorrelation(request, out, nil) {
+			if strings.Contains(p.Path, "originalRequestId") {
+				t.Fatalf("correlated event does not carry the request id: %s (before: %v)", out, problems)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Examples maps field names, as in Allowed, to the example values the docs
+// give for them.
+type Examples map[string]string
+
+// For returns the example of the field at name, found as Allowed.For finds
+// allowed values.
+func (e Examples) For(name string) (string, bool) {
+	return lookupField(e, name)
+}
+
+// ApplyExamples replaces the values of a JSON payload's fields with their
+// documented examples, so sample payloads carry values known to work
+// rather than invented ones. Fields named in given, the values the user
+// supplied, keep theirs. Numbers and booleans stay numbers and booleans
+// when the example is one. meta.details entries are matched by their name.
+// Other payloads are returned unchanged.
+func ApplyExamples(raw string, examples Examples, given []Pair) string {
+	if len(examples) == 0 {
+		return raw
+	}
+	doc, ok := decodeObject(raw)
+	if !ok {
+		return raw
+	}
+	kept := map[string]bool{}
+	for _, p := range given {
+		kept[p.Name] = true
+	}
+	if !applyExamples(doc, "", examples, kept) {
+		return raw
+	}
+	out, err := encodeIndented(doc)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// applyExamples rewrites v in place, reporting whether anything changed.
+func applyExamples(v any, path string, examples Examples, kept map[string]bool) bool {
+	changed := false
+	example := func(name string, value any) (any, bool) {
+		if _, ok := lookupField(kept, name); ok {
+			return nil, false
+		}
+		ex, ok := examples.For(name)
+		if !ok {
+			return nil, false
+		}
+		v, ok := exampleLike(value, ex)
+		return v, ok && fmt.Sprint(v) != fmt.Sprint(value)
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		if name, value, ok := namedEntry(t); ok {
+			if ex, ok := example(name, value); ok {
+				t["value"], changed = fmt.Sprint(ex), true
+			}
+			return changed
+		}
+		for _, k := range sortedKeys(t) {
+			p := join(path, k)
+			if ex, ok := example(p, t[k]); ok {
+				t[k], changed = ex, true
+				continue
+			}
+			if applyExamples(t[k], p, examples, kept) {
+				changed = true
+			}
+		}
+	case []any:
+		for i, item := range t {
+			if applyExamples(item, fmt.Sprintf("%s[%d]", path, i), examples, kept) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// exampleLike returns ex in the JSON type of value, reporting false when
+// value is an object or list, which examples don't replace.
+func exampleLike(value any, ex string) (any, bool) {
+	switch value.(type) {
+	case map[string]any, []any:
+		return nil, false
+	case json.Number:
+		if _, err := strconv.ParseFloat(ex, 64); err == nil {
+			return json.Number(ex), true
+		}
+	case bool:
+		if b, err := strconv.ParseBool(ex); err == nil {
+			return b, true
+		}
+	}
+	return ex, true
+}
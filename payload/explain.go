@@ -0,0 +1,223 @@
+package payload
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// Field is a populated value of a payload. Name is the field name the value
+// is known by: the last segment of Path, or the name of a meta.details or
+// keyValue entry.
+type Field struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Fields lists the populated values of a JSON or XML payload in path order.
+// Name/value entries such as meta.details are reported as one field each.
+func Fields(raw string) ([]Field, error) {
+	body := strings.TrimSpace(raw)
+	if strings.HasPrefix(body, "<") {
+		var req requestmodel.Request
+		if err := xml.Unmarshal([]byte(body), &req); err != nil {
+			return nil, fmt.Errorf("payload is not valid XML: %w", err)
+		}
+		converted, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("payload could not be read: %w", err)
+		}
+		body = string(converted)
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	var fields []Field
+	collectFields(doc, "", &fields)
+	return fields, nil
+}
+
+func collectFields(v any, path string, out *[]Field) {
+	switch t := v.(type) {
+	case map[string]any:
+		if name, value, ok := namedEntry(t); ok {
+			*out = append(*out, Field{Path: path, Name: name, Value: value})
+			return
+		}
+		for _, k := range sortedKeys(t) {
+			collectFields(t[k], join(path, k), out)
+		}
+	case []any:
+		for i, item := range t {
+			collectFields(item, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	case nil:
+	default:
+		value := fmt.Sprint(t)
+		if s, ok := t.(string); ok {
+			if strings.TrimSpace(s) == "" {
+				return
+			}
+			value = s
+		}
+		*out = append(*out, Field{Path: path, Name: leaf(path), Value: value})
+	}
+}
+
+// namedEntry reports whether obj is a requestmodel.Detail: a name and a
+// value and nothing else.
+func namedEntry(obj map[string]any) (string, string, bool) {
+	if len(obj) != 2 {
+		return "", "", false
+	}
+	name, ok := obj["name"].(string)
+	if !ok || strings.TrimSpace(name) == "" {
+		return "", "", false
+	}
+	value, ok := obj["value"].(string)
+	return name, value, ok
+}
+
+var reIndex = regexp.MustCompile(`\[\d+\]`)
+
+// leaf returns the last segment of path, without any index.
+func leaf(path string) string {
+	path = reIndex.ReplaceAllString(path, "")
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// RequiredPaths returns the paths operation's rules require, in rule order.
+func RequiredPaths(operation string) []string {
+	t, ok := TemplateFor(operation)
+	if !ok {
+		return nil
+	}
+	var paths []string
+	seen := map[string]bool{}
+	for _, r := range t.Rules {
+		if !seen[r.Path] {
+			seen[r.Path] = true
+			paths = append(paths, r.Path)
+		}
+	}
+	return paths
+}
+
+// blockMeanings describe the blocks a field can sit in, by path without
+// indexes.
+var blockMeanings = map[string]string{
+	"context":                     "request context",
+	"context.meta":                "request context metadata",
+	"source":                      "sending party",
+	"source.account":              "sending party's account",
+	"destination":                 "receiving party",
+	"destination.account":         "receiving party's account",
+	"payload":                     "payload",
+	"payload.meta":                "payload metadata",
+	"payload.tokenizedAsset":      "tokenized asset",
+	"payload.tokenizedAsset.meta": "tokenized asset's metadata",
+	"payload.transaction":         "transaction",
+	"payload.transaction.data":    "transaction data",
+	"payload.identity":            "identity",
+	"payload.keyValue":            "stored key-value pair",
+}
+
+// fieldMeanings describe fields of the request model whose meaning isn't
+// plain from the name, by path without indexes.
+var fieldMeanings = map[string]string{
+	"signature":                       "Signature over the whole request.",
+	"context.requestId":               "Unique id of this request, echoed in the response and in events.",
+	"context.msgId":                   "Id of this message; retries of the same message reuse it.",
+	"context.isAsync":                 "Whether the result is delivered later as an event instead of in the response.",
+	"context.isUMICompliant":          "Whether the request follows the UMI (Unified Market Interface) specification.",
+	"context.idempotencyKey":          "Key that makes repeated submissions of the request take effect once.",
+	"context.networkId":               "DLT network the request is processed on.",
+	"context.wrapperContract":         "Contract that wraps the chaincode call.",
+	"context.contractName":            "Chaincode (smart contract) the request invokes.",
+	"context.methodName":              "Chaincode method the request invokes.",
+	"context.sender":                  "Participant sending the request.",
+	"context.receiver":                "Participant the request is addressed to.",
+	"context.timestamp":               "Time the request was created.",
+	"context.purpose":                 "Business purpose of the request.",
+	"context.prodType":                "Product type the request is about.",
+	"context.collection":              "Private data collection the data is written to.",
+	"context.type":                    "Request type; together with action it selects how the request is processed.",
+	"context.version":                 "Version of the request format.",
+	"context.subtype":                 "Request subtype, refining type.",
+	"context.action":                  "Operation to perform, e.g. create, burn or settle.",
+	"context.traceDetails":            "Tracing information passed through for diagnostics.",
+	"context.originalRequestId":       "Id of the earlier request this one refers to.",
+	"context.originalTimestamp":       "Time of the earlier request this one refers to.",
+	"context.secureToken":             "Token authorising the request.",
+	"context.status":                  "Status carried by the request, used on responses and callbacks.",
+	"context.code":                    "Result code carried by the request, used on responses and callbacks.",
+	"source.callbackUrl":              "URL the sending party receives asynchronous results on.",
+	"destination.callbackUrl":         "URL the receiving party receives asynchronous results on.",
+	"payload.type":                    "Kind of payload, e.g. tokenized_asset or keyValue.",
+	"payload.tokenizedAsset.id":       "Id of the asset on the ledger.",
+	"payload.tokenizedAsset.value":    "Value of the asset.",
+	"payload.tokenizedAsset.unit":     "Unit of the asset's value.",
+	"payload.tokenizedAsset.parentId": "Id of the asset this one was derived from.",
+	"payload.transaction.id":          "Id of the transaction.",
+	"payload.identity.entityType":     "Kind of participant, e.g. individual or organisation.",
+	"payload.identity.certificate":    "Certificate issued to the identity.",
+	"payload.identity.issuer":         "Authority that issued the identity's certificate.",
+}
+
+// fieldWords describe common field names wherever they appear; %s is the
+// block the field belongs to.
+var fieldWords = map[string]string{
+	"id":                "Id of the %s.",
+	"type":              "Type of the %s.",
+	"status":            "Status of the %s.",
+	"category":          "Category of the %s.",
+	"version":           "Version of the %s.",
+	"name":              "Name of the %s.",
+	"address":           "Address of the %s.",
+	"vpa":               "Virtual payment address of the %s.",
+	"publicKey":         "Public key of the %s.",
+	"signature":         "Signature of the %s.",
+	"creationTimestamp": "Time the %s was created.",
+}
+
+// Describe returns the built-in meaning of the field at path, or "" when
+// there is none. Detail and keyValue entries are described by where they
+// sit, since their names are free-form.
+func Describe(path string) string {
+	key := reIndex.ReplaceAllString(path, "")
+	if m, ok := fieldMeanings[key]; ok {
+		return m
+	}
+
+	block, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		block, name = key[:i], key[i+1:]
+	}
+	if name == "details" || name == "keyValue" {
+		if noun, ok := blockMeanings[block]; ok {
+			return "Custom value carried in the " + noun + "."
+		}
+		return "Custom name/value entry."
+	}
+	noun, ok := blockMeanings[block]
+	if !ok {
+		return ""
+	}
+	if w, ok := fieldWords[name]; ok {
+		return fmt.Sprintf(w, noun)
+	}
+	if base, ok := strings.CutSuffix(name, "Unit"); ok && base != "" {
+		return fmt.Sprintf("Unit of the %s's %s.", noun, base)
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package payload
+
+import (
+	"reflect"
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// Assignment records where a user-supplied value goes in the payload, so the
+// mapping can be confirmed back to the user.
+type Assignment struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Target string `json:"target"`
+}
+
+// Targets of values that don't match a struct field.
+const (
+	detailsTarget  = "tokenizedAsset.meta.details"
+	keyValueTarget = "keyValue"
+)
+
+var (
+	assetFields = stringFields(reflect.TypeOf(requestmodel.TokenizedAsset{}))
+	metaFields  = stringFields(reflect.TypeOf(requestmodel.Meta{}))
+)
+
+// stringFields indexes the string fields of t by lower-cased JSON name.
+func stringFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Type.Kind() == reflect.String && name != "" && name != "-" {
+			fields[strings.ToLower(name)] = f
+		}
+	}
+	return fields
+}
+
+// Place decides where each pair goes for operation. Key-value requests keep
+// every pair as a keyValue entry; otherwise a pair fills the matching
+// TokenizedAsset field, then the matching Meta field, and anything else
+// becomes a meta.details entry.
+func Place(operation string, pairs []Pair) []Assignment {
+	out := make([]Assignment, 0, len(pairs))
+	for _, p := range pairs {
+		out = append(out, Assignment{Name: p.Name, Value: p.Value, Target: target(operation, p.Name)})
+	}
+	return out
+}
+
+func target(operation, name string) string {
+	if operation == "store" {
+		return keyValueTarget
+	}
+	key := strings.ToLower(name)
+	if f, ok := assetFields[key]; ok {
+		return "tokenizedAsset." + jsonName(f)
+	}
+	if f, ok := metaFields[key]; ok {
+		return "tokenizedAsset.meta." + jsonName(f)
+	}
+	return detailsTarget
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// fillAsset writes pairs into asset following Place.
+func fillAsset(asset *requestmodel.TokenizedAsset, pairs []Pair) {
+	for _, p := range pairs {
+		key := strings.ToLower(p.Name)
+		if f, ok := assetFields[key]; ok {
+			reflect.ValueOf(asset).Elem().FieldByIndex(f.Index).SetString(p.Value)
+			continue
+		}
+		if asset.Meta == nil {
+			asset.Meta = &requestmodel.Meta{}
+		}
+		if f, ok := metaFields[key]; ok {
+			reflect.ValueOf(asset.Meta).Elem().FieldByIndex(f.Index).SetString(p.Value)
+			continue
+		}
+		asset.Meta.Details = append(asset.Meta.Details, requestmodel.Detail{Name: p.Name, Value: p.Value})
+	}
+}
+
+// buildTokenizedAsset places the user's values on a single tokenized asset.
+// Requested fields without a value get a placeholder.
+func buildTokenizedAsset(spec Spec) requestmodel.Request {
+	pairs := withPlaceholders(spec)
+	var asset requestmodel.TokenizedAsset
+	fillAsset(&asset, pairs)
+	return requestmodel.Request{
+		Payload: requestmodel.Payload{TokenizedAsset: &[]requestmodel.TokenizedAsset{asset}},
+	}
+}
+
+// withPlaceholders returns the spec's pairs followed by a pair for every
+// requested field the user gave no value for, valued by its documented
+// example or else from the spec's value profile.
+func withPlaceholders(spec Spec) []Pair {
+	pairs := append([]Pair(nil), spec.Pairs...)
+	seen := map[string]bool{}
+	for _, p := range spec.Pairs {
+		seen[strings.ToLower(p.Name)] = true
+	}
+	for _, f := range spec.Fields {
+		if !seen[strings.ToLower(f)] {
+			value, ok := spec.Examples.For(f)
+			if !ok {
+				value = SampleValue(spec.Profile, f, spec.Clock)
+			}
+			pairs = append(pairs, Pair{Name: f, Value: value})
+			seen[strings.ToLower(f)] = true
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,156 @@
+package payload
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the date spellings accepted from users, tried in order.
+// Slash and dash dates are read day first.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"2-1-2006",
+	"02.01.2006",
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2 2006",
+	"January 2 2006",
+}
+
+// quantityPattern splits "5 years" or "1,00,000 INR" into amount and unit.
+var quantityPattern = regexp.MustCompile(`^([-+]?\d[\d,]*(?:\.\d+)?)\s*([A-Za-z%₹$€]+)?$`)
+
+// Normalize rewrites user-supplied values into the formats payloads expect:
+// dates become timestamps in the timezone and format of c, and an amount given with its unit for a
+// field that has a unit companion ("tenure=5 yrs") is split into the value
+// and unit fields unless the unit is given separately. Units are spelled the
+// canonical way ("years") and must suit the field. Values that can't be read
+// are left out and reported.
+func Normalize(pairs []Pair, c *Clock) ([]Pair, []Problem) {
+	given := map[string]bool{}
+	for _, p := range pairs {
+		given[strings.ToLower(p.Name)] = true
+	}
+
+	var out []Pair
+	var problems []Problem
+	for _, p := range pairs {
+		switch {
+		case isDateField(p.Name):
+			ts, err := parseDate(p.Value, c)
+			if err != nil {
+				problems = append(problems, Problem{Path: p.Name, Message: fmt.Sprintf("%q is not a date; use e.g. 2026-12-31 or 31/12/2026", p.Value)})
+				continue
+			}
+			out = append(out, Pair{Name: p.Name, Value: ts})
+		case isNumericField(p.Name):
+			amount, unit, err := parseQuantity(p.Value)
+			if err != nil {
+				problems = append(problems, Problem{Path: p.Name, Message: fmt.Sprintf("%q is not a number", p.Value)})
+				continue
+			}
+			out = append(out, Pair{Name: p.Name, Value: amount})
+			unitField, ok := unitFieldFor(p.Name)
+			if !ok || unit == "" || given[strings.ToLower(unitField)] {
+				continue
+			}
+			canonical, err := canonicalUnit(p.Name, unit)
+			if err != nil {
+				problems = append(problems, Problem{Path: unitField, Message: err.Error()})
+				continue
+			}
+			out = append(out, Pair{Name: unitField, Value: canonical})
+		case isUnitField(p.Name):
+			valueField, _ := valueFieldFor(p.Name)
+			canonical, err := canonicalUnit(valueField, p.Value)
+			if err != nil {
+				problems = append(problems, Problem{Path: p.Name, Message: err.Error()})
+				continue
+			}
+			out = append(out, Pair{Name: p.Name, Value: canonical})
+		default:
+			out = append(out, p)
+		}
+	}
+	return out, problems
+}
+
+// isDateField reports whether name holds a date, judging by its name.
+func isDateField(name string) bool {
+	key := strings.ToLower(name)
+	for _, hint := range []string{"date", "timestamp", "validtill", "expiry", "maturity"} {
+		if strings.Contains(key, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnitField reports whether name is the unit companion of a value field.
+func isUnitField(name string) bool {
+	_, ok := valueFieldFor(name)
+	return ok
+}
+
+// isNumericField reports whether name holds an amount: fields with a unit
+// companion, quantities and amounts.
+func isNumericField(name string) bool {
+	if _, ok := unitFieldFor(name); ok {
+		return true
+	}
+	key := strings.ToLower(name)
+	return key == "quantity" || strings.HasSuffix(key, "amount")
+}
+
+// unitFieldFor returns the JSON name of the Meta field holding name's unit,
+// e.g. tenureUnit for tenure.
+func unitFieldFor(name string) (string, bool) {
+	f, ok := metaFields[strings.ToLower(name)+"unit"]
+	if !ok {
+		return "", false
+	}
+	return jsonName(f), true
+}
+
+// valueFieldFor returns the value field whose unit name holds, e.g. tenure
+// for tenureUnit.
+func valueFieldFor(name string) (string, bool) {
+	for value, unit := range unitPairs {
+		if strings.EqualFold(unit, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func parseDate(value string, c *Clock) (string, error) {
+	t, err := c.ParseAny(strings.Join(strings.Fields(strings.ReplaceAll(value, ",", " ")), " "))
+	if err != nil {
+		return "", err
+	}
+	return c.Format(t), nil
+}
+
+// parseQuantity splits value into a plain number, without grouping commas,
+// and an optional lower-cased unit.
+func parseQuantity(value string) (string, string, error) {
+	m := quantityPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return "", "", fmt.Errorf("not a number: %q", value)
+	}
+	amount := strings.ReplaceAll(m[1], ",", "")
+	if _, err := strconv.ParseFloat(amount, 64); err != nil {
+		return "", "", fmt.Errorf("not a number: %q", value)
+	}
+	return amount, strings.ToLower(m[2]), nil
+}
@@ -0,0 +1,192 @@
+package payload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Limits bound the payloads shown in chat. Zero turns a limit off.
+type Limits struct {
+	MaxBytes int
+	MaxDepth int
+	// PreviewItems is how many entries of each list a preview keeps.
+	PreviewItems int
+}
+
+// Preview is a payload cut down to fit the limits.
+type Preview struct {
+	Text string
+	// Reason says which limit the full payload broke, e.g.
+	// "312.4 KiB, over the 64 KiB limit".
+	Reason string
+}
+
+// Summarize returns a preview of raw when it breaks a limit, and false when
+// it fits. Lists keep their first entries and note how many were left out,
+// levels below the depth limit are collapsed, and a preview still over the
+// size limit is cut at a line break. JSON and XML are summarized by
+// structure; anything else is only cut.
+func Summarize(raw string, l Limits) (Preview, bool) {
+	body := strings.TrimSpace(raw)
+	var reason string
+	switch depth := depthOf(body); {
+	case l.MaxBytes > 0 && len(body) > l.MaxBytes:
+		reason = fmt.Sprintf("%s, over the %s limit", byteSize(len(body)), byteSize(l.MaxBytes))
+	case l.MaxDepth > 0 && depth > l.MaxDepth:
+		reason = fmt.Sprintf("nested %d levels deep, over the limit of %d", depth, l.MaxDepth)
+	default:
+		return Preview{}, false
+	}
+
+	text := body
+	if strings.HasPrefix(body, "<") {
+		if root, err := parseXML([]byte(body)); err == nil {
+			root.summarize(l, 1)
+			var b strings.Builder
+			root.write(&b, 0)
+			text = strings.TrimSpace(b.String())
+		}
+	} else if doc, ok := decodeAny(body); ok {
+		if out, err := encodeIndented(summarizeJSON(doc, l, 1)); err == nil {
+			text = out
+		}
+	}
+	if l.MaxBytes > 0 && len(text) > l.MaxBytes {
+		text = cutAtLine(text, l.MaxBytes)
+	}
+	return Preview{Text: text, Reason: reason}, true
+}
+
+func decodeAny(body string) (any, bool) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// depthOf counts the nesting levels of a JSON or XML payload; the root
+// object or element is level 1. Payloads that can't be read count as 0.
+func depthOf(body string) int {
+	if strings.HasPrefix(body, "<") {
+		root, err := parseXML([]byte(body))
+		if err != nil {
+			return 0
+		}
+		return root.depth()
+	}
+	doc, ok := decodeAny(body)
+	if !ok {
+		return 0
+	}
+	return jsonDepth(doc)
+}
+
+func jsonDepth(v any) int {
+	deepest := 0
+	switch t := v.(type) {
+	case map[string]any:
+		for _, child := range t {
+			deepest = max(deepest, jsonDepth(child))
+		}
+	case []any:
+		for _, child := range t {
+			deepest = max(deepest, jsonDepth(child))
+		}
+	default:
+		return 0
+	}
+	return deepest + 1
+}
+
+// summarizeJSON shortens lists to l.PreviewItems entries and collapses
+// objects and lists below l.MaxDepth into a note of what was left out.
+func summarizeJSON(v any, l Limits, depth int) any {
+	switch t := v.(type) {
+	case map[string]any:
+		if l.MaxDepth > 0 && depth > l.MaxDepth {
+			return "… " + count(len(t), "field") + " omitted"
+		}
+		for k, child := range t {
+			t[k] = summarizeJSON(child, l, depth+1)
+		}
+	case []any:
+		if l.MaxDepth > 0 && depth > l.MaxDepth {
+			return "… " + count(len(t), "item") + " omitted"
+		}
+		kept := t
+		if len(t) > l.PreviewItems {
+			kept = t[:l.PreviewItems]
+		}
+		out := make([]any, 0, len(kept)+1)
+		for _, child := range kept {
+			out = append(out, summarizeJSON(child, l, depth+1))
+		}
+		if n := len(t) - len(kept); n > 0 {
+			out = append(out, "… "+count(n, "more item")+" omitted")
+		}
+		return out
+	}
+	return v
+}
+
+func (n *xmlNode) depth() int {
+	deepest := 0
+	for _, c := range n.children {
+		deepest = max(deepest, c.depth())
+	}
+	return deepest + 1
+}
+
+// summarize keeps the first l.PreviewItems children of each name and drops
+// the children of elements below l.MaxDepth, counting what it left out.
+func (n *xmlNode) summarize(l Limits, depth int) {
+	if l.MaxDepth > 0 && depth >= l.MaxDepth {
+		n.omitted += len(n.children)
+		n.children = nil
+		return
+	}
+	seen := map[string]int{}
+	kept := n.children[:0]
+	for _, c := range n.children {
+		seen[c.name]++
+		if seen[c.name] > l.PreviewItems {
+			n.omitted++
+			continue
+		}
+		c.summarize(l, depth+1)
+		kept = append(kept, c)
+	}
+	n.children = kept
+}
+
+// count renders n of noun, e.g. "1 field" or "3 fields".
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// cutAtLine cuts text to at most limit bytes at a line break and says so.
+func cutAtLine(text string, limit int) string {
+	cut := text[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "\n… preview cut at " + byteSize(limit)
+}
+
+// byteSize renders n bytes for people, e.g. "64 KiB" or "1.5 MiB".
+func byteSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/(1<<20)), ".0") + " MiB"
+	case n >= 1<<10:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/(1<<10)), ".0") + " KiB"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
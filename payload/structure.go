@@ -0,0 +1,195 @@
+package payload
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// Payload formats.
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+)
+
+// Report is the outcome of checking a payload that wasn't generated here.
+// Structure lists where it departs from the request model; Rules lists the
+// operation rules and unit checks it fails.
+type Report struct {
+	Format    string    `json:"format"`
+	Operation string    `json:"operation,omitempty"`
+	Structure []Problem `json:"structure"`
+	Rules     []Problem `json:"rules"`
+}
+
+// Valid reports whether the payload passed every check.
+func (r Report) Valid() bool {
+	return len(r.Structure) == 0 && len(r.Rules) == 0
+}
+
+// Problems returns the structure and rule problems together.
+func (r Report) Problems() []Problem {
+	return append(append([]Problem(nil), r.Structure...), r.Rules...)
+}
+
+var requestType = reflect.TypeOf(requestmodel.Request{})
+
+// MetaField is the top-level JSON field in which a watermarked payload
+// carries how it was generated. It isn't part of the request model, and
+// Check and Convert ignore it.
+const MetaField = "_meta"
+
+// withoutMeta returns a JSON object payload without its MetaField, and any
+// other payload unchanged.
+func withoutMeta(body string) string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &obj); err != nil {
+		return body
+	}
+	if _, ok := obj[MetaField]; !ok {
+		return body
+	}
+	delete(obj, MetaField)
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return body
+	}
+	return string(out)
+}
+
+// Check validates a JSON or XML payload against the request model and the
+// rules of operation. An empty operation is taken from context.action. XML
+// payloads are checked by their JSON equivalent, so elements the model
+// doesn't know are ignored rather than reported. A watermark, the MetaField
+// of JSON or a comment in XML, is ignored too. Timestamps are checked
+// against the format of c.
+func Check(raw, operation string, c *Clock) Report {
+	body := withoutMeta(strings.TrimSpace(raw))
+	report := Report{Format: FormatJSON, Structure: []Problem{}, Rules: []Problem{}}
+
+	var req requestmodel.Request
+	if strings.HasPrefix(body, "<") {
+		report.Format = FormatXML
+		if err := xml.Unmarshal([]byte(body), &req); err != nil {
+			report.Structure = append(report.Structure, Problem{Message: "payload is not valid XML: " + err.Error()})
+			return report
+		}
+		converted, err := json.Marshal(req)
+		if err != nil {
+			report.Structure = append(report.Structure, Problem{Message: "payload could not be read: " + err.Error()})
+			return report
+		}
+		body = string(converted)
+	} else {
+		var doc any
+		if err := json.Unmarshal([]byte(body), &doc); err != nil {
+			report.Structure = append(report.Structure, Problem{Message: "payload is not valid JSON: " + err.Error()})
+			return report
+		}
+		report.Structure = append(report.Structure, shapeProblems(doc, requestType, "")...)
+		// Best effort: a payload with type errors still yields its action
+		_ = json.Unmarshal([]byte(body), &req)
+	}
+
+	if operation == "" {
+		operation = OperationForAction(req.Context.Action)
+	}
+	report.Operation = strings.ToLower(strings.TrimSpace(operation))
+	report.Rules = append(report.Rules, Validate(report.Operation, body, c)...)
+	return report
+}
+
+// OperationForAction maps a payload's context.action to the operation whose
+// rules apply to it.
+func OperationForAction(action string) string {
+	switch action = strings.ToLower(strings.TrimSpace(action)); action {
+	case "settle":
+		return "trade"
+	case "manage":
+		return "burn"
+	default:
+		return action
+	}
+}
+
+// shapeProblems compares a decoded JSON value with the Go type it should
+// decode into, reporting unknown fields and values of the wrong kind.
+func shapeProblems(v any, t reflect.Type, path string) []Problem {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v == nil {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []Problem{{Path: path, Message: "must be an object"}}
+		}
+		fields := jsonFields(t)
+		var problems []Problem
+		for _, key := range sortedKeys(obj) {
+			f, ok := fields[key]
+			if !ok {
+				problems = append(problems, Problem{Path: join(path, key), Message: "is not a field of the request model"})
+				continue
+			}
+			problems = append(problems, shapeProblems(obj[key], f.Type, join(path, key))...)
+		}
+		return problems
+	case reflect.Slice:
+		items, ok := v.([]any)
+		if !ok {
+			return []Problem{{Path: path, Message: "must be an array"}}
+		}
+		var problems []Problem
+		for i, item := range items {
+			problems = append(problems, shapeProblems(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return []Problem{{Path: path, Message: "must be a string"}}
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return []Problem{{Path: path, Message: "must be true or false"}}
+		}
+	}
+	return nil
+}
+
+// jsonFields indexes the fields of t by their JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := jsonName(f); name != "" && name != "-" {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,135 @@
+// Package payload holds the operation-specific shape of generated request
+// payloads: the templates fed to the generation prompt and the rules a
+// generated payload is checked against.
+package payload
+
+import (
+	"strings"
+
+	"api-recommender/requestmodel"
+)
+
+// Template describes the payload an operation needs.
+type Template struct {
+	Operation string
+	// Instructions are added to the payload generation prompt.
+	Instructions string
+	// Skeleton is an example payload showing every required block.
+	Skeleton string
+	Rules    []Rule
+	// Build, when set, produces the payload deterministically so the model
+	// is not asked to generate it.
+	Build func(Spec) requestmodel.Request
+}
+
+// Rule is one structural requirement of a payload. Check receives the decoded
+// JSON payload and reports whether the requirement holds.
+type Rule struct {
+	Path    string
+	Message string
+	Check   func(doc map[string]any) bool
+}
+
+var templates = map[string]Template{
+	"burn": {
+		Operation: "burn",
+		Instructions: `Burn/manage acts on an asset that already exists on the ledger, so the payload needs
+"payload.tokenizedAsset" with the "id" of that asset. Use the asset id the user gave; never invent one.`,
+		Skeleton: `{
+  "context": { "requestId": "...", "action": "burn" },
+  "payload": {
+    "tokenizedAsset": [ { "id": "<existing asset id>" } ]
+  }
+}`,
+		Rules: []Rule{
+			{Path: "payload.tokenizedAsset", Message: "burn payloads must name the asset being burnt by id", Check: blockHasIDs("payload", "tokenizedAsset")},
+		},
+	},
+	"register": {
+		Operation: "register",
+		Instructions: `Identity onboarding registers a participant, so the payload carries "payload.identity" rather than
+"payload.tokenizedAsset". Each identity needs an "id", a "type" and an "entityType" (for example "individual" or
+"organisation"); put aliases such as "alias", "organisationAlias" and "networkAlias" on the identity itself.
+Do not include tokenizedAsset or transaction blocks.`,
+		Skeleton: `{
+  "context": { "requestId": "...", "action": "register" },
+  "payload": {
+    "identity": [ { "id": "...", "type": "...", "entityType": "...", "alias": "..." } ]
+  }
+}`,
+		Rules: []Rule{
+			{Path: "payload.identity", Message: "identity registration needs at least one identity with an id", Check: blockHasIDs("payload", "identity")},
+			{Path: "payload.identity", Message: "registered identities need an entityType", Check: everyHas([]string{"payload", "identity"}, "entityType")},
+		},
+	},
+	"certify": {
+		Operation: "certify",
+		Instructions: `Issuing a certificate attaches it to an identity that is already registered, so the payload carries
+"payload.identity" with the identity's "id", the "certificate" and the "issuer". Do not include tokenizedAsset or
+transaction blocks.`,
+		Skeleton: `{
+  "context": { "requestId": "...", "action": "certify" },
+  "payload": {
+    "identity": [ { "id": "...", "certificate": "...", "issuer": "..." } ]
+  }
+}`,
+		Rules: []Rule{
+			{Path: "payload.identity", Message: "certificates must be issued to an identity with an id", Check: blockHasIDs("payload", "identity")},
+			{Path: "payload.identity", Message: "certificate issuance needs the certificate and its issuer", Check: everyHas([]string{"payload", "identity"}, "certificate", "issuer")},
+		},
+	},
+	"store": {
+		Operation: "store",
+		Instructions: `Storing generic values on chain uses "payload.keyValue": one {"name", "value"} entry per value the
+user gave, with "payload.type" set to "keyValue". Do not wrap the values in tokenizedAsset or meta.details.`,
+		Skeleton: `{
+  "context": { "requestId": "..." },
+  "payload": {
+    "type": "keyValue",
+    "keyValue": [ { "name": "...", "value": "..." } ]
+  }
+}`,
+		Rules: []Rule{
+			{Path: "payload.keyValue", Message: "key-value payloads need at least one named entry", Check: everyHas([]string{"payload", "keyValue"}, "name")},
+		},
+		Build: buildKeyValue,
+	},
+	"trade": {
+		Operation: "trade",
+		Instructions: `Trade/settle transfers an asset from one organization to another, so the payload ALWAYS needs:
+- a "source" block with at least one business identifier carrying an "id" (the seller / sending organization)
+- a "destination" block with at least one business identifier carrying an "id" (the buyer / receiving organization)
+- a "payload.transaction" block with at least one transaction carrying an "id", "type" and "status"
+- the traded asset in "payload.tokenizedAsset" with its "id"
+Source and destination must identify different parties. These blocks are required for trades whether the data is private or public.`,
+		Skeleton: `{
+  "context": { "requestId": "...", "action": "settle" },
+  "source": [ { "id": "...", "type": "..." } ],
+  "destination": [ { "id": "...", "type": "..." } ],
+  "payload": {
+    "tokenizedAsset": [ { "id": "..." } ],
+    "transaction": [ { "id": "...", "type": "...", "status": "..." } ]
+  }
+}`,
+		Rules: []Rule{
+			{Path: "source", Message: "trade payloads need at least one source identifier with an id", Check: blockHasIDs("source")},
+			{Path: "destination", Message: "trade payloads need at least one destination identifier with an id", Check: blockHasIDs("destination")},
+			{Path: "destination", Message: "source and destination must identify different parties", Check: partiesDiffer},
+			{Path: "payload.transaction", Message: "trade payloads need at least one transaction with an id", Check: blockHasIDs("payload", "transaction")},
+			{Path: "payload.tokenizedAsset", Message: "trade payloads must name the traded asset by id", Check: blockHasIDs("payload", "tokenizedAsset")},
+		},
+	},
+}
+
+// TemplateFor returns the template for operation, if one is defined.
+func TemplateFor(operation string) (Template, bool) {
+	t, ok := templates[strings.ToLower(strings.TrimSpace(operation))]
+	return t, ok
+}
+
+// PromptSection renders the template as a section of the generation prompt.
+func (t Template) PromptSection() string {
+	return "\n\n### OPERATION TEMPLATE: " + strings.ToUpper(t.Operation) +
+		" (overrides the general rules below where they conflict)\n" +
+		t.Instructions + "\n\nRequired shape:\n" + t.Skeleton
+}
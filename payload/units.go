@@ -0,0 +1,214 @@
+package payload
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// unitKind groups the units a value/unit field pair accepts.
+type unitKind int
+
+const (
+	durationUnit unitKind = iota + 1
+	rateUnit
+	moneyUnit
+)
+
+type unit struct {
+	canonical string
+	kind      unitKind
+}
+
+// unitAliases maps the spellings users write to the unit stored in payloads.
+var unitAliases = map[string]unit{
+	"d": {"days", durationUnit}, "day": {"days", durationUnit}, "days": {"days", durationUnit},
+	"w": {"weeks", durationUnit}, "wk": {"weeks", durationUnit}, "week": {"weeks", durationUnit}, "weeks": {"weeks", durationUnit},
+	"m": {"months", durationUnit}, "mo": {"months", durationUnit}, "month": {"months", durationUnit}, "months": {"months", durationUnit},
+	"y": {"years", durationUnit}, "yr": {"years", durationUnit}, "yrs": {"years", durationUnit}, "year": {"years", durationUnit}, "years": {"years", durationUnit},
+	"%": {"percent", rateUnit}, "pct": {"percent", rateUnit}, "percent": {"percent", rateUnit}, "percentage": {"percent", rateUnit},
+	"inr": {"INR", moneyUnit}, "rs": {"INR", moneyUnit}, "rupees": {"INR", moneyUnit}, "₹": {"INR", moneyUnit},
+	"usd": {"USD", moneyUnit}, "$": {"USD", moneyUnit}, "dollars": {"USD", moneyUnit},
+	"eur": {"EUR", moneyUnit}, "€": {"EUR", moneyUnit},
+}
+
+// unitKinds lists the kinds of unit each value field with a unit companion
+// accepts. Fees may be a rate or a flat amount.
+var unitKinds = map[string][]unitKind{
+	"tenure":                 {durationUnit},
+	"interval":               {durationUnit},
+	"interest":               {rateUnit},
+	"tdsfee":                 {rateUnit, moneyUnit},
+	"prematurewithdrawalfee": {rateUnit, moneyUnit},
+	"switchfee":              {rateUnit, moneyUnit},
+	"interestaccrued":        {moneyUnit},
+	"interestpaid":           {moneyUnit},
+	"payoutamount":           {moneyUnit},
+}
+
+// canonicalUnit resolves a unit written by the user for the value field name,
+// e.g. "yrs" for tenure becomes "years".
+func canonicalUnit(name, written string) (string, error) {
+	u, ok := unitAliases[strings.ToLower(strings.TrimSpace(written))]
+	allowed := unitKinds[strings.ToLower(name)]
+	if ok && (len(allowed) == 0 || hasKind(allowed, u.kind)) {
+		return u.canonical, nil
+	}
+	return "", fmt.Errorf("%q is not a unit for %s; use %s", written, name, strings.Join(unitsFor(allowed), ", "))
+}
+
+func knownUnit(written string) bool {
+	_, ok := unitAliases[strings.ToLower(written)]
+	return ok
+}
+
+func hasKind(kinds []unitKind, k unitKind) bool {
+	for _, kind := range kinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// unitsFor lists the canonical units of the given kinds, or of every kind
+// when none are given.
+func unitsFor(kinds []unitKind) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, u := range unitAliases {
+		if !seen[u.canonical] && (len(kinds) == 0 || hasKind(kinds, u.kind)) {
+			seen[u.canonical] = true
+			out = append(out, u.canonical)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// unitPairs maps each value field with a unit companion to the companion's
+// JSON name, keyed by the value field's JSON name.
+var unitPairs = func() map[string]string {
+	pairs := map[string]string{}
+	for key, f := range metaFields {
+		if strings.HasSuffix(key, "unit") {
+			if value, ok := metaFields[strings.TrimSuffix(key, "unit")]; ok {
+				pairs[jsonName(value)] = jsonName(f)
+			}
+		}
+	}
+	return pairs
+}()
+
+// phrasePatterns match a value field written out in prose followed by an
+// amount and unit, e.g. "interest 7.5%", "tenure of 5 years" or
+// "switch fee: 1 %".
+var phrasePatterns = func() map[string]*regexp.Regexp {
+	patterns := map[string]*regexp.Regexp{}
+	for name := range unitPairs {
+		words := strings.Join(splitCamel(name), `[\s_-]*`)
+		patterns[name] = regexp.MustCompile(`(?i)\b` + words + `\s*(?:of|is|at|:)?\s*([-+]?\d[\d,]*(?:\.\d+)?\s*(?:%|[₹$€]|[a-z]+\b))`)
+	}
+	return patterns
+}()
+
+// splitCamel splits a camelCase name into its words.
+func splitCamel(name string) []string {
+	var words []string
+	start := 0
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			words = append(words, name[start:i])
+			start = i
+		}
+	}
+	return append(words, name[start:])
+}
+
+// ParseUnitPhrases finds value fields with a unit written in prose, such as
+// "interest 7.5%", and returns them as pairs whose value keeps the unit for
+// Normalize to split. Fields given as key=value pairs are skipped.
+func ParseUnitPhrases(text string, given []Pair) []Pair {
+	skip := map[string]bool{}
+	for _, p := range given {
+		skip[strings.ToLower(p.Name)] = true
+	}
+
+	names := make([]string, 0, len(phrasePatterns))
+	for name := range phrasePatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []Pair
+	for _, name := range names {
+		if skip[strings.ToLower(name)] {
+			continue
+		}
+		m := phrasePatterns[name].FindAllStringSubmatch(text, -1)
+		if len(m) == 0 {
+			continue
+		}
+		value := m[len(m)-1][1]
+		// "tenure 5 and ..." has no unit
+		if _, written, _ := parseQuantity(value); !knownUnit(written) {
+			continue
+		}
+		pairs = append(pairs, Pair{Name: name, Value: value})
+	}
+	return pairs
+}
+
+// unitProblems checks that every value field with a unit companion in a
+// decoded payload's meta blocks is given together with a valid unit.
+func unitProblems(doc map[string]any) []Problem {
+	var problems []Problem
+	check := func(path string, meta map[string]any) {
+		names := make([]string, 0, len(unitPairs))
+		for name := range unitPairs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			unitName := unitPairs[name]
+			value, hasValue := nonEmpty(meta[name])
+			written, hasUnit := nonEmpty(meta[unitName])
+			switch {
+			case hasValue && !hasUnit:
+				problems = append(problems, Problem{Path: path + "." + unitName, Message: fmt.Sprintf("%s %s needs a %s", name, value, unitName)})
+			case hasUnit && !hasValue:
+				problems = append(problems, Problem{Path: path + "." + name, Message: fmt.Sprintf("%s is set without %s", unitName, name)})
+			case hasUnit:
+				if _, err := canonicalUnit(name, written); err != nil {
+					problems = append(problems, Problem{Path: path + "." + unitName, Message: err.Error()})
+				}
+			}
+		}
+	}
+
+	for i, asset := range objects(doc, "payload", "tokenizedAsset") {
+		if meta, ok := asset["meta"].(map[string]any); ok {
+			check(fmt.Sprintf("payload.tokenizedAsset[%d].meta", i), meta)
+		}
+	}
+	if body, ok := doc["payload"].(map[string]any); ok {
+		if meta, ok := body["meta"].(map[string]any); ok {
+			check("payload.meta", meta)
+		}
+	}
+	return problems
+}
+
+// nonEmpty returns v as a string when it is a non-blank string or a number.
+func nonEmpty(v any) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, strings.TrimSpace(t) != ""
+	case float64:
+		return fmt.Sprint(t), true
+	}
+	return "", false
+}
@@ -0,0 +1,107 @@
+package payload
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Problem is a rule a generated payload does not satisfy.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validate checks a generated payload against the template for operation and
+// checks that value fields with a unit companion come with a valid unit and
+// that timestamps are in the format of c. XML payloads are not checked.
+func Validate(operation, raw string, c *Clock) []Problem {
+	body := strings.TrimSpace(raw)
+	start, end := strings.Index(body, "{"), strings.LastIndex(body, "}")
+	if strings.HasPrefix(body, "<") || start < 0 || end < start {
+		return nil
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(body[start:end+1]), &doc); err != nil {
+		return []Problem{{Message: "payload is not valid JSON: " + err.Error()}}
+	}
+
+	var problems []Problem
+	if t, ok := TemplateFor(operation); ok {
+		for _, r := range t.Rules {
+			if !r.Check(doc) {
+				problems = append(problems, Problem{Path: r.Path, Message: r.Message})
+			}
+		}
+	}
+	problems = append(problems, unitProblems(doc)...)
+	return append(problems, timestampProblems(doc, c)...)
+}
+
+// objects returns the array of objects found at path.
+func objects(doc map[string]any, path ...string) []map[string]any {
+	var cur any = doc
+	for _, key := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+
+	items, _ := cur.([]any)
+	var out []map[string]any
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func id(obj map[string]any) string {
+	s, _ := obj["id"].(string)
+	return strings.TrimSpace(s)
+}
+
+// blockHasIDs requires a non-empty array at path whose entries all have an id.
+func blockHasIDs(path ...string) func(map[string]any) bool {
+	return func(doc map[string]any) bool {
+		items := objects(doc, path...)
+		for _, item := range items {
+			if id(item) == "" {
+				return false
+			}
+		}
+		return len(items) > 0
+	}
+}
+
+// everyHas requires a non-empty array at path whose entries all set keys.
+func everyHas(path []string, keys ...string) func(map[string]any) bool {
+	return func(doc map[string]any) bool {
+		items := objects(doc, path...)
+		for _, item := range items {
+			for _, k := range keys {
+				if v, _ := item[k].(string); strings.TrimSpace(v) == "" {
+					return false
+				}
+			}
+		}
+		return len(items) > 0
+	}
+}
+
+// partiesDiffer rejects payloads whose source and destination share an id.
+func partiesDiffer(doc map[string]any) bool {
+	sources := map[string]bool{}
+	for _, s := range objects(doc, "source") {
+		sources[id(s)] = true
+	}
+	for _, d := range objects(doc, "destination") {
+		if d := id(d); d != "" && sources[d] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package payload
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Value profiles select the dummy values filled in for requested fields the
+// user gave no value for.
+const (
+	// ProfileMinimal labels each value with its field, e.g. "sample-purity".
+	ProfileMinimal = "minimal"
+	// ProfileRealisticIndia uses values that look real for an Indian
+	// deployment: Indian names, VPAs such as name@okhdfcbank, timestamps and
+	// amounts of a plausible size in INR.
+	ProfileRealisticIndia = "realistic-india"
+	// ProfileStressTest uses values at the edges: long strings with
+	// characters that need escaping, the largest amounts and far-off dates.
+	ProfileStressTest = "stress-test"
+)
+
+// Profiles lists the value profiles.
+func Profiles() []string {
+	return []string{ProfileMinimal, ProfileRealisticIndia, ProfileStressTest}
+}
+
+// ValidProfile reports whether name is a value profile. Empty means minimal.
+func ValidProfile(name string) bool {
+	switch name {
+	case "", ProfileMinimal, ProfileRealisticIndia, ProfileStressTest:
+		return true
+	}
+	return false
+}
+
+// SampleValue returns the dummy value of field under profile. Values are
+// derived from the field name and, for dates, c, so a request always gets
+// the same payload under a fixed clock.
+func SampleValue(profile, field string, c *Clock) string {
+	switch profile {
+	case ProfileRealisticIndia:
+		return realisticValue(field, c)
+	case ProfileStressTest:
+		return stressValue(field, c)
+	}
+	return "sample-" + field
+}
+
+var (
+	firstNames = []string{"Aarav", "Diya", "Vihaan", "Ananya", "Arjun", "Ishita", "Kabir", "Meera", "Rohan", "Saanvi"}
+	lastNames  = []string{"Sharma", "Iyer", "Patel", "Reddy", "Gupta", "Nair", "Singh", "Mukherjee", "Desai", "Menon"}
+	vpaHandles = []string{"okhdfcbank", "okicici", "oksbi", "okaxis", "ybl", "paytm"}
+	amounts    = []string{"25000", "50000", "100000", "250000", "500000"}
+)
+
+// fieldKind sorts a field by what its name says it holds.
+type fieldKind int
+
+const (
+	kindText fieldKind = iota
+	kindName
+	kindVPA
+	kindAddress
+	kindID
+	kindDate
+	kindAmount
+	kindQuantity
+	kindRate
+	kindDuration
+	kindUnit
+)
+
+func kindOf(field string) fieldKind {
+	key := strings.ToLower(field)
+	switch {
+	case isUnitField(field):
+		return kindUnit
+	case strings.HasSuffix(key, "vpa"):
+		return kindVPA
+	case strings.Contains(key, "address"):
+		return kindAddress
+	case isDateField(field):
+		return kindDate
+	case key == "id" || strings.HasSuffix(field, "Id") || strings.HasSuffix(field, "ID") || strings.HasSuffix(key, "number"):
+		return kindID
+	case strings.HasSuffix(key, "name") || key == "nominee":
+		return kindName
+	case key == "quantity" || key == "units":
+		return kindQuantity
+	case key == "interest" || strings.Contains(key, "rate") || key == "purity":
+		return kindRate
+	case key == "tenure" || key == "interval":
+		return kindDuration
+	case isNumericField(field) || strings.Contains(key, "principal") || strings.Contains(key, "price") ||
+		strings.Contains(key, "premium") || strings.Contains(key, "value") || strings.Contains(key, "fee"):
+		return kindAmount
+	}
+	return kindText
+}
+
+// pick chooses from options by field, the same one every time.
+func pick(field, salt string, options []string) string {
+	return options[digest(field, salt)%uint64(len(options))]
+}
+
+func digest(field, salt string) uint64 {
+	sum := sha256.Sum256([]byte(salt + ":" + field))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func hexOf(field string, n int) string {
+	sum := sha256.Sum256([]byte("hex:" + field))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+func realisticValue(field string, c *Clock) string {
+	first, last := pick(field, "first", firstNames), pick(field, "last", lastNames)
+	switch kindOf(field) {
+	case kindUnit:
+		valueField, _ := valueFieldFor(field)
+		switch kindOf(valueField) {
+		case kindDuration:
+			return "years"
+		case kindRate:
+			return "percent"
+		}
+		return "INR"
+	case kindVPA:
+		return strings.ToLower(first+"."+last) + "@" + pick(field, "handle", vpaHandles)
+	case kindAddress:
+		return "0x" + hexOf(field, 40)
+	case kindDate:
+		key := strings.ToLower(field)
+		if strings.Contains(key, "maturity") || strings.Contains(key, "expiry") || strings.Contains(key, "validtill") {
+			return c.Format(c.Now().AddDate(1, 0, 0))
+		}
+		return c.Timestamp()
+	case kindID:
+		h := hexOf(field, 32)
+		return fmt.Sprintf("%s-%s-%s-%s-%s", h[:8], h[8:12], h[12:16], h[16:20], h[20:])
+	case kindName:
+		return first + " " + last
+	case kindQuantity:
+		return fmt.Sprint(1 + digest(field, "qty")%100)
+	case kindRate:
+		if strings.ToLower(field) == "purity" {
+			return "24k"
+		}
+		return pick(field, "rate", []string{"6.5", "7.1", "7.25", "7.5"})
+	case kindDuration:
+		return pick(field, "tenure", []string{"1", "3", "5"})
+	case kindAmount:
+		return pick(field, "amount", amounts)
+	}
+	return fmt.Sprintf("%s-%04d", field, digest(field, "text")%10000)
+}
+
+// stressText repeats characters that trip up escaping and encodings.
+const stressText = `Ünïcødé ✓ "quoted" <tag> & 'apos' \ back\slash `
+
+func stressValue(field string, c *Clock) string {
+	switch kindOf(field) {
+	case kindUnit:
+		return SampleValue(ProfileRealisticIndia, field, c)
+	case kindVPA:
+		return strings.Repeat("a", 64) + "@" + strings.Repeat("b", 32)
+	case kindAddress:
+		return "0x" + strings.Repeat("f", 40)
+	case kindDate:
+		return c.Format(c.Now().AddDate(99, 0, 0))
+	case kindID:
+		return strings.Repeat(hexOf(field, 64), 2)
+	case kindQuantity:
+		return "2147483647"
+	case kindRate:
+		return "99.99"
+	case kindDuration:
+		return "999"
+	case kindAmount:
+		return "999999999999.99"
+	}
+	text := field + " " + strings.Repeat(stressText, 6)
+	return strings.TrimSpace(text)
+}
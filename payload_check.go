@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/payload"
+	"api-recommender/xsd"
+)
+
+// convertResponse is the outcome of POST /api/v1/convert.
+type convertResponse struct {
+	payload.Converted
+	// Artifact is where the converted payload can be downloaded.
+	Artifact ArtifactLink `json:"artifact"`
+}
+
+// validateResponse is the outcome of POST /api/v1/validate.
+type validateResponse struct {
+	Valid bool `json:"valid"`
+	payload.Report
+	// Schema lists where an XML payload breaks the configured XSD files.
+	Schema []xsd.Violation `json:"schema,omitempty"`
+}
+
+// readPayloadBody reads a raw payload sent as the request body, recording
+// a missing or oversized body on v.
+func readPayloadBody(w http.ResponseWriter, r *http.Request, v *requestValidator) string {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	body, err := io.ReadAll(r.Body)
+
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		v.add("body", "must be at most %d bytes", sizeErr.Limit)
+	case err != nil:
+		v.add("body", "could not be read: %v", err)
+	case strings.TrimSpace(string(body)) == "":
+		v.add("body", "is required")
+	}
+	return string(body)
+}
+
+// handleValidate checks a JSON or XML payload sent as the request body
+// against the request model and the operation's rules, and an XML one
+// against the XSD files when configured. The operation comes from
+// ?operation= or else the payload's context.action. It needs no session.
+func (s *server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	v := &requestValidator{}
+	body := readPayloadBody(w, r, v)
+	operation := strings.TrimSpace(r.URL.Query().Get("operation"))
+	v.text("operation", operation, false, 64)
+	if v.failed(w, r) {
+		return
+	}
+
+	report := payload.Check(body, operation, s.service.clock)
+	res := validateResponse{Valid: report.Valid(), Report: report}
+	if s.service.schema != nil && strings.HasPrefix(strings.TrimSpace(body), "<") {
+		// Structure problems already cover XML that doesn't parse, and
+		// payloads for APIs without a schema aren't checked
+		res.Schema, _ = s.service.schema.Validate([]byte(body))
+		res.Valid = res.Valid && len(res.Schema) == 0
+	}
+	writeJSON(w, res)
+}
+
+// handleConvert converts a JSON payload sent as the request body to XML or
+// an XML one to JSON, copying values through the request model instead of
+// asking the model to rewrite them. ?to= picks the output format. The XML
+// root element is ?root=, else the one configured for the API named by
+// ?api=, else the root of an XML body. Its namespace is the API's, else
+// the catalog's.
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	v := &requestValidator{}
+	body := readPayloadBody(w, r, v)
+	q := r.URL.Query()
+	to := strings.ToLower(strings.TrimSpace(q.Get("to")))
+	if to != "" {
+		v.oneOf("to", to, payload.FormatJSON, payload.FormatXML)
+	}
+	name := strings.TrimSpace(q.Get("root"))
+	v.text("root", name, false, 64)
+	ref := strings.TrimSpace(q.Get("api"))
+	v.text("api", ref, false, 200)
+	ctx, err := s.tenantContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	xmlConfig := s.service.cfg.XML
+	root := payload.XMLRoot(xmlConfig.For("", ""))
+	if ref != "" {
+		if api, ok := apiparser.Find(s.service.catalog(ctx), ref); !ok {
+			v.add("api", "is not in the API catalog")
+		} else {
+			root = payload.XMLRoot(xmlConfig.For(api.Name, api.Path))
+		}
+	}
+	if name != "" {
+		root.Name = name
+	}
+	if v.failed(w, r) {
+		return
+	}
+
+	converted, err := payload.Convert(body, to, root)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	artifact, err := s.service.storeArtifact(r.Context(), "", ArtifactConverted, converted.Payload, nil)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, convertResponse{Converted: converted, Artifact: artifact})
+}
@@ -0,0 +1,84 @@
+package pdf
+
+// Fonts a document is set in. They are three of the standard 14 fonts
+// every PDF reader has, so nothing is embedded.
+const (
+	Regular = iota
+	Bold
+	Mono
+)
+
+// fontNames are the base fonts, indexed by font, and resourceNames the
+// names the page content refers to them by.
+var (
+	fontNames     = [...]string{"Helvetica", "Helvetica-Bold", "Courier"}
+	resourceNames = [...]string{"F1", "F2", "F3"}
+)
+
+// helveticaWidths and helveticaBoldWidths are the advance widths of the
+// printable ASCII characters from space on, in thousandths of the font
+// size, from the fonts' AFM metrics. Courier is 600 throughout.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsi maps the characters outside ASCII that WinAnsiEncoding has to
+// their codes. Latin-1 letters keep their own code.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// encode converts s to WinAnsiEncoding. Characters the encoding lacks
+// become '?', and tabs four spaces.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, "    "...)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsi[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// width is how wide the encoded text is in font at size, in points.
+func width(text []byte, font int, size float64) float64 {
+	total := 0
+	for _, c := range text {
+		switch {
+		case font == Mono:
+			total += 600
+		case c < 0x20 || c > 0x7e:
+			// Accented letters and punctuation are about as wide as a digit
+			total += 556
+		case font == Bold:
+			total += helveticaBoldWidths[c-0x20]
+		default:
+			total += helveticaWidths[c-0x20]
+		}
+	}
+	return float64(total) * size / 1000
+}
@@ -0,0 +1,314 @@
+// Package pdf writes simple text documents as PDF: headings, paragraphs,
+// boxed cards and code blocks on A4 pages, broken across pages as needed.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Page geometry in points.
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	margin     = 50.0
+	contentW   = pageWidth - 2*margin
+	footerY    = 28.0
+)
+
+// Sizes of the text styles in points.
+const (
+	headingSize = 16.0
+	textSize    = 10.0
+	noteSize    = 8.5
+	codeSize    = 8.0
+	leading     = 1.35
+	padding     = 8.0
+)
+
+// A line is one line of text on a page.
+type line struct {
+	font int
+	size float64
+	text []byte
+	gray bool
+}
+
+// Document is a PDF being laid out. Its methods add content below what
+// was added before, starting a page when the current one is full.
+type Document struct {
+	// Title goes in the document's properties.
+	Title string
+	// Footer is printed at the bottom of every page, followed by the page
+	// number.
+	Footer string
+	// Created is the document's creation date; zero leaves it out.
+	Created time.Time
+
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// New returns an empty document titled title.
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+// Heading adds a bold heading.
+func (d *Document) Heading(text string) {
+	d.space(6)
+	d.lines(wrap(text, Bold, headingSize, contentW), margin)
+	d.space(4)
+}
+
+// Note adds a line of small gray text, such as a byline.
+func (d *Document) Note(text string) {
+	d.space(4)
+	lines := wrap(text, Bold, noteSize, contentW)
+	for i := range lines {
+		lines[i].gray = true
+	}
+	d.lines(lines, margin)
+}
+
+// Paragraph adds text, keeping its line breaks and wrapping long lines.
+func (d *Document) Paragraph(text string) {
+	d.lines(wrap(text, Regular, textSize, contentW), margin)
+	d.space(4)
+}
+
+// Card adds a box with a bold title over body, for content that should
+// stand out, such as a recommendation.
+func (d *Document) Card(title, body string) {
+	inner := contentW - 2*padding - 3
+	lines := wrap(title, Bold, textSize+1, inner)
+	if strings.TrimSpace(body) != "" {
+		lines = append(lines, wrap(body, Regular, textSize, inner)...)
+	}
+	d.block(lines, "0.94 0.96 1 rg", "0.2 0.4 0.8 rg", padding+3)
+}
+
+// Code adds text in a monospaced font on a gray background, wrapping lines
+// too long for the page at any character.
+func (d *Document) Code(text string) {
+	d.block(wrap(text, Mono, codeSize, contentW-2*padding), "0.95 g", "", padding)
+}
+
+// WriteTo writes the document as PDF to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.page()
+	}
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-2 are the catalog and page tree, then the fonts, the
+	// document info and a page and its content per page
+	const firstPage = 4 + len(fontNames)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	var fonts []string
+	for i, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", resourceNames[i], 3+i))
+	}
+	info := fmt.Sprintf("/Producer %s", literal(encode("api-recommender")))
+	if d.Title != "" {
+		info += fmt.Sprintf(" /Title %s", literal(encode(d.Title)))
+	}
+	if !d.Created.IsZero() {
+		info += fmt.Sprintf(" /CreationDate (D:%sZ)", d.Created.UTC().Format("20060102150405"))
+	}
+	object("<< " + info + " >>")
+
+	for i, content := range d.pages {
+		if d.Footer != "" || len(d.pages) > 1 {
+			footer := encode(strings.TrimSpace(fmt.Sprintf("%s    Page %d of %d", d.Footer, i+1, len(d.pages))))
+			fmt.Fprintf(content, "0.45 g\nBT /%s %g Tf %.2f %.2f Td %s Tj ET\n", resourceNames[Regular], noteSize,
+				pageWidth-margin-width(footer, Regular, noteSize), footerY, literal(footer))
+		}
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		if _, err := zw.Write(content.Bytes()); err != nil {
+			return 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return 0, err
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, strings.Join(fonts, " "), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, 3+len(fontNames), xref)
+	return out.WriteTo(w)
+}
+
+// page returns the content of the current page, starting the first one.
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+// space leaves h points blank, unless at the top of a page.
+func (d *Document) space(h float64) {
+	d.page()
+	if d.y < pageHeight-margin {
+		d.y -= h
+	}
+}
+
+// ensure starts a page unless h more points fit on this one.
+func (d *Document) ensure(h float64) {
+	d.page()
+	if d.y-h < margin {
+		d.newPage()
+	}
+}
+
+// lines sets lines at x, one below the other.
+func (d *Document) lines(lines []line, x float64) {
+	for _, l := range lines {
+		h := lineHeight(l)
+		d.ensure(h)
+		d.y -= h
+		d.text(l, x, d.y+h-l.size)
+	}
+}
+
+// block sets lines in a box filled with fill, with a bar of the accent
+// color on its left when accent isn't empty. A block too tall for the page
+// continues in a box on the next.
+func (d *Document) block(lines []line, fill, accent string, indent float64) {
+	d.space(2)
+	for len(lines) > 0 {
+		d.ensure(2*padding + lineHeight(lines[0]))
+		// Take the lines that fit on this page
+		room := d.y - margin - 2*padding
+		n, h := 0, 0.0
+		for n < len(lines) && h+lineHeight(lines[n]) <= room {
+			h += lineHeight(lines[n])
+			n++
+		}
+		if n == 0 {
+			n, h = 1, lineHeight(lines[0])
+		}
+		boxH := h + 2*padding
+		p := d.page()
+		fmt.Fprintf(p, "%s\n%.2f %.2f %.2f %.2f re f\n", fill, margin, d.y-boxH, contentW, boxH)
+		if accent != "" {
+			fmt.Fprintf(p, "%s\n%.2f %.2f 3 %.2f re f\n", accent, margin, d.y-boxH, boxH)
+		}
+		d.y -= padding
+		for _, l := range lines[:n] {
+			d.y -= lineHeight(l)
+			d.text(l, margin+indent, d.y+lineHeight(l)-l.size)
+		}
+		d.y -= padding
+		lines = lines[n:]
+	}
+	d.space(6)
+}
+
+// text sets l with its baseline at y.
+func (d *Document) text(l line, x, y float64) {
+	if len(l.text) == 0 {
+		return
+	}
+	color := "0 g"
+	if l.gray {
+		color = "0.45 g"
+	}
+	fmt.Fprintf(d.page(), "%s BT /%s %g Tf %.2f %.2f Td %s Tj ET\n", color, resourceNames[l.font], l.size, x, y, literal(l.text))
+}
+
+func lineHeight(l line) float64 {
+	return l.size * leading
+}
+
+// wrap breaks text into lines no wider than maxWidth, at its line breaks
+// and between words. A word wider than a line is broken where it must be,
+// as is monospaced text, where indentation matters more than whole words.
+func wrap(text string, font int, size, maxWidth float64) []line {
+	var out []line
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		s := encode(strings.TrimRight(raw, " "))
+		if font == Mono {
+			per := int(maxWidth / (0.6 * size))
+			for len(s) > per {
+				out = append(out, line{font: font, size: size, text: s[:per]})
+				s = s[per:]
+			}
+			out = append(out, line{font: font, size: size, text: s})
+			continue
+		}
+
+		var cur []byte
+		for _, word := range bytes.SplitAfter(s, []byte(" ")) {
+			if width(append(cur[:len(cur):len(cur)], bytes.TrimRight(word, " ")...), font, size) <= maxWidth {
+				cur = append(cur, word...)
+				continue
+			}
+			if len(bytes.TrimSpace(cur)) > 0 {
+				out = append(out, line{font: font, size: size, text: bytes.TrimRight(cur, " ")})
+				cur = nil
+			}
+			for width(bytes.TrimRight(word, " "), font, size) > maxWidth {
+				i := 1
+				for i < len(word) && width(word[:i+1], font, size) <= maxWidth {
+					i++
+				}
+				out = append(out, line{font: font, size: size, text: word[:i]})
+				word = word[i:]
+			}
+			cur = append(cur, word...)
+		}
+		out = append(out, line{font: font, size: size, text: bytes.TrimRight(cur, " ")})
+	}
+	return out
+}
+
+// literal writes s as a PDF string, escaping what must be and anything
+// outside printable ASCII.
+func literal(s []byte) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range s {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
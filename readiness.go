@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-recommender/recommend"
+)
+
+// Readiness statuses reported by GET /readyz.
+const (
+	ReadinessReady    = "ready"
+	ReadinessDegraded = "degraded"
+)
+
+// preflightTimeout bounds one run of the LLM preflight checks.
+const preflightTimeout = 30 * time.Second
+
+// preflightRetry is how often a degraded server checks the LLM again.
+const preflightRetry = time.Minute
+
+// Readiness says whether the service can answer chat requests. Without a
+// preflight run it is ready and has no checks.
+type Readiness struct {
+	Status    string                     `json:"status"`
+	Checks    []recommend.PreflightCheck `json:"checks,omitempty"`
+	CheckedAt *time.Time                 `json:"checkedAt,omitempty"`
+}
+
+// Ready reports whether the status is ready.
+func (r Readiness) Ready() bool { return r.Status == ReadinessReady }
+
+// Preflight checks the configured LLM with a tiny round trip and a
+// structured-output check, and keeps the outcome as the service's
+// readiness.
+func (s *ChatService) Preflight(ctx context.Context) Readiness {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	r := Readiness{Status: ReadinessReady, Checks: recommend.Preflight(ctx, s.model), CheckedAt: &now}
+	for _, c := range r.Checks {
+		if !c.OK {
+			r.Status = ReadinessDegraded
+		}
+	}
+	s.readiness.Store(&r)
+	return r
+}
+
+// alive reports whether the service can still reach its database, for the
+// systemd watchdog: a process that can't is better restarted.
+func (s *ChatService) alive() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.db.PingContext(ctx) == nil
+}
+
+// Readiness returns the outcome of the last preflight run.
+func (s *ChatService) Readiness() Readiness {
+	if r := s.readiness.Load(); r != nil {
+		return *r
+	}
+	return Readiness{Status: ReadinessReady}
+}
+
+// runPreflight checks the LLM before the server starts. A failure doesn't
+// stop it: the server starts degraded, says so on /readyz and checks again
+// every preflightRetry until the LLM answers or ctx is done.
+func runPreflight(ctx context.Context, service *ChatService) {
+	r := service.Preflight(ctx)
+	if r.Ready() {
+		log.Printf("LLM preflight passed")
+		return
+	}
+	logPreflightFailure(r)
+
+	go func() {
+		ticker := time.NewTicker(preflightRetry)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if r := service.Preflight(ctx); r.Ready() {
+					log.Printf("LLM preflight passed; server is ready")
+					return
+				}
+			}
+		}
+	}()
+}
+
+func logPreflightFailure(r Readiness) {
+	for _, c := range r.Checks {
+		if !c.OK {
+			log.Printf("LLM preflight %s failed: %s", c.Name, c.Error)
+		}
+	}
+	log.Printf("Starting degraded; GET /readyz reports %s until the LLM passes the preflight", ReadinessDegraded)
+}
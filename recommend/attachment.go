@@ -0,0 +1,64 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ReviewAttachment answers a question about a document the user attached,
+// either a request payload or an excerpt of the API spec. problems are the
+// findings of the payload checks, so the answer can explain them.
+func ReviewAttachment(ctx context.Context, question, document string, problems []string, llm llms.Model) (string, error) {
+	persona := personaFrom(ctx)
+	reviewPrompt := fmt.Sprintf(`%s The user attached the document below and asks about it.
+
+User question: %q
+
+Attached document:
+%s
+%s
+Answer the question using the document and the %s request model. When checks found problems, explain what is
+wrong and how to fix each one. Do not invent fields that are not in the request model.
+%s`, persona.Render(persona.Intro), question, document, problemSection(problems), persona.ProductName, verbosityInstruction(ctx))
+
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "attachment", reviewPrompt), llms.WithTemperature(0.2))
+	if err != nil {
+		return "", fmt.Errorf("%w: review attachment: %w", ErrLLMUnavailable, err)
+	}
+	return trimAnswer(ctx, strings.TrimSpace(response)), nil
+}
+
+// CorrectPayload asks the model for a version of an attached payload that
+// fixes problems, and returns it without any surrounding prose.
+func CorrectPayload(ctx context.Context, document string, problems []string, llm llms.Model) (string, error) {
+	correctPrompt := fmt.Sprintf(`Correct the attached payload so it satisfies the request model and fixes every problem listed.
+Keep every value the user gave unless a problem requires changing it, and keep the same format (JSON or XML).
+
+Attached payload:
+%s
+%s
+Request model:
+%s
+
+Return only the corrected payload, with no explanations.`, document, problemSection(problems), getRequestModelSnippet())
+
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "attachment", correctPrompt), llms.WithTemperature(0.0))
+	if err != nil {
+		return "", fmt.Errorf("%w: correct attachment: %w", ErrLLMUnavailable, err)
+	}
+	response = strings.TrimSpace(response)
+	if strings.HasPrefix(response, "<") {
+		return response, nil
+	}
+	return extractJSON(response), nil
+}
+
+func problemSection(problems []string) string {
+	if len(problems) == 0 {
+		return "\nChecks found no problems.\n"
+	}
+	return "\nProblems found by the checks:\n- " + strings.Join(problems, "\n- ") + "\n"
+}
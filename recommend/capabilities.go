@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	model "api-recommender/api-parser"
+)
+
+// maxCapabilityAPIs caps how many catalog APIs the capabilities summary lists.
+const maxCapabilityAPIs = 12
+
+// capabilityPhrases are questions about the assistant itself. A message that
+// is only "help" or "?" counts too.
+var (
+	capabilityPhrases = regexp.MustCompile(`\b(what (else )?can (you|i) do|what do you (do|support|know)|how can you help|what can you help|your capabilities|what are you capable of|what is supported|list (the )?(usecases|operations))\b`)
+	helpOnly          = regexp.MustCompile(`^\s*(help|help me|\?|capabilities|usage)\s*[.!?]*\s*$`)
+)
+
+// IsCapabilitiesQuery reports whether the user is asking what the assistant
+// can do rather than making a request.
+func IsCapabilitiesQuery(userInput string) bool {
+	lower := strings.ToLower(userInput)
+	return helpOnly.MatchString(lower) || capabilityPhrases.MatchString(lower)
+}
+
+// Capabilities summarises the supported usecases, operations and catalog APIs
+// with example prompts. It is built from the loaded catalog and usecase
+// tables, so it needs no model call. The persona and admin-managed usecases
+// are the ones set on ctx.
+func Capabilities(ctx context.Context, apis []model.APIDoc) string {
+	persona := personaFrom(ctx)
+	var b strings.Builder
+	b.WriteString(persona.Render(persona.Intro))
+	b.WriteString(" Here is what I can help with.\n\n")
+
+	seen := map[string]bool{}
+	var usecases []string
+	for name := range usecaseFieldMap {
+		seen[name] = true
+		usecases = append(usecases, name)
+	}
+	for _, name := range tunablesFrom(ctx).Usecases() {
+		if !seen[name] {
+			seen[name] = true
+			usecases = append(usecases, name)
+		}
+	}
+	sort.Strings(usecases)
+
+	b.WriteString("Usecases and operations:\n")
+	for _, name := range usecases {
+		var ops []string
+		for _, op := range operationsFor(name) {
+			ops = append(ops, fmt.Sprintf("%s (%s API)", strings.ToLower(op.Label), op.API))
+		}
+		fmt.Fprintf(&b, " - %s: %s\n", name, strings.Join(ops, ", "))
+	}
+	b.WriteString(" - key-value data: store (req transact API)\n")
+
+	if len(apis) > 0 {
+		fmt.Fprintf(&b, "\nAPIs in the catalog (%d):\n", len(apis))
+		for i, a := range apis {
+			if i == maxCapabilityAPIs {
+				fmt.Fprintf(&b, " ...and %d more\n", len(apis)-i)
+				break
+			}
+			fmt.Fprintf(&b, " - %s %s", a.Method, a.Path)
+			if a.Name != "" {
+				fmt.Fprintf(&b, " (%s)", a.VersionedName())
+			}
+			if len(a.Tags) > 0 {
+				fmt.Fprintf(&b, " [%s]", strings.Join(a.Tags, ", "))
+			}
+			if a.Deprecated {
+				b.WriteString(" - deprecated")
+				if a.ReplacedBy != "" {
+					fmt.Fprintf(&b, ", use %s", a.ReplacedBy)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\nTry asking:\n")
+	for _, example := range ExamplePrompts(ctx) {
+		fmt.Fprintf(&b, " - %q\n", example)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// ExamplePrompts returns example prompts covering each kind of request.
+func ExamplePrompts(ctx context.Context) []string {
+	fields := getUsecaseFields(ctx, "gold bond", "create")
+	return []string{
+		fmt.Sprintf("create a gold bond asset with %s=100, %s=24k", fields[0], fields[1]),
+		"build an insurance usecase",
+		"burn my latest gold bond",
+		"register a new identity for our organisation",
+		"store these config values: maxLimit=100, region=south",
+		fmt.Sprintf("what does isUMICompliant mean in %s?", personaFrom(ctx).ProductName),
+	}
+}
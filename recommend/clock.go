@@ -0,0 +1,21 @@
+package recommend
+
+import (
+	"context"
+
+	"api-recommender/payload"
+)
+
+type clockKey struct{}
+
+// WithClock makes payloads built with ctx timestamped and dated by c.
+func WithClock(ctx context.Context, c *payload.Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// clockFrom returns the clock set on ctx. Without one it is nil, which
+// payload takes to be the system time in UTC.
+func clockFrom(ctx context.Context) *payload.Clock {
+	c, _ := ctx.Value(clockKey{}).(*payload.Clock)
+	return c
+}
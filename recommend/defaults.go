@@ -0,0 +1,46 @@
+package recommend
+
+import (
+	"context"
+
+	"api-recommender/config"
+)
+
+type smartDefaultsKey struct{}
+
+// WithSmartDefaults returns a context under which the context questions a
+// follow-up left unanswered are defaulted instead of asked again (see
+// ApplyDefaults).
+func WithSmartDefaults(ctx context.Context, on bool) context.Context {
+	return context.WithValue(ctx, smartDefaultsKey{}, on)
+}
+
+// SmartDefaultsFrom returns whether smart defaults are set on ctx, and
+// whether ctx says either way.
+func SmartDefaultsFrom(ctx context.Context) (on, set bool) {
+	on, set = ctx.Value(smartDefaultsKey{}).(bool)
+	return on, set
+}
+
+// ApplyDefaults answers the context questions info still lacks for its
+// usecase the common way: synchronous, UMI compliant and public. Fields
+// have no default and are still asked for. It returns what it set, e.g.
+// "async=false", in checklist order.
+func ApplyDefaults(ctx context.Context, info *QueryInfo) []string {
+	var applied []string
+	for _, item := range MissingInfo(ctx, info) {
+		switch item {
+		case config.QuestionAsync:
+			info.IsAsync = new(bool)
+			applied = append(applied, "async=false")
+		case config.QuestionUMICompliant:
+			yes := true
+			info.IsUMICompliant = &yes
+			applied = append(applied, "umiCompliant=true")
+		case config.QuestionPrivacy:
+			info.IsPrivate = new(bool)
+			applied = append(applied, "privacy=public")
+		}
+	}
+	return applied
+}
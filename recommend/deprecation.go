@@ -0,0 +1,108 @@
+package recommend
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	model "api-recommender/api-parser"
+)
+
+// candidateAPIs leaves deprecated APIs out of the choice unless the request
+// asks for one explicitly. A deprecated version the request only names as
+// it would name the current one ("ReqManage" for both /v1/ReqManage and
+// /v2/ReqManage) stays out unless its version or full path is asked for. If
+// every API is deprecated they all stay in.
+func candidateAPIs(apis []model.APIDoc, request string) []model.APIDoc {
+	var out []model.APIDoc
+	for _, a := range apis {
+		if !a.Deprecated || (requestsAPI(request, a) && !superseded(apis, a, request)) {
+			out = append(out, a)
+		}
+	}
+	if len(out) == 0 {
+		return apis
+	}
+	return out
+}
+
+// superseded reports whether apis has a current version of the deprecated
+// api, one the request names too, while the request doesn't single out api
+// by its version or path.
+func superseded(apis []model.APIDoc, api model.APIDoc, request string) bool {
+	lower := strings.ToLower(request)
+	if strings.Contains(lower, strings.ToLower(api.Path)) || mentionsVersion(lower, api.Version) {
+		return false
+	}
+	_, ok := currentVersion(apis, api, request)
+	return ok
+}
+
+// currentVersion finds a current version of api: an API that isn't
+// deprecated with the same name or last path segment, and that request, if
+// set, names too.
+func currentVersion(apis []model.APIDoc, api model.APIDoc, request string) (model.APIDoc, bool) {
+	for _, a := range apis {
+		if a.Deprecated {
+			continue
+		}
+		same := (api.Name != "" && strings.EqualFold(a.Name, api.Name)) ||
+			(api.Path != "" && strings.EqualFold(path.Base(a.Path), path.Base(api.Path)))
+		if same && (request == "" || requestsAPI(request, a)) {
+			return a, true
+		}
+	}
+	return model.APIDoc{}, false
+}
+
+// mentionsVersion reports whether the lowercase request mentions version,
+// as "v1", "version 1" or the version as written in the docs.
+func mentionsVersion(lower, version string) bool {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version == "" {
+		return false
+	}
+	number := regexp.QuoteMeta(strings.TrimPrefix(version, "v"))
+	return regexp.MustCompile(`(^|[^\w.])(` + regexp.QuoteMeta(version) + `|v` + number + `|version\s+` + number + `)($|[^\w.])`).MatchString(lower)
+}
+
+// requestsAPI reports whether request names api by path, by the last path
+// segment ("ReqManage") or as "<name> API". A bare name doesn't count, since
+// names such as "Issue" are ordinary words.
+func requestsAPI(request string, api model.APIDoc) bool {
+	lower := strings.ToLower(request)
+	if api.Path != "" {
+		if strings.Contains(lower, strings.ToLower(api.Path)) {
+			return true
+		}
+		if base := path.Base(api.Path); base != "/" && base != "." &&
+			regexp.MustCompile(`\b`+regexp.QuoteMeta(strings.ToLower(base))+`\b`).MatchString(lower) {
+			return true
+		}
+	}
+	if api.Name == "" {
+		return false
+	}
+	named := regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(api.Name)) + `\s+(api|endpoint)\b`)
+	return named.MatchString(lower)
+}
+
+// DeprecationNotice warns that api is deprecated and points at its
+// replacement when the catalog has one. It is empty for current APIs.
+func DeprecationNotice(api model.APIDoc, apis []model.APIDoc) string {
+	if !api.Deprecated {
+		return ""
+	}
+	notice := fmt.Sprintf("%s (%s) is deprecated.", api.VersionedName(), api.Path)
+	if api.ReplacedBy == "" {
+		if next, ok := currentVersion(apis, api, ""); ok {
+			return notice + fmt.Sprintf(" Use %s (%s %s) instead.", next.VersionedName(), next.Method, next.Path)
+		}
+		return notice
+	}
+	if next, ok := model.Find(apis, api.ReplacedBy); ok {
+		return notice + fmt.Sprintf(" Use %s (%s %s) instead.", next.VersionedName(), next.Method, next.Path)
+	}
+	return notice + fmt.Sprintf(" Use %s instead.", api.ReplacedBy)
+}
@@ -0,0 +1,60 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	model "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// ErrDisallowedValues is matched by an *InvalidValuesError.
+var ErrDisallowedValues = errors.New("values not allowed")
+
+// InvalidValuesError is returned by Recommend1 when the user gave values
+// that the chosen API's fields don't allow.
+type InvalidValuesError struct {
+	API      model.APIDoc
+	Problems []payload.Problem
+}
+
+func (e *InvalidValuesError) Error() string {
+	paths := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		paths[i] = p.Path
+	}
+	return fmt.Sprintf("%s: %s for %s", ErrDisallowedValues, strings.Join(paths, ", "), e.API.Name)
+}
+
+func (e *InvalidValuesError) Unwrap() error { return ErrDisallowedValues }
+
+// allowedValues collects the allowed values of api's fields.
+func allowedValues(api model.APIDoc) payload.Allowed {
+	allowed := payload.Allowed{}
+	for _, f := range api.Fields {
+		if len(f.Enum) > 0 {
+			allowed[f.Name] = f.Enum
+		}
+	}
+	return allowed
+}
+
+// allowedSection tells the model which values limited fields may take.
+func allowedSection(api model.APIDoc) string {
+	var b strings.Builder
+	for _, f := range api.Fields {
+		if len(f.Enum) == 0 || f.IsParameter() {
+			continue
+		}
+		quoted := make([]string, len(f.Enum))
+		for i, v := range f.Enum {
+			quoted[i] = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, "\n- %s: one of %s", f.Name, strings.Join(quoted, ", "))
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\n### CRITICAL: ALLOWED VALUES\nThese fields only take the listed values; never use any other value for them:" + b.String()
+}
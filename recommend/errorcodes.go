@@ -0,0 +1,141 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	model "api-recommender/api-parser"
+)
+
+var (
+	// reErrorWords mark a question about an error, so a code-like word in it
+	// is taken for an error code.
+	reErrorWords = regexp.MustCompile(`(?i)\b(errors?|codes?|fail(s|ed|ure)?|rejected)\b`)
+	// reCodeLike finds tokens that look like error codes: letters followed
+	// by digits ("E403") or upper snake case ("INSUFFICIENT_BALANCE").
+	reCodeLike = regexp.MustCompile(`\b(?:[A-Za-z]{1,6}-?\d{2,}|[A-Z][A-Z0-9]*_[A-Z0-9_]+)\b`)
+	reDigits   = regexp.MustCompile(`^\d+$`)
+)
+
+type catalogKey struct{}
+
+// WithCatalog makes apis the catalog answers about the docs are drawn from.
+func WithCatalog(ctx context.Context, apis []model.APIDoc) context.Context {
+	return context.WithValue(ctx, catalogKey{}, apis)
+}
+
+func catalogFrom(ctx context.Context) []model.APIDoc {
+	apis, _ := ctx.Value(catalogKey{}).([]model.APIDoc)
+	return apis
+}
+
+// codeMatch is a documented error a question mentions.
+type codeMatch struct {
+	api model.APIDoc
+	err model.APIError
+}
+
+// IsErrorCodeQuestion reports whether the question asks about an error code,
+// one apis document or one that looks like a code while apis document some.
+// Such questions are answered from the docs.
+func IsErrorCodeQuestion(apis []model.APIDoc, question string) bool {
+	_, ok := ErrorCodeAnswer(apis, question)
+	return ok
+}
+
+// ErrorCodeAnswer answers a question about an error code from the errors
+// the APIs document, such as "what does error E403 from req issue mean?".
+// When the question names an API, only its errors count. A code no API
+// documents is said to be undocumented rather than guessed at. It reports
+// false for questions about no error code.
+func ErrorCodeAnswer(apis []model.APIDoc, question string) (string, bool) {
+	documented := false
+	for _, a := range apis {
+		documented = documented || len(a.Errors) > 0
+	}
+	if !documented {
+		return "", false
+	}
+
+	var matches []codeMatch
+	for _, a := range apis {
+		for _, e := range a.Errors {
+			if mentionsCode(question, e.Code) {
+				matches = append(matches, codeMatch{a, e})
+			}
+		}
+	}
+	named, hasNamed := mentionedAPI(apis, question)
+	if len(matches) == 0 {
+		code := reCodeLike.FindString(question)
+		if code == "" || !reErrorWords.MatchString(question) {
+			return "", false
+		}
+		if hasNamed {
+			return fmt.Sprintf("The docs of %s don't list error %s, so I can't say what it means.%s", apiLabel(named), code, knownCodes(named)), true
+		}
+		return fmt.Sprintf("None of the APIs in the docs lists error %s, so I can't say what it means.", code), true
+	}
+
+	if hasNamed {
+		var own []codeMatch
+		for _, m := range matches {
+			if m.api.Refers(named.Name) {
+				own = append(own, m)
+			}
+		}
+		if len(own) == 0 {
+			var b strings.Builder
+			fmt.Fprintf(&b, "The docs of %s don't list error %s, but other APIs do:\n", apiLabel(named), matches[0].err.Code)
+			writeCodeMatches(&b, matches)
+			return strings.TrimSpace(b.String()), true
+		}
+		matches = own
+	}
+	var b strings.Builder
+	writeCodeMatches(&b, matches)
+	return strings.TrimSpace(b.String()), true
+}
+
+// mentionsCode reports whether question mentions code as a word. A code of
+// only digits, such as 409, counts only next to a word like "error", since
+// questions have other numbers in them.
+func mentionsCode(question, code string) bool {
+	if code == "" {
+		return false
+	}
+	quoted := regexp.QuoteMeta(code)
+	if reDigits.MatchString(code) {
+		return regexp.MustCompile(`(?i)\b(error|code|status)\s+` + quoted + `\b|\b` + quoted + `\s+(error|code)\b`).MatchString(question)
+	}
+	return regexp.MustCompile(`(?i)(^|[^\w-])` + quoted + `($|[^\w-])`).MatchString(question)
+}
+
+func writeCodeMatches(b *strings.Builder, matches []codeMatch) {
+	for _, m := range matches {
+		retry := "Not retryable: fix the request before sending it again."
+		if m.err.Retryable {
+			retry = "Retryable: sending the same request again later may succeed."
+		}
+		fmt.Fprintf(b, "- **%s** from %s: %s %s\n", m.err.Code, apiLabel(m.api), strings.TrimSuffix(m.err.Meaning, ".")+".", retry)
+	}
+}
+
+// knownCodes lists the codes api documents, for an answer about one it
+// doesn't.
+func knownCodes(api model.APIDoc) string {
+	if len(api.Errors) == 0 {
+		return ""
+	}
+	codes := make([]string, len(api.Errors))
+	for i, e := range api.Errors {
+		codes[i] = e.Code
+	}
+	return " It documents " + strings.Join(codes, ", ") + "."
+}
+
+func apiLabel(api model.APIDoc) string {
+	return fmt.Sprintf("%s (%s %s)", api.Name, api.Method, api.Path)
+}
@@ -0,0 +1,32 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Failure modes of the steps that call the model. Their errors wrap one of
+// these, so callers can tell with errors.Is whether to retry, report the
+// model or ask the user for something else.
+var (
+	// ErrLLMUnavailable is returned when the model couldn't be reached or
+	// returned an error.
+	ErrLLMUnavailable = errors.New("llm unavailable")
+	// ErrUnparseableOutput is returned when the model answered, but not in
+	// the shape it was asked for.
+	ErrUnparseableOutput = errors.New("unparseable model output")
+	// ErrNoCandidate is returned when no API in the catalog was chosen for
+	// the request: the catalog offered none, or the model picked one that
+	// isn't there.
+	ErrNoCandidate = errors.New("no candidate api")
+)
+
+// unparseable is the ErrUnparseableOutput error for a model answer that
+// step couldn't parse. The answer is logged rather than put in the error:
+// it can repeat the prompt, catalog or user's input, and the error may be
+// sent to the client.
+func unparseable(step string, err error, answer string) error {
+	log.Printf("unparseable model output (%s): %v; raw=%q", step, err, answer)
+	return fmt.Errorf("%w: %s: %w", ErrUnparseableOutput, step, err)
+}
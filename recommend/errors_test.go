@@ -0,0 +1,34 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// replyModel answers every prompt with reply.
+type replyModel struct{ reply string }
+
+func (m replyModel) GenerateContent(context.Context, []llms.MessageContent, ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.reply}}}, nil
+}
+
+func (m replyModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// The model's answer can echo the user's input and the catalog; it is
+// logged, not carried by errors that reach clients.
+func TestUnparseableOutputLeavesOutAnswer(t *testing.T) {
+	const answer = "Sure! The customer's card is 4111 1111 1111 1111."
+	_, err := ExtractRequestedFields(t.Context(), "set the card number", []string{"cardNumber"}, replyModel{answer})
+	if !errors.Is(err, ErrUnparseableOutput) {
+		t.Fatalf("err = %v, want ErrUnparseableOutput", err)
+	}
+	if strings.Contains(err.Error(), "4111") {
+		t.Fatalf("error carries the model's answer: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package recommend
+
+import (
+	"fmt"
+	"strings"
+
+	model "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// exampleValues collects the documented examples of api's fields.
+func exampleValues(api model.APIDoc) payload.Examples {
+	examples := payload.Examples{}
+	for _, f := range api.Fields {
+		if f.Example != "" && !f.IsParameter() {
+			examples[f.Name] = f.Example
+		}
+	}
+	return examples
+}
+
+// givenValues are the payload values the user settled, which documented
+// examples must not replace: their key=value entries, the context values
+// and the asset acted on.
+func givenValues(info *QueryInfo) []payload.Pair {
+	if info == nil {
+		return nil
+	}
+	given := append([]payload.Pair(nil), info.KeyValues...)
+	if info.NetworkID != "" {
+		given = append(given, payload.Pair{Name: "context.networkId", Value: info.NetworkID})
+	}
+	if info.Version != "" {
+		given = append(given, payload.Pair{Name: "context.version", Value: info.Version})
+	}
+	if info.AssetID != "" {
+		given = append(given, payload.Pair{Name: "payload.tokenizedAsset[].id", Value: info.AssetID})
+	}
+	return given
+}
+
+// examplesSection asks the model to use the documented examples for the
+// fields the user left without a value.
+func examplesSection(api model.APIDoc, given []payload.Pair) string {
+	kept := payload.Examples{}
+	for _, p := range given {
+		kept[p.Name] = p.Value
+	}
+	var b strings.Builder
+	for _, f := range api.Fields {
+		if f.Example == "" || f.IsParameter() {
+			continue
+		}
+		if _, ok := kept.For(f.Name); ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s = %q", f.Name, f.Example)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\n### CRITICAL: DOCUMENTED EXAMPLE VALUES\nWhen one of these fields is in the payload and the user gave no value for it, use its documented example instead of a made-up value:" + b.String()
+}
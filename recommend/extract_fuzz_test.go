@@ -0,0 +1,62 @@
+package recommend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// FuzzExtractJSON feeds extractJSON replies a model might write: prose
+// around the JSON, code fences, stray or unbalanced braces. It must not
+// panic, must return part of its input, and must not lose a JSON object
+// that prose without braces surrounds.
+func FuzzExtractJSON(f *testing.F) {
+	f.Add(`{"selectedAPI": "Issue", "reason": "creates tokens"}`)
+	f.Add("Here you go:\n```json\n{\"fields\": [\"id\", \"value\"]}\n```\nLet me know!")
+	f.Add(`["id","value"]`)
+	f.Add("}{")
+	f.Add("{")
+	f.Add("}")
+	f.Add(`{"a": "}"} trailing } brace`)
+	f.Add(strings.Repeat("{", 1000) + strings.Repeat("}", 999))
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, reply string) {
+		got := extractJSON(reply)
+		if !strings.Contains(reply, got) {
+			t.Fatalf("extractJSON(%q) = %q, not part of the reply", reply, got)
+		}
+		if got != reply && (!strings.HasPrefix(got, "{") || !strings.HasSuffix(got, "}")) {
+			t.Fatalf("extractJSON(%q) = %q, cut but not to braces", reply, got)
+		}
+
+		// The callers decode what they get; a bad reply is an error, not a
+		// panic
+		var step1 struct {
+			SelectedAPI string `json:"selectedAPI"`
+			Reason      string `json:"reason"`
+		}
+		_ = json.Unmarshal([]byte(got), &step1)
+		var values map[string]string
+		_ = json.Unmarshal([]byte(got), &values)
+	})
+}
+
+// FuzzExtractJSONWrapped checks that any JSON object comes back intact from
+// between prose that has no braces of its own.
+func FuzzExtractJSONWrapped(f *testing.F) {
+	f.Add("Sure! ", `{"id": "474bccfa", "value": "100"}`, " Hope that helps.")
+	f.Add("```json\n", `{"nested": {"list": [1, {"x": "}"}]}}`, "\n```")
+
+	f.Fuzz(func(t *testing.T, before, object, after string) {
+		object = strings.TrimSpace(object)
+		var v map[string]any
+		if !strings.HasPrefix(object, "{") || json.Unmarshal([]byte(object), &v) != nil || strings.ContainsAny(before+after, "{}") {
+			t.Skip()
+		}
+		got := extractJSON(before + object + after)
+		if got != object {
+			t.Fatalf("extractJSON lost the object: got %q, want %q", got, object)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package recommend
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"api-recommender/payload"
+)
+
+type outputFormatKey struct{}
+
+// WithOutputFormat returns a context under which sample payloads are given
+// in format, payload.FormatJSON or payload.FormatXML, unless the request
+// names the other one.
+func WithOutputFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, outputFormatKey{}, format)
+}
+
+// OutputFormatFrom returns the output format set on ctx, if any.
+func OutputFormatFrom(ctx context.Context) (string, bool) {
+	f, ok := ctx.Value(outputFormatKey{}).(string)
+	return f, ok && f != ""
+}
+
+var (
+	reMentionsXML  = regexp.MustCompile(`(?i)\bxml\b`)
+	reMentionsJSON = regexp.MustCompile(`(?i)\bjson\b`)
+	// reFormatCommand matches asking for one format for the rest of the
+	// session, e.g. "always give me XML" or "from now on use json".
+	reFormatCommand = regexp.MustCompile(`(?i)\b(?:always|from now on|by default|default to|switch(?:ing)? to|for the rest of (?:this|the) (?:session|chat|conversation))\b[^.?!\n]{0,40}?\b(xml|json)\b[^.?!\n]*`)
+	// reFiller is what may be left of a message that only sets the format
+	reFiller = regexp.MustCompile(`(?i)^(?:please|pls|thanks|thank you|ok|okay|and|then|\s|[[:punct:]])*$`)
+)
+
+// RequestedFormat returns the format the sample payload of request should
+// be in: the one request names, else the one set on ctx, else JSON.
+func RequestedFormat(ctx context.Context, request string) string {
+	xml, json := reMentionsXML.MatchString(request), reMentionsJSON.MatchString(request)
+	if xml != json {
+		if xml {
+			return payload.FormatXML
+		}
+		return payload.FormatJSON
+	}
+	if f, ok := OutputFormatFrom(ctx); ok {
+		return f
+	}
+	return payload.FormatJSON
+}
+
+// ParseFormatCommand finds a request to use one format for the rest of the
+// session in message. only is set when the message asks for nothing else.
+func ParseFormatCommand(message string) (format string, only bool, ok bool) {
+	m := reFormatCommand.FindStringSubmatchIndex(message)
+	if m == nil {
+		return "", false, false
+	}
+	format = strings.ToLower(message[m[2]:m[3]])
+	rest := message[:m[0]] + message[m[1]:]
+	return format, reFiller.MatchString(rest), true
+}
+
+// formatInstruction tells the model the payload format to use when the
+// user doesn't name one. The payload prompt already defaults to JSON.
+func formatInstruction(ctx context.Context) string {
+	if f, ok := OutputFormatFrom(ctx); ok && f == payload.FormatXML {
+		return "\n\nFORMAT: Unless the user asks for JSON, return the payload as XML; the user has chosen XML as their default format."
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package recommend
+
+import (
+	"fmt"
+	"strings"
+
+	model "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// parametersSection tells the model which fields of api are sent in the
+// URL or headers, so it leaves them out of the payload.
+func parametersSection(api model.APIDoc) string {
+	var b strings.Builder
+	for _, f := range api.Fields {
+		if f.IsParameter() {
+			fmt.Fprintf(&b, "\n- %s (%s parameter)", f.Name, f.Location())
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\n### CRITICAL: PARAMETERS ARE NOT PAYLOAD FIELDS\nThese are sent in the URL or headers, separately from the payload; never put them in the payload:" + b.String()
+}
+
+// BodyValues leaves out of pairs the values the user gave for api's
+// parameters, which are filled into the URL and headers instead of being
+// placed in the payload.
+func BodyValues(api model.APIDoc, pairs []payload.Pair) []payload.Pair {
+	var body []payload.Pair
+	for _, p := range pairs {
+		if !isParameter(api, p.Name) {
+			body = append(body, p)
+		}
+	}
+	return body
+}
+
+// isParameter reports whether name is a parameter of api and not a body
+// field too. A dotted name such as context.assetId is a body path, never
+// a parameter.
+func isParameter(api model.APIDoc, name string) bool {
+	parameter := false
+	for _, f := range api.Fields {
+		if !strings.EqualFold(f.Name, name) {
+			continue
+		}
+		if !f.IsParameter() {
+			return false
+		}
+		parameter = true
+	}
+	return parameter
+}
+
+// fieldType is the type of f as the model is shown it, with where it is
+// sent when that isn't the payload, e.g. "string, in path".
+func fieldType(f model.APIField) string {
+	if f.IsParameter() {
+		return f.Type + ", in " + f.Location()
+	}
+	return f.Type
+}
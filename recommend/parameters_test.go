@@ -0,0 +1,47 @@
+package recommend
+
+import (
+	"strings"
+	"testing"
+
+	model "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// A value given for a path parameter goes into the URL, not into the
+// payload the deterministic builder writes.
+func TestPayloadSpecLeavesOutParameters(t *testing.T) {
+	api := model.APIDoc{
+		Name:   "UpdateAsset",
+		Method: "PUT",
+		Path:   "/assets/{assetId}",
+		Fields: []model.APIField{
+			{Name: "assetId", Type: "string", In: model.InPath, Required: true},
+			{Name: "purity", Type: "string"},
+		},
+	}
+	info := &QueryInfo{
+		Operation:  "create",
+		FieldNames: []string{"assetId", "purity"},
+		KeyValues:  []payload.Pair{{Name: "assetId", Value: "A-17"}, {Name: "purity", Value: "99.9"}},
+	}
+
+	spec := info.payloadSpec(api)
+	if len(spec.Pairs) != 1 || spec.Pairs[0].Name != "purity" {
+		t.Fatalf("pairs = %+v, want only purity", spec.Pairs)
+	}
+	if len(spec.Fields) != 1 || spec.Fields[0] != "purity" {
+		t.Fatalf("fields = %v, want only purity", spec.Fields)
+	}
+
+	built, ok, err := payload.Build(info.Operation, spec)
+	if err != nil || !ok {
+		t.Fatalf("Build = %v, %v", ok, err)
+	}
+	if strings.Contains(built, "assetId") || strings.Contains(built, "A-17") {
+		t.Fatalf("path parameter in the payload:\n%s", built)
+	}
+	if !strings.Contains(built, "99.9") {
+		t.Fatalf("body value missing from the payload:\n%s", built)
+	}
+}
@@ -0,0 +1,23 @@
+package recommend
+
+import (
+	"context"
+
+	"api-recommender/config"
+)
+
+type personaKey struct{}
+
+// WithPersona makes prompts and canned answers made with ctx use persona as
+// the product identity.
+func WithPersona(ctx context.Context, persona config.Persona) context.Context {
+	return context.WithValue(ctx, personaKey{}, persona)
+}
+
+// personaFrom returns the product identity set on ctx, or the default one.
+func personaFrom(ctx context.Context) config.Persona {
+	if p, ok := ctx.Value(personaKey{}).(config.Persona); ok {
+		return p
+	}
+	return config.Default().Persona
+}
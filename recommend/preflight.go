@@ -0,0 +1,83 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Preflight checks, as named in PreflightCheck.Name.
+const (
+	// CheckRoundTrip asks the model for any answer at all, which catches a
+	// wrong endpoint, token or model name.
+	CheckRoundTrip = "roundTrip"
+	// CheckStructuredOutput asks for the kind of JSON answer every step of
+	// the recommendation relies on.
+	CheckStructuredOutput = "structuredOutput"
+)
+
+// PreflightCheck is the outcome of one preflight check.
+type PreflightCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Millis int64  `json:"millis"`
+}
+
+// preflightEcho is the value the structured-output check expects back.
+const preflightEcho = "preflight-ok"
+
+// Preflight runs a tiny round trip and a structured-output check against
+// llm, so a misconfigured model is found before the first user message.
+// The structured-output check is skipped when the round trip fails.
+func Preflight(ctx context.Context, llm llms.Model) []PreflightCheck {
+	roundTrip := runCheck(CheckRoundTrip, func() error {
+		answer, err := llms.GenerateFromSinglePrompt(ctx, llm, "Preflight check: reply with the single word READY.",
+			llms.WithTemperature(0.0), llms.WithMaxTokens(8))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(answer) == "" {
+			return errors.New("empty answer")
+		}
+		return nil
+	})
+	if !roundTrip.OK {
+		return []PreflightCheck{roundTrip}
+	}
+
+	structured := runCheck(CheckStructuredOutput, func() error {
+		prompt := fmt.Sprintf(`Preflight check: return ONLY valid JSON with shape: {"ready": true, "echo": %q}`, preflightEcho)
+		answer, err := llms.GenerateFromSinglePrompt(ctx, llm, prompt, llms.WithTemperature(0.0))
+		if err != nil {
+			return err
+		}
+		var got struct {
+			Ready bool   `json:"ready"`
+			Echo  string `json:"echo"`
+		}
+		if err := json.Unmarshal([]byte(extractJSON(answer)), &got); err != nil {
+			return fmt.Errorf("answer is not JSON: %w; raw=%s", err, answer)
+		}
+		if !got.Ready || got.Echo != preflightEcho {
+			return fmt.Errorf("answer doesn't follow the requested shape; raw=%s", answer)
+		}
+		return nil
+	})
+	return []PreflightCheck{roundTrip, structured}
+}
+
+func runCheck(name string, fn func() error) PreflightCheck {
+	start := time.Now()
+	err := fn()
+	check := PreflightCheck{Name: name, OK: err == nil, Millis: time.Since(start).Milliseconds()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,42 @@
+package recommend
+
+import (
+	"context"
+
+	"api-recommender/payload"
+)
+
+type valueProfileKey struct{}
+
+// WithValueProfile returns a context under which sample payloads use the
+// dummy values of profile, one of payload.Profiles.
+func WithValueProfile(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, valueProfileKey{}, profile)
+}
+
+// ValueProfileFrom returns the value profile set on ctx, if any.
+func ValueProfileFrom(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(valueProfileKey{}).(string)
+	return p, ok && p != ""
+}
+
+func valueProfile(ctx context.Context) string {
+	if p, ok := ValueProfileFrom(ctx); ok {
+		return p
+	}
+	return payload.ProfileMinimal
+}
+
+// profileInstruction tells the model what kind of dummy values to write,
+// matching what the builder fills in under the same profile.
+func profileInstruction(ctx context.Context) string {
+	switch valueProfile(ctx) {
+	case payload.ProfileRealisticIndia:
+		return "\n\nVALUES: Use realistic Indian sample data: Indian personal names, VPAs such as aarav.sharma@okhdfcbank, 0x-prefixed 40-hex wallet addresses, UUIDs for ids, " +
+			"timestamps like " + payload.SampleValue(payload.ProfileRealisticIndia, "timestamp", clockFrom(ctx)) + " and plausible INR amounts (e.g. 50000)."
+	case payload.ProfileStressTest:
+		return "\n\nVALUES: Use stress-test sample data: strings of 250+ characters with accents, emoji, quotes, <, > and &; the largest plausible amounts (999999999999.99); " +
+			"quantities of 2147483647; dates far in the future."
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package recommend
+
+import (
+	"context"
+
+	"api-recommender/config"
+)
+
+type questionsKey struct{}
+
+// WithQuestions makes requests handled with ctx follow the
+// required-information checklist q.
+func WithQuestions(ctx context.Context, q config.Questions) context.Context {
+	return context.WithValue(ctx, questionsKey{}, q)
+}
+
+// questionsFrom returns the checklist set on ctx, or the default one.
+func questionsFrom(ctx context.Context) config.Questions {
+	if q, ok := ctx.Value(questionsKey{}).(config.Questions); ok {
+		return q
+	}
+	return config.Default().Questions
+}
+
+// QuestionEventFields names the event fields async requests need, which
+// MissingInfo reports alongside the checklist items.
+const QuestionEventFields = "eventFields"
+
+// HasRequiredInfo reports whether info answers every checklist item required
+// for its usecase. Async requests also need event fields.
+func HasRequiredInfo(ctx context.Context, info *QueryInfo) bool {
+	return len(MissingInfo(ctx, info)) == 0
+}
+
+// MissingInfo lists the checklist items info leaves unanswered, e.g.
+// config.QuestionPrivacy, and QuestionEventFields for async requests
+// without event fields. The checklist is the one set on ctx.
+func MissingInfo(ctx context.Context, info *QueryInfo) []string {
+	questions := questionsFrom(ctx)
+	var missing []string
+	if questions.Requires(info.UseCase, config.QuestionAsync) && info.IsAsync == nil {
+		missing = append(missing, config.QuestionAsync)
+	}
+	if questions.Requires(info.UseCase, config.QuestionUMICompliant) && info.IsUMICompliant == nil {
+		missing = append(missing, config.QuestionUMICompliant)
+	}
+	if questions.Requires(info.UseCase, config.QuestionPrivacy) && info.IsPrivate == nil {
+		missing = append(missing, config.QuestionPrivacy)
+	}
+	if questions.Requires(info.UseCase, config.QuestionFields) && len(info.FieldNames) == 0 {
+		missing = append(missing, config.QuestionFields)
+	}
+	if info.IsAsync != nil && *info.IsAsync && len(info.EventFields) == 0 {
+		missing = append(missing, QuestionEventFields)
+	}
+	return missing
+}
@@ -2,10 +2,10 @@ package recommend
 
 import (
 	model "api-recommender/api-parser"
-	llm "api-recommender/llm_provider"
+	"api-recommender/config"
+	"api-recommender/payload"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"strings"
 
@@ -18,15 +18,22 @@ type Selection struct {
 }
 
 // Recommend1 is the updated version that supports event payloads for async requests
-func Recommend1(ctx context.Context, apis []model.APIDoc, user string, queryInfo *QueryInfo) (model.APIDoc, []model.APIField, string, string, error) {
-	llm, err := llm.NewGroqLLM()
-	if err != nil {
-		return model.APIDoc{}, nil, "", "", err
-	}
+func Recommend1(ctx context.Context, apis []model.APIDoc, user string, queryInfo *QueryInfo, llm llms.Model) (model.APIDoc, []model.APIField, string, string, error) {
+	// Choosing the API and its fields is timed apart from the payload
+	trace := TraceFrom(ctx)
+	stop := trace.Start(StageSelection)
+	defer func() { stop() }()
 
+	apis = domainAPIs(candidateAPIs(apis, user), user, queryInfo)
+	if len(apis) == 0 {
+		return model.APIDoc{}, nil, "", "", fmt.Errorf("%w: the catalog has no APIs", ErrNoCandidate)
+	}
 	apiSummaries := make([]string, len(apis))
 	for i, a := range apis {
 		apiSummaries[i] = fmt.Sprintf("[%d] %s %s - %s", i, a.Method, a.Path, a.Description)
+		if len(a.Tags) > 0 {
+			apiSummaries[i] += fmt.Sprintf(" (groups: %s)", strings.Join(a.Tags, ", "))
+		}
 	}
 
 	// Build enhanced user request with usecase and operation context
@@ -36,18 +43,13 @@ func Recommend1(ctx context.Context, apis []model.APIDoc, user string, queryInfo
 			enhancedUserRequest = fmt.Sprintf("%s (usecase: %s)", user, queryInfo.UseCase)
 		}
 		if queryInfo.Operation != "" {
-			operationMap := map[string]string{
-				"create": "req issue",
-				"burn":   "req manage",
-				"trade":  "req settle",
-			}
-			if apiType, ok := operationMap[queryInfo.Operation]; ok {
+			if apiType, ok := operationAPITypes[queryInfo.Operation]; ok {
 				enhancedUserRequest = fmt.Sprintf("%s (operation: %s, API type: %s)", enhancedUserRequest, queryInfo.Operation, apiType)
 			}
 		}
 	}
 
-	pickPrompt := fmt.Sprintf(`You are selecting the best API for the user's request in the UMI project.
+	pickPrompt := fmt.Sprintf(`You are selecting the best API for the user's request in the %s project.
 
 APIs:
 %s
@@ -58,31 +60,54 @@ IMPORTANT:
 - If user mentions "create" or "issue" operation → look for APIs with "req issue" or "issue" in name/path
 - If user mentions "burn" or "manage" operation → look for APIs with "req manage" or "manage" in name/path
 - If user mentions "trade" or "settle" operation → look for APIs with "req settle" or "settle" in name/path
+- If user mentions "register" (identity onboarding) or "certify" (issue certificate) operation → look for APIs with "req issue" or "issue" in name/path
+- If user mentions "store" operation (generic key-value data) → look for APIs with "req transact" or "transact" in name/path
 - If usecase is mentioned (insurance, fd, gold bond, etc.), consider APIs relevant to that usecase
 
 Return ONLY valid JSON with shape: {"api_index": <int>}
-`, strings.Join(apiSummaries, "\n"), enhancedUserRequest)
+`, personaFrom(ctx).ProductName, strings.Join(apiSummaries, "\n"), enhancedUserRequest)
 
-	apiJSON, err := llms.GenerateFromSinglePrompt(ctx, llm, pickPrompt,
+	apiJSON, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "pick", pickPrompt),
 		llms.WithTemperature(0.0))
 	if err != nil {
-		return model.APIDoc{}, nil, "", "", err
+		return model.APIDoc{}, nil, "", "", fmt.Errorf("%w: pick API: %w", ErrLLMUnavailable, err)
 	}
 
 	var step1 struct {
 		APIIndex int `json:"api_index"`
 	}
 	if err := json.Unmarshal([]byte(extractJSON(apiJSON)), &step1); err != nil {
-		return model.APIDoc{}, nil, "", "", fmt.Errorf("parse API index: %w; raw=%s", err, apiJSON)
+		return model.APIDoc{}, nil, "", "", unparseable("parse API index", err, apiJSON)
+	}
+	if scorer := scorerFrom(ctx); scorer != nil {
+		// The model's pick is one signal among several
+		best, report, ok := scorer.Choose(ctx, apis, user, queryInfo, step1.APIIndex)
+		trace.setScoring(report)
+		if ok {
+			step1.APIIndex = best
+		}
 	}
 	if step1.APIIndex < 0 || step1.APIIndex >= len(apis) {
-		return model.APIDoc{}, nil, "", "", errors.New("api_index out of range")
+		return model.APIDoc{}, nil, "", "", fmt.Errorf("%w: api_index %d out of range", ErrNoCandidate, step1.APIIndex)
 	}
 	chosen := apis[step1.APIIndex]
+	// Nothing is generated until the request has every required field
+	if missing := MissingRequiredFields(chosen, queryInfo); len(missing) > 0 {
+		return chosen, nil, "", "", &MissingFieldsError{API: chosen, Fields: missing}
+	}
+	allowed := allowedValues(chosen)
+	if queryInfo != nil && len(allowed) > 0 {
+		var problems []payload.Problem
+		if queryInfo.KeyValues, problems = payload.CheckAllowed(queryInfo.KeyValues, allowed); len(problems) > 0 {
+			return chosen, nil, "", "", &InvalidValuesError{API: chosen, Problems: problems}
+		}
+	}
+	// Required fields left without a value take their defaults
+	queryInfo = withDefaults(chosen, queryInfo)
 
 	fieldSummaries := make([]string, len(chosen.Fields))
 	for i, f := range chosen.Fields {
-		fieldSummaries[i] = fmt.Sprintf("[%d] %s (%s) - %s", i, f.Name, f.Type, f.Description)
+		fieldSummaries[i] = fmt.Sprintf("[%d] %s (%s) - %s", i, f.Name, fieldType(f), f.Description)
 	}
 
 	fieldsPrompt := fmt.Sprintf(`For the chosen API %q %s:
@@ -95,23 +120,33 @@ User request: %q
 Return ONLY valid JSON with shape: {"field_index": [<int>, ...]}
 `, chosen.Name, chosen.Path, strings.Join(fieldSummaries, "\n"), user)
 
-	fieldsJSON, err := llms.GenerateFromSinglePrompt(ctx, llm, fieldsPrompt,
+	fieldsJSON, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "fields", fieldsPrompt),
 		llms.WithTemperature(0.0))
 	if err != nil {
-		return model.APIDoc{}, nil, "", "", err
+		return model.APIDoc{}, nil, "", "", fmt.Errorf("%w: pick fields: %w", ErrLLMUnavailable, err)
 	}
 
 	var step2 Selection
 	if err := json.Unmarshal([]byte(extractJSON(fieldsJSON)), &step2); err != nil {
-		return model.APIDoc{}, nil, "", "", fmt.Errorf("parse field_index: %w; raw=%s", err, fieldsJSON)
+		return model.APIDoc{}, nil, "", "", unparseable("parse field_index", err, fieldsJSON)
 	}
 
 	var picked []model.APIField
+	seen := map[int]bool{}
 	for _, idx := range step2.FieldIndex {
-		if idx >= 0 && idx < len(chosen.Fields) {
+		if idx >= 0 && idx < len(chosen.Fields) && !seen[idx] {
+			seen[idx] = true
 			picked = append(picked, chosen.Fields[idx])
 		}
 	}
+	for i, f := range chosen.Fields {
+		if f.Required && !seen[i] {
+			picked = append(picked, f)
+		}
+	}
+
+	stop()
+	stop = trace.Start(StagePayload)
 
 	// Build field list for request payload (exclude event fields)
 	requestFieldsList := ""
@@ -134,12 +169,43 @@ Return ONLY valid JSON with shape: {"field_index": [<int>, ...]}
 		eventFieldsWarning = fmt.Sprintf("\n\n### CRITICAL: DO NOT INCLUDE EVENT FIELDS IN REQUEST PAYLOAD\nThe following fields are for EVENT payload ONLY (not request payload): %s\nThese fields should NOT appear in the request payload you generate.", strings.Join(queryInfo.EventFields, ", "))
 	}
 
+	// Operations such as trade need blocks the general rules below don't cover
+	examples, given := exampleValues(chosen), givenValues(queryInfo)
+	operationTemplate := parametersSection(chosen) + allowedSection(chosen) + examplesSection(chosen, given)
+	if queryInfo != nil {
+		if t, ok := payload.TemplateFor(queryInfo.Operation); ok {
+			operationTemplate = t.PromptSection() + operationTemplate
+		}
+		if queryInfo.AssetID != "" {
+			operationTemplate += fmt.Sprintf("\n\n### CRITICAL: EXISTING ASSET\nThe operation acts on the existing asset %q. Use exactly this value as payload.tokenizedAsset[0].id; never invent an asset id.", queryInfo.AssetID)
+		}
+		if queryInfo.NetworkID != "" || queryInfo.Version != "" {
+			operationTemplate += "\n\n### CRITICAL: CONTEXT VALUES\nSet these context fields exactly:"
+			if queryInfo.NetworkID != "" {
+				operationTemplate += fmt.Sprintf("\n- context.networkId = %q", queryInfo.NetworkID)
+			}
+			if queryInfo.Version != "" {
+				operationTemplate += fmt.Sprintf("\n- context.version = %q", queryInfo.Version)
+			}
+		}
+		if queryInfo.Correction != "" {
+			operationTemplate += fmt.Sprintf("\n\n### CRITICAL: USER CORRECTION\nA previous payload for this request was rejected. The user's complaint: %q\nFix what the complaint describes and keep everything else correct.", queryInfo.Correction)
+		}
+		if values := BodyValues(chosen, queryInfo.KeyValues); len(values) > 0 {
+			var placed strings.Builder
+			for _, a := range payload.Place(queryInfo.Operation, values) {
+				placed.WriteString(fmt.Sprintf("\n- %s = %q -> payload.%s", a.Name, a.Value, a.Target))
+			}
+			operationTemplate += "\n\n### CRITICAL: USER-SUPPLIED VALUES\nUse exactly these values at the given locations (meta.details entries are {\"name\": ..., \"value\": ...}):" + placed.String()
+		}
+	}
+
 	payloadPrompt := fmt.Sprintf(`
 You are a senior Go developer responsible for generating a precise, valid sample request payload for an API.
 
 ### User Instruction
 %q
-%s%s
+%s%s%s
 
 ### API Specification
 The request model is defined in Go as:
@@ -259,22 +325,41 @@ Generate only the REQUEST payload (JSON or XML as per user request).
 - Include ONLY the fields specified for the request payload.
 - DO NOT include any event fields.
 - Do not add explanations, notes, or comments. Just return the payload.
-`, user, requestFieldsList, eventFieldsWarning, getRequestModelSnippet(), chosen.Method, chosen.Path)
-
-	payloadResp, err := llms.GenerateFromSinglePrompt(ctx, llm, payloadPrompt,
-		llms.WithTemperature(0.2))
-	if err != nil {
-		return chosen, picked, "", "", err
+`, user, requestFieldsList, eventFieldsWarning, operationTemplate, getRequestModelSnippet(), chosen.Method, chosen.Path)
+
+	// Operations with a deterministic builder don't need the model for the
+	// payload, unless the built payload was rejected
+	var samplePayload string
+	built := false
+	if queryInfo != nil && queryInfo.Correction == "" {
+		spec := queryInfo.payloadSpec(chosen)
+		spec.Profile = valueProfile(ctx)
+		spec.Examples = examples
+		spec.Clock = clockFrom(ctx)
+		samplePayload, built, err = payload.Build(queryInfo.Operation, spec)
+		if err != nil {
+			return chosen, picked, "", "", err
+		}
 	}
-
-	samplePayload := strings.TrimSpace(payloadResp)
+	if !built {
+		payloadResp, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "payload", payloadPrompt+profileInstruction(ctx)+formatInstruction(ctx)),
+			llms.WithTemperature(0.2))
+		if err != nil {
+			return chosen, picked, "", "", fmt.Errorf("%w: generate payload: %w", ErrLLMUnavailable, err)
+		}
+		samplePayload = strings.TrimSpace(payloadResp)
+	}
+	// The model may still invent values for documented or limited fields
+	samplePayload = payload.ApplyExamples(samplePayload, examples, given)
+	samplePayload = payload.EnforceAllowed(samplePayload, allowed)
 
 	// Generate event payload if async is true
 	var eventPayload string
 	if queryInfo != nil && queryInfo.IsAsync != nil && *queryInfo.IsAsync && len(queryInfo.EventFields) > 0 {
 		eventPayload, err = generateEventPayload(ctx, llm, queryInfo.EventFields)
 		if err != nil {
-			// Don't fail if event payload generation fails, just log it
+			// The request payload is still worth returning
+			trace.noteError(err)
 			eventPayload = ""
 		}
 	}
@@ -312,9 +397,9 @@ Rules:
 
 Return ONLY the JSON payload, no explanations.`, fieldsStr, fieldsStr)
 
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, eventPrompt, llms.WithTemperature(0.2))
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "event", eventPrompt), llms.WithTemperature(0.2))
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: generate event payload: %w", ErrLLMUnavailable, err)
 	}
 
 	return strings.TrimSpace(response), nil
@@ -545,11 +630,11 @@ Example: ["id","value"]
 `, fieldsStr, prompt)
 	answer, err := llms.GenerateFromSinglePrompt(ctx, llm, extractionPrompt, llms.WithTemperature(0.0))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: extract requested fields: %w", ErrLLMUnavailable, err)
 	}
 	var requested []string
 	if err := json.Unmarshal([]byte(extractJSON(answer)), &requested); err != nil {
-		return nil, err
+		return nil, unparseable("parse requested fields", err, answer)
 	}
 	return requested, nil
 }
@@ -564,16 +649,18 @@ Example: {"id":"474bccfa...", "value":"100"}
 `, prompt, fieldsStr)
 	answer, err := llms.GenerateFromSinglePrompt(ctx, llm, valuePrompt, llms.WithTemperature(0.0))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: suggest sample values: %w", ErrLLMUnavailable, err)
 	}
 	var values map[string]string
 	if err := json.Unmarshal([]byte(extractJSON(answer)), &values); err != nil {
-		return nil, err
+		return nil, unparseable("parse sample values", err, answer)
 	}
 	return values, nil
 }
 
-func RenderAssetXML(values map[string]string) string {
+// RenderAssetXML renders a tokenized asset request under root, e.g.
+// payload.TokenXMLRoot("ReqManage").
+func RenderAssetXML(values map[string]string, root payload.XMLRoot) string {
 	id := values["id"]
 	value := values["value"]
 	// Add other fields as needed, use "" if not present
@@ -582,7 +669,7 @@ func RenderAssetXML(values map[string]string) string {
 		meta = m
 	}
 	return fmt.Sprintf(`
-<token:ReqManage xmlns:token="http://npci.org/token/schema/">
+%s
     <Payload type="tokenized_asset">
         <TokenizedAssets>
             <TokenizedAsset %s %s>
@@ -590,10 +677,12 @@ func RenderAssetXML(values map[string]string) string {
             </TokenizedAsset>
         </TokenizedAssets>
     </Payload>
-</token:ReqManage>`,
+</%s>`,
+		root.StartTag(),
 		optAttr("id", id),
 		optAttr("value", value),
 		meta,
+		root.QName(),
 	)
 }
 
@@ -603,64 +692,107 @@ func optAttr(name, value string) string {
 	}
 	return ""
 }
-func HandleCreateAssetPrompt(ctx context.Context, prompt string, llm llms.Model) {
+
+// HandleCreateAssetPrompt returns a sample ReqManage XML payload for the
+// asset fields prompt asks for, with values suggested by the model.
+func HandleCreateAssetPrompt(ctx context.Context, prompt string, llm llms.Model) (string, error) {
 	// Define available asset fields (from your model or config)
 	assetFields := []string{"id", "value", "meta"}
 	requestedFields, err := ExtractRequestedFields(ctx, prompt, assetFields, llm)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	values, err := GetSampleValues(ctx, prompt, requestedFields, llm)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	xml := RenderAssetXML(values)
-	fmt.Println("Sample Payload:\n", xml)
+	return RenderAssetXML(values, payload.TokenXMLRoot("ReqManage")), nil
 }
 
 // QueryInfo tracks the required information for API recommendation
 type QueryInfo struct {
-	IsAsync        *bool    // nil = unknown, true/false = known
-	IsUMICompliant *bool    // nil = unknown, true/false = known
-	IsPrivate      *bool    // nil = unknown, true = private, false = public
-	FieldNames     []string // empty = no fields provided
-	EventFields    []string // fields for event payload (when async is true)
-	Operation      string   // operation type: "create"/"issue", "burn"/"manage", "trade"/"settle", or empty
-	UseCase        string   // usecase type: "insurance", "fd", "gold bond", etc.
+	IsAsync        *bool    `json:"isAsync"`               // nil = unknown, true/false = known
+	IsUMICompliant *bool    `json:"isUMICompliant"`        // nil = unknown, true/false = known
+	IsPrivate      *bool    `json:"isPrivate"`             // nil = unknown, true = private, false = public
+	FieldNames     []string `json:"fieldNames,omitempty"`  // empty = no fields provided
+	EventFields    []string `json:"eventFields,omitempty"` // fields for event payload (when async is true)
+	Operation      string   `json:"operation,omitempty"`   // operation type: "create"/"issue", "burn"/"manage", "trade"/"settle", "register"/"certify" for identities, "store" for key-value data, or empty
+	UseCase        string   `json:"useCase,omitempty"`     // usecase type: "insurance", "fd", "gold bond", etc.
+	AssetID        string   `json:"assetId,omitempty"`     // existing asset the operation acts on, when looked up
+	Preset         string   `json:"preset,omitempty"`      // context preset the user referred to
+	NetworkID      string   `json:"networkId,omitempty"`   // context.networkId, set by a preset
+	Version        string   `json:"version,omitempty"`     // context.version, set by a preset
+	Correction     string   `json:"correction,omitempty"`  // complaint about a previous answer to fix when regenerating
+
+	KeyValues []payload.Pair `json:"keyValues,omitempty"` // key=value entries the user supplied
+}
+
+// payloadSpec describes the request to api for the deterministic payload
+// builder. The api's parameters are sent outside the payload and are left
+// out of it.
+func (q *QueryInfo) payloadSpec(api model.APIDoc) payload.Spec {
+	var fields []string
+	for _, name := range q.FieldNames {
+		if !isParameter(api, name) {
+			fields = append(fields, name)
+		}
+	}
+	return payload.Spec{
+		IsAsync:        q.IsAsync != nil && *q.IsAsync,
+		IsUMICompliant: q.IsUMICompliant != nil && *q.IsUMICompliant,
+		IsPrivate:      q.IsPrivate != nil && *q.IsPrivate,
+		NetworkID:      q.NetworkID,
+		Version:        q.Version,
+		Fields:         fields,
+		Pairs:          BodyValues(api, q.KeyValues),
+	}
+}
+
+// usecaseFieldMap holds the typical fields per usecase and operation.
+var usecaseFieldMap = map[string]map[string][]string{
+	"insurance": {
+		"create": []string{"startYear", "endYear", "policyNumber", "premium", "coverageAmount", "type"},
+		"burn":   []string{"policyNumber", "type", "id"},
+		"trade":  []string{"policyNumber", "type", "id", "value"},
+	},
+	"fd": {
+		"create": []string{"principal", "interestRate", "tenure", "maturityDate", "type"},
+		"burn":   []string{"id", "type", "principal"},
+		"trade":  []string{"id", "type", "value", "principal"},
+	},
+	"gold bond": {
+		"create": []string{"quantity", "purity", "price", "type", "id"},
+		"burn":   []string{"id", "type", "quantity"},
+		"trade":  []string{"id", "type", "value", "quantity"},
+	},
+	"bond": {
+		"create": []string{"quantity", "purity", "price", "type", "id"},
+		"burn":   []string{"id", "type", "quantity"},
+		"trade":  []string{"id", "type", "value", "quantity"},
+	},
+	"mutual fund": {
+		"create": []string{"units", "nav", "investmentAmount", "type", "id"},
+		"burn":   []string{"id", "type", "units"},
+		"trade":  []string{"id", "type", "value", "units"},
+	},
+	"identity": {
+		"register": []string{"id", "type", "entityType", "alias", "organisationAlias", "networkAlias", "category"},
+		"certify":  []string{"id", "certificate", "issuer", "category", "status"},
+	},
 }
 
 // getUsecaseFields returns typical fields for a given usecase
-func getUsecaseFields(usecase string, operation string) []string {
+func getUsecaseFields(ctx context.Context, usecase string, operation string) []string {
+	tunables := tunablesFrom(ctx)
 	usecase = strings.ToLower(usecase)
 	operation = strings.ToLower(operation)
 
-	// Map of usecase -> operation -> fields
-	usecaseFieldMap := map[string]map[string][]string{
-		"insurance": {
-			"create": []string{"startYear", "endYear", "policyNumber", "premium", "coverageAmount", "type"},
-			"burn":   []string{"policyNumber", "type", "id"},
-			"trade":  []string{"policyNumber", "type", "id", "value"},
-		},
-		"fd": {
-			"create": []string{"principal", "interestRate", "tenure", "maturityDate", "type"},
-			"burn":   []string{"id", "type", "principal"},
-			"trade":  []string{"id", "type", "value", "principal"},
-		},
-		"gold bond": {
-			"create": []string{"quantity", "purity", "price", "type", "id"},
-			"burn":   []string{"id", "type", "quantity"},
-			"trade":  []string{"id", "type", "value", "quantity"},
-		},
-		"bond": {
-			"create": []string{"quantity", "purity", "price", "type", "id"},
-			"burn":   []string{"id", "type", "quantity"},
-			"trade":  []string{"id", "type", "value", "quantity"},
-		},
-		"mutual fund": {
-			"create": []string{"units", "nav", "investmentAmount", "type", "id"},
-			"burn":   []string{"id", "type", "units"},
-			"trade":  []string{"id", "type", "value", "units"},
-		},
+	// Admin-managed usecases take precedence over the built-in ones
+	if fields, ok := tunables.UsecaseFields(usecase, operation); ok {
+		return fields
+	}
+	if fields, ok := tunables.UsecaseFields(usecase, defaultOperation(usecase)); ok {
+		return fields
 	}
 
 	if opMap, ok := usecaseFieldMap[usecase]; ok {
@@ -668,7 +800,7 @@ func getUsecaseFields(usecase string, operation string) []string {
 			return fields
 		}
 		// If operation not found, return default fields for the usecase
-		if fields, ok := opMap["create"]; ok {
+		if fields, ok := opMap[defaultOperation(usecase)]; ok {
 			return fields
 		}
 	}
@@ -676,6 +808,72 @@ func getUsecaseFields(usecase string, operation string) []string {
 	return []string{}
 }
 
+// usecaseOperations lists the operations offered for usecases whose flow
+// differs from the asset lifecycle of create, burn and trade.
+var usecaseOperations = map[string][]operationChoice{
+	"identity": {
+		{Name: "register", Label: "REGISTER", API: "req issue", Meaning: "onboard a new identity"},
+		{Name: "certify", Label: "CERTIFY", API: "req issue", Meaning: "issue a certificate to an identity"},
+	},
+}
+
+// operationChoice is one operation a usecase can be asked to perform.
+type operationChoice struct {
+	Name    string
+	Label   string
+	API     string
+	Meaning string
+}
+
+var assetOperations = []operationChoice{
+	{Name: "create", Label: "CREATE/ISSUE", API: "req issue"},
+	{Name: "burn", Label: "BURN/MANAGE", API: "req manage"},
+	{Name: "trade", Label: "TRADE/SETTLE", API: "req settle"},
+}
+
+func operationsFor(usecase string) []operationChoice {
+	if ops, ok := usecaseOperations[strings.ToLower(usecase)]; ok {
+		return ops
+	}
+	return assetOperations
+}
+
+// defaultOperation is the operation assumed when suggesting fields before the
+// user has picked one.
+func defaultOperation(usecase string) string {
+	return operationsFor(usecase)[0].Name
+}
+
+// OperationQuestion asks which operation to perform for usecase.
+func OperationQuestion(usecase string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "For %s usecase, which operation do you want to perform?\n\n", usecase)
+	names := make([]string, 0, 3)
+	for _, op := range operationsFor(usecase) {
+		fmt.Fprintf(&b, "- %s → use **%s** API", op.Label, op.API)
+		if op.Meaning != "" {
+			fmt.Fprintf(&b, " (%s)", op.Meaning)
+		}
+		b.WriteString("\n")
+		names = append(names, op.Name)
+	}
+	fmt.Fprintf(&b, "\nPlease specify: %s", joinOr(names))
+	return b.String()
+}
+
+// joinOr joins items as "a, b, or c".
+func joinOr(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " or " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", or " + items[len(items)-1]
+}
+
 // ClassifyQuery determines if the user is asking to create something or asking about a field
 func ClassifyQuery(ctx context.Context, userInput, history string, llm llms.Model) (bool, bool, error) {
 	// First check: is this an irrelevant request (not API-related)?
@@ -707,12 +905,14 @@ func ClassifyQuery(ctx context.Context, userInput, history string, llm llms.Mode
 	classificationPrompt := fmt.Sprintf(`Analyze the following user query and determine:
 1. Is this asking to CREATE something (e.g., "I want to create a gold bond", "create asset", "make a transaction", "burn asset", "build insurance usecase", "I want to build an fd usecase")
 2. Is this asking ABOUT a field or property (e.g., "what is toWalletAddress?", "explain id field", "what does async mean?")
-3. Is this providing answers to previous questions (e.g., "yes", "no", "async", "private", field names like "id", "value", "create", "burn", "trade")
+3. Is this providing answers to previous questions (e.g., "yes", "no", "async", "private", field names like "id", "value", "create", "burn", "trade", "register", "certify")
 
 IMPORTANT: 
 - If the user is providing answers to follow-up questions (like "yes", "no", "async", "private", or field names, or operation types like "create"/"burn"/"trade"), 
   this is STILL a creation request continuation, NOT a field question.
 - If user mentions "build X usecase" or "insurance usecase" or "fd usecase" → is_creation_request = true, is_relevant = true
+- If user wants to register/onboard an identity or issue a certificate → is_creation_request = true, is_relevant = true
+- If user wants to store generic key-value or config values on chain → is_creation_request = true, is_relevant = true
 
 User query: %q
 Recent conversation (last 3-4 messages only): %s
@@ -730,9 +930,10 @@ Rules:
 - If providing answers to questions (yes/no/field names/operation types) → is_creation_request = true, is_relevant = true
 - If completely unrelated to APIs → is_relevant = false`, userInput, getRecentHistory(history, 3))
 
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, classificationPrompt, llms.WithTemperature(0.0))
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "classify", classificationPrompt), llms.WithTemperature(0.0))
 	if err != nil {
 		// Fallback logic
+		TraceFrom(ctx).noteError(fmt.Errorf("%w: classify: %w", ErrLLMUnavailable, err))
 		return classifyQueryFallback(userInput), true, nil
 	}
 
@@ -743,6 +944,7 @@ Rules:
 	}
 
 	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
+		TraceFrom(ctx).noteError(fmt.Errorf("%w: parse classification: %w", ErrUnparseableOutput, err))
 		return classifyQueryFallback(userInput), true, nil
 	}
 
@@ -766,7 +968,7 @@ func classifyQueryFallback(userInput string) bool {
 	}
 
 	// Creation keywords
-	creationKeywords := []string{"create", "make", "generate", "build", "new", "want to", "need to", "burn", "lock"}
+	creationKeywords := []string{"create", "make", "generate", "build", "new", "want to", "need to", "burn", "lock", "register", "onboard", "certif", "store"}
 	for _, keyword := range creationKeywords {
 		if strings.Contains(lower, keyword) {
 			return true
@@ -854,11 +1056,14 @@ CRITICAL RULES:
 - But DO use information from the CURRENT request's question-answer flow.
 
 Extract:
-1. Usecase type (if user mentions building a usecase like "insurance", "fd", "gold bond", "mutual fund", etc. in current query OR conversation context)
+1. Usecase type (if user mentions building a usecase like "insurance", "fd", "gold bond", "mutual fund", etc. in current query OR conversation context; identity onboarding, identity registration or certificates → "identity")
 2. Operation type (CRITICAL: Only extract if user EXPLICITLY mentions one of these operations:
    - "create" or "issue" → set operation to "create"
    - "burn" or "manage" → set operation to "burn"
    - "trade" or "settle" → set operation to "trade"
+   - "register" or "onboard" an identity → set operation to "register"
+   - "issue certificate" or "certify" an identity → set operation to "certify" (NOT "create")
+   - "store" generic key-value / config values on chain → set operation to "store"
    - DO NOT infer operation from "build" or "want to build" - these are just usecase requests, NOT operation specifications
    - If user says "build insurance usecase" or "i want to build insurance usecase" → usecase = "insurance", operation = null (empty)
    - If user says "build X usecase" without mentioning create/burn/trade → operation MUST be null/empty, NOT "create")
@@ -870,8 +1075,8 @@ Extract:
 
 Return ONLY a JSON object:
 {
-  "usecase": "insurance"/"fd"/"gold bond"/etc. or null,
-  "operation": "create"/"burn"/"trade" or null,
+  "usecase": "insurance"/"fd"/"gold bond"/"identity"/etc. or null,
+  "operation": "create"/"burn"/"trade"/"register"/"certify"/"store" or null,
   "is_async": true/false/null,
   "is_umi_compliant": true/false/null,
   "is_private": true/false/null,
@@ -894,10 +1099,11 @@ CRITICAL SEPARATION RULES:
   * If this is a CONTINUATION and is_async is true, only include event_fields if user explicitly provided them in the conversation
   * Do NOT carry over event_fields from previous unrelated requests`, userInput, contextMsg)
 
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, extractionPrompt, llms.WithTemperature(0.0))
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "extract", extractionPrompt), llms.WithTemperature(0.0))
 	if err != nil {
 		// Fallback extraction
-		return extractQueryInfoFallback(userInput, contextToUse), nil
+		TraceFrom(ctx).noteError(fmt.Errorf("%w: extract query info: %w", ErrLLMUnavailable, err))
+		return extractQueryInfoFallback(ctx, userInput, contextToUse), nil
 	}
 
 	var result struct {
@@ -912,7 +1118,8 @@ CRITICAL SEPARATION RULES:
 
 	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
 		// Fallback: use the fallback function with proper context
-		return extractQueryInfoFallback(userInput, contextToUse), nil
+		TraceFrom(ctx).noteError(fmt.Errorf("%w: parse query info: %w", ErrUnparseableOutput, err))
+		return extractQueryInfoFallback(ctx, userInput, contextToUse), nil
 	}
 
 	info := &QueryInfo{
@@ -930,7 +1137,7 @@ CRITICAL SEPARATION RULES:
 
 	// If extraction failed, use fallback
 	if info.IsAsync == nil && info.IsUMICompliant == nil && info.IsPrivate == nil && len(info.FieldNames) == 0 && info.UseCase == "" {
-		fallbackInfo := extractQueryInfoFallback(userInput, contextToUse)
+		fallbackInfo := extractQueryInfoFallback(ctx, userInput, contextToUse)
 		if fallbackInfo != nil {
 			// Merge fallback info but preserve usecase/operation if already extracted
 			if info.UseCase == "" {
@@ -958,13 +1165,13 @@ CRITICAL SEPARATION RULES:
 }
 
 // extractQueryInfoFallback provides fallback extraction logic
-func extractQueryInfoFallback(userInput, context string) *QueryInfo {
+func extractQueryInfoFallback(ctx context.Context, userInput, history string) *QueryInfo {
 	info := &QueryInfo{}
 	// Always use context if available to capture previous answers
 	// Put context first so previous answers are found
 	textToAnalyze := userInput
-	if context != "" {
-		textToAnalyze = context + " " + userInput
+	if history != "" {
+		textToAnalyze = history + " " + userInput
 	}
 	lower := strings.ToLower(textToAnalyze)
 
@@ -978,6 +1185,9 @@ func extractQueryInfoFallback(userInput, context string) *QueryInfo {
 		"mutual fund":   "mutual fund",
 		"mf":            "mutual fund",
 	}
+	for _, name := range tunablesFrom(ctx).Usecases() {
+		usecaseKeywords[name] = name
+	}
 	for keyword, usecase := range usecaseKeywords {
 		if (strings.Contains(lower, keyword) && strings.Contains(lower, "usecase")) ||
 			(strings.Contains(lower, "build") && strings.Contains(lower, keyword)) {
@@ -985,6 +1195,10 @@ func extractQueryInfoFallback(userInput, context string) *QueryInfo {
 			break
 		}
 	}
+	// Identity onboarding is named by what it acts on rather than as a usecase
+	if info.UseCase == "" && (strings.Contains(lower, "identity") || strings.Contains(lower, "onboard")) {
+		info.UseCase = "identity"
+	}
 
 	// Extract operation type
 	// CRITICAL: Do NOT infer operation from "build" - "build X usecase" is not an operation
@@ -994,7 +1208,15 @@ func extractQueryInfoFallback(userInput, context string) *QueryInfo {
 	
 	// Only extract operation if it's explicitly mentioned AND not in "build usecase" context
 	if !isBuildUsecaseRequest {
-		if strings.Contains(lower, "create") || strings.Contains(lower, "issue") {
+		// Identity operations first: "issue certificate" is not an asset issue
+		if strings.Contains(lower, "certificate") || strings.Contains(lower, "certify") {
+			info.Operation = "certify"
+		} else if strings.Contains(lower, "key-value") || strings.Contains(lower, "key value") ||
+			(strings.Contains(lower, "store") && strings.Contains(lower, "value")) {
+			info.Operation = "store"
+		} else if strings.Contains(lower, "register") || strings.Contains(lower, "onboard") {
+			info.Operation = "register"
+		} else if strings.Contains(lower, "create") || strings.Contains(lower, "issue") {
 			info.Operation = "create"
 		} else if strings.Contains(lower, "burn") || strings.Contains(lower, "manage") {
 			info.Operation = "burn"
@@ -1003,6 +1225,10 @@ func extractQueryInfoFallback(userInput, context string) *QueryInfo {
 		}
 	}
 	// If user says "build X usecase" without explicit operation, leave operation empty
+	if info.UseCase == "identity" && info.Operation == "create" {
+		// Creating an identity is registering it
+		info.Operation = "register"
+	}
 
 	// Check for async - look for explicit mentions or yes/no answers to async questions
 	if strings.Contains(lower, "async") || strings.Contains(lower, "asynchronous") {
@@ -1022,7 +1248,7 @@ func extractQueryInfoFallback(userInput, context string) *QueryInfo {
 			asyncTrue := true
 			info.IsAsync = &asyncTrue
 		}
-	} else if context != "" {
+	} else if history != "" {
 		// Look for yes/no answers to async questions in context
 		// Pattern: question about async followed by yes/no
 		if (strings.Contains(lower, "async") || strings.Contains(lower, "asynchronous")) &&
@@ -1102,40 +1328,46 @@ func GenerateFollowUpQuestions(ctx context.Context, info *QueryInfo, llm llms.Mo
 	// If usecase is mentioned but operation is not specified, ask about operation FIRST
 	// Do NOT ask the 4 questions until operation is selected
 	if info.UseCase != "" && info.Operation == "" {
+		var choices strings.Builder
+		for _, op := range operationsFor(info.UseCase) {
+			fmt.Fprintf(&choices, "- %s (%s API)\n", op.Label, op.API)
+		}
 		operationPrompt := fmt.Sprintf(`The user wants to build a %s usecase. Ask them which operation they want to perform:
-- Create/Issue (req issue API)
-- Burn/Manage (req manage API)
-- Trade/Settle (req settle API)
-
-Generate a friendly question asking which operation they want. Return ONLY the question.`, info.UseCase)
+%s
+Generate a friendly question asking which operation they want. Return ONLY the question.`, info.UseCase, choices.String())
 
-		response, err := llms.GenerateFromSinglePrompt(ctx, llm, operationPrompt, llms.WithTemperature(0.3))
+		response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "followup", operationPrompt), llms.WithTemperature(0.3))
 		if err != nil {
 			// Fallback: return a clear question about operation
-			return fmt.Sprintf("For %s usecase, which operation do you want to perform?\n\n- CREATE/ISSUE → use req issue API\n- BURN/MANAGE → use req manage API\n- TRADE/SETTLE → use req settle API\n\nPlease specify: create, burn, or trade", info.UseCase), nil
+			TraceFrom(ctx).noteError(fmt.Errorf("%w: ask for operation: %w", ErrLLMUnavailable, err))
+			return OperationQuestion(info.UseCase), nil
 		}
 		return strings.TrimSpace(response), nil
 	}
 
+	questions := questionsFrom(ctx)
 	var missing []string
 
-	if info.IsAsync == nil {
+	if info.IsAsync == nil && questions.Requires(info.UseCase, config.QuestionAsync) {
 		missing = append(missing, "Is this request async? (yes/no)")
 	}
-	if info.IsUMICompliant == nil {
-		missing = append(missing, "Is this UMI compliant? (yes/no)")
+	if info.IsUMICompliant == nil && questions.Requires(info.UseCase, config.QuestionUMICompliant) {
+		missing = append(missing, fmt.Sprintf("Is this %s compliant? (yes/no)", personaFrom(ctx).ProductName))
 	}
-	if info.IsPrivate == nil {
+	if info.IsPrivate == nil && questions.Requires(info.UseCase, config.QuestionPrivacy) {
 		missing = append(missing, "Is this private or public?")
 	}
-	if len(info.FieldNames) == 0 {
+	needFields := len(info.FieldNames) == 0 && questions.Requires(info.UseCase, config.QuestionFields)
+	if needFields && info.Operation == "store" {
+		missing = append(missing, "Please provide the values to store as key=value pairs (e.g., maxLimit=100, region=south)")
+	} else if needFields {
 		// If usecase is known, suggest usecase-specific fields (but don't require all of them)
 		if info.UseCase != "" {
 			op := info.Operation
 			if op == "" {
-				op = "create"
+				op = defaultOperation(info.UseCase)
 			}
-			suggestedFields := getUsecaseFields(info.UseCase, op)
+			suggestedFields := getUsecaseFields(ctx, info.UseCase, op)
 			if len(suggestedFields) > 0 {
 				fieldsStr := strings.Join(suggestedFields, ", ")
 				missing = append(missing, fmt.Sprintf("Please provide at least one field name for the REQUEST payload. Suggested fields for %s (%s): %s", info.UseCase, op, fieldsStr))
@@ -1181,9 +1413,10 @@ CRITICAL: Generate ONE single question that asks for ALL %d items above.
 
 Return ONLY the single question text. Be friendly and clear.`, numMissing, missingList, numMissing)
 
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, questionPrompt, llms.WithTemperature(0.3))
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "followup", questionPrompt), llms.WithTemperature(0.3))
 	if err != nil {
 		// Fallback: format all missing items in one clear question
+		TraceFrom(ctx).noteError(fmt.Errorf("%w: ask follow-up questions: %w", ErrLLMUnavailable, err))
 		formattedMissing := ""
 		for i, item := range missing {
 			formattedMissing += fmt.Sprintf("%d. %s\n", i+1, item)
@@ -1194,8 +1427,15 @@ Return ONLY the single question text. Be friendly and clear.`, numMissing, missi
 	return strings.TrimSpace(response), nil
 }
 
-// AnswerFieldQuestion answers questions about fields without suggesting APIs
+// AnswerFieldQuestion answers questions about fields without suggesting APIs.
+// history holds earlier questions about fields and their answers, used only
+// to work out what the question refers to; it may be empty.
 func AnswerFieldQuestion(ctx context.Context, userInput, history string, llm llms.Model) (string, error) {
+	// Error codes the docs list are answered from them, not from the model
+	if answer, ok := ErrorCodeAnswer(catalogFrom(ctx), userInput); ok {
+		return answer, nil
+	}
+
 	// Check if user is asking about UMI specifically
 	lower := strings.ToLower(userInput)
 
@@ -1211,12 +1451,12 @@ func AnswerFieldQuestion(ctx context.Context, userInput, history string, llm llm
 		return "UMI stands for **Unified Market Interface**. It's a compliance standard that ensures interoperability and standardization across different market participants and systems. When a request is UMI compliant, it means it adheres to the Unified Market Interface specifications for data exchange and communication protocols.", nil
 	}
 
-	// Check for async field question - provide UMI project-specific answer
+	// Check for async field question - provide a project-specific answer
 	if strings.Contains(lower, "async") && (strings.Contains(lower, "what is") ||
 		strings.Contains(lower, "explain") || strings.Contains(lower, "what does") ||
 		strings.Contains(lower, "field") || strings.Contains(lower, "sync vs async") ||
 		strings.Contains(lower, "sync versus async") || strings.Contains(lower, "difference")) {
-		return `In the UMI project, the **async** field (or **isAsync**) is a boolean flag in the request context that determines how the API request is processed.
+		return trimAnswer(ctx, personaFrom(ctx).Render(`In the {{product}} project, the **async** field (or **isAsync**) is a boolean flag in the request context that determines how the API request is processed.
 
 **Async Flow (isAsync = true):**
 1. FSP commits the transaction on DLT (Distributed Ledger Technology)
@@ -1227,34 +1467,41 @@ func AnswerFieldQuestion(ctx context.Context, userInput, history string, llm llm
 **Sync Flow (isAsync = false or omitted):**
 The API processes the request synchronously, waiting for the operation to complete before returning a response.
 
-When you set 'isAsync: true' in your request, the system follows the async flow where the transaction is committed on DLT first, then events are propagated through gRPC and Kafka for backend processing.`, nil
+When you set 'isAsync: true' in your request, the system follows the async flow where the transaction is committed on DLT first, then events are propagated through gRPC and Kafka for backend processing.`)), nil
 	}
 
-	// Don't use history for field questions - answer based on current question only
-	// This prevents confusion from previous questions
-	answerPrompt := fmt.Sprintf(`You are an AI agent for the UMI (Unified Market Interface) project. You provide answers ONLY related to this project.
-
-User question: %q
+	// Earlier questions only help resolve references such as "what about X?"
+	earlier := ""
+	if history != "" {
+		earlier = fmt.Sprintf("\nEarlier questions in this conversation, with your answers:\n%s\n", history)
+	}
+	persona := personaFrom(ctx)
+	answerPrompt := fmt.Sprintf(`You are an AI agent for the %[2]s (%[1]s) project. You provide answers ONLY related to this project.
+%[5]s
+User question: %[3]q
 
 IMPORTANT RULES:
-- You are an AI agent of the UMI project - give answers ONLY related to this project.
+- You are an AI agent of the %[2]s project - give answers ONLY related to this project.
 - If the user asks about "UMI" or "UMI compliant", explain that UMI stands for "Unified Market Interface" and it's a compliance standard for this project.
-- If the user asks about "async" or "isAsync" or "sync vs async", explain the UMI project-specific flow:
+- If the user asks about "async" or "isAsync" or "sync vs async", explain the %[2]s project-specific flow:
   * Async flow: FSP commits on DLT → Chaincode sends event to FSP via gRPC → FSP produces event in Kafka → Backend consumes from Kafka
   * Sync flow: API processes synchronously, waiting for operation to complete
-- Answer ONLY the current question. Do NOT reference previous questions or answers.
-- Answer the question clearly and concisely with UMI project-specific context.
+- Answer ONLY the current question. Use earlier questions only to work out what it refers to, e.g. "what about X?" asks the same about X; do NOT repeat their answers.
+- Answer the question clearly and concisely with %[2]s project-specific context.
 - Do NOT suggest any APIs or generate payloads unless explicitly asked.
-- Just explain what the field is, what it does, or answer their question directly in the context of the UMI project.
+- Just explain what the field is, what it does, or answer their question directly in the context of the %[2]s project.
+- If one of your tools can answer the question, e.g. whether the network is up, call it and answer from its result instead of redirecting.
+
+If the question is not related to the %[2]s project, politely redirect: %[4]q
 
-If the question is not related to the UMI project, politely redirect: "I'm an AI agent for the UMI project. I can only answer questions related to this project. How can I help you with UMI-related questions?"
+If you don't know the answer, say so politely.`, persona.ProductFullName, persona.ProductName, userInput, persona.Render(persona.OffTopicAnswer), earlier)
 
-If you don't know the answer, say so politely.`, userInput)
+	answerPrompt += glossarySection(ctx) + verbosityInstruction(ctx)
 
-	response, err := llms.GenerateFromSinglePrompt(ctx, llm, answerPrompt, llms.WithTemperature(0.3))
+	response, err := llms.GenerateFromSinglePrompt(ctx, llm, withAddendum(ctx, "answer", answerPrompt), llms.WithTemperature(0.3))
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: answer question: %w", ErrLLMUnavailable, err)
 	}
 
-	return strings.TrimSpace(response), nil
+	return trimAnswer(ctx, response), nil
 }
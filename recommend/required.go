@@ -0,0 +1,119 @@
+package recommend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	model "api-recommender/api-parser"
+	"api-recommender/payload"
+)
+
+// ErrMissingRequiredFields is matched by a *MissingFieldsError.
+var ErrMissingRequiredFields = errors.New("missing required fields")
+
+// MissingFieldsError is returned by Recommend1 when the chosen API has
+// required fields the request doesn't provide. No payload is generated
+// until they are.
+type MissingFieldsError struct {
+	API    model.APIDoc
+	Fields []model.APIField
+}
+
+func (e *MissingFieldsError) Error() string {
+	names := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		names[i] = f.Name
+	}
+	return fmt.Sprintf("%s: %s needs %s", ErrMissingRequiredFields, e.API.Name, strings.Join(names, ", "))
+}
+
+func (e *MissingFieldsError) Unwrap() error { return ErrMissingRequiredFields }
+
+// MissingRequiredFields returns the required fields of api without a
+// default that info provides neither as a requested field nor as a
+// key=value entry. A field is provided by its full name or, for dotted
+// names such as context.requestId, by its last part.
+func MissingRequiredFields(api model.APIDoc, info *QueryInfo) []model.APIField {
+	provided := map[string]bool{}
+	if info != nil {
+		for _, name := range info.FieldNames {
+			provided[strings.ToLower(name)] = true
+		}
+		for _, p := range info.KeyValues {
+			provided[strings.ToLower(p.Name)] = true
+		}
+	}
+	var missing []model.APIField
+	for _, f := range api.Fields {
+		if !f.Required || f.Default != "" {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		short := name[strings.LastIndex(name, ".")+1:]
+		if !provided[name] && !provided[short] {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// withDefaults returns info with the defaults of api's required fields
+// that info gives no value for added as key=value entries, so they are
+// placed in the payload like the user's. info itself is left as it is.
+func withDefaults(api model.APIDoc, info *QueryInfo) *QueryInfo {
+	valued := map[string]bool{}
+	if info != nil {
+		for _, p := range info.KeyValues {
+			valued[strings.ToLower(p.Name)] = true
+		}
+	}
+	var defaults []payload.Pair
+	for _, f := range api.Fields {
+		// A parameter's default is filled into the URL or headers instead
+		if !f.Required || f.Default == "" || f.IsParameter() {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		if !valued[name] && !valued[name[strings.LastIndex(name, ".")+1:]] {
+			defaults = append(defaults, payload.Pair{Name: f.Name, Value: f.Default})
+		}
+	}
+	if len(defaults) == 0 {
+		return info
+	}
+
+	filled := QueryInfo{}
+	if info != nil {
+		filled = *info
+	}
+	filled.KeyValues = append(append([]payload.Pair(nil), filled.KeyValues...), defaults...)
+	filled.FieldNames = append([]string(nil), filled.FieldNames...)
+	for _, d := range defaults {
+		if !slices.ContainsFunc(filled.FieldNames, func(n string) bool { return strings.EqualFold(n, d.Name) }) {
+			filled.FieldNames = append(filled.FieldNames, d.Name)
+		}
+	}
+	return &filled
+}
+
+// RequiredFieldsQuestion asks for the required fields err lists.
+func RequiredFieldsQuestion(err *MissingFieldsError) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "To proceed with %s (%s %s), I need these required fields:\n", err.API.Name, err.API.Method, err.API.Path)
+	examples := make([]string, len(err.Fields))
+	for i, f := range err.Fields {
+		fmt.Fprintf(&b, "%d. %s", i+1, f.Name)
+		if f.Type != "" {
+			fmt.Fprintf(&b, " (%s)", f.Type)
+		}
+		if f.Description != "" {
+			b.WriteString(": " + f.Description)
+		}
+		b.WriteString("\n")
+		examples[i] = f.Name + "=..."
+	}
+	fmt.Fprintf(&b, "Please reply with them as key=value pairs, e.g. %s", strings.Join(examples, ", "))
+	return b.String()
+}
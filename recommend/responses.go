@@ -0,0 +1,109 @@
+package recommend
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	model "api-recommender/api-parser"
+)
+
+// responsePhrases ask what an API sends back.
+var responsePhrases = regexp.MustCompile(`\bwhat (does|do|will|would) .{0,60}\b(return|respond with|send back|give back|reply with)\b|\bwhat do (i|we) get back\b|\b(response|return) (schema|body|fields|codes?|type|format)\b|\bresponses? (of|for|from)\b`)
+
+// reRecommendedPath finds the paths of the APIs recommended in a history.
+var reRecommendedPath = regexp.MustCompile(`(?m)^\s*Path: (\S+)`)
+
+// IsResponseQuery reports whether the user is asking what an API returns
+// rather than making a request.
+func IsResponseQuery(userInput string) bool {
+	return responsePhrases.MatchString(strings.ToLower(userInput))
+}
+
+// ResponseAPI finds the API a response question is about: the one it names,
+// by path or by name, or else the one recommended last in history.
+func ResponseAPI(apis []model.APIDoc, input, history string) (model.APIDoc, bool) {
+	if api, ok := mentionedAPI(apis, input); ok {
+		return api, true
+	}
+	paths := reRecommendedPath.FindAllStringSubmatch(history, -1)
+	if paths == nil {
+		return model.APIDoc{}, false
+	}
+	last := paths[len(paths)-1][1]
+	for _, a := range apis {
+		if a.Path == last {
+			return a, true
+		}
+	}
+	return model.APIDoc{}, false
+}
+
+// mentionedAPI finds the API a question is about, named as a request
+// would name it, by its bare name, or by its last path segment written with
+// spaces ("req issue" for /v1/ReqIssue).
+func mentionedAPI(apis []model.APIDoc, input string) (model.APIDoc, bool) {
+	for _, a := range apis {
+		if requestsAPI(input, a) {
+			return a, true
+		}
+	}
+	lower := strings.ToLower(input)
+	for _, a := range apis {
+		if a.Name != "" && regexp.MustCompile(`\b`+regexp.QuoteMeta(strings.ToLower(a.Name))+`\b`).MatchString(lower) {
+			return a, true
+		}
+	}
+	squashed := strings.Join(strings.Fields(lower), "")
+	for _, a := range apis {
+		if base := strings.ToLower(path.Base(a.Path)); len(base) >= 6 && strings.Contains(squashed, base) {
+			return a, true
+		}
+	}
+	return model.APIDoc{}, false
+}
+
+// ResponseSummary describes what api returns: each documented status with
+// its description and fields.
+func ResponseSummary(api model.APIDoc) string {
+	name := fmt.Sprintf("%s %s", api.Method, api.Path)
+	if api.Name != "" {
+		name += fmt.Sprintf(" (%s)", api.Name)
+	}
+	if len(api.Responses) == 0 {
+		return fmt.Sprintf("The docs don't describe what %s returns.", name)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s returns:\n", name)
+	writeResponses(&b, api.Responses)
+	return strings.TrimSpace(b.String())
+}
+
+// ResponseLines lists api's responses as the lines of a recommendation's
+// "Returns" section, or nil when the docs describe none.
+func ResponseLines(api model.APIDoc) []string {
+	if len(api.Responses) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	writeResponses(&b, api.Responses)
+	return strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+}
+
+func writeResponses(b *strings.Builder, responses []model.APIResponse) {
+	for _, r := range responses {
+		fmt.Fprintf(b, " - %s", r.Status)
+		if r.Description != "" {
+			fmt.Fprintf(b, ": %s", r.Description)
+		}
+		b.WriteString("\n")
+		for _, f := range r.Fields {
+			fmt.Fprintf(b, "   - %s (%s)", f.Name, f.Type)
+			if f.Description != "" {
+				fmt.Fprintf(b, ": %s", f.Description)
+			}
+			b.WriteString("\n")
+		}
+	}
+}
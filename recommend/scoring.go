@@ -0,0 +1,259 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	model "api-recommender/api-parser"
+	"api-recommender/config"
+
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+// Signals a Scorer combines, as named in APIScore.Signals.
+const (
+	SignalModel     = "model"
+	SignalEmbedding = "embedding"
+	SignalRules     = "rules"
+	SignalHistory   = "history"
+)
+
+// unratedAcceptance is the history signal of an API nobody has rated yet,
+// halfway between always rejected and always accepted.
+const unratedAcceptance = 0.5
+
+// operationAPITypes maps operations to the kind of API that carries them.
+var operationAPITypes = map[string]string{
+	"create":   "req issue",
+	"burn":     "req manage",
+	"trade":    "req settle",
+	"register": "req issue",
+	"certify":  "req issue",
+	"store":    "req transact",
+}
+
+// APIScore is how one candidate API scored. Signals holds each signal
+// that was weighed, between 0 and 1; Total is their weighted sum.
+type APIScore struct {
+	API     string             `json:"api"`
+	Path    string             `json:"path"`
+	Signals map[string]float64 `json:"signals"`
+	Total   float64            `json:"total"`
+}
+
+// ScoreReport is how the API for a request was chosen.
+type ScoreReport struct {
+	Weights config.Scoring `json:"weights"`
+	Scores  []APIScore     `json:"scores"`
+	Chosen  string         `json:"chosen"`
+	// Notes are signals that couldn't be worked out, e.g. because the
+	// embedding model failed.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Scorer chooses among candidate APIs by the weighted sum of several
+// signals rather than by the model's pick alone.
+type Scorer struct {
+	Weights config.Scoring
+	// Embedder embeds requests and API descriptions for the embedding
+	// signal; without one the signal is left out.
+	Embedder embeddings.EmbedderClient
+	// Acceptance returns the share of accepted recommendations per API
+	// name, for the history signal; APIs missing from it count as unrated.
+	Acceptance func(context.Context) (map[string]float64, error)
+
+	mu sync.Mutex
+	// vectors caches API embeddings by the text embedded.
+	vectors map[string][]float32
+}
+
+type scorerKey struct{}
+
+// WithScorer makes Recommend1 run with ctx choose the API with scorer.
+func WithScorer(ctx context.Context, scorer *Scorer) context.Context {
+	return context.WithValue(ctx, scorerKey{}, scorer)
+}
+
+func scorerFrom(ctx context.Context) *Scorer {
+	s, _ := ctx.Value(scorerKey{}).(*Scorer)
+	return s
+}
+
+// Choose scores apis for request and returns the index of the best one.
+// picked is the model's pick, or -1 when it gave none; ties go to it, then
+// to catalog order. ok is false when no API scored above 0.
+func (s *Scorer) Choose(ctx context.Context, apis []model.APIDoc, request string, info *QueryInfo, picked int) (int, *ScoreReport, bool) {
+	report := &ScoreReport{Weights: s.Weights, Scores: make([]APIScore, len(apis))}
+	for i, a := range apis {
+		report.Scores[i] = APIScore{API: a.Name, Path: a.Path, Signals: map[string]float64{}}
+	}
+	set := func(signal string, weight float64, values []float64) {
+		for i, v := range values {
+			report.Scores[i].Signals[signal] = round(v)
+			report.Scores[i].Total += weight * v
+		}
+	}
+
+	if w := s.Weights.Model; w > 0 {
+		values := make([]float64, len(apis))
+		if picked >= 0 && picked < len(apis) {
+			values[picked] = 1
+		}
+		set(SignalModel, w, values)
+	}
+	if w := s.Weights.Rules; w > 0 {
+		domains := DetectDomains(apis, request, info)
+		values := make([]float64, len(apis))
+		for i, a := range apis {
+			values[i] = ruleScore(a, request, info, domains)
+		}
+		set(SignalRules, w, values)
+	}
+	if w := s.Weights.History; w > 0 && s.Acceptance != nil {
+		if rates, err := s.Acceptance(ctx); err != nil {
+			report.Notes = append(report.Notes, fmt.Sprintf("history left out: %v", err))
+		} else {
+			values := make([]float64, len(apis))
+			for i, a := range apis {
+				values[i] = unratedAcceptance
+				if rate, ok := rates[a.Name]; ok {
+					values[i] = rate
+				}
+			}
+			set(SignalHistory, w, values)
+		}
+	}
+	if w := s.Weights.Embedding; w > 0 && s.Embedder != nil {
+		if values, err := s.similarities(ctx, apis, request, info); err != nil {
+			report.Notes = append(report.Notes, fmt.Sprintf("embedding left out: %v", err))
+		} else {
+			set(SignalEmbedding, w, values)
+		}
+	}
+
+	best := -1
+	for i := range report.Scores {
+		report.Scores[i].Total = round(report.Scores[i].Total)
+		if report.Scores[i].Total <= 0 {
+			continue
+		}
+		if best < 0 || report.Scores[i].Total > report.Scores[best].Total ||
+			report.Scores[i].Total == report.Scores[best].Total && i == picked {
+			best = i
+		}
+	}
+	if best >= 0 {
+		report.Chosen = apis[best].Name
+	}
+	sort.SliceStable(report.Scores, func(i, j int) bool { return report.Scores[i].Total > report.Scores[j].Total })
+	return best, report, best >= 0
+}
+
+// ruleScore scores how well api fits the request by keyword rules: being
+// named outright decides it, and the operation's API type, the request's
+// groups and its usecase each add to it.
+func ruleScore(api model.APIDoc, request string, info *QueryInfo, domains []string) float64 {
+	if requestsAPI(request, api) {
+		return 1
+	}
+	score := 0.0
+	text := strings.ToLower(api.Name + " " + api.Path)
+	if info != nil {
+		if apiType, ok := operationAPITypes[info.Operation]; ok {
+			if strings.Contains(text, strings.TrimPrefix(apiType, "req ")) {
+				score += 0.6
+			}
+		}
+		if useCase := strings.ToLower(strings.TrimSpace(info.UseCase)); useCase != "" &&
+			strings.Contains(strings.ToLower(api.Description), useCase) {
+			score += 0.2
+		}
+	}
+	for _, d := range domains {
+		if api.HasTag(d) {
+			score += 0.3
+			break
+		}
+	}
+	return math.Min(score, 1)
+}
+
+// similarities returns how close the request is to each API by the cosine
+// similarity of their embeddings, with opposite directions counted as 0.
+// API embeddings are kept, so only the request is embedded once the
+// catalog has been seen.
+func (s *Scorer) similarities(ctx context.Context, apis []model.APIDoc, request string, info *QueryInfo) ([]float64, error) {
+	if info != nil && info.UseCase != "" {
+		request += " (usecase: " + info.UseCase + ")"
+	}
+	texts := make([]string, len(apis))
+	for i, a := range apis {
+		texts[i] = embeddingText(a)
+	}
+
+	s.mu.Lock()
+	if s.vectors == nil {
+		s.vectors = map[string][]float32{}
+	}
+	batch := []string{request}
+	for _, t := range texts {
+		if _, ok := s.vectors[t]; !ok && !slices.Contains(batch[1:], t) {
+			batch = append(batch, t)
+		}
+	}
+	s.mu.Unlock()
+
+	vectors, err := s.Embedder.CreateEmbedding(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(batch) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(batch))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range batch[1:] {
+		s.vectors[t] = vectors[i+1]
+	}
+	values := make([]float64, len(apis))
+	for i, t := range texts {
+		values[i] = math.Max(cosine(vectors[0], s.vectors[t]), 0)
+	}
+	return values, nil
+}
+
+// embeddingText describes api for embedding.
+func embeddingText(api model.APIDoc) string {
+	text := fmt.Sprintf("%s %s %s - %s", api.Name, api.Method, api.Path, api.Description)
+	if len(api.Tags) > 0 {
+		text += " (groups: " + strings.Join(api.Tags, ", ") + ")"
+	}
+	return text
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// round keeps scores readable in traces.
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,145 @@
+package recommend
+
+import (
+	"context"
+	"strings"
+
+	"api-recommender/payload"
+)
+
+// shorthandOperations maps the verbs the single-shot syntax starts with to
+// the operations ExtractQueryInfo would extract for them.
+var shorthandOperations = map[string]string{
+	"create":   "create",
+	"issue":    "create",
+	"burn":     "burn",
+	"manage":   "burn",
+	"lock":     "burn",
+	"trade":    "trade",
+	"settle":   "trade",
+	"register": "register",
+	"certify":  "certify",
+	"store":    "store",
+}
+
+// ParseShorthand reads the single-shot creation syntax, e.g.
+//
+//	create fd async=yes umi=yes private fields=id,principal,tenure event=id,timestamp
+//
+// without the model: an operation, an optional known usecase, then options.
+// The options are async=yes|no (or a bare sync or async), umi=yes|no,
+// private or public (or privacy=private|public), fields= and event= with
+// comma-separated names, and key=value pairs for the payload. ok is false
+// for anything else, including messages with words that aren't options, so
+// ordinary sentences are left to the model. Usecases configured by the admin
+// (see WithTunables) are known too.
+func ParseShorthand(ctx context.Context, input string) (info *QueryInfo, ok bool) {
+	tokens := strings.Fields(input)
+	if len(tokens) < 2 {
+		return nil, false
+	}
+	operation, ok := shorthandOperations[strings.ToLower(tokens[0])]
+	if !ok {
+		return nil, false
+	}
+	info = &QueryInfo{Operation: operation}
+	rest := tokens[1:]
+	if usecase, n := shorthandUsecase(ctx, rest); n > 0 {
+		info.UseCase, rest = usecase, rest[n:]
+	}
+	if len(rest) == 0 {
+		return nil, false
+	}
+
+	flag := func(b bool) *bool { return &b }
+	for _, tok := range rest {
+		key, value, isPair := strings.Cut(tok, "=")
+		lower := strings.ToLower(key)
+		if !isPair {
+			switch lower {
+			case "sync":
+				info.IsAsync = flag(false)
+			case "async":
+				info.IsAsync = flag(true)
+			case "private":
+				info.IsPrivate = flag(true)
+			case "public":
+				info.IsPrivate = flag(false)
+			default:
+				return nil, false
+			}
+			continue
+		}
+		if key == "" || value == "" {
+			return nil, false
+		}
+		switch lower {
+		case "async":
+			if info.IsAsync, ok = shorthandBool(value); !ok {
+				return nil, false
+			}
+		case "umi":
+			if info.IsUMICompliant, ok = shorthandBool(value); !ok {
+				return nil, false
+			}
+		case "privacy":
+			switch strings.ToLower(value) {
+			case "private":
+				info.IsPrivate = flag(true)
+			case "public":
+				info.IsPrivate = flag(false)
+			default:
+				return nil, false
+			}
+		case "fields":
+			info.FieldNames = append(info.FieldNames, shorthandList(value)...)
+		case "event", "events":
+			info.EventFields = append(info.EventFields, shorthandList(value)...)
+		default:
+			info.KeyValues = append(info.KeyValues, payload.Pair{Name: key, Value: value})
+		}
+	}
+	return info, true
+}
+
+// shorthandUsecase matches the longest known usecase at the start of
+// tokens, returning it and how many tokens it took.
+func shorthandUsecase(ctx context.Context, tokens []string) (string, int) {
+	known := map[string]bool{}
+	for name := range usecaseFieldMap {
+		known[name] = true
+	}
+	for _, name := range tunablesFrom(ctx).Usecases() {
+		known[strings.ToLower(name)] = true
+	}
+	best, taken := "", 0
+	for n := 1; n <= len(tokens) && n <= 3; n++ {
+		candidate := strings.ToLower(strings.Join(tokens[:n], " "))
+		if known[candidate] {
+			best, taken = candidate, n
+		}
+	}
+	return best, taken
+}
+
+func shorthandBool(value string) (*bool, bool) {
+	var b bool
+	switch strings.ToLower(value) {
+	case "yes", "y", "true":
+		b = true
+	case "no", "n", "false":
+	default:
+		return nil, false
+	}
+	return &b, true
+}
+
+func shorthandList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,15 @@
+package recommend
+
+import (
+	"regexp"
+	"strings"
+)
+
+// simulatePhrases ask what happens to a payload once it is sent.
+var simulatePhrases = regexp.MustCompile(`\b(simulate|simulation|dry[ -]?run)\b|\bwalk me through\b|\bwhat happens (next|after|downstream|when i (send|submit|call))\b|\btrace (the |this )?(flow|request|payload)\b`)
+
+// IsSimulateQuery reports whether the user is asking for a walkthrough of
+// the downstream flow of a payload rather than making a request.
+func IsSimulateQuery(userInput string) bool {
+	return simulatePhrases.MatchString(strings.ToLower(userInput))
+}
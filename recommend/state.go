@@ -0,0 +1,103 @@
+package recommend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// QueryInfoVersion is the version of the stored QueryInfo format that
+// MarshalQueryInfo writes. Bump it with any change to QueryInfo that would
+// misread what earlier versions stored, and add the migration from the
+// previous version to queryInfoMigrations.
+const QueryInfoVersion = 2
+
+// ErrQueryInfoVersion is returned for stored QueryInfo this build can't
+// read, such as one written by a newer release after a rollback.
+var ErrQueryInfoVersion = errors.New("unsupported query info version")
+
+// storedQueryInfo is the stored form of a QueryInfo. Its key isn't
+// "version", which QueryInfo already uses for context.version.
+type storedQueryInfo struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	QueryInfo     json.RawMessage `json:"queryInfo"`
+}
+
+// queryInfoMigrations upgrade the fields of a stored QueryInfo one version
+// at a time: the migration at index v-1 turns version v into v+1.
+var queryInfoMigrations = []func(fields map[string]any) error{
+	migrateOperationWords,
+}
+
+// migrateOperationWords upgrades version 1, the bare QueryInfo JSON stored
+// before it was versioned. It kept the operation as the model worded it,
+// e.g. "issue" or "settle", which the operation lookups don't know.
+func migrateOperationWords(fields map[string]any) error {
+	if op, ok := fields["operation"].(string); ok {
+		fields["operation"] = canonicalOperation(op)
+	}
+	return nil
+}
+
+// canonicalOperation maps an operation word to the operation it stands
+// for, as the single-shot syntax does, leaving words it doesn't know alone.
+func canonicalOperation(op string) string {
+	if canonical, ok := shorthandOperations[op]; ok {
+		return canonical
+	}
+	return op
+}
+
+// MarshalQueryInfo encodes info for storage, tagged with QueryInfoVersion
+// so UnmarshalQueryInfo can upgrade it after QueryInfo changes.
+func MarshalQueryInfo(info *QueryInfo) ([]byte, error) {
+	if info != nil && info.Operation != canonicalOperation(info.Operation) {
+		copied := *info
+		copied.Operation = canonicalOperation(info.Operation)
+		info = &copied
+	}
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedQueryInfo{SchemaVersion: QueryInfoVersion, QueryInfo: raw})
+}
+
+// UnmarshalQueryInfo decodes a QueryInfo stored by MarshalQueryInfo, or by
+// a release before it, running the migrations from the version it was
+// stored with. A QueryInfo from a newer version is ErrQueryInfoVersion.
+func UnmarshalQueryInfo(data []byte) (*QueryInfo, error) {
+	version, raw := 1, data
+	var stored storedQueryInfo
+	if err := json.Unmarshal(data, &stored); err == nil && stored.SchemaVersion > 0 && len(stored.QueryInfo) > 0 {
+		version, raw = stored.SchemaVersion, stored.QueryInfo
+	}
+	if version > QueryInfoVersion {
+		return nil, fmt.Errorf("%w: %d is newer than %d", ErrQueryInfoVersion, version, QueryInfoVersion)
+	}
+
+	info := &QueryInfo{}
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return info, nil
+	}
+	if version < QueryInfoVersion {
+		var fields map[string]any
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		for v := version; v < QueryInfoVersion; v++ {
+			if err := queryInfoMigrations[v-1](fields); err != nil {
+				return nil, fmt.Errorf("migrate query info from version %d: %w", v, err)
+			}
+		}
+		var err error
+		if raw, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(raw, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,17 @@
+package recommend
+
+import (
+	"regexp"
+	"strings"
+)
+
+// statusPhrases are questions about whether the network or the service is
+// working right now, e.g. "is the settlement network up?".
+var statusPhrases = regexp.MustCompile(`\b(network|settlement|ledger|dlt|nodes?|chain)\b.*\b(up|down|status|online|offline|outage|available|working|healthy|degraded)\b|\b(status|outage|health) of\b.*\b(network|settlement|ledger|dlt|nodes?|chain)\b`)
+
+// IsStatusQuery reports whether the user is asking about the live status of
+// the network rather than about an API. Such questions can only be answered
+// with a status tool.
+func IsStatusQuery(userInput string) bool {
+	return statusPhrases.MatchString(strings.ToLower(userInput))
+}
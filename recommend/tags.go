@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"regexp"
+	"strings"
+
+	model "api-recommender/api-parser"
+)
+
+// minStemMatch is how many leading letters a word of the request must share
+// with a word of a tag to name it, so "settle" finds "Settlement" and
+// "tokenize" finds "Tokenization" while "transfer" doesn't find
+// "Transactions".
+const minStemMatch = 6
+
+var reWord = regexp.MustCompile(`[\pL\pN]+`)
+
+// DetectDomains returns the catalog groups the request is about: the tags
+// of apis that the request or its usecase mentions, in catalog order. Tags
+// named after an API type, such as issue or settle, are also found through
+// the request's operation, so "transfer my bond" is about settle.
+func DetectDomains(apis []model.APIDoc, request string, info *QueryInfo) []string {
+	text := request
+	if info != nil && info.UseCase != "" {
+		text += " " + info.UseCase
+	}
+	if info != nil {
+		if apiType, ok := operationAPITypes[info.Operation]; ok {
+			text += " " + strings.TrimPrefix(apiType, "req ")
+		}
+	}
+	words := reWord.FindAllString(strings.ToLower(text), -1)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var domains []string
+	for _, tag := range model.Tags(apis) {
+		if mentionsTag(words, tag) {
+			domains = append(domains, tag)
+		}
+	}
+	return domains
+}
+
+// mentionsTag reports whether every word of tag is among words, exactly or
+// by a shared stem.
+func mentionsTag(words []string, tag string) bool {
+	tagWords := reWord.FindAllString(strings.ToLower(tag), -1)
+	if len(tagWords) == 0 {
+		return false
+	}
+	for _, tw := range tagWords {
+		found := false
+		for _, w := range words {
+			if w == tw || sharesStem(w, tw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sharesStem(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < minStemMatch || len(rb) < minStemMatch {
+		return false
+	}
+	for i := 0; i < minStemMatch; i++ {
+		if ra[i] != rb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// domainAPIs narrows apis to the groups the request is about, keeping any
+// API the request names outright. Without a detected group, or when none
+// of the APIs is in one, apis is returned as it is.
+func domainAPIs(apis []model.APIDoc, request string, info *QueryInfo) []model.APIDoc {
+	domains := DetectDomains(apis, request, info)
+	if len(domains) == 0 {
+		return apis
+	}
+	var out []model.APIDoc
+	for _, a := range apis {
+		if requestsAPI(request, a) {
+			out = append(out, a)
+			continue
+		}
+		for _, d := range domains {
+			if a.HasTag(d) {
+				out = append(out, a)
+				break
+			}
+		}
+	}
+	if len(out) == 0 {
+		return apis
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package recommend
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stages of a turn timed by a Trace.
+const (
+	StageClassification = "classification"
+	StageExtraction     = "extraction"
+	StageSelection      = "selection"
+	StagePayload        = "payload"
+)
+
+// Timings is how long the stages of a turn took, in milliseconds. A stage
+// that didn't run is 0; Total covers the whole turn, stages and all.
+type Timings struct {
+	ClassificationMs int64 `json:"classificationMs"`
+	ExtractionMs     int64 `json:"extractionMs"`
+	SelectionMs      int64 `json:"selectionMs"`
+	PayloadMs        int64 `json:"payloadMs"`
+	TotalMs          int64 `json:"totalMs"`
+}
+
+// Trace collects how the requests run with a context were handled, for
+// debugging. It is safe for concurrent use.
+type Trace struct {
+	mu      sync.Mutex
+	scoring *ScoreReport
+	stages  map[string]time.Duration
+	errors  []string
+}
+
+type traceKey struct{}
+
+// WithTrace records into t how the requests run with ctx are handled.
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// TraceFrom returns the trace set on ctx, if any.
+func TraceFrom(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// Scoring returns how the last API was chosen, or nil when none was
+// scored.
+func (t *Trace) Scoring() *ScoreReport {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.scoring
+}
+
+func (t *Trace) setScoring(r *ScoreReport) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.scoring = r
+	t.mu.Unlock()
+}
+
+// noteError records an error a step recovered from, e.g. by falling back
+// to keyword rules, so it isn't lost from debug output.
+func (t *Trace) noteError(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.errors = append(t.errors, err.Error())
+	t.mu.Unlock()
+}
+
+// Errors returns the errors steps recovered from, in the order they
+// happened.
+func (t *Trace) Errors() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.errors...)
+}
+
+// Start times stage until the returned func is called, e.g.
+//
+//	defer TraceFrom(ctx).Start(StageExtraction)()
+//
+// A stage run more than once, such as a regenerated payload, adds up. On a
+// nil trace it does nothing.
+func (t *Trace) Start(stage string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.stages == nil {
+			t.stages = map[string]time.Duration{}
+		}
+		t.stages[stage] += time.Since(start)
+	}
+}
+
+// Timings returns the time spent in each stage so far. Total is left for
+// the caller, which knows when the turn started.
+func (t *Trace) Timings() Timings {
+	if t == nil {
+		return Timings{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Timings{
+		ClassificationMs: t.stages[StageClassification].Milliseconds(),
+		ExtractionMs:     t.stages[StageExtraction].Milliseconds(),
+		SelectionMs:      t.stages[StageSelection].Milliseconds(),
+		PayloadMs:        t.stages[StagePayload].Milliseconds(),
+	}
+}
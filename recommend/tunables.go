@@ -0,0 +1,74 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Tunables supplies admin-managed content to the prompts. It is consulted on
+// every request, so edits take effect without a restart.
+type Tunables interface {
+	// PromptAddendum returns extra instructions for the named prompt. ctx
+	// identifies the request, so instructions can differ between sessions.
+	PromptAddendum(ctx context.Context, name string) string
+	// Glossary maps project terms to their definitions.
+	Glossary() map[string]string
+	// UsecaseFields returns the typical fields for a usecase and operation.
+	UsecaseFields(usecase, operation string) ([]string, bool)
+	// Usecases lists the usecases with configured fields.
+	Usecases() []string
+}
+
+type noTunables struct{}
+
+func (noTunables) PromptAddendum(context.Context, string) string { return "" }
+func (noTunables) Glossary() map[string]string                   { return nil }
+func (noTunables) UsecaseFields(string, string) ([]string, bool) { return nil, false }
+func (noTunables) Usecases() []string                            { return nil }
+
+type tunablesKey struct{}
+
+// WithTunables makes requests handled with ctx take admin-managed content
+// from t.
+func WithTunables(ctx context.Context, t Tunables) context.Context {
+	return context.WithValue(ctx, tunablesKey{}, t)
+}
+
+// tunablesFrom returns the source of admin-managed content set on ctx, or
+// one with no content.
+func tunablesFrom(ctx context.Context) Tunables {
+	if t, ok := ctx.Value(tunablesKey{}).(Tunables); ok && t != nil {
+		return t
+	}
+	return noTunables{}
+}
+
+// withAddendum appends the admin's extra instructions for the named prompt.
+func withAddendum(ctx context.Context, name, prompt string) string {
+	if extra := tunablesFrom(ctx).PromptAddendum(ctx, name); extra != "" {
+		return prompt + "\n\nAdditional instructions:\n" + extra
+	}
+	return prompt
+}
+
+// glossarySection lists the admin's glossary for the field-question prompt.
+func glossarySection(ctx context.Context) string {
+	terms := tunablesFrom(ctx).Glossary()
+	if len(terms) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(terms))
+	for name := range terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("\n\nProject glossary (use these definitions when the question mentions a term):")
+	for _, name := range names {
+		b.WriteString("\n- " + name + ": " + terms[name])
+	}
+	return b.String()
+}
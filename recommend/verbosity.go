@@ -0,0 +1,71 @@
+package recommend
+
+import (
+	"context"
+	"strings"
+)
+
+// Verbosity controls how much the assistant says around its answers.
+type Verbosity string
+
+const (
+	// VerbosityConcise drops explanations and trims answers to their first
+	// paragraph.
+	VerbosityConcise Verbosity = "concise"
+	// VerbosityNormal is the default.
+	VerbosityNormal Verbosity = "normal"
+	// VerbosityDetailed adds the rationale behind a recommendation and asks
+	// for fuller explanations.
+	VerbosityDetailed Verbosity = "detailed"
+)
+
+// ParseVerbosity reads a verbosity name, case-insensitively.
+func ParseVerbosity(s string) (Verbosity, bool) {
+	switch v := Verbosity(strings.ToLower(strings.TrimSpace(s))); v {
+	case VerbosityConcise, VerbosityNormal, VerbosityDetailed:
+		return v, true
+	}
+	return "", false
+}
+
+type verbosityKey struct{}
+
+// WithVerbosity sets the verbosity for the prompts run with ctx.
+func WithVerbosity(ctx context.Context, v Verbosity) context.Context {
+	return context.WithValue(ctx, verbosityKey{}, v)
+}
+
+// VerbosityFrom returns the verbosity set on ctx, if any.
+func VerbosityFrom(ctx context.Context) (Verbosity, bool) {
+	v, ok := ctx.Value(verbosityKey{}).(Verbosity)
+	return v, ok
+}
+
+func verbosity(ctx context.Context) Verbosity {
+	if v, ok := VerbosityFrom(ctx); ok {
+		return v
+	}
+	return VerbosityNormal
+}
+
+// verbosityInstruction is the answer prompt's length rule for ctx.
+func verbosityInstruction(ctx context.Context) string {
+	switch verbosity(ctx) {
+	case VerbosityConcise:
+		return "\n\nLENGTH: Answer in at most two sentences, without lists or examples."
+	case VerbosityDetailed:
+		return "\n\nLENGTH: Give a thorough answer: explain the purpose, allowed values and an example."
+	}
+	return ""
+}
+
+// trimAnswer cuts concise answers down to their first paragraph, since the
+// model doesn't always keep to the length it is asked for.
+func trimAnswer(ctx context.Context, answer string) string {
+	answer = strings.TrimSpace(answer)
+	if verbosity(ctx) != VerbosityConcise {
+		return answer
+	}
+	first, _, _ := strings.Cut(answer, "\n\n")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"api-recommender/anonymize"
+	apiparser "api-recommender/api-parser"
+	"api-recommender/recommend"
+)
+
+const recommendationsSchema = `
+CREATE TABLE IF NOT EXISTS recommendations (
+	id INTEGER PRIMARY KEY,
+	session TEXT NOT NULL,
+	query TEXT NOT NULL,
+	query_info TEXT NOT NULL,
+	api_name TEXT NOT NULL,
+	api_path TEXT NOT NULL,
+	payload TEXT,
+	feedback INTEGER,
+	feedback_comment TEXT,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_recommendations_session ON recommendations (session);`
+
+// Feedback ratings stored against a recommendation.
+const (
+	FeedbackDown = -1
+	FeedbackUp   = 1
+)
+
+// DatasetRecord is one anonymized example in the prompt-tuning dataset.
+type DatasetRecord struct {
+	Query     string               `json:"query"`
+	QueryInfo *recommend.QueryInfo `json:"queryInfo"`
+	APIName   string               `json:"apiName"`
+	APIPath   string               `json:"apiPath"`
+	Feedback  *int                 `json:"feedback,omitempty"`
+	Comment   string               `json:"comment,omitempty"`
+}
+
+func ensureRecommendationsSchema(db *sql.DB) error {
+	if _, err := db.Exec(recommendationsSchema); err != nil {
+		return fmt.Errorf("create recommendations schema: %w", err)
+	}
+	// message_id links a recommendation to the reply that presented it;
+	// databases created before it existed get the column added.
+	if err := addColumnIfMissing(db, "recommendations", "message_id", "INTEGER"); err != nil {
+		return fmt.Errorf("create recommendations schema: %w", err)
+	}
+	// api_seen is the API as the user last saw it, JSON of an apiSnapshot
+	if err := addColumnIfMissing(db, "recommendations", "api_seen", "TEXT"); err != nil {
+		return fmt.Errorf("create recommendations schema: %w", err)
+	}
+	return nil
+}
+
+// addColumnIfMissing adds column to table unless it is already there.
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, decl))
+	return err
+}
+
+// recordRecommendation persists the inputs and outcome of a final
+// recommendation so it can be rated and exported later. It returns the
+// recommendation's id.
+func (s *ChatService) recordRecommendation(ctx context.Context, sessionID, query string, info *recommend.QueryInfo, api apiparser.APIDoc, payload string) (int64, error) {
+	infoJSON, err := recommend.MarshalQueryInfo(info)
+	if err != nil {
+		return 0, fmt.Errorf("encode query info: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO recommendations (session, query, query_info, api_name, api_path, payload, api_seen) VALUES (?, ?, ?, ?, ?, ?, ?);",
+		sessionID, query, string(infoJSON), api.Name, api.Path, payload, snapshotAPI(api).encode())
+	if err != nil {
+		return 0, fmt.Errorf("record recommendation: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("record recommendation: %w", err)
+	}
+	return id, nil
+}
+
+// linkRecommendation records which reply presented a recommendation.
+func (s *ChatService) linkRecommendation(ctx context.Context, id, messageID int64) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE recommendations SET message_id = ? WHERE id = ?;", messageID, id); err != nil {
+		return fmt.Errorf("link recommendation: %w", err)
+	}
+	return nil
+}
+
+// RateLatestRecommendation stores user feedback against the most recent
+// recommendation in the session.
+func (s *ChatService) RateLatestRecommendation(ctx context.Context, sessionID string, rating int, comment string) error {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+	if rating != FeedbackUp && rating != FeedbackDown {
+		return fmt.Errorf("%w: rating must be %d or %d", ErrInvalidInput, FeedbackUp, FeedbackDown)
+	}
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE recommendations SET feedback = ?, feedback_comment = ?
+		WHERE id = (SELECT id FROM recommendations WHERE session = ? ORDER BY id DESC LIMIT 1);`,
+		rating, strings.TrimSpace(comment), sessionID)
+	if err != nil {
+		return fmt.Errorf("store feedback: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s has no recommendation to rate", ErrSessionNotFound, sessionID)
+	}
+	s.evaluateRollouts(ctx)
+	return nil
+}
+
+// sharedRecommendation is a session's latest recommendation as handed on
+// to someone outside the chat.
+type sharedRecommendation struct {
+	Query   string
+	APIName string
+	APIPath string
+	// Replies is the recommendation as shown in the chat, with its
+	// payloads.
+	Replies string
+}
+
+// latestRecommendation loads the latest recommendation of a session. A
+// session without one is ErrSessionNotFound.
+func (s *ChatService) latestRecommendation(ctx context.Context, sessionID string) (sharedRecommendation, error) {
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return sharedRecommendation{}, err
+	}
+	if err := s.flushSession(ctx, sessionID); err != nil {
+		return sharedRecommendation{}, err
+	}
+
+	var rec sharedRecommendation
+	var payload sql.NullString
+	var messageID sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT query, api_name, api_path, payload, message_id FROM recommendations WHERE session = ? ORDER BY id DESC LIMIT 1;",
+		sessionID).Scan(&rec.Query, &rec.APIName, &rec.APIPath, &payload, &messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, fmt.Errorf("%w: %s has no recommendation yet", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return rec, fmt.Errorf("load recommendation: %w", err)
+	}
+
+	rec.Replies = fmt.Sprintf("Recommended API:\n Name: %s\n Path: %s", rec.APIName, rec.APIPath)
+	if payload.String != "" {
+		rec.Replies += "\n\nSample payload:\n" + payload.String
+	}
+	if messageID.Valid {
+		shown, err := s.recommendationReplies(ctx, sessionID, messageID.Int64)
+		if err != nil {
+			return rec, err
+		}
+		if shown != "" {
+			rec.Replies = shown
+		}
+	}
+	return rec, nil
+}
+
+// recommendationReplies returns the replies of the turn whose first reply
+// is messageID, as shown in the chat, or "" when they are gone.
+func (s *ChatService) recommendationReplies(ctx context.Context, sessionID string, messageID int64) (string, error) {
+	messages, err := s.GetSessionMessages(ctx, sessionID, 0)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, m := range messages {
+		switch {
+		case m.ID == messageID:
+			parts = append(parts, m.Content)
+		case len(parts) > 0 && m.Role == "user":
+			return strings.Join(parts, "\n\n"), nil
+		case len(parts) > 0:
+			parts = append(parts, m.Content)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// ExportDataset writes every recorded recommendation as anonymized NDJSON.
+// Wallet addresses, VPAs and identifiers are masked in the query and in
+// whatever the user typed that the query info kept; see anonymizeQuery.
+func (s *ChatService) ExportDataset(ctx context.Context, w io.Writer) error {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT query, query_info, api_name, api_path, feedback, feedback_comment FROM recommendations ORDER BY id ASC;")
+	if err != nil {
+		return fmt.Errorf("load recommendations: %w", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var query, infoJSON, apiName, apiPath string
+		var feedback sql.NullInt64
+		var comment sql.NullString
+		if err := rows.Scan(&query, &infoJSON, &apiName, &apiPath, &feedback, &comment); err != nil {
+			return fmt.Errorf("scan recommendation: %w", err)
+		}
+
+		info, err := recommend.UnmarshalQueryInfo([]byte(infoJSON))
+		if err != nil {
+			return fmt.Errorf("decode query info: %w", err)
+		}
+		query = anonymizeQuery(query, info)
+
+		record := DatasetRecord{
+			Query:     query,
+			QueryInfo: info,
+			APIName:   apiName,
+			APIPath:   apiPath,
+			Comment:   anonymize.Text(comment.String),
+		}
+		if feedback.Valid {
+			rating := int(feedback.Int64)
+			record.Feedback = &rating
+		}
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("write dataset record: %w", err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate recommendations: %w", err)
+	}
+	return nil
+}
+
+// anonymizeQuery masks query and what the user typed that info kept:
+// field names, the values of key=value entries and the correction asked
+// for. The asset id is a real registry id, so it is masked whole, also
+// where the query and correction mention it.
+func anonymizeQuery(query string, info *recommend.QueryInfo) string {
+	if info.AssetID != "" {
+		query = strings.ReplaceAll(query, info.AssetID, anonymize.MaskedID)
+		info.Correction = strings.ReplaceAll(info.Correction, info.AssetID, anonymize.MaskedID)
+		info.AssetID = anonymize.MaskedID
+	}
+	info.FieldNames = anonymize.Strings(info.FieldNames)
+	info.EventFields = anonymize.Strings(info.EventFields)
+	for i := range info.KeyValues {
+		info.KeyValues[i].Value = anonymize.Text(info.KeyValues[i].Value)
+	}
+	info.Correction = anonymize.Text(info.Correction)
+	return anonymize.Text(query)
+}
+
+// apiAcceptance returns, per API name, the share of its rated
+// recommendations that were rated up. The share is smoothed towards a half
+// so that a single rating doesn't settle it: (up+1)/(rated+2).
+func (s *ChatService) apiAcceptance(ctx context.Context) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT api_name,
+			COALESCE(SUM(CASE WHEN feedback = ? THEN 1 ELSE 0 END), 0),
+			COUNT(feedback)
+		FROM recommendations
+		WHERE feedback IS NOT NULL
+		GROUP BY api_name;`, FeedbackUp)
+	if err != nil {
+		return nil, fmt.Errorf("load api acceptance: %w", err)
+	}
+	defer rows.Close()
+
+	rates := map[string]float64{}
+	for rows.Next() {
+		var name string
+		var up, rated int
+		if err := rows.Scan(&name, &up, &rated); err != nil {
+			return nil, fmt.Errorf("scan api acceptance: %w", err)
+		}
+		rates[name] = float64(up+1) / float64(rated+2)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate api acceptance: %w", err)
+	}
+	return rates, nil
+}
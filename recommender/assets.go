@@ -0,0 +1,172 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"api-recommender/assets"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+)
+
+// maxAssetSuggestions caps how many known assets a follow-up offers.
+const maxAssetSuggestions = 10
+
+// assetIDPattern matches an explicit "asset id X" mention.
+var assetIDPattern = regexp.MustCompile(`(?i)\basset[ _-]?id\s*(?:is\s+|:\s*|=\s*)?["']?([A-Za-z0-9._:-]+)`)
+
+// resolveBurnAsset makes sure a burn request names an existing asset. It sets
+// info.AssetID when the user's turns identify an asset, either by id or as one
+// of their own ("my latest gold bond"), and otherwise returns the follow-up
+// question to ask. Lookups are skipped for other operations, when no registry
+// is configured, or when the registry is unreachable.
+func (e *Engine) resolveBurnAsset(ctx context.Context, info *recommend.QueryInfo, history, userInput string) string {
+	if e.assets == nil || info.Operation != "burn" {
+		return ""
+	}
+
+	owner := assets.OwnerFrom(ctx)
+	if owner == "" {
+		owner = e.assetOwner
+	}
+
+	known, err := e.assets.ListByOwner(ctx, owner)
+	if err != nil {
+		log.Printf("asset registry unavailable, continuing without it: %v", err)
+		return ""
+	}
+
+	// The most recent turn that identifies an asset wins
+	turns := append(userTurns(history), userInput)
+	for i := len(turns) - 1; i >= 0; i-- {
+		if m := assetIDPattern.FindAllStringSubmatch(turns[i], -1); len(m) > 0 {
+			id := m[len(m)-1][1]
+			asset, err := e.assets.Get(ctx, id)
+			switch {
+			case err == nil:
+				info.AssetID = asset.ID
+				return ""
+			case errors.Is(err, assets.ErrNotFound):
+				return fmt.Sprintf("I couldn't find an asset with id %q, and only existing assets can be burnt. %s", id, offerAssets(known))
+			default:
+				log.Printf("asset lookup failed for %s, continuing without it: %v", id, err)
+				return ""
+			}
+		}
+
+		lower := strings.ToLower(turns[i])
+		for _, a := range known {
+			if a.ID != "" && strings.Contains(lower, strings.ToLower(a.ID)) {
+				info.AssetID = a.ID
+				return ""
+			}
+		}
+
+		if owner != "" && ownReference.MatchString(lower) {
+			candidates := describedAssets(known, lower)
+			if asset, ok := pickAsset(candidates, lower); ok {
+				info.AssetID = asset.ID
+				return ""
+			}
+			if len(candidates) > 1 {
+				return "You hold several matching assets. " + offerAssets(candidates)
+			}
+		}
+	}
+
+	return "Burning acts on an existing asset. Which asset should be burnt? " + offerAssets(known)
+}
+
+var (
+	// ownReference matches a user referring to their own assets.
+	ownReference = regexp.MustCompile(`\b(my|mine)\b`)
+	newestWords  = regexp.MustCompile(`\b(latest|last|newest|most recent|recent)\b`)
+	oldestWords  = regexp.MustCompile(`\b(oldest|first|earliest)\b`)
+)
+
+// describedAssets returns the assets whose name, or failing that type, appears
+// in text, or every asset when text only speaks of "assets" in general.
+func describedAssets(owned []assets.Asset, text string) []assets.Asset {
+	var byName, byType []assets.Asset
+	for _, a := range owned {
+		if name := strings.ToLower(a.Name); name != "" && strings.Contains(text, name) {
+			byName = append(byName, a)
+		} else if typ := strings.ToLower(a.Type); typ != "" && strings.Contains(text, typ) {
+			byType = append(byType, a)
+		}
+	}
+
+	switch {
+	case len(byName) > 0:
+		return byName
+	case len(byType) > 0:
+		return byType
+	case strings.Contains(text, "asset") || strings.Contains(text, "token"):
+		return owned
+	}
+	return nil
+}
+
+// pickAsset chooses among candidates using the ordering words in text. A
+// single candidate is picked without any.
+func pickAsset(candidates []assets.Asset, text string) (assets.Asset, bool) {
+	switch {
+	case len(candidates) == 0:
+		return assets.Asset{}, false
+	case newestWords.MatchString(text):
+		return assets.Latest(candidates)
+	case oldestWords.MatchString(text):
+		oldest := candidates[0]
+		for _, a := range candidates[1:] {
+			if a.Created < oldest.Created {
+				oldest = a
+			}
+		}
+		return oldest, true
+	case len(candidates) == 1:
+		return candidates[0], true
+	}
+	return assets.Asset{}, false
+}
+
+// offerAssets lists known assets the user can pick from.
+func offerAssets(known []assets.Asset) string {
+	if len(known) == 0 {
+		return "No assets are known yet; please give the asset id."
+	}
+
+	var b strings.Builder
+	b.WriteString("Known assets:\n")
+	for i, a := range known {
+		if i == maxAssetSuggestions {
+			b.WriteString(fmt.Sprintf(" ...and %d more\n", len(known)-i))
+			break
+		}
+		b.WriteString(" - " + a.ID)
+		switch {
+		case a.Name != "":
+			b.WriteString(" (" + a.Name + ")")
+		case a.Type != "":
+			b.WriteString(" (" + a.Type + ")")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Reply with the asset id to burn.")
+	return b.String()
+}
+
+// checkAssetID reports a problem when the generated payload does not carry
+// the resolved asset id.
+func checkAssetID(samplePayload, assetID string) []payload.Problem {
+	if assetID == "" || strings.Contains(samplePayload, assetID) {
+		return nil
+	}
+	return []payload.Problem{{
+		Path:    "payload.tokenizedAsset",
+		Message: fmt.Sprintf("expected the existing asset id %q", assetID),
+	}}
+}
@@ -0,0 +1,172 @@
+package recommender
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conversationAwareRequest folds the recent conversation into the latest
+// request.
+func conversationAwareRequest(history, latest string) string {
+	latest = strings.TrimSpace(latest)
+	if history == "" {
+		return latest
+	}
+	return fmt.Sprintf("Conversation so far:\n%s\n\nLatest user request: %s", history, latest)
+}
+
+// recentHistory extracts only the last N messages from history for context
+func recentHistory(history string, n int) string {
+	if history == "" {
+		return ""
+	}
+
+	// Split by message pairs (Human/AI)
+	parts := strings.Split(history, "\n\n")
+	if len(parts) <= n {
+		return history
+	}
+
+	// Get last N parts
+	start := len(parts) - n
+	if start < 0 {
+		start = 0
+	}
+
+	return strings.Join(parts[start:], "\n\n")
+}
+
+// isNewCreationRequest detects if this is a new creation request (not a continuation)
+func isNewCreationRequest(userInput, history string) bool {
+	lower := strings.ToLower(userInput)
+
+	// Check for creation keywords that indicate a new request
+	creationKeywords := []string{"create", "make", "generate", "build", "new", "want to", "need to", "burn", "lock", "register", "onboard", "store"}
+	for _, keyword := range creationKeywords {
+		if strings.Contains(lower, keyword) {
+			// Check if it's not just answering a question
+			// If it contains creation keywords and is not just "yes"/"no", it's a new request
+			isJustAnswer := strings.Contains(lower, "yes") || strings.Contains(lower, "no")
+			// Also check if it's a full sentence with creation intent
+			hasCreationIntent := strings.Contains(lower, keyword) &&
+				(strings.Contains(lower, "asset") || strings.Contains(lower, "bond") ||
+					strings.Contains(lower, "transaction") || strings.Contains(lower, "gold") ||
+					strings.Contains(lower, "token"))
+
+			if hasCreationIntent || (!isJustAnswer && len(strings.Fields(lower)) > 2) {
+				return true
+			}
+		}
+	}
+
+	// If it's a short answer (yes/no/field names), it's likely a continuation
+	if len(strings.Fields(lower)) <= 3 {
+		return false
+	}
+
+	return false
+}
+
+// explanationExchanges is how many earlier questions about fields a field
+// question is answered with.
+const explanationExchanges = 3
+
+// exchange is one user message of a history with the replies to it, in
+// the history's Human/AI form.
+type exchange struct {
+	user string
+	text string
+}
+
+// splitExchanges divides a Human/AI buffer string into exchanges. Lines
+// before the first user message are dropped.
+func splitExchanges(history string) []exchange {
+	var exchanges []exchange
+	human := false
+	for _, line := range strings.Split(history, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Human: "):
+			human = true
+			exchanges = append(exchanges, exchange{user: strings.TrimPrefix(line, "Human: "), text: line})
+			continue
+		case strings.HasPrefix(line, "AI: "):
+			human = false
+		}
+		if len(exchanges) == 0 {
+			continue
+		}
+		last := &exchanges[len(exchanges)-1]
+		last.text += "\n" + line
+		if human {
+			last.user += "\n" + line
+		}
+	}
+	return exchanges
+}
+
+// isExplanation reports whether a user message asked about a field or
+// concept rather than building a request or answering a follow-up
+// question: it reads as a question and names nothing to create.
+func isExplanation(message string) bool {
+	lower := strings.ToLower(strings.TrimSpace(message))
+	for _, keyword := range []string{"create", "make", "generate", "build", "burn", "lock", "register", "onboard", "store", "want to", "need to"} {
+		if strings.Contains(lower, keyword) {
+			return false
+		}
+	}
+	for _, keyword := range []string{"explain", "what is", "what's", "what does", "what about", "how about", "tell me about", "how does", "describe", "meaning of", "difference"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return strings.HasSuffix(lower, "?")
+}
+
+// creationMemory is the part of history the creation flow works from:
+// every exchange but the questions about fields, which would otherwise
+// crowd out the follow-up questions and lend their field names to the
+// request.
+func creationMemory(history string) string {
+	var kept []string
+	for _, ex := range splitExchanges(history) {
+		if !isExplanation(ex.user) {
+			kept = append(kept, ex.text)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// explanationMemory is the part of history a field question is answered
+// with: the last n questions about fields and their answers, so "and what
+// about fromWalletAddress?" can be read against the field asked about
+// before.
+func explanationMemory(history string, n int) string {
+	var kept []string
+	for _, ex := range splitExchanges(history) {
+		if isExplanation(ex.user) {
+			kept = append(kept, ex.text)
+		}
+	}
+	if len(kept) > n {
+		kept = kept[len(kept)-n:]
+	}
+	return strings.Join(kept, "\n")
+}
+
+// userTurns returns the user's messages from a Human/AI buffer string.
+func userTurns(history string) []string {
+	var turns []string
+	human := false
+	for _, line := range strings.Split(history, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Human: "):
+			human = true
+			turns = append(turns, strings.TrimPrefix(line, "Human: "))
+		case strings.HasPrefix(line, "AI: "):
+			human = false
+		case human:
+			turns[len(turns)-1] += "\n" + line
+		}
+	}
+	return turns
+}
@@ -0,0 +1,50 @@
+package recommender
+
+import (
+	"regexp"
+	"strings"
+
+	"api-recommender/config"
+	"api-recommender/recommend"
+)
+
+// applyPreset sets the context flags of the preset the user's turns mention
+// most recently, so the matching follow-up questions are skipped. Flags the
+// preset leaves unset keep their extracted values.
+func applyPreset(info *recommend.QueryInfo, presets []config.Preset, history, userInput string) {
+	if len(presets) == 0 {
+		return
+	}
+
+	turns := append(userTurns(history), userInput)
+	for i := len(turns) - 1; i >= 0; i-- {
+		for _, p := range presets {
+			if !mentionsPreset(turns[i], p.Name) {
+				continue
+			}
+			info.Preset = p.Name
+			if p.IsAsync != nil {
+				info.IsAsync = p.IsAsync
+			}
+			if p.IsUMICompliant != nil {
+				info.IsUMICompliant = p.IsUMICompliant
+			}
+			if p.IsPrivate != nil {
+				info.IsPrivate = p.IsPrivate
+			}
+			if p.NetworkID != "" {
+				info.NetworkID = p.NetworkID
+			}
+			if p.Version != "" {
+				info.Version = p.Version
+			}
+			return
+		}
+	}
+}
+
+// mentionsPreset reports whether text names the preset as a whole word.
+func mentionsPreset(text, name string) bool {
+	pattern := `(?i)(^|[^\w-])` + regexp.QuoteMeta(strings.TrimSpace(name)) + `($|[^\w-])`
+	return regexp.MustCompile(pattern).MatchString(text)
+}
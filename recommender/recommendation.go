@@ -0,0 +1,197 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/fees"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+	"api-recommender/xsd"
+)
+
+// Recommendation is the structured form of a final API recommendation.
+type Recommendation struct {
+	API          apiparser.APIDoc     `json:"api"`
+	Fields       []apiparser.APIField `json:"fields"`
+	Payload      string               `json:"payload,omitempty"`
+	EventPayload string               `json:"eventPayload,omitempty"`
+	// Request is where the API's parameters go, when it has any; Payload
+	// is then only the body.
+	Request *SampleRequest `json:"request,omitempty"`
+	// Problems lists the operation rules the generated payload breaks.
+	Problems []payload.Problem `json:"problems,omitempty"`
+	// Mapping shows where each key=value entry the user supplied was placed.
+	Mapping []payload.Assignment `json:"mapping,omitempty"`
+	// Fees are the fee fields computed for the payload.
+	Fees []fees.Fee `json:"fees,omitempty"`
+	// Rationale says which parts of the request led to the API.
+	Rationale string `json:"rationale,omitempty"`
+	// Deprecation warns that the API is deprecated and names its successor.
+	Deprecation string `json:"deprecation,omitempty"`
+	// Defaults are the answers smart defaults gave in the user's place,
+	// e.g. "async=false".
+	Defaults []string `json:"defaults,omitempty"`
+}
+
+// Recommend picks the API for a complete request and generates its sample
+// and event payloads, checking the sample against the operation's rules and
+// the event's link to the sample. When the API has required fields the
+// request doesn't provide, it returns a *recommend.MissingFieldsError
+// instead, and for values its fields don't allow a
+// *recommend.InvalidValuesError. Other errors wrap one of the recommend
+// package's failure modes, such as recommend.ErrNoCandidate.
+// request is the user's request; info is what was extracted from it, with
+// Correction set to steer a second attempt.
+func (e *Engine) Recommend(ctx context.Context, request string, info *recommend.QueryInfo) (*Recommendation, error) {
+	ctx = e.Context(ctx)
+	catalog := e.catalog(ctx)
+	if e.scorer != nil {
+		ctx = recommend.WithScorer(ctx, e.scorer)
+	}
+	api, fields, samplePayload, eventPayload, err := recommend.Recommend1(ctx, catalog, request, info, e.model)
+	if errors.Is(err, recommend.ErrMissingRequiredFields) || errors.Is(err, recommend.ErrDisallowedValues) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recommend api: %w", err)
+	}
+
+	// Model output dates things in whatever format it likes
+	samplePayload, eventPayload = payload.FormatTimestamps(samplePayload, e.clock), payload.FormatTimestamps(eventPayload, e.clock)
+	samplePayload, computed, problems := fees.Apply(samplePayload, e.fees, info.KeyValues, info.FieldNames)
+	problems = append(problems, payload.Validate(info.Operation, samplePayload, e.clock)...)
+	problems = append(problems, checkAssetID(samplePayload, info.AssetID)...)
+	if eventPayload != "" {
+		// The two payloads are generated separately; link the event to
+		// the request it answers
+		if linked, err := payload.Correlate(samplePayload, eventPayload, e.clock); err == nil {
+			eventPayload = linked
+		}
+		problems = append(problems, payload.CheckCorrelation(samplePayload, eventPayload, e.clock)...)
+	}
+	samplePayload = inFormat(recommend.RequestedFormat(ctx, request), samplePayload, e.xmlRoot(api))
+	if violations := e.schemaProblems(samplePayload); len(violations) > 0 {
+		if e.schemaRetry && info.Correction == "" {
+			retry := *info
+			retry.Correction = schemaCorrection(violations)
+			if rec, err := e.Recommend(ctx, request, &retry); err == nil && len(e.schemaProblems(rec.Payload)) < len(violations) {
+				return rec, nil
+			}
+		}
+		problems = append(problems, violations...)
+	}
+	rec := &Recommendation{
+		API:          api,
+		Fields:       fields,
+		Payload:      samplePayload,
+		EventPayload: eventPayload,
+		Problems:     problems,
+		Fees:         computed,
+	}
+	if len(info.KeyValues) > 0 {
+		rec.Mapping = payload.Place(info.Operation, recommend.BodyValues(api, info.KeyValues))
+	}
+	rec.Request = sampleRequest(ctx, api, fields, info.KeyValues, e.clock)
+	rec.Rationale = rationale(info, api)
+	rec.Deprecation = recommend.DeprecationNotice(api, catalog)
+	return rec, nil
+}
+
+// inFormat returns the sample payload as XML under root when that is the
+// format asked for. Built payloads are always JSON, and the model may not
+// have followed the format it was told; XML it wrote is re-encoded so the
+// root and namespace are the configured ones. A payload that can't be
+// converted is left as it is. Event payloads stay JSON.
+func inFormat(format, sample string, root payload.XMLRoot) string {
+	if format != payload.FormatXML || sample == "" {
+		return sample
+	}
+	converted, err := payload.Convert(sample, payload.FormatXML, root)
+	if err != nil {
+		return sample
+	}
+	return converted.Payload
+}
+
+// xmlRoot is the root element of api's XML payloads.
+func (e *Engine) xmlRoot(api apiparser.APIDoc) payload.XMLRoot {
+	return payload.XMLRoot(e.xml.For(api.Name, api.Path))
+}
+
+// schemaProblems checks an XML sample payload against the schemas. Payloads
+// whose root the schemas don't declare aren't checked.
+func (e *Engine) schemaProblems(sample string) []payload.Problem {
+	if e.schema == nil || !strings.HasPrefix(strings.TrimSpace(sample), "<") {
+		return nil
+	}
+	violations, err := e.schema.Validate([]byte(sample))
+	switch {
+	case errors.Is(err, xsd.ErrUndeclared):
+		return nil
+	case err != nil:
+		return []payload.Problem{{Message: "payload is not valid XML: " + err.Error()}}
+	}
+	problems := make([]payload.Problem, len(violations))
+	for i, v := range violations {
+		problems[i] = payload.Problem{Path: v.Path, Message: v.Message}
+	}
+	return problems
+}
+
+// maxCorrections bounds the schema violations named in a retry prompt.
+const maxCorrections = 10
+
+// schemaCorrection tells the model which schema violations to fix.
+func schemaCorrection(problems []payload.Problem) string {
+	var b strings.Builder
+	b.WriteString("The XML payload breaks the API's XSD schema:")
+	for i, p := range problems {
+		if i == maxCorrections {
+			fmt.Fprintf(&b, " and %d more", len(problems)-i)
+			break
+		}
+		fmt.Fprintf(&b, " %s: %s;", p.Path, p.Message)
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// rationale explains which parts of the request led to api.
+func rationale(info *recommend.QueryInfo, api apiparser.APIDoc) string {
+	var request []string
+	if info.Operation != "" {
+		request = append(request, info.Operation+" operation")
+	}
+	if info.UseCase != "" {
+		request = append(request, "the "+info.UseCase+" usecase")
+	}
+	var flags []string
+	for _, f := range []struct {
+		value   *bool
+		yes, no string
+	}{
+		{info.IsAsync, "async", "sync"},
+		{info.IsUMICompliant, "UMI compliant", "not UMI compliant"},
+		{info.IsPrivate, "private", "public"},
+	} {
+		switch {
+		case f.value == nil:
+		case *f.value:
+			flags = append(flags, f.yes)
+		default:
+			flags = append(flags, f.no)
+		}
+	}
+
+	why := api.Name + " was chosen"
+	if len(request) > 0 {
+		why += " for the " + strings.Join(request, " of ")
+	}
+	if len(flags) > 0 {
+		why += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return why + "."
+}
@@ -0,0 +1,404 @@
+// Package recommender is the recommendation pipeline without the HTTP and
+// CLI layers around it: it classifies a user's message, extracts what they
+// want, asks follow-up questions until the request is complete and then
+// recommends an API with sample payloads. It keeps no state of its own;
+// callers pass the conversation so far with each turn and store the reply
+// themselves.
+//
+//	engine := recommender.New(model, apis,
+//		recommender.WithPresets(cfg.Presets),
+//		recommender.WithRedirectMessage("I can only help with the token APIs."),
+//	)
+//	res, err := engine.Respond(ctx, "create a gold bond asset", history)
+//
+// History is a Human/AI transcript as produced by llms.GetBufferString with
+// the "Human" and "AI" prefixes. Payloads can be checked and converted with
+// the payload package.
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/assets"
+	"api-recommender/config"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+	"api-recommender/tools"
+	"api-recommender/xsd"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Intents describe how a turn was handled.
+const (
+	IntentIrrelevant     = "irrelevant"
+	IntentFieldQuestion  = "field_question"
+	IntentFollowUp       = "follow_up"
+	IntentRecommendation = "recommendation"
+	IntentCapabilities   = "capabilities"
+	IntentSimulate       = "simulate"
+	IntentResponses      = "responses"
+)
+
+// Kinds of follow-up questions, as reported in Result.Questions. Questions
+// from the required-information checklist are named by their item, e.g.
+// config.QuestionPrivacy.
+const (
+	QuestionOperation   = "operation"
+	QuestionEventFields = recommend.QuestionEventFields
+	QuestionValues      = "values"
+	QuestionAsset       = "asset"
+	// QuestionRequiredFields asks for the required fields of the chosen
+	// API that the request left out.
+	QuestionRequiredFields = "requiredFields"
+)
+
+// ErrLLMUnavailable is returned when the model fails at a step the turn
+// can't do without. Errors from the recommend package keep their own
+// failure mode, e.g. recommend.ErrUnparseableOutput.
+var ErrLLMUnavailable = recommend.ErrLLMUnavailable
+
+// defaultRedirectMessage answers messages unrelated to the APIs.
+const defaultRedirectMessage = "I can help with choosing and calling the APIs in the catalog. Please ask about one of those."
+
+// Engine runs the recommendation pipeline against one model and catalog.
+// It is safe for concurrent use.
+type Engine struct {
+	model      llms.Model
+	catalog    func(context.Context) []apiparser.APIDoc
+	presets    []config.Preset
+	assets     assets.AssetRegistry
+	assetOwner string
+	redirect   string
+	fees       map[string]config.FeeRule
+	xml        config.XML
+	eventTopic string
+	// schema checks XML payloads; schemaRetry regenerates the ones that
+	// break it once.
+	schema      *xsd.Schema
+	schemaRetry bool
+	// answerer answers field questions; it can call tools when any are set.
+	answerer llms.Model
+	tools    func() []tools.Tool
+	// scorer, when set, weighs the model's pick of API against other
+	// signals.
+	scorer *recommend.Scorer
+	// persona, questions, tunables and clock are put on the context of
+	// every turn; see Context.
+	persona   config.Persona
+	questions config.Questions
+	tunables  recommend.Tunables
+	clock     *payload.Clock
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// WithCatalog makes the engine ask fn for the APIs it may recommend on each
+// turn, e.g. to restrict them per tenant.
+func WithCatalog(fn func(context.Context) []apiparser.APIDoc) Option {
+	return func(e *Engine) { e.catalog = fn }
+}
+
+// WithPresets lets users name a preset instead of answering the context
+// questions it settles.
+func WithPresets(presets []config.Preset) Option {
+	return func(e *Engine) { e.presets = presets }
+}
+
+// WithAssets makes burn requests name an asset that exists in registry.
+// owner is whose assets are offered when ctx carries no owner (see
+// assets.WithOwner).
+func WithAssets(registry assets.AssetRegistry, owner string) Option {
+	return func(e *Engine) { e.assets, e.assetOwner = registry, owner }
+}
+
+// WithRedirectMessage sets the reply to messages unrelated to the APIs.
+func WithRedirectMessage(message string) Option {
+	return func(e *Engine) { e.redirect = message }
+}
+
+// WithFees makes the engine compute fee fields following rules, keyed by
+// field name, instead of keeping the values the model wrote.
+func WithFees(rules map[string]config.FeeRule) Option {
+	return func(e *Engine) { e.fees = rules }
+}
+
+// WithXML sets the root element and namespace of XML sample payloads.
+func WithXML(x config.XML) Option {
+	return func(e *Engine) { e.xml = x }
+}
+
+// WithSchema checks XML sample payloads against schema, reporting where
+// they break it as problems. With retry, such a payload is generated once
+// more with the violations to fix, and the better of the two is kept.
+func WithSchema(schema *xsd.Schema, retry bool) Option {
+	return func(e *Engine) { e.schema, e.schemaRetry = schema, retry }
+}
+
+// WithTools lets the model call the tools list returns while answering
+// questions. The list is read on every answer.
+func WithTools(list func() []tools.Tool) Option {
+	return func(e *Engine) { e.answerer, e.tools = tools.WithTools(e.model, list), list }
+}
+
+// WithScorer chooses the API of each recommendation with scorer instead of
+// taking the model's pick as it is.
+func WithScorer(scorer *recommend.Scorer) Option {
+	return func(e *Engine) { e.scorer = scorer }
+}
+
+// WithPersona sets the product identity used in prompts and canned answers.
+func WithPersona(persona config.Persona) Option {
+	return func(e *Engine) { e.persona = persona }
+}
+
+// WithQuestions sets the checklist of information a request needs before
+// an API is recommended.
+func WithQuestions(questions config.Questions) Option {
+	return func(e *Engine) { e.questions = questions }
+}
+
+// WithTunables makes the engine take prompt addenda, the glossary and
+// usecase fields from t, which it consults on every turn.
+func WithTunables(t recommend.Tunables) Option {
+	return func(e *Engine) { e.tunables = t }
+}
+
+// WithClock makes payloads timestamped, dated and checked with c instead of
+// the system time in UTC.
+func WithClock(c *payload.Clock) Option {
+	return func(e *Engine) { e.clock = c }
+}
+
+// New returns an engine that recommends from apis using model.
+func New(model llms.Model, apis []apiparser.APIDoc, opts ...Option) *Engine {
+	e := &Engine{
+		model:      model,
+		catalog:    func(context.Context) []apiparser.APIDoc { return apis },
+		redirect:   defaultRedirectMessage,
+		xml:        config.Default().XML,
+		eventTopic: defaultEventTopic,
+		answerer:   model,
+		tools:      func() []tools.Tool { return nil },
+		persona:    config.Default().Persona,
+		questions:  config.Default().Questions,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Context returns ctx configured with the engine's persona, checklist,
+// tunables and clock, for calling the recommend package directly the way
+// the engine would, e.g. to review an attachment.
+func (e *Engine) Context(ctx context.Context) context.Context {
+	ctx = recommend.WithPersona(ctx, e.persona)
+	ctx = recommend.WithQuestions(ctx, e.questions)
+	if e.tunables != nil {
+		ctx = recommend.WithTunables(ctx, e.tunables)
+	}
+	return recommend.WithClock(ctx, e.clock)
+}
+
+// Result is the outcome of a turn. Reply is the text to show the user;
+// for recommendations it is empty and Recommendation holds the answer.
+type Result struct {
+	Intent         string
+	Reply          string
+	QueryInfo      *recommend.QueryInfo
+	Recommendation *Recommendation
+	// ToolCalls are the tools the model called for its answer.
+	ToolCalls []tools.Call
+	// Simulation is the walkthrough of a payload's downstream flow.
+	Simulation []Step
+	// Questions are the kinds of question a follow-up asks.
+	Questions []string
+}
+
+// Classification says what kind of message a turn is.
+type Classification struct {
+	// Creation is set for requests to build something, as opposed to
+	// questions about a field.
+	Creation bool
+	Relevant bool
+}
+
+// Classify works out whether input asks for an API or about a field, and
+// whether it concerns the APIs at all. A model failure is reported along
+// with the fallback used in that case: a relevant creation request.
+func (e *Engine) Classify(ctx context.Context, input, history string) (Classification, error) {
+	ctx = e.Context(ctx)
+	defer recommend.TraceFrom(ctx).Start(recommend.StageClassification)()
+	creation, relevant, err := recommend.ClassifyQuery(ctx, input, history, e.model)
+	if err != nil {
+		return Classification{Creation: true, Relevant: true}, err
+	}
+	return Classification{Creation: creation, Relevant: relevant}, nil
+}
+
+// Respond handles one user turn given the conversation before it.
+func (e *Engine) Respond(ctx context.Context, input, history string) (*Result, error) {
+	ctx = e.Context(ctx)
+	// "What can you do?" is answered from the catalog without classifying it
+	if recommend.IsCapabilitiesQuery(input) {
+		return &Result{Intent: IntentCapabilities, Reply: recommend.Capabilities(ctx, e.catalog(ctx))}, nil
+	}
+
+	// Documented error codes are answered from the docs, never classified
+	// as creation requests or guessed at by the model
+	if recommend.IsErrorCodeQuestion(e.catalog(ctx), input) {
+		return e.answer(ctx, input, history)
+	}
+
+	// "What does Issue return?" is answered from the API's documented
+	// responses. Without an API to go by it is left to the model
+	if recommend.IsResponseQuery(input) {
+		if api, ok := recommend.ResponseAPI(e.catalog(ctx), input, history); ok {
+			return &Result{Intent: IntentResponses, Reply: recommend.ResponseSummary(api)}, nil
+		}
+	}
+
+	// "Simulate this" walks through the last payload without the model
+	if recommend.IsSimulateQuery(input) {
+		return e.simulate(input, history), nil
+	}
+
+	// Questions like "is the network up?" mention settlement and would be
+	// taken for creation requests or turned away; with tools they can be
+	// answered
+	if recommend.IsStatusQuery(input) && len(e.tools()) > 0 {
+		return e.answer(ctx, input, history)
+	}
+
+	// The single-shot syntax is read without the model
+	if info, ok := recommend.ParseShorthand(ctx, input); ok {
+		problems := useKeyValues(info, info.KeyValues, e.clock)
+		return e.resolve(ctx, input, recentHistory(history, 2), true, info, problems)
+	}
+
+	// On failure the fallback keeps the turn going as a creation request
+	class, _ := e.Classify(ctx, input, history)
+	switch {
+	case !class.Relevant:
+		return &Result{Intent: IntentIrrelevant, Reply: e.redirect}, nil
+	case !class.Creation:
+		return e.answer(ctx, input, history)
+	}
+	return e.create(ctx, input, history)
+}
+
+// answer answers a question about a field or the network, calling tools if
+// the model asks for them.
+func (e *Engine) answer(ctx context.Context, input, history string) (*Result, error) {
+	// Only earlier questions about fields go with the question: enough to
+	// follow "what about X?", without the request being built
+	ctx, calls := tools.Record(ctx)
+	ctx = recommend.WithCatalog(ctx, e.catalog(ctx))
+	answer, err := recommend.AnswerFieldQuestion(ctx, input, explanationMemory(history, explanationExchanges), e.answerer)
+	if err != nil {
+		return nil, fmt.Errorf("answer field question: %w", err)
+	}
+	return &Result{Intent: IntentFieldQuestion, Reply: answer, ToolCalls: calls.Calls()}, nil
+}
+
+// create handles a request to build something written in prose, extracting
+// what it asks for with the model.
+func (e *Engine) create(ctx context.Context, input, history string) (*Result, error) {
+	// Questions about fields asked along the way aren't part of the request
+	history = creationMemory(history)
+	// A new request needs little context; answers to follow-up questions
+	// need the questions and earlier answers
+	recent := recentHistory(history, 10)
+	isNew := isNewCreationRequest(input, history)
+	if isNew {
+		recent = recentHistory(history, 2)
+	}
+
+	stop := recommend.TraceFrom(ctx).Start(recommend.StageExtraction)
+	info, err := recommend.ExtractQueryInfo(ctx, input, recent, e.model, isNew)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("extract query info: %w", err)
+	}
+	valueProblems := collectKeyValues(info, recent, input, isNew, e.clock)
+	applyPreset(info, e.presets, recent, input)
+	stop()
+	return e.resolve(ctx, input, recent, isNew, info, valueProblems)
+}
+
+// resolve asks for whatever info still lacks, or recommends an API once it
+// is complete. isNew is set for a new request as opposed to a reply to
+// earlier questions; valueProblems are the key=value pairs that need
+// correcting.
+func (e *Engine) resolve(ctx context.Context, input, recent string, isNew bool, info *recommend.QueryInfo, valueProblems []payload.Problem) (*Result, error) {
+	res := &Result{QueryInfo: info}
+	// With smart defaults, a reply to the questions that still leaves some
+	// unanswered settles them instead of being asked again
+	var defaults []string
+	if on, _ := recommend.SmartDefaultsFrom(ctx); on && !isNew && info.Operation != "" {
+		defaults = recommend.ApplyDefaults(ctx, info)
+	}
+
+	// A usecase without an operation is settled before anything else is asked
+	if info.UseCase != "" && info.Operation == "" {
+		res.Intent, res.Reply = IntentFollowUp, recommend.OperationQuestion(info.UseCase)
+		res.Questions = []string{QuestionOperation}
+		return res, nil
+	}
+
+	missing := recommend.MissingInfo(ctx, info)
+	hasAllInfo := len(missing) == 0
+	var assetQuestion string
+	if hasAllInfo {
+		assetQuestion = e.resolveBurnAsset(ctx, info, recent, input)
+	}
+	switch {
+	case len(valueProblems) > 0:
+		res.Intent, res.Reply = IntentFollowUp, valueQuestion(valueProblems)
+		res.Questions = []string{QuestionValues}
+	case assetQuestion != "":
+		res.Intent, res.Reply = IntentFollowUp, assetQuestion
+		res.Questions = []string{QuestionAsset}
+	case !hasAllInfo:
+		questions, err := recommend.GenerateFollowUpQuestions(ctx, info, e.model)
+		if err != nil {
+			return nil, fmt.Errorf("generate follow-up questions: %w", err)
+		}
+		if len(defaults) > 0 {
+			questions = defaultsNote(defaults) + "\n\n" + questions
+		}
+		res.Intent, res.Reply, res.Questions = IntentFollowUp, questions, missing
+	default:
+		var err error
+		res.Recommendation, err = e.Recommend(ctx, conversationAwareRequest(recent, input), info)
+		var missingFields *recommend.MissingFieldsError
+		if errors.As(err, &missingFields) {
+			res.Intent, res.Reply = IntentFollowUp, recommend.RequiredFieldsQuestion(missingFields)
+			res.Questions = []string{QuestionRequiredFields}
+			return res, nil
+		}
+		var invalidValues *recommend.InvalidValuesError
+		if errors.As(err, &invalidValues) {
+			res.Intent, res.Reply = IntentFollowUp, valueQuestion(invalidValues.Problems)
+			res.Questions = []string{QuestionValues}
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Recommendation.Defaults = defaults
+		res.Intent = IntentRecommendation
+	}
+	return res, nil
+}
+
+// defaultsNote tells the user which answers were defaulted for them.
+func defaultsNote(defaults []string) string {
+	return "Defaults applied: " + strings.Join(defaults, ", ") + "."
+}
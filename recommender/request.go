@@ -0,0 +1,112 @@
+package recommender
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+)
+
+// SampleRequest is how the sample payload is sent to an API that takes
+// parameters outside it, in the URL or in headers.
+type SampleRequest struct {
+	Method string `json:"method"`
+	// URL is the API's path with its path parameters filled in and its
+	// query parameters appended, e.g. /assets/sample-assetId?dryRun=true.
+	URL     string         `json:"url"`
+	Headers []payload.Pair `json:"headers,omitempty"`
+}
+
+// sampleRequest fills in the parameters of api: all of its path parameters,
+// and the query parameters and headers that are required, were picked for
+// the request or given a value by the user. A parameter takes the user's
+// value, else its example, default or first allowed value, else a dummy
+// value, dated with c. It returns nil when api has no parameters.
+func sampleRequest(ctx context.Context, api apiparser.APIDoc, picked []apiparser.APIField, given []payload.Pair, c *payload.Clock) *SampleRequest {
+	profile, _ := recommend.ValueProfileFrom(ctx)
+	path := api.Path
+	query := url.Values{}
+	var keys []string
+	var headers []payload.Pair
+	found := false
+	for _, f := range api.Fields {
+		if !f.IsParameter() {
+			continue
+		}
+		found = true
+		value, ok := givenValue(given, f.Name)
+		if f.Location() != apiparser.InPath && !ok && !f.Required && !slices.ContainsFunc(picked, func(p apiparser.APIField) bool { return p.Name == f.Name && p.In == f.In }) {
+			continue
+		}
+		if !ok {
+			value = parameterValue(profile, f, c)
+		}
+		switch f.Location() {
+		case apiparser.InPath:
+			path = fillPathParameter(path, f.Name, url.PathEscape(value))
+		case apiparser.InQuery:
+			if !query.Has(f.Name) {
+				keys = append(keys, f.Name)
+			}
+			query.Add(f.Name, value)
+		case apiparser.InHeader:
+			headers = append(headers, payload.Pair{Name: f.Name, Value: value})
+		}
+	}
+	if !found {
+		return nil
+	}
+	// Query parameters keep the order of the docs; url.Values.Encode would
+	// sort them
+	var q []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			q = append(q, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	if len(q) > 0 {
+		path += "?" + strings.Join(q, "&")
+	}
+	return &SampleRequest{Method: strings.ToUpper(api.Method), URL: path, Headers: headers}
+}
+
+// givenValue returns the value the user gave for the parameter name.
+func givenValue(given []payload.Pair, name string) (string, bool) {
+	for _, p := range given {
+		if strings.EqualFold(p.Name, name) {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func parameterValue(profile string, f apiparser.APIField, c *payload.Clock) string {
+	switch {
+	case f.Example != "":
+		return f.Example
+	case f.Default != "":
+		return f.Default
+	case len(f.Enum) > 0:
+		return f.Enum[0]
+	}
+	return payload.SampleValue(profile, f.Name, c)
+}
+
+// fillPathParameter puts value in place of the parameter name in path,
+// written {name} as in OpenAPI or :name as in Postman.
+func fillPathParameter(path, name, value string) string {
+	if braced := "{" + name + "}"; strings.Contains(path, braced) {
+		return strings.ReplaceAll(path, braced, value)
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s == ":"+name {
+			segments[i] = value
+		}
+	}
+	return strings.Join(segments, "/")
+}
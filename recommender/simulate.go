@@ -0,0 +1,216 @@
+package recommender
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"api-recommender/payload"
+)
+
+// defaultEventTopic names the Kafka topic events are produced to.
+const defaultEventTopic = "{{operation}}-events"
+
+// Stages of a simulated flow.
+const (
+	StageRequest  = "request"
+	StageCommit   = "dlt_commit"
+	StageEvent    = "grpc_event"
+	StageKafka    = "kafka"
+	StageBackend  = "backend"
+	StageResponse = "response"
+)
+
+// Step is one stage of a simulated flow.
+type Step struct {
+	Stage  string `json:"stage"`
+	Detail string `json:"detail"`
+}
+
+// stageTitles head the steps in the reply.
+var stageTitles = map[string]string{
+	StageRequest:  "Request",
+	StageCommit:   "DLT commit",
+	StageEvent:    "gRPC event",
+	StageKafka:    "Kafka",
+	StageBackend:  "Backend",
+	StageResponse: "Response",
+}
+
+var (
+	reSamplePayload = regexp.MustCompile(`(?m)^(?:AI: )?Sample payload:\n`)
+	reAPIPath       = regexp.MustCompile(`(?m)^\s*Path: (\S+)`)
+	reNextTurn      = regexp.MustCompile(`\n(?:Human|AI): `)
+)
+
+// WithEventTopic sets the Kafka topic simulations say events go to.
+// {{operation}} in topic is replaced by the operation, e.g. "issue".
+func WithEventTopic(topic string) Option {
+	return func(e *Engine) { e.eventTopic = topic }
+}
+
+// simulate walks through what happens downstream to the payload pasted in
+// input or, failing that, the last one recommended in history.
+func (e *Engine) simulate(input, history string) *Result {
+	raw, apiPath := simulatedPayload(input, history)
+	res := &Result{Intent: IntentSimulate}
+	if raw == "" {
+		res.Reply = "There's no payload to simulate yet. Ask me for a recommendation first, or paste the payload along with \"simulate\"."
+		return res
+	}
+	fields, err := payload.Fields(raw)
+	if err != nil {
+		res.Reply = fmt.Sprintf("I can't simulate that payload: %v.", err)
+		return res
+	}
+
+	res.Simulation = e.flow(fields, apiPath)
+	var b strings.Builder
+	b.WriteString("Here is what happens once this payload is sent. Nothing is actually sent; the ids are the ones in the payload.\n\n")
+	for i, s := range res.Simulation {
+		fmt.Fprintf(&b, "%d. **%s**: %s\n", i+1, stageTitles[s.Stage], s.Detail)
+	}
+	res.Reply = strings.TrimSpace(b.String())
+	return res
+}
+
+// simulatedPayload finds the payload to simulate and the path of the API it
+// was recommended for, when known.
+func simulatedPayload(input, history string) (string, string) {
+	if i := strings.IndexAny(input, "{<"); i >= 0 {
+		return strings.TrimSpace(input[i:]), ""
+	}
+	loc := reSamplePayload.FindAllStringIndex(history, -1)
+	if loc == nil {
+		return "", ""
+	}
+	last := loc[len(loc)-1]
+	raw := history[last[1]:]
+	if end := reNextTurn.FindStringIndex(raw); end != nil {
+		raw = raw[:end[0]]
+	}
+	var apiPath string
+	if paths := reAPIPath.FindAllStringSubmatch(history[:last[0]], -1); paths != nil {
+		apiPath = paths[len(paths)-1][1]
+	}
+	return strings.TrimSpace(raw), apiPath
+}
+
+// flow lays out the stages the payload goes through: async requests are
+// answered by an event that reaches the backend through Kafka, sync ones in
+// the HTTP response.
+func (e *Engine) flow(fields []payload.Field, apiPath string) []Step {
+	value := func(p string) string {
+		for _, f := range fields {
+			if f.Path == p {
+				return f.Value
+			}
+		}
+		return ""
+	}
+	operation := operationOf(apiPath, orDefault(value("context.action"), value("payload.type")))
+	requestID := value("context.requestId")
+	rid := "requestId " + requestID
+	if requestID == "" {
+		rid = "no requestId (set context.requestId, or the event can't be matched to the request)"
+	}
+	target := "the API"
+	if apiPath != "" {
+		target = apiPath
+	}
+
+	request := fmt.Sprintf("The client POSTs the payload to %s with %s", target, rid)
+	if network := value("context.networkId"); network != "" {
+		request += " for network " + network
+	}
+	async := value("context.isAsync") == "true"
+	if async {
+		request += ". FSP validates it and acknowledges at once; the outcome follows as an event."
+	} else {
+		request += ". FSP validates it and keeps the call open until the ledger answers."
+	}
+
+	written := writtenEntries(fields)
+	commit := fmt.Sprintf("FSP submits the %s transaction to the ledger, where the chaincode commits it", operation)
+	if len(written) > 0 {
+		commit += ", writing " + strings.Join(written, ", ")
+	}
+	if parties := parties(fields); parties != "" {
+		commit += ", privately between " + parties
+	}
+	commit += "."
+
+	steps := []Step{{StageRequest, request}, {StageCommit, commit}}
+	if !async {
+		return append(steps, Step{StageResponse, fmt.Sprintf("FSP returns the outcome of %s in the HTTP response. Sync requests send no event, so nothing reaches Kafka.", rid)})
+	}
+
+	topic := strings.ReplaceAll(e.eventTopic, "{{operation}}", operation)
+	return append(steps,
+		Step{StageEvent, fmt.Sprintf("The chaincode sends the %s event to FSP over gRPC, carrying %s so it can be matched with the request.", operation, rid)},
+		Step{StageKafka, fmt.Sprintf("FSP produces the event to the %s topic, keyed by %s.", topic, rid)},
+		Step{StageBackend, fmt.Sprintf("The backend consumes the event from %s, matches it to %s and records the committed %s.", topic, rid, orDefault(strings.Join(written, ", "), "entries"))},
+	)
+}
+
+// operationOf names the operation of an API path such as /v1/ReqIssue, or
+// of the payload type when the path isn't known.
+func operationOf(apiPath, payloadType string) string {
+	if apiPath != "" {
+		name := strings.TrimPrefix(path.Base(apiPath), "Req")
+		if name != "" && name != "." && name != "/" {
+			return strings.ToLower(name)
+		}
+	}
+	if payloadType != "" {
+		return payloadType
+	}
+	return "request"
+}
+
+// writtenEntries describes the ledger entries the payload writes, e.g.
+// "tokenized asset GOLD-1".
+func writtenEntries(fields []payload.Field) []string {
+	kinds := []struct{ prefix, name string }{
+		{"payload.tokenizedAsset[", "tokenized asset"},
+		{"payload.transaction[", "transaction"},
+		{"payload.identity[", "identity"},
+	}
+	var out []string
+	for _, f := range fields {
+		for _, k := range kinds {
+			if strings.HasPrefix(f.Path, k.prefix) && strings.HasSuffix(f.Path, "].id") && !strings.Contains(f.Path, ".meta") {
+				out = append(out, k.name+" "+f.Value)
+			}
+		}
+		if strings.HasPrefix(f.Path, "payload.keyValue[") {
+			out = append(out, "key "+f.Name)
+		}
+	}
+	return out
+}
+
+// parties names the source and destination of a private transaction.
+func parties(fields []payload.Field) string {
+	var source, destination []string
+	for _, f := range fields {
+		switch {
+		case strings.HasPrefix(f.Path, "source[") && f.Name == "id":
+			source = append(source, f.Value)
+		case strings.HasPrefix(f.Path, "destination[") && f.Name == "id":
+			destination = append(destination, f.Value)
+		}
+	}
+	if len(source) == 0 || len(destination) == 0 {
+		return ""
+	}
+	return strings.Join(source, ", ") + " and " + strings.Join(destination, ", ")
+}
+
+func orDefault(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package recommender
+
+import (
+	"strings"
+
+	"api-recommender/payload"
+	"api-recommender/recommend"
+)
+
+// collectKeyValues gathers the key=value entries from the user's turns of the
+// current request, e.g. "purity=24k, quantity=100, vendor=MMTC", along with
+// amounts written in prose such as "interest 7.5%", so they can be placed in
+// the payload without asking the model. The keys count as the requested
+// fields: for a key-value store they are the fields, otherwise they are added
+// to whatever fields were extracted. Values are normalized first; the ones
+// that can't be read are returned as problems for the user to fix. Dates
+// are written with c.
+func collectKeyValues(info *recommend.QueryInfo, history, userInput string, isNew bool, c *payload.Clock) []payload.Problem {
+	text := strings.Join(requestTurns(history, userInput, isNew), "\n")
+	pairs := payload.ParsePairs(text)
+	pairs = append(pairs, payload.ParseUnitPhrases(text, pairs)...)
+	return useKeyValues(info, pairs, c)
+}
+
+// requestTurns returns the user's turns of the current request: userInput
+// alone when it starts a new request, else the turns since the last one
+// that did. Values given for an earlier request don't carry over to the
+// next one.
+func requestTurns(history, userInput string, isNew bool) []string {
+	if isNew {
+		return []string{userInput}
+	}
+	turns := userTurns(history)
+	for i := len(turns) - 1; i >= 0; i-- {
+		if isNewCreationRequest(turns[i], "") {
+			turns = turns[i:]
+			break
+		}
+	}
+	return append(turns, userInput)
+}
+
+// useKeyValues normalizes pairs into info's key=value entries and adds
+// their names to its fields, returning the values that need correcting.
+func useKeyValues(info *recommend.QueryInfo, pairs []payload.Pair, c *payload.Clock) []payload.Problem {
+	var problems []payload.Problem
+	info.KeyValues, problems = payload.Normalize(pairs, c)
+	if len(info.KeyValues) == 0 {
+		return problems
+	}
+
+	if info.Operation == "store" {
+		info.FieldNames = info.FieldNames[:0]
+	}
+	have := map[string]bool{}
+	for _, f := range info.FieldNames {
+		have[strings.ToLower(f)] = true
+	}
+	for _, p := range info.KeyValues {
+		if !have[strings.ToLower(p.Name)] {
+			info.FieldNames = append(info.FieldNames, p.Name)
+			have[strings.ToLower(p.Name)] = true
+		}
+	}
+	return problems
+}
+
+// valueQuestion asks the user to correct values Normalize could not read.
+func valueQuestion(problems []payload.Problem) string {
+	var b strings.Builder
+	b.WriteString("Some of the values you gave can't be used as they are:\n")
+	for _, p := range problems {
+		b.WriteString(" - " + p.Path + ": " + p.Message + "\n")
+	}
+	b.WriteString("Please send the corrected key=value pairs.")
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	apiparser "api-recommender/api-parser"
+	"api-recommender/config"
+	"api-recommender/content"
+	"api-recommender/hooks"
+	"api-recommender/recommend"
+)
+
+const regenerationsSchema = `
+CREATE TABLE IF NOT EXISTS regenerations (
+	message_id INTEGER PRIMARY KEY,
+	original_id INTEGER NOT NULL,
+	session TEXT NOT NULL,
+	complaint TEXT NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+func ensureRegenerationsSchema(db *sql.DB) error {
+	if _, err := db.Exec(regenerationsSchema); err != nil {
+		return fmt.Errorf("create regenerations schema: %w", err)
+	}
+	return nil
+}
+
+// canRegenerate reports whether a message presented a recommendation and
+// has been downvoted with a reason.
+func (s *ChatService) canRegenerate(ctx context.Context, sessionID string, messageID int64) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM recommendations r
+		JOIN message_feedback f ON f.message_id = r.message_id
+		WHERE r.session = ? AND r.message_id = ? AND f.rating = ? AND f.comment != '';`,
+		sessionID, messageID, FeedbackDown).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check regeneration: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Regenerate answers a downvoted recommendation again, passing the user's
+// complaint to the model as a correction. The new reply is appended to the
+// session and linked to the original message.
+func (s *ChatService) Regenerate(ctx context.Context, sessionID string, messageID int64) (*ChatResult, error) {
+	if err := s.checkNotDeleted(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	if err := s.content.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	ctx = content.WithSession(ctx, sessionID)
+	ctx, verbosity, err := s.sessionVerbosity(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ctx, err = s.sessionOutputFormat(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	var query, infoJSON string
+	err = s.db.QueryRowContext(ctx,
+		"SELECT query, query_info FROM recommendations WHERE session = ? AND message_id = ? ORDER BY id DESC LIMIT 1;",
+		sessionID, messageID).Scan(&query, &infoJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: message %d has no payload to regenerate", ErrMessageNotFound, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load recommendation: %w", err)
+	}
+
+	var complaint string
+	err = s.db.QueryRowContext(ctx,
+		"SELECT comment FROM message_feedback WHERE message_id = ? AND rating = ? AND comment != '';",
+		messageID, FeedbackDown).Scan(&complaint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: downvote message %d with a reason before regenerating it", ErrInvalidInput, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load feedback: %w", err)
+	}
+
+	info, err := recommend.UnmarshalQueryInfo([]byte(infoJSON))
+	if err != nil {
+		return nil, fmt.Errorf("decode query info: %w", err)
+	}
+	info.Correction = complaint
+
+	prompt := fmt.Sprintf("%s\n\nThe previous answer to this request was rejected: %s", query, complaint)
+	rec, err := s.engine.Recommend(ctx, prompt, info)
+	if errors.Is(err, recommend.ErrMissingRequiredFields) || errors.Is(err, recommend.ErrDisallowedValues) {
+		// The docs changed since the recommendation
+		return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("regenerate recommendation: %w", err)
+	}
+	shown, links, err := s.storePayloads(ctx, sessionID, rec)
+	if err != nil {
+		return nil, err
+	}
+	replies := recommendationMessages(shown, verbosity, links, s.FeatureEnabled(ctx, config.FeatureResponseSchemas))
+	if err := s.saveTurn(ctx, sessionID, "Regenerate the payload: "+complaint, replies); err != nil {
+		return nil, err
+	}
+	newID := replies[0].ID
+	if err := s.linkArtifacts(ctx, links, replies); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordRegeneration(ctx, sessionID, query, info, rec.API, rec.Payload, newID, messageID, complaint); err != nil {
+		return nil, err
+	}
+
+	s.runHooks(ctx, hooks.Event{
+		SessionID:    sessionID,
+		Query:        query,
+		QueryInfo:    info,
+		API:          rec.API,
+		Payload:      rec.Payload,
+		EventPayload: rec.EventPayload,
+	})
+
+	return &ChatResult{
+		SessionID:       sessionID,
+		MessageID:       newID,
+		RegeneratedFrom: messageID,
+		Message:         joinMessages(replies),
+		Messages:        replies,
+		Intent:          IntentRecommendation,
+		QueryInfo:       info,
+		Recommendation:  shown,
+		Artifacts:       links,
+	}, nil
+}
+
+// recordRegeneration stores the regenerated recommendation and links its
+// message to the original.
+func (s *ChatService) recordRegeneration(ctx context.Context, sessionID, query string, info *recommend.QueryInfo, api apiparser.APIDoc, payload string, messageID, originalID int64, complaint string) error {
+	id, err := s.recordRecommendation(ctx, sessionID, query, info, api, payload)
+	if err != nil {
+		return err
+	}
+	if err := s.linkRecommendation(ctx, id, messageID); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO regenerations (message_id, original_id, session, complaint) VALUES (?, ?, ?, ?);",
+		messageID, originalID, sessionID, complaint)
+	if err != nil {
+		return fmt.Errorf("record regeneration: %w", err)
+	}
+	return nil
+}
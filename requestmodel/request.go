@@ -3,8 +3,8 @@ package requestmodel
 import "encoding/xml"
 
 type Request struct {
-	XmlName     xml.Name
-	XmlNs       string               `xml:"xmlns:token,attr"`
+	XMLName     xml.Name             `json:"-"`
+	XmlNs       string               `json:"-" xml:"xmlns:token,attr"`
 	Source      []BusinessIdentifier `json:"source,omitempty" xml:"Source>BusinessIdentifiers>BusinessIdentifier,omitempty"`
 	Destination []BusinessIdentifier `json:"destination,omitempty" xml:"Destination>BusinessIdentifiers>BusinessIdentifier,omitempty"`
 	Context     Context              `json:"context,omitempty" xml:"Context,omitempty"`
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"api-recommender/content"
+	"api-recommender/hooks"
+)
+
+// ArmMetrics is the live accuracy of one arm of a prompt rollout: the share
+// of its rated recommendations that got a thumbs-up.
+type ArmMetrics struct {
+	FeedbackCounts
+	Accuracy float64 `json:"accuracy"`
+}
+
+func (m *ArmMetrics) add(rating int) {
+	if rating == FeedbackUp {
+		m.Up++
+	} else {
+		m.Down++
+	}
+	m.Accuracy = float64(m.Up) / float64(m.Up+m.Down)
+}
+
+func (m ArmMetrics) rated() int {
+	return m.Up + m.Down
+}
+
+// RolloutStatus compares the arms of one active rollout.
+type RolloutStatus struct {
+	content.Rollout
+	Stable    ArmMetrics `json:"stable"`
+	Candidate ArmMetrics `json:"candidate"`
+	// RolledBack is set when this evaluation rolled the candidate back.
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// RolloutAlert is posted to the rollout alert URL after an automatic
+// rollback.
+type RolloutAlert struct {
+	Event      string  `json:"event"`
+	Threshold  float64 `json:"threshold"`
+	MinSamples int     `json:"minSamples"`
+	RolloutStatus
+}
+
+// Rollouts reports the live accuracy of both arms of every active prompt
+// rollout.
+func (s *ChatService) Rollouts(ctx context.Context) ([]RolloutStatus, error) {
+	if err := s.content.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	out := []RolloutStatus{}
+	for _, r := range s.content.Rollouts() {
+		status, err := s.measureRollout(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// measureRollout tallies the feedback given since the rollout started, split
+// by the arm each session was served. A rating of the recommendation itself
+// wins over a rating of the message that presented it.
+func (s *ChatService) measureRollout(ctx context.Context, r content.Rollout) (RolloutStatus, error) {
+	status := RolloutStatus{Rollout: r}
+
+	started, err := time.Parse(time.RFC3339, r.Started)
+	if err != nil {
+		return status, fmt.Errorf("rollout of prompt %s: start time %q: %w", r.Prompt, r.Started, err)
+	}
+	// Matches the format of SQLite's CURRENT_TIMESTAMP
+	since := started.UTC().Format("2006-01-02 15:04:05")
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.session, COALESCE(r.feedback, mf.rating)
+		FROM recommendations r
+		LEFT JOIN message_feedback mf ON mf.message_id = r.message_id
+		WHERE r.created >= ? AND COALESCE(r.feedback, mf.rating) IS NOT NULL;`, since)
+	if err != nil {
+		return status, fmt.Errorf("load rollout feedback: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session string
+		var rating sql.NullInt64
+		if err := rows.Scan(&session, &rating); err != nil {
+			return status, fmt.Errorf("scan rollout feedback: %w", err)
+		}
+		if content.ArmFor(session, r.Prompt, r.Share) == content.ArmCandidate {
+			status.Candidate.add(int(rating.Int64))
+		} else {
+			status.Stable.add(int(rating.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return status, fmt.Errorf("iterate rollout feedback: %w", err)
+	}
+	return status, nil
+}
+
+// evaluateRollouts rolls back every candidate prompt whose accuracy fell too
+// far below the stable prompt's. It runs after each rating; failures are
+// logged and never fail the rating.
+func (s *ChatService) evaluateRollouts(ctx context.Context) {
+	cfg := s.cfg.Rollout
+	statuses, err := s.Rollouts(ctx)
+	if err != nil {
+		log.Printf("evaluate rollouts: %v", err)
+		return
+	}
+
+	for _, status := range statuses {
+		if status.Stable.rated() < cfg.MinSamples || status.Candidate.rated() < cfg.MinSamples {
+			continue
+		}
+		if status.Stable.Accuracy-status.Candidate.Accuracy < cfg.Threshold {
+			continue
+		}
+
+		reason := fmt.Sprintf("candidate accuracy %.2f is %.2f or more below stable accuracy %.2f",
+			status.Candidate.Accuracy, cfg.Threshold, status.Stable.Accuracy)
+		if _, err := s.content.Rollback(ctx, status.Prompt, reason); err != nil {
+			log.Printf("roll back prompt %s: %v", status.Prompt, err)
+			continue
+		}
+		log.Printf("Rolled back candidate for prompt %s: %s", status.Prompt, reason)
+
+		status.RolledBack = true
+		if cfg.AlertURL != "" {
+			alert := RolloutAlert{Event: "prompt_rollback", Threshold: cfg.Threshold, MinSamples: cfg.MinSamples, RolloutStatus: status}
+			go s.sendRolloutAlert(context.WithoutCancel(ctx), alert)
+		}
+	}
+}
+
+func (s *ChatService) sendRolloutAlert(ctx context.Context, alert RolloutAlert) {
+	if err := hooks.NewWebhook(s.cfg.Rollout.AlertURL).Post(ctx, alert); err != nil {
+		log.Printf("rollout alert for prompt %s: %v", alert.Prompt, err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-recommender/content"
+)
+
+func TestRolloutWithoutStartTime(t *testing.T) {
+	ts := newTestServer(t)
+	if _, err := ts.svc.measureRollout(t.Context(), content.Rollout{Prompt: "payload", Share: 10}); err == nil {
+		t.Fatal("rollout without a start time measured over all feedback")
+	}
+	if _, err := ts.svc.measureRollout(t.Context(), content.Rollout{Prompt: "payload", Share: 10, Started: "2026-10-16T09:00:00Z"}); err != nil {
+		t.Fatalf("measure rollout: %v", err)
+	}
+}
+
+func TestRolloutAlertDelivered(t *testing.T) {
+	got := make(chan RolloutAlert, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert RolloutAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		got <- alert
+	}))
+	defer hook.Close()
+
+	ts := newTestServer(t)
+	ts.svc.cfg.Rollout.AlertURL = hook.URL
+	ts.svc.sendRolloutAlert(t.Context(), RolloutAlert{Event: "prompt_rollback", RolloutStatus: RolloutStatus{Rollout: content.Rollout{Prompt: "payload"}}})
+	if alert := <-got; alert.Event != "prompt_rollback" || alert.Prompt != "payload" {
+		t.Fatalf("alert = %+v", alert)
+	}
+}
@@ -0,0 +1,294 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"api-recommender/payload"
+)
+
+// ErrNoCannedResponse is returned for prompts the stub has no answer for.
+// Every such prompt in the recommender has a keyword-based fallback, which is
+// what the sandbox relies on for classification and extraction.
+var ErrNoCannedResponse = errors.New("sandbox: no canned response for prompt")
+
+// LLM is a deterministic stand-in for a real model. It recognises the
+// recommender's prompts by their wording and answers each with a fixed
+// response derived only from the prompt text.
+type LLM struct{}
+
+// NewLLM returns the sandbox stub model.
+func NewLLM() *LLM {
+	return &LLM{}
+}
+
+var (
+	reAPILine       = regexp.MustCompile(`(?m)^\[(\d+)\] \S+ (\S+)`)
+	reOperation     = regexp.MustCompile(`\(operation: (\w+)`)
+	reRequestFields = regexp.MustCompile(`Use ONLY these fields in the request payload: (.+)`)
+	reEventFields   = regexp.MustCompile(`Event struct with the following fields: (.+)`)
+	reUserQuestion  = regexp.MustCompile(`User question: "(.*)"`)
+	reExistingAsset = regexp.MustCompile(`acts on the existing asset "([^"]+)"`)
+	reUserQuery     = regexp.MustCompile(`User query: "(.*)"`)
+	reRecentHistory = regexp.MustCompile(`(?s)Recent conversation \(last 3-4 messages only\): (.*?)\n\nReturn ONLY`)
+	reAttachment    = regexp.MustCompile(`(?s)Attached payload:\n(.*?)\n\n(?:Problems|Checks)`)
+	rePreflightEcho = regexp.MustCompile(`"echo": "([^"]*)"`)
+)
+
+// valueProfiles maps the wording of the prompt's VALUES line to the value
+// profile it asks for.
+var valueProfiles = map[string]string{
+	"VALUES: Use realistic Indian": payload.ProfileRealisticIndia,
+	"VALUES: Use stress-test":      payload.ProfileStressTest,
+}
+
+// Keywords the stub uses to classify a query the way the model is asked to.
+var (
+	explainKeywords  = []string{"explain", "what is", "what does", "tell me about", "how does", "describe", "meaning of"}
+	creationKeywords = []string{"create", "issue", "make", "generate", "build", "burn", "lock", "trade", "settle", "register", "onboard", "certif", "store", "want to", "need to"}
+	pendingQuestions = []string{"To proceed", "which operation", "Reply with the asset id", "corrected key=value pairs"}
+)
+
+// operationPaths maps an extracted operation to the API path it should pick.
+var operationPaths = map[string]string{
+	"create": "ReqIssue",
+	"burn":   "ReqManage",
+	"trade":  "ReqSettle",
+	// Identity onboarding goes through the issue API
+	"register": "ReqIssue",
+	"certify":  "ReqIssue",
+	"store":    "ReqTransact",
+}
+
+// GenerateContent implements llms.Model.
+func (l *LLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, o := range options {
+		o(&opts)
+	}
+
+	var prompt strings.Builder
+	var results []llms.ToolCallResponse
+	for _, m := range messages {
+		for _, part := range m.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				prompt.WriteString(p.Text)
+			case llms.ToolCallResponse:
+				results = append(results, p)
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		if call, ok := toolCall(prompt.String(), opts.Tools); ok {
+			return &llms.ContentResponse{
+				Choices: []*llms.ContentChoice{{ToolCalls: []llms.ToolCall{call}, StopReason: "tool_calls"}},
+			}, nil
+		}
+	}
+
+	content, err := l.respond(prompt.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		content += fmt.Sprintf("\n\n%s says: %s", r.Name, r.Content)
+	}
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{Content: content, StopReason: "stop"}},
+	}, nil
+}
+
+// toolCall calls the first offered tool whose name, read as words
+// ("network_status"), appears in the user's question, or failing that whose
+// first word ("network") does. It passes no arguments.
+func toolCall(prompt string, tools []llms.Tool) (llms.ToolCall, bool) {
+	m := reUserQuestion.FindStringSubmatch(prompt)
+	if m == nil {
+		return llms.ToolCall{}, false
+	}
+	question := " " + strings.Join(strings.FieldsFunc(strings.ToLower(m[1]), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+	for _, wholeName := range []bool{true, false} {
+		for _, t := range tools {
+			if t.Function == nil {
+				continue
+			}
+			words := strings.Fields(strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(t.Function.Name)))
+			if len(words) == 0 {
+				continue
+			}
+			if !wholeName {
+				words = words[:1]
+			}
+			if strings.Contains(question, " "+strings.Join(words, " ")+" ") {
+				return llms.ToolCall{
+					ID:           "sandbox-call-1",
+					Type:         "function",
+					FunctionCall: &llms.FunctionCall{Name: t.Function.Name, Arguments: "{}"},
+				}, true
+			}
+		}
+	}
+	return llms.ToolCall{}, false
+}
+
+// Call implements llms.Model.
+func (l *LLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, l, prompt, options...)
+}
+
+func (l *LLM) respond(prompt string) (string, error) {
+	switch {
+	case strings.Contains(prompt, "Preflight check: reply"):
+		return "READY", nil
+	case strings.Contains(prompt, "Preflight check: return ONLY valid JSON"):
+		if m := rePreflightEcho.FindStringSubmatch(prompt); m != nil {
+			return fmt.Sprintf(`{"ready": true, "echo": %q}`, m[1]), nil
+		}
+	case strings.Contains(prompt, "Analyze the following user query and determine"):
+		return classify(prompt), nil
+	case strings.Contains(prompt, "You are selecting the best API"):
+		return fmt.Sprintf(`{"api_index": %d}`, pickAPI(prompt)), nil
+	case strings.Contains(prompt, `{"field_index"`):
+		return `{"field_index": [0]}`, nil
+	case strings.Contains(prompt, "generating a precise, valid sample request payload"):
+		return samplePayload(prompt), nil
+	case reEventFields.MatchString(prompt):
+		return sampleEvent(prompt), nil
+	case reAttachment.MatchString(prompt):
+		// The stub can't fix payloads; it hands the attachment back
+		return reAttachment.FindStringSubmatch(prompt)[1], nil
+	case reUserQuestion.MatchString(prompt):
+		question := reUserQuestion.FindStringSubmatch(prompt)[1]
+		return fmt.Sprintf("This is a sandbox answer for %q. Connect a real model with LLM_API_TOKEN for detailed explanations of fields and flows.", question), nil
+	}
+	return "", ErrNoCannedResponse
+}
+
+// classify treats explanations as field questions, and creation keywords or
+// replies to a pending follow-up question as creation requests.
+func classify(prompt string) string {
+	var query, recent string
+	if m := reUserQuery.FindStringSubmatch(prompt); m != nil {
+		query = strings.ToLower(m[1])
+	}
+	if m := reRecentHistory.FindStringSubmatch(prompt); m != nil {
+		recent = m[1]
+	}
+
+	creation := false
+	switch {
+	case containsAny(query, explainKeywords):
+	case containsAny(query, creationKeywords), containsAny(recent, pendingQuestions):
+		creation = true
+	}
+	return fmt.Sprintf(`{"is_creation_request": %t, "is_relevant": true, "reason": "sandbox"}`, creation)
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickAPI chooses the API matching the operation named in the prompt, falling
+// back to the first API listed.
+func pickAPI(prompt string) int {
+	want := operationPaths["create"]
+	if m := reOperation.FindStringSubmatch(prompt); m != nil {
+		if path, ok := operationPaths[m[1]]; ok {
+			want = path
+		}
+	}
+
+	for _, m := range reAPILine.FindAllStringSubmatch(prompt, -1) {
+		if strings.HasSuffix(m[2], want) {
+			idx, _ := strconv.Atoi(m[1])
+			return idx
+		}
+	}
+	return 0
+}
+
+// promptProfile returns the value profile the prompt asks for, minimal
+// when it names none.
+func promptProfile(prompt string) string {
+	for wording, profile := range valueProfiles {
+		if strings.Contains(prompt, wording) {
+			return profile
+		}
+	}
+	return payload.ProfileMinimal
+}
+
+// samplePayload builds a request payload carrying a placeholder value for
+// every requested field, in the value profile the prompt asks for. Dates
+// are UTC, like a model's would be in any format; the engine rewrites them
+// with its clock.
+func samplePayload(prompt string) string {
+	profile := promptProfile(prompt)
+	var details []map[string]string
+	if m := reRequestFields.FindStringSubmatch(prompt); m != nil {
+		for _, name := range strings.Split(m[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				details = append(details, map[string]string{"name": name, "value": payload.SampleValue(profile, name, nil)})
+			}
+		}
+	}
+
+	assetID := "sandbox-asset-001"
+	if m := reExistingAsset.FindStringSubmatch(prompt); m != nil {
+		assetID = m[1]
+	}
+
+	body := map[string]any{
+		"tokenizedAsset": []any{
+			map[string]any{"id": assetID, "meta": map[string]any{"details": details}},
+		},
+	}
+	doc := map[string]any{
+		"context": map[string]any{"requestId": "sandbox-request-001"},
+		"payload": body,
+	}
+	switch {
+	case strings.Contains(prompt, "OPERATION TEMPLATE: REGISTER"):
+		delete(body, "tokenizedAsset")
+		body["identity"] = []any{map[string]any{"id": "sandbox-identity-001", "type": "participant", "entityType": "organisation", "alias": "sandbox-org"}}
+	case strings.Contains(prompt, "OPERATION TEMPLATE: CERTIFY"):
+		delete(body, "tokenizedAsset")
+		body["identity"] = []any{map[string]any{"id": "sandbox-identity-001", "certificate": "-----BEGIN CERTIFICATE-----sandbox-----END CERTIFICATE-----", "issuer": "sandbox-ca"}}
+	case strings.Contains(prompt, "OPERATION TEMPLATE: TRADE"):
+		doc["source"] = []any{map[string]any{"id": "sandbox-org-seller", "type": "organization"}}
+		doc["destination"] = []any{map[string]any{"id": "sandbox-org-buyer", "type": "organization"}}
+		body["transaction"] = []any{map[string]any{"id": "sandbox-txn-001", "type": "settle", "status": "initiated"}}
+	}
+	out, _ := json.MarshalIndent(doc, "", "  ")
+	return string(out)
+}
+
+// sampleEvent builds an event payload with a placeholder for each field.
+func sampleEvent(prompt string) string {
+	event := map[string]string{}
+	m := reEventFields.FindStringSubmatch(prompt)
+	for _, name := range strings.Split(m[1], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			event[name] = "sample-" + name
+		}
+	}
+	out, _ := json.MarshalIndent(event, "", "  ")
+	return string(out)
+}
@@ -0,0 +1,19 @@
+// Package sandbox provides a self-contained demo setup: a small embedded API
+// catalog and a stub LLM with deterministic canned responses, so the product
+// can be tried end-to-end without an API key or docs.
+package sandbox
+
+import (
+	_ "embed"
+	"strings"
+
+	apiparser "api-recommender/api-parser"
+)
+
+//go:embed demo_apis.md
+var demoAPIs string
+
+// Catalog returns the embedded demo API catalog.
+func Catalog() ([]apiparser.APIDoc, error) {
+	return apiparser.ParseAPIDocsFrom(strings.NewReader(demoAPIs))
+}
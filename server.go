@@ -0,0 +1,884 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"api-recommender/assets"
+	"api-recommender/config"
+	"api-recommender/content"
+	llmprovider "api-recommender/llm_provider"
+	"api-recommender/payload"
+	"api-recommender/recommend"
+
+	"github.com/google/uuid"
+)
+
+// serverConfig holds the settings for server mode.
+type serverConfig struct {
+	addr       string
+	staticDir  string
+	adminToken string
+	apiKeys    []string
+	rateLimit  int // requests per minute per client, 0 disables limiting
+	// trustedProxies are the proxies whose X-Forwarded-For is believed
+	// when telling rate-limited clients apart.
+	trustedProxies []netip.Prefix
+
+	requireSessionTokens bool
+}
+
+type server struct {
+	service *ChatService
+	cfg     serverConfig
+}
+
+// apiV1Prefix is the prefix of the current versioned HTTP API. The original
+// unversioned /api paths are served by a compatibility shim that keeps their
+// historical response shapes.
+const apiV1Prefix = "/api/v1"
+
+// route describes one endpoint. Every route gets the global middleware stack;
+// methods are enforced automatically and admin routes additionally require the
+// admin token. Routes under /api/v1 are also exposed at their legacy /api path,
+// served by legacy when the v1 response shape has diverged.
+type route struct {
+	pattern string
+	methods []string
+	admin   bool
+	handler http.HandlerFunc
+	legacy  http.HandlerFunc
+}
+
+func runServer(ctx context.Context, service *ChatService, cfg serverConfig) {
+	log.Printf("Starting API recommender server on %s", cfg.addr)
+
+	srv := &server{service: service, cfg: cfg}
+	httpServer := &http.Server{Addr: cfg.addr, Handler: srv.handler()}
+	listener, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+
+	// Stop on SIGINT/SIGTERM so the caller can close the service, which
+	// writes any queued messages
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		sdNotify("STOPPING=1")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("server shutdown: %v", err)
+		}
+	}()
+
+	// systemd (Type=notify) counts the service as started once it listens
+	sdNotify("READY=1")
+	go sdWatchdog(ctx, service.alive)
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("server error: %v", err)
+	}
+	// Wait for in-flight requests before the service is closed
+	<-stopped
+	log.Printf("Server stopped")
+}
+
+func (s *server) routes() []route {
+	return []route{
+		{pattern: "/api/v1/chat", methods: []string{http.MethodPost}, handler: s.handleChat, legacy: s.handleLegacyChat},
+		{pattern: "/api/v1/sessions", methods: []string{http.MethodGet}, handler: s.handleListSessions},
+		{pattern: "/api/v1/sessions/", methods: []string{http.MethodGet, http.MethodPost, http.MethodDelete}, handler: s.handleSession},
+		{pattern: "/api/v1/artifacts/", methods: []string{http.MethodGet}, handler: s.handleArtifact},
+		{pattern: "/api/v1/admin/sessions/export", methods: []string{http.MethodGet}, admin: true, handler: s.handleExportSessions},
+		{pattern: "/api/v1/admin/sessions/import", methods: []string{http.MethodPost}, admin: true, handler: s.handleImportSessions},
+		{pattern: "/api/v1/admin/sessions/import-transcript", methods: []string{http.MethodPost}, admin: true, handler: s.handleImportTranscript},
+		{pattern: "/api/v1/admin/dataset", methods: []string{http.MethodGet}, admin: true, handler: s.handleDatasetExport},
+		{pattern: "/api/v1/admin/analytics", methods: []string{http.MethodGet}, admin: true, handler: s.handleAnalytics},
+		{pattern: "/api/v1/admin/rollouts", methods: []string{http.MethodGet}, admin: true, handler: s.handleRollouts},
+		{pattern: "/api/v1/admin/gc", methods: []string{http.MethodGet, http.MethodPost}, admin: true, handler: s.handleGC},
+		{pattern: "/api/v1/admin/prompts", methods: contentMethods, admin: true, handler: s.handleContent(content.KindPrompts)},
+		{pattern: "/api/v1/admin/prompts/", methods: contentMethods, admin: true, handler: s.handleContent(content.KindPrompts)},
+		{pattern: "/api/v1/admin/glossary", methods: contentMethods, admin: true, handler: s.handleContent(content.KindGlossary)},
+		{pattern: "/api/v1/admin/glossary/", methods: contentMethods, admin: true, handler: s.handleContent(content.KindGlossary)},
+		{pattern: "/api/v1/admin/usecases", methods: contentMethods, admin: true, handler: s.handleContent(content.KindUsecases)},
+		{pattern: "/api/v1/admin/usecases/", methods: contentMethods, admin: true, handler: s.handleContent(content.KindUsecases)},
+		{pattern: "/api/v1/features", methods: []string{http.MethodGet}, handler: s.handleFeatures},
+		{pattern: "/api/v1/validate", methods: []string{http.MethodPost}, handler: s.handleValidate},
+		{pattern: "/api/v1/explain", methods: []string{http.MethodPost}, handler: s.handleExplain},
+		{pattern: "/api/v1/convert", methods: []string{http.MethodPost}, handler: s.handleConvert},
+		{pattern: "/healthz", methods: []string{http.MethodGet}, handler: s.handleHealthz},
+		{pattern: "/readyz", methods: []string{http.MethodGet}, handler: s.handleReadyz},
+	}
+}
+
+// withLegacyRoutes appends the unversioned /api alias of every v1 route.
+// Legacy responses advertise their successor so clients can migrate.
+func withLegacyRoutes(routes []route) []route {
+	out := append([]route(nil), routes...)
+	for _, rt := range routes {
+		if !strings.HasPrefix(rt.pattern, apiV1Prefix+"/") {
+			continue
+		}
+
+		successor := rt.pattern
+		h := rt.handler
+		if rt.legacy != nil {
+			h = rt.legacy
+		}
+
+		legacy := rt
+		legacy.pattern = "/api" + strings.TrimPrefix(rt.pattern, apiV1Prefix)
+		legacy.handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+			h(w, r)
+		}
+		legacy.legacy = nil
+		out = append(out, legacy)
+	}
+	return out
+}
+
+// handler builds the full HTTP handler: the route table wrapped in the
+// per-route and global middleware stacks.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	for _, rt := range withLegacyRoutes(s.routes()) {
+		mws := []middleware{allowMethods(rt.methods...)}
+		if rt.admin {
+			mws = append(mws, requireAdminToken(s.cfg.adminToken))
+		} else if strings.HasPrefix(rt.pattern, "/api/") {
+			mws = append(mws, requireAPIKey(s.cfg.apiKeys))
+		}
+		mux.Handle(rt.pattern, chain(rt.handler, mws...))
+	}
+
+	if fi, err := os.Stat(s.cfg.staticDir); err == nil && fi.IsDir() {
+		mux.Handle("/", http.FileServer(http.Dir(s.cfg.staticDir)))
+		log.Printf("Serving static files from %s", s.cfg.staticDir)
+	} else {
+		log.Printf("Static directory %s not found or not a directory; skipping static file serving", s.cfg.staticDir)
+	}
+
+	return chain(mux,
+		withRequestID,
+		recoverPanics,
+		logRequests,
+		cors,
+		rateLimit(s.cfg.rateLimit, s.cfg.trustedProxies),
+		compress,
+	)
+}
+
+// chatRequest is the chat request body shared by every API version.
+type chatRequest struct {
+	SessionID string `json:"sessionId"`
+	Message   string `json:"message"`
+	// Verbosity, when set, becomes the session's verbosity.
+	Verbosity string `json:"verbosity"`
+	// ValueProfile picks the dummy values of this turn's sample payload.
+	ValueProfile string `json:"valueProfile"`
+	// SmartDefaults, when set, turns the session's smart defaults on or
+	// off: context questions a reply leaves open are defaulted instead of
+	// asked again.
+	SmartDefaults *bool `json:"smartDefaults"`
+	// Attachment is a payload or spec excerpt to discuss. Multipart
+	// requests send it as the "attachment" file.
+	Attachment *Attachment `json:"attachment"`
+	// Anonymize replaces VPAs, wallet addresses and ids in the message and
+	// attachment with fakes before they are stored or echoed back.
+	Anonymize bool `json:"anonymize"`
+	// Debug adds the turn's trace, such as how the API was scored, to the
+	// result.
+	Debug bool `json:"debug"`
+}
+
+// context adds the request's settings to the chat context.
+func (req chatRequest) context(ctx context.Context) context.Context {
+	if v, ok := recommend.ParseVerbosity(req.Verbosity); ok {
+		ctx = recommend.WithVerbosity(ctx, v)
+	}
+	if req.ValueProfile != "" {
+		ctx = recommend.WithValueProfile(ctx, req.ValueProfile)
+	}
+	if req.SmartDefaults != nil {
+		ctx = recommend.WithSmartDefaults(ctx, *req.SmartDefaults)
+	}
+	if req.Attachment != nil {
+		ctx = withAttachment(ctx, req.Attachment)
+	}
+	if req.Anonymize {
+		ctx = withAnonymize(ctx)
+	}
+	if req.Debug {
+		ctx = recommend.WithTrace(ctx, &recommend.Trace{})
+	}
+	return ctx
+}
+
+// decodeChatRequest reads and validates the chat request body, sent as JSON
+// or, to attach a file, as multipart/form-data.
+func decodeChatRequest(w http.ResponseWriter, r *http.Request) (chatRequest, bool) {
+	var req chatRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		if !decodeChatForm(w, r, &req) {
+			return req, false
+		}
+	} else if !decodeBody(w, r, &req) {
+		return req, false
+	}
+
+	v := &requestValidator{}
+	v.sessionID("sessionId", req.SessionID, false)
+	// A message is optional when there is an attachment to look at
+	v.text("message", req.Message, req.Attachment == nil, maxMessageLength)
+	if req.Verbosity != "" {
+		v.oneOf("verbosity", req.Verbosity, string(recommend.VerbosityConcise), string(recommend.VerbosityNormal), string(recommend.VerbosityDetailed))
+	}
+	if req.ValueProfile != "" {
+		v.oneOf("valueProfile", req.ValueProfile, payload.Profiles()...)
+	}
+	if req.Attachment != nil {
+		v.attachment("attachment", req.Attachment)
+	}
+	if v.failed(w, r) {
+		return req, false
+	}
+
+	if req.Attachment != nil && strings.TrimSpace(req.Message) == "" {
+		req.Message = "Check this attachment."
+	}
+	return req, true
+}
+
+// decodeChatForm reads a multipart chat request: the chatRequest fields as
+// form values and an optional "attachment" file.
+func decodeChatForm(w http.ResponseWriter, r *http.Request, req *chatRequest) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	if err := r.ParseMultipartForm(maxRequestBodyBytes); err != nil {
+		v := &requestValidator{}
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			v.add("body", "must be at most %d bytes", sizeErr.Limit)
+		} else {
+			v.add("body", "is not a valid multipart form: %v", err)
+		}
+		v.failed(w, r)
+		return false
+	}
+
+	req.SessionID = r.FormValue("sessionId")
+	req.Message = r.FormValue("message")
+	req.Verbosity = r.FormValue("verbosity")
+	req.ValueProfile = r.FormValue("valueProfile")
+	req.Anonymize, _ = strconv.ParseBool(r.FormValue("anonymize"))
+	req.Debug, _ = strconv.ParseBool(r.FormValue("debug"))
+	if on, err := strconv.ParseBool(r.FormValue("smartDefaults")); err == nil {
+		req.SmartDefaults = &on
+	}
+
+	file, header, err := r.FormFile("attachment")
+	if errors.Is(err, http.ErrMissingFile) {
+		return true
+	}
+	if err != nil {
+		v := &requestValidator{}
+		v.add("attachment", "could not be read: %v", err)
+		v.failed(w, r)
+		return false
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so oversized files are caught
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentBytes+1))
+	if err != nil {
+		v := &requestValidator{}
+		v.add("attachment", "could not be read: %v", err)
+		v.failed(w, r)
+		return false
+	}
+	req.Attachment = &Attachment{Name: header.Filename, Content: string(data)}
+	return true
+}
+
+// handleChat returns the structured chat result.
+func (s *server) handleChat(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.SessionID != "" && !s.authorizeChat(w, r, req.SessionID) {
+		return
+	}
+
+	ctx, err := s.chatContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	result, err := s.service.Chat(req.context(ctx), req.SessionID, req.Message)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// handleLegacyChat keeps the original {sessionId, message} response shape for
+// clients of the unversioned API.
+func (s *server) handleLegacyChat(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.SessionID != "" && !s.authorizeChat(w, r, req.SessionID) {
+		return
+	}
+
+	ctx, err := s.chatContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	result, err := s.service.Chat(req.context(ctx), req.SessionID, req.Message)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"sessionId": result.SessionID,
+		"message":   result.Message,
+	}
+	if result.SessionToken != "" {
+		resp["sessionToken"] = result.SessionToken
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	v := &requestValidator{}
+	limit := v.limit(r.URL.Query().Get("limit"))
+	if v.failed(w, r) {
+		return
+	}
+
+	var sessions []SessionSummary
+	var err error
+	if s.cfg.requireSessionTokens {
+		sessions, err = s.service.ListSessionsByID(r.Context(), s.presentedSessions(r), limit)
+	} else {
+		sessions, err = s.service.ListSessions(r.Context(), limit)
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, map[string]any{"sessions": sessions})
+}
+
+func (s *server) handleSession(w http.ResponseWriter, r *http.Request) {
+	path := pathAfter(r.URL.Path, "/sessions/")
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidInput, "session id required", nil)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	sessionID := parts[0]
+
+	v := &requestValidator{}
+	v.sessionID("sessionId", sessionID, true)
+	if v.failed(w, r) {
+		return
+	}
+	if !s.authorizeSession(w, r, sessionID) {
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodDelete {
+		s.handleDeleteSession(w, r, sessionID)
+		return
+	}
+	if len(parts) == 1 {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "resource not found", nil)
+		return
+	}
+
+	switch {
+	case parts[1] == "feedback" && r.Method == http.MethodPost:
+		s.handleFeedback(w, r, sessionID)
+	case parts[1] == "messages" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.handleSessionMessages(w, r, sessionID)
+	case parts[1] == "artifacts" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.handleSessionArtifacts(w, r, sessionID)
+	case parts[1] == "pdf" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.handleSessionPDF(w, r, sessionID)
+	case parts[1] == "email" && len(parts) == 2 && r.Method == http.MethodPost:
+		s.handleEmailRecommendation(w, r, sessionID)
+	case parts[1] == "ticket" && len(parts) == 2 && r.Method == http.MethodPost:
+		s.handleRaiseTicket(w, r, sessionID)
+	case parts[1] == "messages" && len(parts) == 4 && parts[3] == "feedback" && r.Method == http.MethodPost:
+		s.handleMessageFeedback(w, r, sessionID, parts[2])
+	case parts[1] == "messages" && len(parts) == 4 && parts[3] == "regenerate" && r.Method == http.MethodPost:
+		s.handleRegenerate(w, r, sessionID, parts[2])
+	default:
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "resource not found", nil)
+	}
+}
+
+func (s *server) handleSessionMessages(w http.ResponseWriter, r *http.Request, sessionID string) {
+	v := &requestValidator{}
+	limit := v.limit(r.URL.Query().Get("limit"))
+	if v.failed(w, r) {
+		return
+	}
+
+	messages, err := s.service.GetSessionMessages(r.Context(), sessionID, limit)
+	switch {
+	case errors.Is(err, ErrSessionNotFound) && isLegacyPath(r):
+		// The unversioned API answered an unknown session with no messages
+		messages = []StoredMessage{}
+	case err != nil:
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"sessionId": sessionID,
+		"messages":  messages,
+	})
+}
+
+// isLegacyPath reports whether r came through the unversioned /api shim.
+func isLegacyPath(r *http.Request) bool {
+	return !strings.HasPrefix(r.URL.Path, apiV1Prefix+"/")
+}
+
+// handleSessionPDF serves the session's transcript as a PDF download.
+func (s *server) handleSessionPDF(w http.ResponseWriter, r *http.Request, sessionID string) {
+	doc, err := s.service.SessionPDF(r.Context(), sessionID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.pdf"`, sessionID))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(doc)
+}
+
+// handleEmailRecommendation emails the session's latest recommendation to
+// the address in the body.
+func (s *server) handleEmailRecommendation(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var req struct {
+		To string `json:"to"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	v := &requestValidator{}
+	v.text("to", req.To, true, maxAddressLength)
+	if v.failed(w, r) {
+		return
+	}
+
+	to, err := s.service.EmailRecommendation(r.Context(), sessionID, req.To)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]any{"sessionId": sessionID, "to": to, "status": "sent"})
+}
+
+// handleRaiseTicket raises the session's latest recommendation as a ticket
+// in the tenant's issue tracker.
+func (s *server) handleRaiseTicket(w http.ResponseWriter, r *http.Request, sessionID string) {
+	ctx, err := s.tenantContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	ref, err := s.service.RaiseTicket(ctx, sessionID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSONBody(w, map[string]any{"sessionId": sessionID, "ticket": ref})
+}
+
+// handleDeleteSession deletes a session. Its data is purged by the next
+// sweep.
+func (s *server) handleDeleteSession(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if err := s.service.DeleteSession(r.Context(), sessionID); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]any{"sessionId": sessionID, "status": "deleted"})
+}
+
+// handleGC reports the sweep metrics, or with POST runs a sweep now and
+// reports what it removed.
+func (s *server) handleGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		stats, err := s.service.Sweep(r.Context())
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+		writeJSON(w, map[string]any{"swept": stats, "metrics": s.service.GCMetrics()})
+		return
+	}
+	writeJSON(w, s.service.GCMetrics())
+}
+
+// handleSessionArtifacts lists the artifacts generated in a session.
+func (s *server) handleSessionArtifacts(w http.ResponseWriter, r *http.Request, sessionID string) {
+	artifacts, err := s.service.SessionArtifacts(r.Context(), sessionID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]any{"sessionId": sessionID, "artifacts": artifacts})
+}
+
+func (s *server) handleFeedback(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var req struct {
+		Rating  string `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	v := &requestValidator{}
+	v.oneOf("rating", req.Rating, "up", "down")
+	v.text("comment", req.Comment, false, maxCommentLength)
+	if v.failed(w, r) {
+		return
+	}
+
+	rating := FeedbackUp
+	if strings.EqualFold(req.Rating, "down") {
+		rating = FeedbackDown
+	}
+
+	if err := s.service.RateLatestRecommendation(r.Context(), sessionID, rating, req.Comment); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, map[string]any{"sessionId": sessionID, "status": "recorded"})
+}
+
+func (s *server) handleMessageFeedback(w http.ResponseWriter, r *http.Request, sessionID, rawID string) {
+	var req struct {
+		Rating  string `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	v := &requestValidator{}
+	messageID := v.messageID("messageId", rawID)
+	v.oneOf("rating", req.Rating, "up", "down")
+	v.text("comment", req.Comment, false, maxCommentLength)
+	if v.failed(w, r) {
+		return
+	}
+
+	rating := FeedbackUp
+	if strings.EqualFold(req.Rating, "down") {
+		rating = FeedbackDown
+	}
+
+	regenerable, err := s.service.RateMessage(r.Context(), sessionID, messageID, rating, req.Comment)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{"sessionId": sessionID, "messageId": messageID, "status": "recorded"}
+	if regenerable {
+		// Offer to redo the payload with the complaint as a correction
+		resp["regenerate"] = fmt.Sprintf("%s/sessions/%s/messages/%d/regenerate", apiV1Prefix, sessionID, messageID)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *server) handleRegenerate(w http.ResponseWriter, r *http.Request, sessionID, rawID string) {
+	v := &requestValidator{}
+	messageID := v.messageID("messageId", rawID)
+	if v.failed(w, r) {
+		return
+	}
+
+	ctx, err := s.chatContext(r)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	result, err := s.service.Regenerate(ctx, sessionID, messageID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// handleArtifact downloads a stored artifact. Artifacts belong to the
+// session that produced them and need its token when tokens are required;
+// artifacts of session-less endpoints are shared by their id alone.
+// ?inline=true serves the content for display instead of as a download.
+func (s *server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	id := pathAfter(r.URL.Path, "/artifacts/")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "resource not found", nil)
+		return
+	}
+
+	artifact, err := s.service.Artifact(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if !s.authorizeSession(w, r, artifact.SessionID) {
+		return
+	}
+
+	ext := "json"
+	if artifact.ContentType == "application/xml" {
+		ext = "xml"
+	}
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(r.URL.Query().Get("inline")); inline {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s-%s.%s"`, disposition, artifact.Kind, artifact.ID, ext))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(artifact.Content))
+}
+
+func (s *server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	analytics, err := s.service.Analytics(r.Context())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, analytics)
+}
+
+func (s *server) handleRollouts(w http.ResponseWriter, r *http.Request) {
+	rollouts, err := s.service.Rollouts(r.Context())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, map[string]any{"rollouts": rollouts})
+}
+
+func (s *server) handleExportSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="sessions.ndjson"`)
+	if err := s.service.ExportSessions(r.Context(), w); err != nil {
+		log.Printf("export sessions: %v", err)
+	}
+}
+
+func (s *server) handleImportSessions(w http.ResponseWriter, r *http.Request) {
+	result, err := s.service.ImportSessions(r.Context(), r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidInput, "import sessions failed", err.Error())
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// handleImportTranscript stores the plain transcript in the body as a new
+// session, named by the optional session query parameter.
+func (s *server) handleImportTranscript(w http.ResponseWriter, r *http.Request) {
+	v := &requestValidator{}
+	v.sessionID("session", r.URL.Query().Get("session"), false)
+	if v.failed(w, r) {
+		return
+	}
+
+	result, err := s.service.ImportTranscript(r.Context(), r.URL.Query().Get("session"), r.Body)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSONBody(w, result)
+}
+
+func (s *server) handleDatasetExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="dataset.ndjson"`)
+	if err := s.service.ExportDataset(r.Context(), w); err != nil {
+		log.Printf("export dataset: %v", err)
+	}
+}
+
+// handleHealthz reports whether the process is alive: 200 while it can
+// reach its database, 503 when it can't, which the systemd watchdog also
+// goes by.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !s.service.alive() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("database unavailable"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz reports whether the server can answer chat requests: 200
+// when the LLM passed its preflight (or none was run), 503 while it is
+// degraded.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := s.service.Readiness()
+	w.Header().Set("Content-Type", "application/json")
+	if !readiness.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSONBody(w, readiness)
+}
+
+// chatContext carries the caller's asset owner, tenant and own LLM key,
+// sent in X-LLM-API-Key and X-LLM-Model, into the chat flow.
+func (s *server) chatContext(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if owner := s.assetOwner(r); owner != "" {
+		ctx = assets.WithOwner(ctx, owner)
+	}
+	tenant, err := s.tenant(r)
+	if err != nil {
+		return ctx, err
+	}
+	if tenant != "" {
+		ctx = withTenant(ctx, tenant)
+	}
+	key := llmprovider.ClientKey{
+		Token: strings.TrimSpace(r.Header.Get("X-LLM-API-Key")),
+		Model: strings.TrimSpace(r.Header.Get("X-LLM-Model")),
+	}
+	switch {
+	case key.Token == "" && key.Model != "":
+		return ctx, fmt.Errorf("%w: X-LLM-Model needs an X-LLM-API-Key", ErrInvalidInput)
+	case key.Token == "":
+	case !s.service.FeatureEnabled(ctx, config.FeatureClientKeys):
+		return ctx, fmt.Errorf("%w: the %s feature is off", ErrClientKeysDisabled, config.FeatureClientKeys)
+	default:
+		ctx = llmprovider.WithClientKey(ctx, key)
+	}
+	return ctx, nil
+}
+
+// assetOwner is whose assets "my" refers to for the caller: the owner
+// configured for the tenant its API key is pinned to. Nothing the caller
+// sends can name another owner; without a pinned key the deployment's
+// assets.owner applies.
+func (s *server) assetOwner(r *http.Request) string {
+	tenant, ok := s.service.cfg.Access.TenantForKey(apiKey(r))
+	if !ok {
+		return ""
+	}
+	return s.service.cfg.Assets.OwnerFor(tenant)
+}
+
+// authorizeSession enforces the per-session access token sent in the
+// X-Session-Token header when session tokens are required.
+// Artifacts of session-less endpoints have no session and need none.
+func (s *server) authorizeSession(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if !s.cfg.requireSessionTokens || sessionID == "" {
+		return true
+	}
+	if err := s.service.VerifySessionToken(r.Context(), sessionID, r.Header.Get("X-Session-Token")); err != nil {
+		writeServiceError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// authorizeChat is authorizeSession for a chat turn, which may also start
+// a session under an id nobody has used yet; its first turn issues the
+// token.
+func (s *server) authorizeChat(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if !s.cfg.requireSessionTokens {
+		return true
+	}
+	claimable, err := s.service.sessionClaimable(r.Context(), sessionID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return false
+	}
+	return claimable || s.authorizeSession(w, r, sessionID)
+}
+
+// presentedSessions returns the sessions the caller proved access to through
+// the X-Session-Tokens header ("id:token" pairs separated by commas).
+func (s *server) presentedSessions(r *http.Request) []string {
+	var ids []string
+	for _, pair := range splitList(r.Header.Get("X-Session-Tokens")) {
+		id, token, ok := strings.Cut(pair, ":")
+		if !ok || !sessionIDPattern.MatchString(id) {
+			continue
+		}
+		if s.service.VerifySessionToken(r.Context(), id, token) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// pathAfter returns the part of path following marker, independent of the API
+// version prefix the request came in on.
+func pathAfter(path, marker string) string {
+	i := strings.Index(path, marker)
+	if i < 0 {
+		return ""
+	}
+	return path[i+len(marker):]
+}
+
+func writeJSON(w http.ResponseWriter, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSONBody(w, payload)
+}
+
+func writeJSONBody(w http.ResponseWriter, payload any) {
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("encode response: %v", err)
+	}
+}
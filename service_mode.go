@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBackups is how many rotated log files are kept: <file>.1 is the most
+// recent, <file>.3 the oldest.
+const logBackups = 3
+
+// logFile is a log file that can be reopened after an outside tool such as
+// logrotate moved it, and rotates itself past maxBytes where there is no
+// such tool, as under a Windows service.
+type logFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	f        *os.File
+	size     int64
+}
+
+// openLogFile opens path for appending, creating it if needed. maxBytes 0
+// leaves rotation to outside tools.
+func openLogFile(path string, maxBytes int64) (*logFile, error) {
+	l := &logFile{path: path, maxBytes: maxBytes}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open log file: %w", err)
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			// Keep logging to the file that is open rather than lose lines
+			fmt.Fprintf(l.f, "rotate log file: %v\n", err)
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Reopen closes the file and opens path again, so lines go to a new file
+// once the old one was moved aside.
+func (l *logFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.f
+	if err := l.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// rotate shifts <path>.1 ... to <path>.2 ..., dropping the oldest, moves
+// the file to <path>.1 and starts a new one. The file is closed before it
+// is renamed, which Windows requires.
+func (l *logFile) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	for i := logBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	renameErr := os.Rename(l.path, l.path+".1")
+	if err := l.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+// Close closes the file.
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// setupLogFile sends the log to path and reopens it whenever the process
+// gets the reopen signal (SIGHUP where there is one), as logrotate's
+// postrotate step expects.
+func setupLogFile(path string, maxMB int) (*logFile, error) {
+	l, err := openLogFile(path, int64(maxMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+	log.SetOutput(l)
+	if sigs := reopenSignals(); len(sigs) > 0 {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sigs...)
+		go func() {
+			for range ch {
+				if err := l.Reopen(); err != nil {
+					log.Printf("reopen log file: %v", err)
+				}
+			}
+		}()
+	}
+	return l, nil
+}
+
+// writePIDFile writes the process id to path for service managers and
+// rotation scripts. The returned func removes it again, unless another
+// process has written its own id there since.
+func writePIDFile(path string) (func(), error) {
+	pid := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(path, []byte(pid+"\n"), 0o644); err != nil {
+		return nil, fmt.Errorf("write pid file: %w", err)
+	}
+	return func() {
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == pid {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// sdNotify sends state, e.g. READY=1, to systemd when it runs the process
+// as a Type=notify service, and does nothing otherwise.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if strings.HasPrefix(socket, "@") {
+		// Abstract socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("notify systemd: %v", err)
+	}
+}
+
+// sdWatchdog pings systemd's watchdog at half the interval it asks for
+// (WatchdogSec= in the unit) while alive reports true, until ctx is done.
+// Without a watchdog it returns at once.
+func sdWatchdog(ctx context.Context, alive func() bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 || os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if alive() {
+				sdNotify("WATCHDOG=1")
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+// reopenSignals are the signals that make the log file reopen.
+func reopenSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
+
+// runAsService runs serve under the platform's service manager when the
+// process was started by one that needs a handshake, reporting whether it
+// did. systemd needs none beyond sdNotify.
+func runAsService(ctx context.Context, serve func(context.Context)) bool {
+	return false
+}
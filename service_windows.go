@@ -0,0 +1,73 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the name the Windows service is registered under.
+const serviceName = "api-recommender"
+
+// reopenSignals is empty on Windows, which has no SIGHUP; use -log-max-mb
+// to rotate the log there.
+func reopenSignals() []os.Signal {
+	return nil
+}
+
+// runAsService runs serve as a Windows service when the service control
+// manager started the process, reporting whether it did. Stop and shutdown
+// requests cancel serve's context, which shuts the server down as
+// SIGTERM does elsewhere.
+func runAsService(ctx context.Context, serve func(context.Context)) bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Printf("detect Windows service: %v", err)
+		return false
+	}
+	if !isService {
+		return false
+	}
+	if err := svc.Run(serviceName, &windowsService{ctx: ctx, serve: serve}); err != nil {
+		log.Fatalf("Windows service failed: %v", err)
+	}
+	return true
+}
+
+type windowsService struct {
+	ctx   context.Context
+	serve func(context.Context)
+}
+
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(ctx)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"api-recommender/pdf"
+)
+
+// reReplySection finds where the parts of an assistant reply start. Replies
+// stored before a turn's messages were kept apart hold several of them.
+var reReplySection = regexp.MustCompile(`(?m)^(?:Recommended API:|Sample payload:|Event payload \(for async requests\):|Payload check:)`)
+
+// SessionPDF renders a session's transcript as a PDF, for attaching to
+// change requests and audits. Recommendations are set as cards and
+// payloads as code blocks.
+func (s *ChatService) SessionPDF(ctx context.Context, sessionID string) ([]byte, error) {
+	messages, err := s.GetSessionMessages(ctx, sessionID, 0)
+	if err != nil {
+		return nil, err
+	}
+	sessionID = strings.TrimSpace(sessionID)
+
+	now := time.Now().UTC()
+	title := fmt.Sprintf("%s session transcript", s.cfg.Persona.ProductName)
+	doc := pdf.New(title)
+	doc.Created = now
+	doc.Footer = "Session " + sessionID
+	doc.Heading(title)
+	doc.Note(fmt.Sprintf("Session %s, %d messages, exported %s", sessionID, len(messages), now.Format(time.RFC3339)))
+
+	for _, m := range messages {
+		speaker := "User"
+		if m.Role != "user" {
+			speaker = "Assistant"
+		}
+		if m.Created != "" {
+			speaker += " · " + m.Created
+		}
+		doc.Note(speaker)
+		if m.Role == "user" {
+			doc.Paragraph(m.Content)
+			continue
+		}
+		for _, part := range replySections(m.Content) {
+			writeReplySection(doc, part)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("render session pdf: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// replySections splits an assistant reply into its parts.
+func replySections(content string) []string {
+	starts := reReplySection.FindAllStringIndex(content, -1)
+	if len(starts) == 0 || starts[0][0] != 0 {
+		starts = append([][]int{{0, 0}}, starts...)
+	}
+	var parts []string
+	for i, loc := range starts {
+		end := len(content)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		if part := strings.TrimSpace(content[loc[0]:end]); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// writeReplySection adds one part of a reply to doc: the recommendation and
+// payload check as cards, payloads as code under their label.
+func writeReplySection(doc *pdf.Document, part string) {
+	head, body, _ := strings.Cut(part, "\n")
+	switch {
+	case strings.HasPrefix(head, "Recommended API:"), strings.HasPrefix(head, "Payload check:"):
+		doc.Card(strings.TrimSuffix(head, ":"), body)
+	case strings.HasPrefix(head, "Sample payload:"), strings.HasPrefix(head, "Event payload"):
+		doc.Paragraph(head)
+		doc.Code(body)
+	default:
+		doc.Paragraph(part)
+	}
+}
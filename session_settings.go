@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"api-recommender/payload"
+	"api-recommender/recommend"
+)
+
+const sessionSettingsSchema = `
+CREATE TABLE IF NOT EXISTS session_settings (
+	session TEXT PRIMARY KEY,
+	verbosity TEXT NOT NULL,
+	updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+func ensureSessionSettingsSchema(db *sql.DB) error {
+	if _, err := db.Exec(sessionSettingsSchema); err != nil {
+		return fmt.Errorf("create session settings schema: %w", err)
+	}
+	if err := addColumnIfMissing(db, "session_settings", "output_format", "TEXT"); err != nil {
+		return fmt.Errorf("create session settings schema: %w", err)
+	}
+	if err := addColumnIfMissing(db, "session_settings", "smart_defaults", "INTEGER"); err != nil {
+		return fmt.Errorf("create session settings schema: %w", err)
+	}
+	return nil
+}
+
+// sessionVerbosity applies the session's verbosity to ctx. A verbosity the
+// caller already set on ctx becomes the session's new setting; otherwise the
+// stored setting is used.
+func (s *ChatService) sessionVerbosity(ctx context.Context, sessionID string) (context.Context, recommend.Verbosity, error) {
+	if v, ok := recommend.VerbosityFrom(ctx); ok {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO session_settings (session, verbosity) VALUES (?, ?)
+			ON CONFLICT (session) DO UPDATE SET verbosity = excluded.verbosity, updated = CURRENT_TIMESTAMP;`,
+			sessionID, string(v))
+		if err != nil {
+			return ctx, v, fmt.Errorf("store session verbosity: %w", err)
+		}
+		return ctx, v, nil
+	}
+
+	var stored string
+	err := s.db.QueryRowContext(ctx, "SELECT verbosity FROM session_settings WHERE session = ?;", sessionID).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ctx, recommend.VerbosityNormal, nil
+	}
+	if err != nil {
+		return ctx, recommend.VerbosityNormal, fmt.Errorf("load session verbosity: %w", err)
+	}
+	v, ok := recommend.ParseVerbosity(stored)
+	if !ok {
+		return ctx, recommend.VerbosityNormal, nil
+	}
+	return recommend.WithVerbosity(ctx, v), v, nil
+}
+
+// sessionOutputFormat applies the payload format to ctx: the one the session
+// chose, else the default of the tenant in ctx.
+func (s *ChatService) sessionOutputFormat(ctx context.Context, sessionID string) (context.Context, error) {
+	var stored sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT output_format FROM session_settings WHERE session = ?;", sessionID).Scan(&stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ctx, fmt.Errorf("load session output format: %w", err)
+	}
+	format := stored.String
+	if format == "" {
+		format = s.cfg.OutputFormat.For(tenantFrom(ctx))
+	}
+	return recommend.WithOutputFormat(ctx, format), nil
+}
+
+// sessionSmartDefaults applies the session's smart defaults setting to ctx.
+// A setting the caller put on ctx is stored for the session's later turns.
+func (s *ChatService) sessionSmartDefaults(ctx context.Context, sessionID string) (context.Context, error) {
+	if on, ok := recommend.SmartDefaultsFrom(ctx); ok {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO session_settings (session, verbosity, smart_defaults) VALUES (?, ?, ?)
+			ON CONFLICT (session) DO UPDATE SET smart_defaults = excluded.smart_defaults, updated = CURRENT_TIMESTAMP;`,
+			sessionID, string(recommend.VerbosityNormal), on)
+		if err != nil {
+			return ctx, fmt.Errorf("store session smart defaults: %w", err)
+		}
+		return ctx, nil
+	}
+
+	var stored sql.NullBool
+	err := s.db.QueryRowContext(ctx, "SELECT smart_defaults FROM session_settings WHERE session = ?;", sessionID).Scan(&stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ctx, fmt.Errorf("load session smart defaults: %w", err)
+	}
+	return recommend.WithSmartDefaults(ctx, stored.Bool), nil
+}
+
+// setSessionOutputFormat makes format the session's payload format. A
+// session that has no settings yet keeps the normal verbosity.
+func (s *ChatService) setSessionOutputFormat(ctx context.Context, sessionID, format string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO session_settings (session, verbosity, output_format) VALUES (?, ?, ?)
+		ON CONFLICT (session) DO UPDATE SET output_format = excluded.output_format, updated = CURRENT_TIMESTAMP;`,
+		sessionID, string(recommend.VerbosityNormal), format)
+	if err != nil {
+		return fmt.Errorf("store session output format: %w", err)
+	}
+	return nil
+}
+
+// formatConfirmation answers a turn that only chose the session's format.
+func formatConfirmation(format string) string {
+	name, other := strings.ToUpper(format), "JSON"
+	if format == payload.FormatJSON {
+		other = "XML"
+	}
+	return fmt.Sprintf("Got it: sample payloads in this session will be %s from now on. "+
+		"Ask for %s in a request to get it just that once, or say \"always give me %s\" to switch.", name, other, other)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// session_summaries keeps one row per session so listing sessions doesn't
+// aggregate the whole message table. last_message_at is TEXT so it is
+// returned exactly as stored in the message table.
+const sessionSummariesSchema = `
+CREATE TABLE IF NOT EXISTS session_summaries (
+	session TEXT PRIMARY KEY,
+	last_message_at TEXT,
+	preview TEXT,
+	message_count INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_session_summaries_last ON session_summaries (last_message_at);`
+
+// sessionSummaryTrigger updates the summary on every message insert,
+// whichever code path writes the message. Imported messages may be older
+// than the session's latest one, so the preview only moves forward in time.
+const sessionSummaryTrigger = `
+CREATE TRIGGER IF NOT EXISTS %[1]s_session_summary AFTER INSERT ON %[1]s
+WHEN NEW.session IS NOT NULL AND NEW.session != ''
+BEGIN
+	INSERT INTO session_summaries (session, last_message_at, preview, message_count)
+	VALUES (NEW.session, NEW.created, NEW.content, 1)
+	ON CONFLICT (session) DO UPDATE SET
+		message_count = message_count + 1,
+		preview = CASE WHEN excluded.last_message_at >= last_message_at THEN excluded.preview ELSE preview END,
+		last_message_at = MAX(last_message_at, excluded.last_message_at);
+END;`
+
+// sessionSummariesBackfill summarises the messages stored before the table
+// existed.
+const sessionSummariesBackfill = `
+INSERT INTO session_summaries (session, last_message_at, preview, message_count)
+SELECT
+	session,
+	MAX(created),
+	(SELECT content FROM %[1]s m2 WHERE m2.session = m1.session ORDER BY created DESC, id DESC LIMIT 1),
+	COUNT(*)
+FROM %[1]s m1
+WHERE session IS NOT NULL AND session != ''
+GROUP BY session;`
+
+func ensureSessionSummariesSchema(db *sql.DB, table string) error {
+	var existing int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'session_summaries';").Scan(&existing)
+	if err != nil {
+		return fmt.Errorf("create session summaries schema: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("create session summaries schema: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmts := []string{sessionSummariesSchema, fmt.Sprintf(sessionSummaryTrigger, table)}
+	if existing == 0 {
+		stmts = append(stmts, fmt.Sprintf(sessionSummariesBackfill, table))
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("create session summaries schema: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const sessionTokensSchema = `
+CREATE TABLE IF NOT EXISTS session_tokens (
+	session TEXT PRIMARY KEY,
+	token_hash TEXT NOT NULL,
+	created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+func ensureSessionTokensSchema(db *sql.DB) error {
+	if _, err := db.Exec(sessionTokensSchema); err != nil {
+		return fmt.Errorf("create session tokens schema: %w", err)
+	}
+	return nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSessionToken creates the access token for a session that does not have
+// one yet. It returns an empty token when the session is already claimed.
+func (s *ChatService) issueSessionToken(ctx context.Context, sessionID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate session token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO session_tokens (session, token_hash) VALUES (?, ?);",
+		sessionID, hashSessionToken(token))
+	if err != nil {
+		return "", fmt.Errorf("store session token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", nil
+	}
+	return token, nil
+}
+
+// releaseSessionToken drops the token issued for a session whose first
+// turn failed, so the session id isn't left claimed by a token nobody got.
+func (s *ChatService) releaseSessionToken(ctx context.Context, sessionID string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM session_tokens WHERE session = ?;", sessionID); err != nil {
+		return fmt.Errorf("release session token: %w", err)
+	}
+	return nil
+}
+
+// VerifySessionToken checks token against the secret issued for the session.
+// Sessions without a secret, created before tokens existed or imported from
+// an archive, are refused; IssueMissingSessionTokens gives them one.
+func (s *ChatService) VerifySessionToken(ctx context.Context, sessionID, token string) error {
+	var stored string
+	err := s.db.QueryRowContext(ctx, "SELECT token_hash FROM session_tokens WHERE session = ?;", sessionID).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: session %s has no access token", ErrSessionForbidden, sessionID)
+	}
+	if err != nil {
+		return fmt.Errorf("load session token: %w", err)
+	}
+
+	if token == "" || subtle.ConstantTimeCompare([]byte(hashSessionToken(token)), []byte(stored)) != 1 {
+		return fmt.Errorf("%w: invalid or missing token for session %s", ErrSessionForbidden, sessionID)
+	}
+	return nil
+}
+
+// sessionClaimable reports whether a session can still be started by the
+// caller: it has neither a token nor any messages. Its first turn issues the
+// token.
+func (s *ChatService) sessionClaimable(ctx context.Context, sessionID string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT (SELECT COUNT(*) FROM session_tokens WHERE session = ?)
+		     + (SELECT COUNT(*) FROM %s WHERE session = ?);`, s.table), sessionID, sessionID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check session token: %w", err)
+	}
+	return n == 0, nil
+}
+
+// IssueMissingSessionTokens issues tokens for the sessions that have
+// messages but no token, and returns them by session id, so sessions from
+// before tokens were required can be handed back to their users.
+func (s *ChatService) IssueMissingSessionTokens(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT DISTINCT session FROM %s
+		WHERE session NOT IN (SELECT session FROM session_tokens)
+		  AND session NOT IN (SELECT session FROM deleted_sessions)
+		ORDER BY session;`, s.table))
+	if err != nil {
+		return nil, fmt.Errorf("list sessions without tokens: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list sessions without tokens: %w", err)
+	}
+
+	tokens := make(map[string]string, len(ids))
+	for _, id := range ids {
+		token, err := s.issueSessionToken(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			tokens[id] = token
+		}
+	}
+	return tokens, nil
+}
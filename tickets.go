@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"api-recommender/config"
+	"api-recommender/tickets"
+)
+
+// ErrTicketsUnavailable is returned when the tenant has no issue tracker
+// configured or the tracker didn't take the ticket.
+var ErrTicketsUnavailable = errors.New("tickets unavailable")
+
+// reTicketCommand matches a request to raise the recommendation as a
+// ticket, e.g. "raise a ticket for this" or "open a Jira ticket".
+var reTicketCommand = regexp.MustCompile(`(?i)^\s*(?:please\s+)?(?:raise|create|open|file|log|submit)\s+an?\s+(?:(?:jira|servicenow|service\s*now)\s+)?(?:ticket|incident)(?:\s+for\s+(?:this|it|that|the\s+(?:last\s+|latest\s+)?recommendation))?\s*[.!]?\s*$`)
+
+// isTicketCommand reports whether a message asks for the recommendation to
+// be raised as a ticket.
+func isTicketCommand(input string) bool {
+	return reTicketCommand.MatchString(input)
+}
+
+// ticketCreator returns the tracker of the tenant in ctx, reporting false
+// when it has none. The token is read from the connector's variable on
+// each call, so a rotated token is picked up without a restart.
+func (s *ChatService) ticketCreator(ctx context.Context) (tickets.Creator, bool) {
+	conn, ok := s.cfg.Tickets.For(tenantFrom(ctx))
+	if !ok {
+		return nil, false
+	}
+	creds := tickets.Credentials{Username: conn.Username, Token: os.Getenv(conn.TokenEnv)}
+	client := &http.Client{Timeout: time.Duration(s.cfg.Tickets.TimeoutMillis) * time.Millisecond}
+	if conn.Kind == config.TicketsServiceNow {
+		return &tickets.ServiceNow{URL: conn.URL, Table: conn.Project, Credentials: creds, Client: client}, true
+	}
+	return &tickets.Jira{URL: conn.URL, Project: conn.Project, IssueType: conn.IssueType, Credentials: creds, Client: client}, true
+}
+
+// RaiseTicket raises the latest recommendation of a session, with its
+// payloads, as a ticket in the issue tracker of the tenant in ctx.
+func (s *ChatService) RaiseTicket(ctx context.Context, sessionID string) (tickets.Ref, error) {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return tickets.Ref{}, fmt.Errorf("%w: session id is required", ErrInvalidInput)
+	}
+	creator, ok := s.ticketCreator(ctx)
+	if !ok {
+		return tickets.Ref{}, fmt.Errorf("%w: no issue tracker is configured", ErrTicketsUnavailable)
+	}
+	rec, err := s.latestRecommendation(ctx, sessionID)
+	if err != nil {
+		return tickets.Ref{}, err
+	}
+
+	product := s.cfg.Persona.ProductName
+	ticket := tickets.Ticket{
+		Summary: fmt.Sprintf("Integrate %s API: %s (%s)", product, rec.APIName, rec.APIPath),
+		Labels:  []string{"api-recommender"},
+	}
+	var description []string
+	for _, part := range replySections(rec.Replies) {
+		head, body, _ := strings.Cut(part, "\n")
+		if strings.HasPrefix(head, "Sample payload:") || strings.HasPrefix(head, "Event payload") {
+			ticket.Code = append(ticket.Code, tickets.CodeBlock{Title: strings.TrimSuffix(head, ":"), Text: body})
+			continue
+		}
+		description = append(description, part)
+	}
+	ticket.Description = fmt.Sprintf("Raised from %s API recommender session %s.\n\nRequest: %s\n\n%s",
+		product, sessionID, rec.Query, strings.Join(description, "\n\n"))
+
+	ref, err := creator.Create(ctx, ticket)
+	if err != nil {
+		return tickets.Ref{}, fmt.Errorf("%w: %w", ErrTicketsUnavailable, err)
+	}
+	return ref, nil
+}
+
+// ticketReply raises the session's recommendation as a ticket for a chat
+// command and says how it went. Only storage failures are returned as
+// errors.
+func (s *ChatService) ticketReply(ctx context.Context, sessionID string) (*tickets.Ref, string, error) {
+	ref, err := s.RaiseTicket(ctx, sessionID)
+	switch {
+	case err == nil:
+		return &ref, fmt.Sprintf("I've raised ticket %s for this recommendation: %s", ref.Key, ref.URL), nil
+	case errors.Is(err, ErrSessionNotFound):
+		return nil, "There's no recommendation in this session to raise a ticket for yet. Ask me for one first.", nil
+	case errors.Is(err, ErrTicketsUnavailable):
+		if _, ok := s.ticketCreator(ctx); !ok {
+			return nil, "No issue tracker is set up for your team, so I can't raise a ticket.", nil
+		}
+		log.Printf("raise ticket for %s: %v", sessionID, err)
+		return nil, "I couldn't raise the ticket; the issue tracker didn't accept it. Please try again later.", nil
+	}
+	return nil, "", err
+}
@@ -0,0 +1,191 @@
+// Package tickets raises tickets in issue trackers: Jira and ServiceNow.
+package tickets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ticket is what a raised ticket holds.
+type Ticket struct {
+	Summary     string
+	Description string
+	// Code holds blocks, such as payloads, set apart from the description
+	// where the tracker can format them.
+	Code []CodeBlock
+	// Labels tag the ticket where the tracker supports it.
+	Labels []string
+}
+
+// CodeBlock is a titled block of code.
+type CodeBlock struct {
+	Title string
+	Text  string
+}
+
+// Ref identifies a raised ticket.
+type Ref struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// Creator raises tickets.
+type Creator interface {
+	Create(ctx context.Context, t Ticket) (Ref, error)
+}
+
+// Credentials authenticate with a tracker: basic authentication with a
+// username, else the token as a bearer token.
+type Credentials struct {
+	Username string
+	Token    string
+}
+
+func (c Credentials) apply(req *http.Request) {
+	switch {
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Token)
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+// Jira raises tickets as Jira issues through its REST API.
+type Jira struct {
+	// URL is the site's base URL, e.g. https://example.atlassian.net.
+	URL       string
+	Project   string
+	IssueType string
+	Credentials
+	Client *http.Client
+}
+
+// Create raises t as an issue in the project.
+func (j *Jira) Create(ctx context.Context, t Ticket) (Ref, error) {
+	issueType := j.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": j.Project},
+		"issuetype":   map[string]string{"name": issueType},
+		"summary":     oneLine(t.Summary),
+		"description": jiraDescription(t),
+	}
+	if len(t.Labels) > 0 {
+		fields["labels"] = t.Labels
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	base := strings.TrimRight(j.URL, "/")
+	if err := post(ctx, j.Client, "jira", base+"/rest/api/2/issue", j.Credentials, map[string]any{"fields": fields}, &created); err != nil {
+		return Ref{}, err
+	}
+	if created.Key == "" {
+		return Ref{}, fmt.Errorf("jira returned no issue key")
+	}
+	return Ref{Key: created.Key, URL: base + "/browse/" + created.Key}, nil
+}
+
+// jiraDescription writes t's description in Jira's wiki markup, with its
+// code in {code} blocks.
+func jiraDescription(t Ticket) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(t.Description))
+	for _, c := range t.Code {
+		fmt.Fprintf(&b, "\n\n{code:title=%s}\n%s\n{code}", strings.NewReplacer("|", " ", "}", " ").Replace(c.Title), strings.TrimSpace(c.Text))
+	}
+	return b.String()
+}
+
+// ServiceNow raises tickets as records of a ServiceNow table through its
+// Table API.
+type ServiceNow struct {
+	// URL is the instance's base URL, e.g. https://example.service-now.com.
+	URL string
+	// Table is incident by default.
+	Table string
+	Credentials
+	Client *http.Client
+}
+
+// Create raises t as a record of the table.
+func (s *ServiceNow) Create(ctx context.Context, t Ticket) (Ref, error) {
+	table := s.Table
+	if table == "" {
+		table = "incident"
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(t.Description))
+	for _, c := range t.Code {
+		fmt.Fprintf(&b, "\n\n%s:\n%s", c.Title, strings.TrimSpace(c.Text))
+	}
+	var created struct {
+		Result struct {
+			Number string `json:"number"`
+			SysID  string `json:"sys_id"`
+		} `json:"result"`
+	}
+	base := strings.TrimRight(s.URL, "/")
+	record := map[string]string{"short_description": oneLine(t.Summary), "description": b.String()}
+	if err := post(ctx, s.Client, "servicenow", base+"/api/now/table/"+url.PathEscape(table), s.Credentials, record, &created); err != nil {
+		return Ref{}, err
+	}
+	if created.Result.SysID == "" {
+		return Ref{}, fmt.Errorf("servicenow returned no record")
+	}
+	key := created.Result.Number
+	if key == "" {
+		key = created.Result.SysID
+	}
+	link := base + "/nav_to.do?uri=" + url.QueryEscape(table+".do?sys_id="+created.Result.SysID)
+	return Ref{Key: key, URL: link}, nil
+}
+
+// post sends body as JSON to endpoint and decodes the response into out.
+// Errors name the tracker and carry the start of any error response.
+func post(ctx context.Context, client *http.Client, tracker, endpoint string, creds Credentials, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode %s ticket: %w", tracker, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", tracker, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	creds.apply(req)
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reach %s: %w", tracker, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := oneLine(string(detail)); msg != "" {
+			return fmt.Errorf("%s returned %s: %s", tracker, resp.Status, msg)
+		}
+		return fmt.Errorf("%s returned %s", tracker, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil {
+		return fmt.Errorf("read %s response: %w", tracker, err)
+	}
+	return nil
+}
+
+// oneLine collapses s onto one line, as ticket summaries must be.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxRounds caps how many times one answer may go back to the model with
+// tool results, so a model that keeps calling tools still answers.
+const maxRounds = 4
+
+// ErrTooManyRounds is returned when the model is still calling tools after
+// maxRounds.
+var ErrTooManyRounds = errors.New("tools: model kept calling tools")
+
+// Model is an llms.Model that offers tools to the model it wraps and runs
+// the calls the model makes, returning only the final answer. Callers use
+// it like any other model.
+type Model struct {
+	llms.Model
+	tools func() []Tool
+}
+
+// WithTools wraps model so that it can call the tools list returns. The
+// list is read on each call, so tools added later are offered too.
+func WithTools(model llms.Model, list func() []Tool) *Model {
+	return &Model{Model: model, tools: list}
+}
+
+// GenerateContent implements llms.Model.
+func (m *Model) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	available := m.tools()
+	if len(available) == 0 {
+		return m.Model.GenerateContent(ctx, messages, options...)
+	}
+
+	byName := make(map[string]Tool, len(available))
+	defs := make([]llms.Tool, 0, len(available))
+	for _, t := range available {
+		def := t.Definition()
+		byName[def.Name] = t
+		params := def.Parameters
+		if params == nil {
+			params = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		defs = append(defs, llms.Tool{
+			Type:     "function",
+			Function: &llms.FunctionDefinition{Name: def.Name, Description: def.Description, Parameters: params},
+		})
+	}
+	options = append(options, llms.WithTools(defs))
+
+	messages = append([]llms.MessageContent(nil), messages...)
+	for range maxRounds {
+		resp, err := m.Model.GenerateContent(ctx, messages, options...)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 || len(resp.Choices[0].ToolCalls) == 0 {
+			return resp, nil
+		}
+
+		calls := resp.Choices[0].ToolCalls
+		request := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		for _, c := range calls {
+			request.Parts = append(request.Parts, c)
+		}
+		messages = append(messages, request)
+		for _, c := range calls {
+			messages = append(messages, llms.MessageContent{
+				Role:  llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{m.run(ctx, byName, c)},
+			})
+		}
+	}
+	return nil, ErrTooManyRounds
+}
+
+// Call implements llms.Model.
+func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// run calls the tool the model asked for. Failures become the response, so
+// the model learns the tool didn't work rather than the answer failing.
+func (m *Model) run(ctx context.Context, byName map[string]Tool, c llms.ToolCall) llms.ToolCallResponse {
+	resp := llms.ToolCallResponse{ToolCallID: c.ID}
+	if c.FunctionCall == nil {
+		resp.Content = "error: the call names no function"
+		return resp
+	}
+	resp.Name = c.FunctionCall.Name
+	args := json.RawMessage(c.FunctionCall.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	record := Call{Tool: resp.Name, Arguments: args}
+
+	var err error
+	switch t, ok := byName[resp.Name]; {
+	case !ok:
+		err = fmt.Errorf("no tool is named %q", resp.Name)
+	case !json.Valid(args):
+		err = errors.New("arguments are not valid JSON")
+	default:
+		resp.Content, err = t.Call(ctx, args)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		resp.Content = "error: " + err.Error()
+	} else {
+		record.Result = resp.Content
+	}
+	if !json.Valid(record.Arguments) {
+		record.Arguments = nil
+	}
+	if l := logFrom(ctx); l != nil {
+		l.add(record)
+	}
+	return resp
+}
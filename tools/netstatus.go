@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxStatusBody caps how much of a status response is passed to the model.
+const maxStatusBody = 2048
+
+// NetworkStatus returns the network_status tool, which reports the live
+// status of the settlement network by fetching endpoint, e.g. a health or
+// status page of the network's nodes. The response is passed to the model
+// as it is, so any JSON or plain text status works. When the model names a
+// network it is sent as the "network" query parameter.
+func NetworkStatus(endpoint string, timeout time.Duration) Tool {
+	client := &http.Client{Timeout: timeout}
+	return Func{
+		Def: Definition{
+			Name:        "network_status",
+			Description: "Returns the live status of the settlement network, e.g. whether it is up, degraded or down. Use it whenever the user asks whether the network, its nodes or settlement are working.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"network": map[string]any{
+						"type":        "string",
+						"description": "Network to check, if the user named one; omit for the default network.",
+					},
+				},
+			},
+		},
+		Fn: func(ctx context.Context, arguments json.RawMessage) (string, error) {
+			var args struct {
+				Network string `json:"network"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("parse arguments: %w", err)
+			}
+			return fetchStatus(ctx, client, endpoint, strings.TrimSpace(args.Network))
+		},
+	}
+}
+
+func fetchStatus(ctx context.Context, client *http.Client, endpoint, network string) (string, error) {
+	target := endpoint
+	if network != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", fmt.Errorf("parse status endpoint: %w", err)
+		}
+		q := u.Query()
+		q.Set("network", network)
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", fmt.Errorf("status request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, text/plain")
+	checked := time.Now().UTC()
+	resp, err := client.Do(req)
+	if err != nil {
+		// Not reaching the endpoint says nothing certain about the network,
+		// so it is reported as an error rather than as "down"
+		return "", fmt.Errorf("status endpoint unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusBody+1))
+	if err != nil {
+		return "", fmt.Errorf("read status response: %w", err)
+	}
+	text := strings.TrimSpace(string(body))
+	if len(text) > maxStatusBody {
+		text = text[:maxStatusBody] + " …"
+	}
+	if text == "" {
+		text = "(empty response)"
+	}
+	// The HTTP status is part of the answer: health endpoints commonly
+	// signal an outage with 503 and little else
+	return fmt.Sprintf("Checked at %s. Status endpoint answered HTTP %d %s: %s",
+		checked.Format(time.RFC3339), resp.StatusCode, http.StatusText(resp.StatusCode), text), nil
+}
@@ -0,0 +1,128 @@
+// Package tools lets deployments give the assistant tools it can call while
+// answering: asset lookups, network status, fee calculations and the like.
+// A tool is offered to the model with a name, a description and a JSON
+// schema of its arguments; when the model calls it, its result is passed
+// back so the model can work it into the answer.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Definition describes a tool to the model.
+type Definition struct {
+	// Name is what the model calls the tool by: letters, digits, "_" and
+	// "-", as model APIs require.
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments, e.g.
+	// {"type": "object", "properties": {"network": {"type": "string"}}}.
+	// Nil means the tool takes none.
+	Parameters map[string]any
+}
+
+// Tool is something the assistant can call during a conversation.
+type Tool interface {
+	Definition() Definition
+	// Call runs the tool with the arguments the model sent, a JSON object,
+	// and returns the result for the model to read. Errors are shown to
+	// the model, which may retry or answer without the tool.
+	Call(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+// Func adapts an ordinary function to the Tool interface.
+type Func struct {
+	Def Definition
+	Fn  func(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+// Definition returns f.Def.
+func (f Func) Definition() Definition { return f.Def }
+
+// Call calls f.Fn(ctx, arguments).
+func (f Func) Call(ctx context.Context, arguments json.RawMessage) (string, error) {
+	return f.Fn(ctx, arguments)
+}
+
+var reName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	mu         sync.RWMutex
+	registered = map[string]Tool{}
+)
+
+// Register makes a tool available to the assistant. Like hooks, tools are
+// registered from an init function in a file added to the main package.
+func Register(tool Tool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if tool == nil {
+		panic("tools: Register tool is nil")
+	}
+	name := tool.Definition().Name
+	if !reName.MatchString(name) {
+		panic(fmt.Sprintf("tools: invalid tool name %q", name))
+	}
+	if _, dup := registered[name]; dup {
+		panic("tools: Register called twice for tool " + name)
+	}
+	registered[name] = tool
+}
+
+// Registered returns every registered tool ordered by name.
+func Registered() []Tool {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]Tool, 0, len(registered))
+	for _, tool := range registered {
+		out = append(out, tool)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Definition().Name < out[j].Definition().Name })
+	return out
+}
+
+// Call records one tool call made while answering.
+type Call struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Result    string          `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Log collects the tool calls made under a context.
+type Log struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Calls returns the calls made so far, in order.
+func (l *Log) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
+
+func (l *Log) add(c Call) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, c)
+}
+
+type logKey struct{}
+
+// Record returns a context under which tool calls are added to the
+// returned log.
+func Record(ctx context.Context) (context.Context, *Log) {
+	l := &Log{}
+	return context.WithValue(ctx, logKey{}, l), l
+}
+
+func logFrom(ctx context.Context) *Log {
+	l, _ := ctx.Value(logKey{}).(*Log)
+	return l
+}
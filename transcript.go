@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transcriptTimeLayout is how SQLite's CURRENT_TIMESTAMP writes created
+// times, so imported messages sort with the ones written by chat turns.
+const transcriptTimeLayout = "2006-01-02 15:04:05"
+
+// reTranscriptLine matches the first line of a transcript message: an
+// optional [timestamp], the speaker and the start of the message.
+var reTranscriptLine = regexp.MustCompile(`^(?:\[([^\]]+)\]\s*)?(Human|AI):\s?(.*)$`)
+
+// transcriptStampLayouts are the timestamp forms accepted in brackets.
+var transcriptStampLayouts = []string{
+	time.RFC3339,
+	transcriptTimeLayout,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+}
+
+// TranscriptMessage is one message read from a plain transcript.
+type TranscriptMessage struct {
+	Role    string
+	Content string
+	Created time.Time
+	// Stamped is whether Created came from the transcript rather than
+	// being filled in.
+	Stamped bool
+}
+
+// TranscriptResult summarises a transcript import.
+type TranscriptResult struct {
+	SessionID        string `json:"sessionId"`
+	MessagesImported int    `json:"messagesImported"`
+	Stamped          int    `json:"stamped"`
+}
+
+// ParseTranscript reads a pasted transcript of "Human: ..." and "AI: ..."
+// lines, the format the CLI-only version of the tool kept its history in.
+// A message runs until the next speaker line, so multi-line replies are
+// kept whole. A speaker line may start with a timestamp in brackets, e.g.
+// "[2024-03-01 09:30:00] Human: ..."; messages without one are placed a
+// second after the message before them (or before the first stamped one),
+// and a transcript without any stamps ends at now.
+func ParseTranscript(r io.Reader, now time.Time) ([]TranscriptMessage, error) {
+	var messages []TranscriptMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		m := reTranscriptLine.FindStringSubmatch(text)
+		if m == nil {
+			if len(messages) == 0 {
+				if strings.TrimSpace(text) == "" {
+					continue
+				}
+				return nil, fmt.Errorf("%w: line %d: transcript must start with a Human: or AI: line", ErrInvalidInput, line)
+			}
+			last := &messages[len(messages)-1]
+			last.Content += "\n" + text
+			continue
+		}
+
+		msg := TranscriptMessage{Role: "user", Content: m[3]}
+		if m[2] == "AI" {
+			msg.Role = "assistant"
+		}
+		if m[1] != "" {
+			created, ok := parseTranscriptStamp(m[1])
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: unknown timestamp %q", ErrInvalidInput, line, m[1])
+			}
+			msg.Created, msg.Stamped = created, true
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read transcript: %w", err)
+	}
+
+	var kept []TranscriptMessage
+	for _, msg := range messages {
+		msg.Content = strings.TrimSpace(msg.Content)
+		if msg.Content != "" {
+			kept = append(kept, msg)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("%w: transcript has no messages", ErrInvalidInput)
+	}
+	fillTranscriptTimes(kept, now)
+	return kept, nil
+}
+
+func parseTranscriptStamp(raw string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range transcriptStampLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// fillTranscriptTimes gives every unstamped message a time one second after
+// the message before it, counting back from the first stamped message for
+// those ahead of it.
+func fillTranscriptTimes(messages []TranscriptMessage, now time.Time) {
+	first := -1
+	for i, msg := range messages {
+		if msg.Stamped {
+			first = i
+			break
+		}
+	}
+	anchor := now.UTC().Truncate(time.Second)
+	if first < 0 {
+		first = len(messages) - 1
+		messages[first].Created = anchor
+	}
+	for i := first - 1; i >= 0; i-- {
+		messages[i].Created = messages[i+1].Created.Add(-time.Second)
+	}
+	for i := first + 1; i < len(messages); i++ {
+		if !messages[i].Stamped {
+			messages[i].Created = messages[i-1].Created.Add(time.Second)
+		}
+	}
+}
+
+// ImportTranscript stores a plain transcript (see ParseTranscript) as the
+// session sessionID, or a new session when sessionID is empty. The session
+// must not exist yet.
+func (s *ChatService) ImportTranscript(ctx context.Context, sessionID string, r io.Reader) (TranscriptResult, error) {
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+	if !sessionIDPattern.MatchString(sessionID) {
+		return TranscriptResult{}, fmt.Errorf("%w: session id must be 1-64 characters of letters, digits, '-' or '_'", ErrInvalidInput)
+	}
+	messages, err := ParseTranscript(r, time.Now())
+	if err != nil {
+		return TranscriptResult{}, err
+	}
+
+	if s.writes == nil {
+		return s.importTranscript(ctx, sessionID, messages)
+	}
+	var result TranscriptResult
+	err = s.writes.exclusive(ctx, func() error {
+		var err error
+		result, err = s.importTranscript(ctx, sessionID, messages)
+		return err
+	})
+	return result, err
+}
+
+func (s *ChatService) importTranscript(ctx context.Context, sessionID string, messages []TranscriptMessage) (TranscriptResult, error) {
+	result := TranscriptResult{SessionID: sessionID}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("begin transcript import: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE session = ?;", s.table), sessionID).Scan(&count); err != nil {
+		return result, fmt.Errorf("check session: %w", err)
+	}
+	if count > 0 {
+		return result, fmt.Errorf("%w: session %s already exists", ErrInvalidInput, sessionID)
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (session, content, type, created) VALUES (?, ?, ?, ?);", s.table)
+	for _, msg := range messages {
+		if _, err := tx.ExecContext(ctx, insert, sessionID, msg.Content, messageTypeFromRole(msg.Role), msg.Created.Format(transcriptTimeLayout)); err != nil {
+			return result, fmt.Errorf("insert message: %w", err)
+		}
+		result.MessagesImported++
+		if msg.Stamped {
+			result.Stamped++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit transcript import: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Kinds of assistant message within a turn.
+const (
+	MessageKindAnswer       = "answer"
+	MessageKindQuestion     = "question"
+	MessageKindPayload      = "payload"
+	MessageKindEventPayload = "eventPayload"
+	MessageKindCheck        = "check"
+	// MessageKindNotice starts a turn with news the user didn't ask for,
+	// such as a docs change to the API recommended earlier.
+	MessageKindNotice = "notice"
+)
+
+// TurnMessage is one of the assistant messages a turn produced. A turn's
+// messages are stored in order, each with its own id.
+type TurnMessage struct {
+	ID      int64  `json:"id"`
+	Kind    string `json:"kind"`
+	Content string `json:"content"`
+}
+
+// joinMessages renders a turn's messages as a single reply.
+func joinMessages(messages []TurnMessage) string {
+	parts := make([]string, len(messages))
+	for i, m := range messages {
+		parts[i] = m.Content
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// saveTurn stores the user's message followed by the replies, in order,
+// and sets each reply's id.
+func (s *ChatService) saveTurn(ctx context.Context, sessionID, userInput string, replies []TurnMessage) error {
+	if s.writes != nil {
+		messages := []llms.ChatMessage{llms.HumanChatMessage{Content: userInput}}
+		for _, r := range replies {
+			messages = append(messages, llms.AIChatMessage{Content: r.Content})
+		}
+		ids, err := s.writes.enqueue(sessionID, messages...)
+		if err != nil {
+			return fmt.Errorf("save conversation: %w", err)
+		}
+		for i := range replies {
+			replies[i].ID = ids[i+1]
+		}
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+	defer tx.Rollback()
+
+	insert := tx.StmtContext(ctx, s.stmts.insertMessage)
+	if _, err := insert.ExecContext(ctx, sessionID, userInput, string(llms.ChatMessageTypeHuman)); err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+	for i := range replies {
+		res, err := insert.ExecContext(ctx, sessionID, replies[i].Content, string(llms.ChatMessageTypeAI))
+		if err != nil {
+			return fmt.Errorf("save conversation: %w", err)
+		}
+		if replies[i].ID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("save conversation: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Request limits enforced by the validation layer.
+const (
+	maxRequestBodyBytes = 1 << 20
+	maxMessageLength    = 8000
+	maxCommentLength    = 2000
+	maxAddressLength    = 254
+	maxListLimit        = 1000
+)
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// FieldError describes a single invalid field in a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// requestValidator collects field-level problems for one request so they can
+// be reported together.
+type requestValidator struct {
+	errs []FieldError
+}
+
+func (v *requestValidator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// failed writes the validation error envelope when any problem was found and
+// reports whether it did.
+func (v *requestValidator) failed(w http.ResponseWriter, r *http.Request) bool {
+	if len(v.errs) == 0 {
+		return false
+	}
+	writeError(w, r, http.StatusBadRequest, CodeInvalidInput, "request validation failed", v.errs)
+	return true
+}
+
+func (v *requestValidator) sessionID(field, id string, required bool) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return
+	}
+	if !sessionIDPattern.MatchString(id) {
+		v.add(field, "must be 1-64 characters of letters, digits, '-' or '_'")
+	}
+}
+
+func (v *requestValidator) text(field, value string, required bool, maxLen int) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return
+	}
+	if n := utf8.RuneCountInString(trimmed); n > maxLen {
+		v.add(field, "must be at most %d characters (got %d)", maxLen, n)
+	}
+}
+
+func (v *requestValidator) attachment(field string, a *Attachment) {
+	switch {
+	case strings.TrimSpace(a.Content) == "":
+		v.add(field, "must not be empty")
+	case len(a.Content) > maxAttachmentBytes:
+		v.add(field, "must be at most %d bytes", maxAttachmentBytes)
+	case !utf8.ValidString(a.Content):
+		v.add(field, "must be a text file (JSON, XML or plain text)")
+	}
+}
+
+func (v *requestValidator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	v.add(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+// messageID parses a message id path segment.
+func (v *requestValidator) messageID(field, raw string) int64 {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 1 {
+		v.add(field, "must be a positive integer")
+		return 0
+	}
+	return id
+}
+
+// version parses a content version. Zero is allowed and means "create".
+func (v *requestValidator) version(field, raw string) int {
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 0 {
+		v.add(field, "must be a non-negative integer")
+		return 0
+	}
+	return version
+}
+
+// limit parses an optional limit query parameter. Zero means "use the default".
+func (v *requestValidator) limit(raw string) int {
+	if raw == "" {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		v.add("limit", "must be an integer")
+		return 0
+	}
+	if limit < 1 || limit > maxListLimit {
+		v.add("limit", "must be between 1 and %d", maxListLimit)
+		return 0
+	}
+
+	return limit
+}
+
+// decodeBody decodes a JSON request body into dst, translating decoder errors
+// into field-level validation errors.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return true
+	}
+
+	v := &requestValidator{}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		v.add("body", "is required")
+	case errors.As(err, &syntaxErr):
+		v.add("body", "is not valid JSON (error at offset %d)", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		v.add(typeErr.Field, "must be a %s", typeErr.Type.String())
+	case errors.As(err, &sizeErr):
+		v.add("body", "must be at most %d bytes", sizeErr.Limit)
+	default:
+		v.add("body", "could not be decoded: %v", err)
+	}
+	v.failed(w, r)
+	return false
+}
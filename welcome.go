@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"api-recommender/recommend"
+)
+
+// maxWelcomeHighlights caps how many catalog APIs the welcome message features.
+const maxWelcomeHighlights = 3
+
+// MessageTypeWelcome marks the onboarding message so clients can style it
+// apart from replies.
+const MessageTypeWelcome = "welcome"
+
+// Welcome is the onboarding message returned with the first reply of a new
+// session.
+type Welcome struct {
+	Type       string   `json:"type"`
+	Message    string   `json:"message"`
+	Examples   []string `json:"examples"`
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+// welcome builds the onboarding message, or returns nil when it is disabled.
+func (s *ChatService) welcome(ctx context.Context) *Welcome {
+	if !s.cfg.Welcome.Enabled {
+		return nil
+	}
+
+	w := &Welcome{
+		Type:     MessageTypeWelcome,
+		Message:  s.cfg.Persona.Render(s.cfg.Welcome.Message),
+		Examples: recommend.ExamplePrompts(s.engine.Context(ctx)),
+	}
+	for _, api := range s.catalog(ctx) {
+		if len(w.Highlights) == maxWelcomeHighlights {
+			break
+		}
+		if api.Deprecated {
+			continue
+		}
+		highlight := fmt.Sprintf("%s %s", api.Method, api.Path)
+		if len(api.Tags) > 0 {
+			highlight += fmt.Sprintf(" [%s]", strings.Join(api.Tags, ", "))
+		}
+		if api.Description != "" {
+			highlight += ": " + api.Description
+		}
+		w.Highlights = append(w.Highlights, highlight)
+	}
+	return w
+}
+
+// String renders the welcome as plain text for the CLI.
+func (w *Welcome) String() string {
+	var b strings.Builder
+	b.WriteString(w.Message + "\n")
+	for _, e := range w.Examples {
+		fmt.Fprintf(&b, " - %q\n", e)
+	}
+	if len(w.Highlights) > 0 {
+		b.WriteString("Featured APIs:\n")
+		for _, h := range w.Highlights {
+			b.WriteString(" - " + h + "\n")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-recommender/config"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/memory/sqlite3"
+)
+
+// queuedMessage is a chat message waiting to be written.
+type queuedMessage struct {
+	id      int64
+	session string
+	content string
+	msgType string
+	created string
+	// attempts counts the flushes that failed to write the message.
+	attempts int
+}
+
+// maxWriteAttempts is how many flushes may fail to write a message before
+// it is dropped, so a row the database keeps rejecting doesn't sit at the
+// head of the queue for good.
+const maxWriteAttempts = 5
+
+// writeBehind queues chat messages and writes them in batches from a
+// background goroutine. Message ids are assigned when a message is queued,
+// so replies can be identified before they reach the database; that makes
+// the queue the only writer of the message table while it is running.
+type writeBehind struct {
+	db        *sql.DB
+	table     string
+	interval  time.Duration
+	batchSize int
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  []queuedMessage
+	sessions map[string]int // queued or in-flight messages per session
+	// lost holds, per session, why messages of it were dropped, until the
+	// session's next write is refused with it.
+	lost map[string]error
+
+	// flushMu serialises flushes so batches are written in id order.
+	flushMu sync.Mutex
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newWriteBehind(db *sql.DB, table string, cfg config.WriteBehind) (*writeBehind, error) {
+	w := &writeBehind{
+		db:        db,
+		table:     table,
+		interval:  time.Duration(cfg.FlushMillis) * time.Millisecond,
+		batchSize: cfg.BatchSize,
+		sessions:  map[string]int{},
+		lost:      map[string]error{},
+		kick:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := w.seedIDs(context.Background()); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// seedIDs continues message ids after the largest one stored.
+func (w *writeBehind) seedIDs(ctx context.Context) error {
+	err := w.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s;", w.table)).Scan(&w.nextID)
+	if err != nil {
+		return fmt.Errorf("load last message id: %w", err)
+	}
+	return nil
+}
+
+func (w *writeBehind) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.kick:
+		}
+		if err := w.flush(context.Background()); err != nil {
+			log.Printf("write-behind flush: %v", err)
+		}
+	}
+}
+
+// enqueue queues messages of a session, together, and returns their ids.
+// Once messages of the session have been dropped, the session's next
+// enqueue is refused with the reason, so its writer learns that the
+// history it was given ids for is incomplete.
+func (w *writeBehind) enqueue(session string, messages ...llms.ChatMessage) ([]int64, error) {
+	w.mu.Lock()
+	if err := w.lost[session]; err != nil {
+		delete(w.lost, session)
+		w.mu.Unlock()
+		return nil, err
+	}
+	created := time.Now().UTC().Format(time.DateTime)
+	ids := make([]int64, len(messages))
+	for i, m := range messages {
+		w.nextID++
+		ids[i] = w.nextID
+		w.pending = append(w.pending, queuedMessage{
+			id:      w.nextID,
+			session: session,
+			content: m.GetContent(),
+			msgType: string(m.GetType()),
+			created: created,
+		})
+	}
+	w.sessions[session] += len(messages)
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	return ids, nil
+}
+
+// flush writes every queued message. When the batch fails its messages are
+// written one at a time; those that fail again are put back at the head of
+// the queue for the next flush, or dropped after maxWriteAttempts.
+func (w *writeBehind) flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	batchErr := w.write(ctx, batch)
+	var retry []queuedMessage
+	if batchErr != nil {
+		for _, m := range batch {
+			if err := w.write(ctx, []queuedMessage{m}); err != nil {
+				m.attempts++
+				if m.attempts < maxWriteAttempts {
+					retry = append(retry, m)
+					continue
+				}
+				log.Printf("write-behind: dropping message %d of session %s after %d attempts: %v", m.id, m.session, m.attempts, err)
+				w.mu.Lock()
+				w.lost[m.session] = fmt.Errorf("message %d of session %s could not be saved: %w", m.id, m.session, err)
+				w.mu.Unlock()
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(retry, w.pending...)
+	requeued := map[int64]bool{}
+	for _, m := range retry {
+		requeued[m.id] = true
+	}
+	for _, m := range batch {
+		if requeued[m.id] {
+			continue
+		}
+		if w.sessions[m.session]--; w.sessions[m.session] == 0 {
+			delete(w.sessions, m.session)
+		}
+	}
+	if len(retry) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// flushSession writes the queue if it holds messages of sessionID, so a
+// read of the session sees every message written before it.
+func (w *writeBehind) flushSession(ctx context.Context, sessionID string) error {
+	w.mu.Lock()
+	queued := w.sessions[sessionID]
+	w.mu.Unlock()
+	if queued == 0 {
+		return nil
+	}
+	return w.flush(ctx)
+}
+
+func (w *writeBehind) write(ctx context.Context, batch []queuedMessage) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("write messages: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (id, session, content, type, created) VALUES (?, ?, ?, ?, ?);", w.table))
+	if err != nil {
+		return fmt.Errorf("write messages: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, m := range batch {
+		if _, err := stmt.ExecContext(ctx, m.id, m.session, m.content, m.msgType, m.created); err != nil {
+			return fmt.Errorf("write message %d: %w", m.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("write messages: %w", err)
+	}
+	return nil
+}
+
+// exclusive flushes the queue and runs fn with queueing blocked, for
+// writers that insert messages themselves. Ids continue after whatever fn
+// stored.
+func (w *writeBehind) exclusive(ctx context.Context, fn func() error) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		if err := w.write(ctx, w.pending); err != nil {
+			return err
+		}
+		w.pending = nil
+		w.sessions = map[string]int{}
+	}
+
+	fnErr := fn()
+	if err := w.seedIDs(ctx); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// Close stops the background writer and writes what is still queued.
+func (w *writeBehind) Close() error {
+	close(w.stop)
+	<-w.done
+	return w.flush(context.Background())
+}
+
+// queuedHistory is a session's chat history whose writes go through the
+// write-behind queue. Reads write the session's queued messages first.
+type queuedHistory struct {
+	*sqlite3.SqliteChatMessageHistory
+	queue   *writeBehind
+	session string
+}
+
+func (h *queuedHistory) AddMessage(_ context.Context, message llms.ChatMessage) error {
+	_, err := h.queue.enqueue(h.session, message)
+	return err
+}
+
+func (h *queuedHistory) AddUserMessage(ctx context.Context, text string) error {
+	return h.AddMessage(ctx, llms.HumanChatMessage{Content: text})
+}
+
+func (h *queuedHistory) AddAIMessage(ctx context.Context, text string) error {
+	return h.AddMessage(ctx, llms.AIChatMessage{Content: text})
+}
+
+func (h *queuedHistory) Messages(ctx context.Context) ([]llms.ChatMessage, error) {
+	if err := h.queue.flushSession(ctx, h.session); err != nil {
+		return nil, err
+	}
+	return h.SqliteChatMessageHistory.Messages(ctx)
+}
+
+func (h *queuedHistory) Clear(ctx context.Context) error {
+	if err := h.queue.flushSession(ctx, h.session); err != nil {
+		return err
+	}
+	return h.SqliteChatMessageHistory.Clear(ctx)
+}
+
+func (h *queuedHistory) SetMessages(ctx context.Context, messages []llms.ChatMessage) error {
+	if err := h.queue.flushSession(ctx, h.session); err != nil {
+		return err
+	}
+	return h.SqliteChatMessageHistory.SetMessages(ctx, messages)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"api-recommender/config"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// A message the database keeps rejecting is dropped after maxWriteAttempts
+// flushes without holding back the others, and its session's next write
+// reports the loss.
+func TestWriteBehindDropsRejectedMessage(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE messages (id INTEGER PRIMARY KEY, session TEXT, content TEXT, type TEXT, created TEXT);",
+		"CREATE TRIGGER reject BEFORE INSERT ON messages WHEN NEW.content = 'poison' BEGIN SELECT RAISE(ABORT, 'rejected'); END;",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The ticker stays out of the way; the test flushes
+	w, err := newWriteBehind(db, "messages", config.WriteBehind{FlushMillis: 60_000, BatchSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	ctx := t.Context()
+	enqueue := func(session, text string) error {
+		_, err := w.enqueue(session, llms.HumanChatMessage{Content: text})
+		return err
+	}
+	for _, m := range [][2]string{{"a", "first"}, {"a", "poison"}, {"b", "other"}, {"a", "last"}} {
+		if err := enqueue(m[0], m[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < maxWriteAttempts; i++ {
+		if err := w.flush(ctx); err == nil {
+			t.Fatalf("flush %d succeeded with the rejected message queued", i)
+		}
+	}
+	if err := w.flush(ctx); err != nil {
+		t.Fatalf("flush after the last attempt: %v", err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages;").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || len(w.pending) != 0 || len(w.sessions) != 0 {
+		t.Fatalf("stored %d messages, %d pending, sessions %v; want 3, 0 and none", n, len(w.pending), w.sessions)
+	}
+
+	if err := enqueue("a", "next"); err == nil {
+		t.Fatal("write to the session that lost a message wasn't refused")
+	}
+	if err := enqueue("a", "next"); err != nil {
+		t.Fatalf("loss reported more than once: %v", err)
+	}
+	if err := enqueue("b", "next"); err != nil {
+		t.Fatalf("another session's write refused: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+// Package xsd validates XML documents against XML Schema (XSD) files. It
+// covers the part of XSD request schemas are written in: global and local
+// elements, named and anonymous complex and simple types, sequence, choice
+// and all groups with their occurrence bounds, named groups and attribute
+// groups, simple and complex content extensions, attributes, and the
+// built-in types with the enumeration, pattern, length and range facets.
+// Imports, substitution groups, identity constraints and xsi:type are not
+// read. Elements are matched by local name; only the root's namespace is
+// checked against the target namespace of the schema declaring it.
+package xsd
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUndeclared is returned for documents whose root element no schema
+// declares.
+var ErrUndeclared = errors.New("root element not declared in the schemas")
+
+// Schema is the declarations of one or more XSD files, merged.
+type Schema struct {
+	elements        map[string]*element
+	attributes      map[string]*attribute
+	complexTypes    map[string]*complexType
+	simpleTypes     map[string]*simpleType
+	groups          map[string]*group
+	attributeGroups map[string]*attributeGroup
+	// namespaces holds the target namespace of each global element.
+	namespaces map[string]string
+}
+
+type schemaFile struct {
+	TargetNamespace string            `xml:"targetNamespace,attr"`
+	Elements        []*element        `xml:"element"`
+	Attributes      []*attribute      `xml:"attribute"`
+	ComplexTypes    []*complexType    `xml:"complexType"`
+	SimpleTypes     []*simpleType     `xml:"simpleType"`
+	Groups          []*group          `xml:"group"`
+	AttributeGroups []*attributeGroup `xml:"attributeGroup"`
+}
+
+type element struct {
+	Name        string       `xml:"name,attr"`
+	Ref         string       `xml:"ref,attr"`
+	Type        string       `xml:"type,attr"`
+	MinOccurs   string       `xml:"minOccurs,attr"`
+	MaxOccurs   string       `xml:"maxOccurs,attr"`
+	Fixed       *string      `xml:"fixed,attr"`
+	ComplexType *complexType `xml:"complexType"`
+	SimpleType  *simpleType  `xml:"simpleType"`
+}
+
+// complexType is a complex type, or the extension or restriction of a
+// content derivation, which names its Base.
+type complexType struct {
+	Name           string            `xml:"name,attr"`
+	Base           string            `xml:"base,attr"`
+	Mixed          bool              `xml:"mixed,attr"`
+	SimpleContent  *content          `xml:"simpleContent"`
+	ComplexContent *content          `xml:"complexContent"`
+	Sequence       *group            `xml:"sequence"`
+	Choice         *group            `xml:"choice"`
+	All            *group            `xml:"all"`
+	Group          *group            `xml:"group"`
+	Attributes     []*attribute      `xml:"attribute"`
+	AttributeGroup []*attributeGroup `xml:"attributeGroup"`
+	AnyAttribute   *struct{}         `xml:"anyAttribute"`
+}
+
+// content is a simpleContent or complexContent derivation.
+type content struct {
+	Mixed       bool         `xml:"mixed,attr"`
+	Extension   *complexType `xml:"extension"`
+	Restriction *complexType `xml:"restriction"`
+}
+
+// derivation returns the extension or restriction and its base type.
+func (c *content) derivation() (*complexType, string) {
+	if c == nil {
+		return nil, ""
+	}
+	if c.Extension != nil {
+		return c.Extension, c.Extension.Base
+	}
+	if c.Restriction != nil {
+		return c.Restriction, c.Restriction.Base
+	}
+	return nil, ""
+}
+
+// group is a sequence, choice or all group, or a named group or a
+// reference to one. Its particles keep the order of the schema.
+type group struct {
+	kind      string
+	name      string
+	ref       string
+	minOccurs string
+	maxOccurs string
+	particles []particle
+}
+
+// particle is an element, a nested group or an xs:any wildcard.
+type particle struct {
+	element *element
+	group   *group
+	any     bool
+}
+
+func (g *group) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	g.kind = start.Name.Local
+	for _, a := range start.Attr {
+		switch a.Name.Local {
+		case "name":
+			g.name = a.Value
+		case "ref":
+			g.ref = a.Value
+		case "minOccurs":
+			g.minOccurs = a.Value
+		case "maxOccurs":
+			g.maxOccurs = a.Value
+		}
+	}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			var err error
+			switch t.Name.Local {
+			case "element":
+				e := &element{}
+				err = d.DecodeElement(e, &t)
+				g.particles = append(g.particles, particle{element: e})
+			case "sequence", "choice", "all", "group":
+				sub := &group{}
+				err = d.DecodeElement(sub, &t)
+				g.particles = append(g.particles, particle{group: sub})
+			case "any":
+				err = d.Skip()
+				g.particles = append(g.particles, particle{any: true})
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type attribute struct {
+	Name       string      `xml:"name,attr"`
+	Ref        string      `xml:"ref,attr"`
+	Type       string      `xml:"type,attr"`
+	Use        string      `xml:"use,attr"`
+	Fixed      *string     `xml:"fixed,attr"`
+	SimpleType *simpleType `xml:"simpleType"`
+}
+
+type attributeGroup struct {
+	Name           string            `xml:"name,attr"`
+	Ref            string            `xml:"ref,attr"`
+	Attributes     []*attribute      `xml:"attribute"`
+	AttributeGroup []*attributeGroup `xml:"attributeGroup"`
+	AnyAttribute   *struct{}         `xml:"anyAttribute"`
+}
+
+// Load reads the XSD files at paths; a directory is walked for .xsd files.
+// The declarations of all files are merged, so files that include each
+// other need only all be listed.
+func Load(paths ...string) (*Schema, error) {
+	s := &Schema{
+		elements:        map[string]*element{},
+		attributes:      map[string]*attribute{},
+		complexTypes:    map[string]*complexType{},
+		simpleTypes:     map[string]*simpleType{},
+		groups:          map[string]*group{},
+		attributeGroups: map[string]*attributeGroup{},
+		namespaces:      map[string]string{},
+	}
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || path != root && !strings.EqualFold(filepath.Ext(path), ".xsd") {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := s.add(f); err != nil {
+				return fmt.Errorf("load schema %s: %w", path, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.elements) == 0 {
+		return nil, fmt.Errorf("load schemas %s: no global elements declared", strings.Join(paths, ", "))
+	}
+	return s, nil
+}
+
+// add merges the declarations of the XSD document r.
+func (s *Schema) add(r io.Reader) error {
+	var f schemaFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return err
+	}
+	for _, e := range f.Elements {
+		s.elements[e.Name] = e
+		s.namespaces[e.Name] = f.TargetNamespace
+	}
+	for _, a := range f.Attributes {
+		s.attributes[a.Name] = a
+	}
+	for _, t := range f.ComplexTypes {
+		s.complexTypes[t.Name] = t
+	}
+	for _, t := range f.SimpleTypes {
+		s.simpleTypes[t.Name] = t
+	}
+	for _, g := range f.Groups {
+		s.groups[g.name] = g
+	}
+	for _, g := range f.AttributeGroups {
+		s.attributeGroups[g.Name] = g
+	}
+	return nil
+}
+
+// local strips the namespace prefix of a QName, e.g. tns:Amount.
+func local(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
+
+// occurs reads a minOccurs or maxOccurs value; unbounded is -1.
+func occurs(v string) int {
+	switch v {
+	case "":
+		return 1
+	case "unbounded":
+		return -1
+	}
+	n := 0
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return 1
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
@@ -0,0 +1,336 @@
+package xsd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type simpleType struct {
+	Name        string       `xml:"name,attr"`
+	Restriction *restriction `xml:"restriction"`
+	List        *struct {
+		ItemType   string      `xml:"itemType,attr"`
+		SimpleType *simpleType `xml:"simpleType"`
+	} `xml:"list"`
+	Union *struct {
+		MemberTypes string        `xml:"memberTypes,attr"`
+		SimpleTypes []*simpleType `xml:"simpleType"`
+	} `xml:"union"`
+}
+
+type restriction struct {
+	Base         string      `xml:"base,attr"`
+	SimpleType   *simpleType `xml:"simpleType"`
+	Enumeration  []facet     `xml:"enumeration"`
+	Pattern      []facet     `xml:"pattern"`
+	Length       *facet      `xml:"length"`
+	MinLength    *facet      `xml:"minLength"`
+	MaxLength    *facet      `xml:"maxLength"`
+	MinInclusive *facet      `xml:"minInclusive"`
+	MaxInclusive *facet      `xml:"maxInclusive"`
+	MinExclusive *facet      `xml:"minExclusive"`
+	MaxExclusive *facet      `xml:"maxExclusive"`
+}
+
+type facet struct {
+	Value string `xml:"value,attr"`
+}
+
+// maxTypeDepth bounds how far type derivations are followed, which also
+// stops types derived from themselves.
+const maxTypeDepth = 32
+
+// checkType checks value against the simple type named name, built-in or
+// declared. It returns why the value doesn't fit, or "".
+func (s *Schema) checkType(name, value string, depth int) string {
+	if name == "" {
+		return ""
+	}
+	prefix, _, _ := strings.Cut(name, ":")
+	if prefix == name {
+		prefix = ""
+	}
+	// Declared types win over built-ins unless the name is prefixed as
+	// the XML Schema namespace usually is
+	if t, ok := s.simpleTypes[local(name)]; ok && prefix != "xs" && prefix != "xsd" {
+		return s.checkSimple(t, value, depth+1)
+	}
+	if check, ok := builtins[local(name)]; ok {
+		return check(collapse(local(name), value))
+	}
+	if t, ok := s.simpleTypes[local(name)]; ok {
+		return s.checkSimple(t, value, depth+1)
+	}
+	return ""
+}
+
+// checkSimple checks value against t.
+func (s *Schema) checkSimple(t *simpleType, value string, depth int) string {
+	if t == nil || depth > maxTypeDepth {
+		return ""
+	}
+	switch {
+	case t.List != nil:
+		for _, item := range strings.Fields(value) {
+			var why string
+			if t.List.SimpleType != nil {
+				why = s.checkSimple(t.List.SimpleType, item, depth+1)
+			} else {
+				why = s.checkType(t.List.ItemType, item, depth+1)
+			}
+			if why != "" {
+				return why
+			}
+		}
+		return ""
+	case t.Union != nil:
+		var why string
+		for _, m := range strings.Fields(t.Union.MemberTypes) {
+			if why = s.checkType(m, value, depth+1); why == "" {
+				return ""
+			}
+		}
+		for _, m := range t.Union.SimpleTypes {
+			if why = s.checkSimple(m, value, depth+1); why == "" {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q matches none of the member types", value)
+	case t.Restriction != nil:
+		return s.checkRestriction(t.Restriction, value, depth)
+	}
+	return ""
+}
+
+func (s *Schema) checkRestriction(r *restriction, value string, depth int) string {
+	var why string
+	if r.SimpleType != nil {
+		why = s.checkSimple(r.SimpleType, value, depth+1)
+	} else {
+		why = s.checkType(r.Base, value, depth+1)
+	}
+	if why != "" {
+		return why
+	}
+	value = collapse(local(r.Base), value)
+
+	if len(r.Enumeration) > 0 {
+		allowed := make([]string, len(r.Enumeration))
+		found := false
+		for i, e := range r.Enumeration {
+			allowed[i] = e.Value
+			found = found || e.Value == value
+		}
+		if !found {
+			return fmt.Sprintf("%q is not one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+	for _, p := range r.Pattern {
+		// XSD patterns match the whole value. Patterns using classes
+		// RE2 lacks, such as \i, are not checked.
+		re, err := regexp.Compile(`^(?:` + p.Value + `)$`)
+		if err == nil && !re.MatchString(value) {
+			return fmt.Sprintf("%q does not match the pattern %s", value, p.Value)
+		}
+	}
+
+	n := utf8.RuneCountInString(value)
+	for _, l := range []struct {
+		f    *facet
+		ok   func(limit int) bool
+		what string
+	}{
+		{r.Length, func(limit int) bool { return n == limit }, "exactly"},
+		{r.MinLength, func(limit int) bool { return n >= limit }, "at least"},
+		{r.MaxLength, func(limit int) bool { return n <= limit }, "at most"},
+	} {
+		if l.f == nil {
+			continue
+		}
+		if limit, err := strconv.Atoi(l.f.Value); err == nil && !l.ok(limit) {
+			return fmt.Sprintf("%q must be %s %d characters long", value, l.what, limit)
+		}
+	}
+
+	for _, b := range []struct {
+		f  *facet
+		ok func(cmp int) bool
+		op string
+	}{
+		{r.MinInclusive, func(cmp int) bool { return cmp >= 0 }, ">="},
+		{r.MaxInclusive, func(cmp int) bool { return cmp <= 0 }, "<="},
+		{r.MinExclusive, func(cmp int) bool { return cmp > 0 }, ">"},
+		{r.MaxExclusive, func(cmp int) bool { return cmp < 0 }, "<"},
+	} {
+		if b.f == nil {
+			continue
+		}
+		if cmp, ok := compare(value, b.f.Value); ok && !b.ok(cmp) {
+			return fmt.Sprintf("%s must be %s %s", value, b.op, b.f.Value)
+		}
+	}
+	return ""
+}
+
+// compare compares two numbers, or two dates or times in the same format.
+func compare(a, b string) (int, bool) {
+	x, okA := new(big.Float).SetString(a)
+	y, okB := new(big.Float).SetString(b)
+	if okA && okB {
+		return x.Cmp(y), true
+	}
+	for _, layout := range timeLayouts {
+		ta, errA := time.Parse(layout, a)
+		tb, errB := time.Parse(layout, b)
+		if errA == nil && errB == nil {
+			return ta.Compare(tb), true
+		}
+	}
+	return 0, false
+}
+
+// collapse trims the whitespace of values of types other than the string
+// types, as XSD does before checking them.
+func collapse(typ, value string) string {
+	if typ == "string" || typ == "normalizedString" {
+		return value
+	}
+	return strings.Join(strings.Fields(value), " ")
+}
+
+var (
+	reDecimal  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	reDuration = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	reLanguage = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	reNCName   = regexp.MustCompile(`^[\pL_][\pL\pN_.\-]*$`)
+)
+
+var timeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999",
+	"2006-01-02Z07:00", "2006-01-02",
+	"15:04:05.999999999Z07:00", "15:04:05.999999999",
+}
+
+// builtins check values of the built-in types. Types not listed take any
+// value.
+var builtins = map[string]func(string) string{
+	"string":             anything,
+	"normalizedString":   anything,
+	"token":              anything,
+	"anyURI":             anything,
+	"anySimpleType":      anything,
+	"anyType":            anything,
+	"boolean":            oneOf("boolean", "true", "false", "1", "0"),
+	"decimal":            matches("decimal", reDecimal),
+	"float":              float,
+	"double":             float,
+	"duration":           duration,
+	"language":           matches("language", reLanguage),
+	"NCName":             matches("NCName", reNCName),
+	"ID":                 matches("ID", reNCName),
+	"IDREF":              matches("IDREF", reNCName),
+	"dateTime":           timeIn("dateTime", timeLayouts[0], timeLayouts[1]),
+	"date":               timeIn("date", timeLayouts[2], timeLayouts[3]),
+	"time":               timeIn("time", timeLayouts[4], timeLayouts[5]),
+	"hexBinary":          hexBinary,
+	"integer":            integer("integer", "", ""),
+	"long":               integer("long", "-9223372036854775808", "9223372036854775807"),
+	"int":                integer("int", "-2147483648", "2147483647"),
+	"short":              integer("short", "-32768", "32767"),
+	"byte":               integer("byte", "-128", "127"),
+	"nonNegativeInteger": integer("nonNegativeInteger", "0", ""),
+	"positiveInteger":    integer("positiveInteger", "1", ""),
+	"nonPositiveInteger": integer("nonPositiveInteger", "", "0"),
+	"negativeInteger":    integer("negativeInteger", "", "-1"),
+	"unsignedLong":       integer("unsignedLong", "0", "18446744073709551615"),
+	"unsignedInt":        integer("unsignedInt", "0", "4294967295"),
+	"unsignedShort":      integer("unsignedShort", "0", "65535"),
+	"unsignedByte":       integer("unsignedByte", "0", "255"),
+}
+
+func anything(string) string { return "" }
+
+func oneOf(typ string, allowed ...string) func(string) string {
+	return func(v string) string {
+		for _, a := range allowed {
+			if v == a {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not a valid %s", v, typ)
+	}
+}
+
+func matches(typ string, re *regexp.Regexp) func(string) string {
+	return func(v string) string {
+		if re.MatchString(v) {
+			return ""
+		}
+		return fmt.Sprintf("%q is not a valid %s", v, typ)
+	}
+}
+
+// duration checks durations such as P1Y2M or PT30S, which name at least
+// one part.
+func duration(v string) string {
+	if !reDuration.MatchString(v) || strings.HasSuffix(v, "P") || strings.HasSuffix(v, "T") {
+		return fmt.Sprintf("%q is not a valid duration", v)
+	}
+	return ""
+}
+
+func float(v string) string {
+	switch v {
+	case "INF", "-INF", "+INF", "NaN":
+		return ""
+	}
+	if _, err := strconv.ParseFloat(v, 64); err != nil || strings.ContainsAny(v, "xXpP_") || strings.EqualFold(v, "inf") {
+		return fmt.Sprintf("%q is not a valid number", v)
+	}
+	return ""
+}
+
+func timeIn(typ string, layouts ...string) func(string) string {
+	return func(v string) string {
+		for _, l := range layouts {
+			if _, err := time.Parse(l, v); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not a valid %s", v, typ)
+	}
+}
+
+func hexBinary(v string) string {
+	if _, err := hex.DecodeString(v); err != nil {
+		return fmt.Sprintf("%q is not valid hexBinary", v)
+	}
+	return ""
+}
+
+// integer checks integers between min and max, where empty is no bound.
+func integer(typ, min, max string) func(string) string {
+	return func(v string) string {
+		n, ok := new(big.Int).SetString(strings.TrimPrefix(v, "+"), 10)
+		if !ok || strings.HasPrefix(v, "+-") {
+			return fmt.Sprintf("%q is not a valid %s", v, typ)
+		}
+		if min != "" {
+			if lo, _ := new(big.Int).SetString(min, 10); n.Cmp(lo) < 0 {
+				return fmt.Sprintf("%s is out of range for %s", v, typ)
+			}
+		}
+		if max != "" {
+			if hi, _ := new(big.Int).SetString(max, 10); n.Cmp(hi) > 0 {
+				return fmt.Sprintf("%s is out of range for %s", v, typ)
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,487 @@
+package xsd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// Violation is a place where a document breaks the schema. Path leads to
+// the element, e.g. ReqIssue/Payload/TokenizedAsset[2], or to one of its
+// attributes, e.g. ReqIssue/Context/@requestId.
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// node is an element of the document being validated.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+// Validate checks the XML document doc against the global element
+// declaration of its root. It returns ErrUndeclared when no schema
+// declares the root, and an error for documents that aren't XML.
+func (s *Schema) Validate(doc []byte) ([]Violation, error) {
+	root, err := parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	decl, ok := s.elements[root.name.Local]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUndeclared, root.name.Local)
+	}
+	v := &validation{schema: s}
+	if ns := s.namespaces[root.name.Local]; ns != root.name.Space {
+		v.add(root.name.Local, "the root element is in namespace %q; the schema declares it in %q", root.name.Space, ns)
+	}
+	v.element(root, decl, root.name.Local, 0)
+	return v.violations, nil
+}
+
+func parse(doc []byte) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	var stack []*node
+	var root *node
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("parse XML: no root element")
+	}
+	return root, nil
+}
+
+type validation struct {
+	schema     *Schema
+	violations []Violation
+}
+
+func (v *validation) add(path, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// element checks n against its declaration.
+func (v *validation) element(n *node, decl *element, path string, depth int) {
+	s := v.schema
+	if decl.Ref != "" {
+		if decl = s.elements[local(decl.Ref)]; decl == nil {
+			return
+		}
+	}
+	if depth > maxTypeDepth*4 {
+		return
+	}
+	switch {
+	case decl.ComplexType != nil:
+		v.complex(n, s.model(decl.ComplexType, 0), path, depth)
+	case decl.SimpleType != nil:
+		v.complex(n, model{simple: true, check: func(value string) string {
+			return s.checkSimple(decl.SimpleType, value, 0)
+		}}, path, depth)
+	case decl.Type != "" && local(decl.Type) != "anyType":
+		if t, ok := s.complexTypes[local(decl.Type)]; ok && !builtinPrefix(decl.Type) {
+			v.complex(n, s.model(t, 0), path, depth)
+		} else {
+			v.complex(n, s.textModel(decl.Type), path, depth)
+		}
+	default:
+		// Elements without a type take anything
+		return
+	}
+	if decl.Fixed != nil && len(n.children) == 0 && strings.TrimSpace(n.text) != *decl.Fixed {
+		v.add(path, "must be %q", *decl.Fixed)
+	}
+}
+
+func builtinPrefix(qname string) bool {
+	prefix, _, found := strings.Cut(qname, ":")
+	return found && (prefix == "xs" || prefix == "xsd")
+}
+
+// model is the effective content of a complex type, with the content and
+// attributes of the types it extends.
+type model struct {
+	groups  []*group
+	attrs   []*attribute
+	anyAttr bool
+	mixed   bool
+	// simple is set for text-only content, which check validates.
+	simple bool
+	check  func(string) string
+}
+
+// textModel is the model of an element of the simple type typ.
+func (s *Schema) textModel(typ string) model {
+	return model{simple: true, check: func(value string) string { return s.checkType(typ, value, 0) }}
+}
+
+func (s *Schema) model(t *complexType, depth int) model {
+	m := model{mixed: t.Mixed}
+	if depth > maxTypeDepth {
+		return model{anyAttr: true, mixed: true, groups: []*group{{kind: "sequence", particles: []particle{{any: true}}}}}
+	}
+	if d, base := t.SimpleContent.derivation(); d != nil {
+		if bt, ok := s.complexTypes[local(base)]; ok && !builtinPrefix(base) {
+			m = s.model(bt, depth+1)
+		} else {
+			m = s.textModel(base)
+		}
+		m.simple = true
+		s.addAttributes(&m, d.Attributes, d.AttributeGroup, d.AnyAttribute != nil, depth)
+		return m
+	}
+	if d, base := t.ComplexContent.derivation(); d != nil {
+		if bt, ok := s.complexTypes[local(base)]; ok {
+			bm := s.model(bt, depth+1)
+			m.attrs, m.anyAttr = bm.attrs, bm.anyAttr
+			// A restriction restates the content it keeps
+			if d == t.ComplexContent.Extension {
+				m.groups, m.mixed = bm.groups, bm.mixed
+			}
+		}
+		m.mixed = m.mixed || t.ComplexContent.Mixed || d.Mixed
+		t = d
+	}
+	for _, g := range []*group{t.Sequence, t.Choice, t.All, t.Group} {
+		if g != nil {
+			m.groups = append(m.groups, g)
+		}
+	}
+	s.addAttributes(&m, t.Attributes, t.AttributeGroup, t.AnyAttribute != nil, depth)
+	return m
+}
+
+func (s *Schema) addAttributes(m *model, attrs []*attribute, groups []*attributeGroup, any bool, depth int) {
+	m.anyAttr = m.anyAttr || any
+	for _, a := range attrs {
+		if a.Ref != "" {
+			ref, ok := s.attributes[local(a.Ref)]
+			if !ok {
+				continue
+			}
+			use := a.Use
+			a = ref
+			if use != "" {
+				copied := *a
+				copied.Use = use
+				a = &copied
+			}
+		}
+		m.attrs = append(m.attrs, a)
+	}
+	for _, g := range groups {
+		if depth > maxTypeDepth {
+			break
+		}
+		if g.Ref != "" {
+			if g = s.attributeGroups[local(g.Ref)]; g == nil {
+				continue
+			}
+		}
+		s.addAttributes(m, g.Attributes, g.AttributeGroup, g.AnyAttribute != nil, depth+1)
+	}
+}
+
+// complex checks the attributes, text and children of n against m.
+func (v *validation) complex(n *node, m model, path string, depth int) {
+	v.attributes(n, m, path)
+	text := strings.TrimSpace(n.text)
+	if m.simple {
+		if len(n.children) > 0 {
+			v.add(path, "may only hold text, not elements such as %s", n.children[0].name.Local)
+		}
+		if why := m.check(n.text); why != "" {
+			v.add(path, "%s", why)
+		}
+		return
+	}
+	if text != "" && !m.mixed {
+		v.add(path, "may only hold elements, not text")
+	}
+
+	c := &allowed{}
+	for _, g := range m.groups {
+		v.schema.flatten(g, 1, 1, false, true, c, 0)
+	}
+	counts := map[string]int{}
+	for _, child := range n.children {
+		counts[child.name.Local]++
+	}
+	seen := map[string]int{}
+	last, lastName := -1, ""
+	for _, child := range n.children {
+		name := child.name.Local
+		seen[name]++
+		childPath := path + "/" + name
+		if counts[name] > 1 {
+			childPath += fmt.Sprintf("[%d]", seen[name])
+		}
+		sl, ok := c.slots[name]
+		if !ok {
+			if !c.any {
+				v.add(childPath, "element %s is not allowed in %s", name, n.name.Local)
+			}
+			continue
+		}
+		if sl.order >= 0 {
+			if sl.order < last {
+				v.add(childPath, "%s must come before %s", name, lastName)
+			} else {
+				last, lastName = sl.order, name
+			}
+		}
+		v.element(child, sl.decl, childPath, depth+1)
+	}
+	for _, name := range c.names {
+		sl := c.slots[name]
+		switch got := counts[name]; {
+		case got < sl.min && got == 0:
+			v.add(path, "required element %s is missing", name)
+		case got < sl.min:
+			v.add(path, "element %s appears %d times; at least %d are required", name, got, sl.min)
+		case sl.max >= 0 && got > sl.max:
+			v.add(path, "element %s appears %d times; at most %d are allowed", name, got, sl.max)
+		}
+	}
+	for _, ch := range c.choices {
+		var found []string
+		total := 0
+		for _, name := range ch.names {
+			if counts[name] > 0 {
+				found = append(found, name)
+				total += counts[name]
+			}
+		}
+		names := strings.Join(ch.names, ", ")
+		switch {
+		case total == 0 && ch.min > 0:
+			v.add(path, "one of %s is required", names)
+		case total < ch.min:
+			v.add(path, "elements %s appear %d times; at least %d are required", names, total, ch.min)
+		case ch.exclusive && len(found) > 1:
+			v.add(path, "only one of %s may be present, not %s", names, strings.Join(found, " and "))
+		case ch.max >= 0 && total > ch.max && len(found) > 1:
+			// One element over the limit is reported as such above
+			v.add(path, "elements %s appear %d times; at most %d are allowed", names, total, ch.max)
+		}
+	}
+}
+
+// allowed is the flattened content model of a complex type: the elements
+// it allows with their combined occurrence bounds.
+type allowed struct {
+	slots map[string]*slot
+	names []string
+	// choices are the choices between elements, whose elements are
+	// counted together.
+	choices []choice
+	any     bool
+	next    int
+}
+
+// choice lists the elements of a choice, which together must occur min to
+// max times (-1 for unbounded). Of an exclusive choice, one made once
+// between elements that occur once, only one element may be present.
+type choice struct {
+	names     []string
+	min, max  int
+	exclusive bool
+}
+
+type slot struct {
+	decl     *element
+	min, max int
+	// order is the element's position in a sequence, or -1 where its
+	// order isn't fixed.
+	order int
+}
+
+// flatten adds the particles of g to c. min and max are the bounds of the
+// enclosing groups; optional is set inside choices and ordered while every
+// enclosing group is a sequence that occurs once.
+func (s *Schema) flatten(g *group, min, max int, optional, ordered bool, c *allowed, depth int) {
+	if depth > maxTypeDepth {
+		c.any = true
+		return
+	}
+	gmin, gmax := occurs(g.minOccurs), occurs(g.maxOccurs)
+	if g.ref != "" {
+		named, ok := s.groups[local(g.ref)]
+		if !ok {
+			c.any = true
+			return
+		}
+		for _, p := range named.particles {
+			if p.group != nil {
+				s.flatten(&group{kind: p.group.kind, particles: p.group.particles, minOccurs: g.minOccurs, maxOccurs: g.maxOccurs}, min, max, optional, ordered, c, depth+1)
+			}
+		}
+		return
+	}
+	min, max = min*gmin, times(max, gmax)
+	// The elements of a choice in a sequence share the choice's place in it
+	shared := -1
+	if ordered && g.kind == "choice" {
+		shared = c.next
+		c.next++
+	}
+	ordered = ordered && g.kind == "sequence" && max == 1
+	if g.kind == "choice" && len(g.particles) > 1 {
+		if ch, ok := choiceOf(g, min, max, optional); ok {
+			c.choices = append(c.choices, ch)
+		}
+		optional = true
+	}
+	if c.slots == nil {
+		c.slots = map[string]*slot{}
+	}
+	for _, p := range g.particles {
+		switch {
+		case p.any:
+			c.any = true
+		case p.group != nil:
+			s.flatten(p.group, min, max, optional, ordered, c, depth+1)
+		case p.element != nil:
+			name := elementName(p.element)
+			emin, emax := min*occurs(p.element.MinOccurs), times(max, occurs(p.element.MaxOccurs))
+			if optional {
+				emin = 0
+			}
+			if sl, ok := c.slots[name]; ok {
+				// The same element in two places of the model
+				sl.min, sl.max, sl.order = sl.min+emin, plus(sl.max, emax), -1
+				continue
+			}
+			order := shared
+			if ordered {
+				order = c.next
+				c.next++
+			}
+			c.slots[name] = &slot{decl: p.element, min: emin, max: emax, order: order}
+			c.names = append(c.names, name)
+		}
+	}
+}
+
+// choiceOf is the choice g makes when it is one between elements; min and
+// max are the occurrence bounds of g within its type. Each time the choice
+// is made, the element chosen occurs at least as often as the least
+// required alternative and at most as often as the most allowed one.
+func choiceOf(g *group, min, max int, optional bool) (choice, bool) {
+	ch := choice{exclusive: max == 1}
+	altMin, altMax := -1, 0
+	for _, p := range g.particles {
+		if p.element == nil {
+			return choice{}, false
+		}
+		ch.names = append(ch.names, elementName(p.element))
+		emin, emax := occurs(p.element.MinOccurs), occurs(p.element.MaxOccurs)
+		if altMin < 0 || emin < altMin {
+			altMin = emin
+		}
+		if altMax >= 0 && (emax < 0 || emax > altMax) {
+			altMax = emax
+		}
+		ch.exclusive = ch.exclusive && emax == 1
+	}
+	if !optional {
+		ch.min = min * altMin
+	}
+	ch.max = times(max, altMax)
+	return ch, true
+}
+
+func elementName(e *element) string {
+	if e.Ref != "" {
+		return local(e.Ref)
+	}
+	return e.Name
+}
+
+// times multiplies occurrence bounds, where -1 is unbounded.
+func times(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a * b
+}
+
+func plus(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
+
+// attributes checks the attributes of n against those m declares.
+func (v *validation) attributes(n *node, m model, path string) {
+	declared := map[string]*attribute{}
+	for _, a := range m.attrs {
+		declared[a.Name] = a
+	}
+	present := map[string]bool{}
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Name.Space == xsiNamespace {
+			continue
+		}
+		present[a.Name.Local] = true
+		attrPath := path + "/@" + a.Name.Local
+		d, ok := declared[a.Name.Local]
+		if !ok {
+			if !m.anyAttr {
+				v.add(attrPath, "attribute %s is not allowed on %s", a.Name.Local, n.name.Local)
+			}
+			continue
+		}
+		var why string
+		if d.SimpleType != nil {
+			why = v.schema.checkSimple(d.SimpleType, a.Value, 0)
+		} else {
+			why = v.schema.checkType(d.Type, a.Value, 0)
+		}
+		switch {
+		case why != "":
+			v.add(attrPath, "%s", why)
+		case d.Fixed != nil && a.Value != *d.Fixed:
+			v.add(attrPath, "must be %q", *d.Fixed)
+		}
+	}
+	for _, a := range m.attrs {
+		if a.Use == "required" && !present[a.Name] {
+			v.add(path, "required attribute %s is missing", a.Name)
+			present[a.Name] = true
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package xsd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:t" elementFormDefault="qualified">
+  <xs:element name="Req">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="Head" type="xs:string"/>
+        <xs:element name="Note" type="xs:string" minOccurs="0" maxOccurs="2"/>
+        <xs:choice maxOccurs="unbounded">
+          <xs:element name="Item" type="xs:string"/>
+          <xs:element name="Ref" type="xs:string"/>
+        </xs:choice>
+      </xs:sequence>
+      <xs:attribute name="id" type="xs:int" use="required"/>
+      <xs:attribute name="kind" type="xs:string" fixed="test"/>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="Pick">
+    <xs:complexType>
+      <xs:choice>
+        <xs:element name="A" type="xs:string"/>
+        <xs:element name="B" type="xs:string"/>
+      </xs:choice>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="Pair">
+    <xs:complexType>
+      <xs:choice minOccurs="2" maxOccurs="3">
+        <xs:element name="A" type="xs:string"/>
+        <xs:element name="B" type="xs:string"/>
+      </xs:choice>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="Maybe">
+    <xs:complexType>
+      <xs:choice minOccurs="0">
+        <xs:element name="A" type="xs:string"/>
+        <xs:element name="B" type="xs:string"/>
+      </xs:choice>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+func loadTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.xsd")
+	if err := os.WriteFile(path, []byte(testSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	s := loadTestSchema(t)
+	tests := []struct {
+		name string
+		doc  string
+		// want are the expected violations as "path: message" substrings,
+		// in order; none for a valid document.
+		want []string
+	}{
+		// Sequences
+		{"valid request", `<Req xmlns="urn:t" id="1"><Head>h</Head><Note>n</Note><Item>i</Item></Req>`, nil},
+		{"missing required element", `<Req xmlns="urn:t" id="1"><Item>i</Item></Req>`,
+			[]string{"Req: required element Head is missing"}},
+		{"out of order", `<Req xmlns="urn:t" id="1"><Head>h</Head><Item>i</Item><Note>n</Note></Req>`,
+			[]string{"Req/Note: Note must come before Item"}},
+		{"unknown element", `<Req xmlns="urn:t" id="1"><Head>h</Head><Item>i</Item><Tail/></Req>`,
+			[]string{"Req/Tail: element Tail is not allowed in Req"}},
+
+		// Choices
+		{"required unbounded choice empty", `<Req xmlns="urn:t" id="1"><Head>h</Head></Req>`,
+			[]string{"Req: one of Item, Ref is required"}},
+		{"unbounded choice repeated and mixed", `<Req xmlns="urn:t" id="1"><Head>h</Head><Item>i</Item><Ref>r</Ref><Item>j</Item></Req>`, nil},
+		{"required choice empty", `<Pick xmlns="urn:t"/>`, []string{"Pick: one of A, B is required"}},
+		{"choice of one", `<Pick xmlns="urn:t"><B>b</B></Pick>`, nil},
+		{"choice made twice", `<Pick xmlns="urn:t"><A>a</A><B>b</B></Pick>`,
+			[]string{"Pick: only one of A, B may be present, not A and B"}},
+		{"optional choice empty", `<Maybe xmlns="urn:t"/>`, nil},
+		{"choice under its minimum", `<Pair xmlns="urn:t"><A>a</A></Pair>`,
+			[]string{"Pair: elements A, B appear 1 times; at least 2 are required"}},
+		{"choice within its bounds", `<Pair xmlns="urn:t"><A>a</A><B>b</B><A>c</A></Pair>`, nil},
+		{"choice over its maximum", `<Pair xmlns="urn:t"><A>a</A><B>b</B><A>c</A><B>d</B></Pair>`,
+			[]string{"Pair: elements A, B appear 4 times; at most 3 are allowed"}},
+
+		// Occurrence limits
+		{"element over its maximum", `<Req xmlns="urn:t" id="1"><Head>h</Head><Note>1</Note><Note>2</Note><Note>3</Note><Item>i</Item></Req>`,
+			[]string{"Req: element Note appears 3 times; at most 2 are allowed"}},
+		{"element twice where once is allowed", `<Req xmlns="urn:t" id="1"><Head>h</Head><Head>h</Head><Item>i</Item></Req>`,
+			[]string{"Req: element Head appears 2 times; at most 1 are allowed"}},
+
+		// Attributes
+		{"missing required attribute", `<Req xmlns="urn:t"><Head>h</Head><Item>i</Item></Req>`,
+			[]string{"Req: required attribute id is missing"}},
+		{"attribute of the wrong type", `<Req xmlns="urn:t" id="one"><Head>h</Head><Item>i</Item></Req>`,
+			[]string{"Req/@id: "}},
+		{"fixed attribute changed", `<Req xmlns="urn:t" id="1" kind="prod"><Head>h</Head><Item>i</Item></Req>`,
+			[]string{`Req/@kind: must be "test"`}},
+		{"undeclared attribute", `<Req xmlns="urn:t" id="1" extra="x"><Head>h</Head><Item>i</Item></Req>`,
+			[]string{"Req/@extra: attribute extra is not allowed on Req"}},
+		{"wrong namespace", `<Pick xmlns="urn:other"><A>a</A></Pick>`,
+			[]string{`Pick: the root element is in namespace "urn:other"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Validate([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("violations = %+v, want %q", got, tt.want)
+			}
+			for i, v := range got {
+				if line := v.Path + ": " + v.Message; !strings.Contains(line, tt.want[i]) {
+					t.Errorf("violation %d = %q, want %q", i, line, tt.want[i])
+				}
+			}
+		})
+	}
+}